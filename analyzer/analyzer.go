@@ -3,25 +3,29 @@ package analyzer
 import (
 	"fmt"
 	"quoi/ast"
+	"quoi/diagnostic"
+	"quoi/std"
 	"quoi/token"
+	"quoi/types"
 	"strings"
 )
 
 // TODO check numeric value ranges (64-bit integers)
 
-type Err struct {
-	Line, Column uint
-	Msg          string
-}
+type Err = diagnostic.Diagnostic
 
-func (e Err) Error() string { return e.Msg }
+// code is the stable error code of the call site (e.g. A012).
+func newErr(code string, line, col uint, msgf string, args ...interface{}) Err {
+	return diagnostic.New(diagnostic.Analyzer, code, line, col, msgf, args...)
+}
 
-func newErr(line, col uint, msgf string, args ...interface{}) Err {
-	return Err{
-		Line:   line,
-		Column: col,
-		Msg:    fmt.Sprintf(msgf, args...),
+// like newErr, but the error covers the whole range of span (e.g. an expression).
+func newSpanErr(code string, span token.Span, msgf string, args ...interface{}) Err {
+	err := newErr(code, span.Start.Line, span.Start.Col, msgf, args...)
+	if span.End.Offset > span.Start.Offset && span.End.Col > 1 {
+		err.EndLine, err.EndColumn = span.End.Line, span.End.Col-1
 	}
+	return err
 }
 
 type Analyzer struct {
@@ -29,13 +33,21 @@ type Analyzer struct {
 	env     *ScopeStack
 	std     *StandardLibrary
 	Errs    []Err
+	// if not nil, the declarations, and the references of the program are recorded in it
+	Info *Info
 
 	// state
 	seenReturn bool
 }
 
 func New(program *ast.Program) *Analyzer {
-	a := &Analyzer{program: program, env: NewScopeStack()}
+	return NewWithEnv(program, NewScopeStack())
+}
+
+// like New, but program is typechecked in env; and its declarations are added to env.
+// the REPL keeps env across inputs.
+func NewWithEnv(program *ast.Program, env *ScopeStack) *Analyzer {
+	a := &Analyzer{program: program, env: env}
 	a.std = InitStandardLibrary(a)
 	return a
 }
@@ -44,85 +56,202 @@ func (a *Analyzer) pushErr(err error) {
 	a.Errs = append(a.Errs, err.(Err))
 }
 
-var (
-	TypeList = func(listType string) string {
-		return "list-" + listType
+// the type named by tok (e.g. 'int', 'User'); fun is the type if tok is 'fun'.
+// a datatype that isn't declared is still a datatype; using it is an error
+// somewhere else.
+func (a *Analyzer) typeOf(tok token.Token, fun *ast.FunctionType) types.Type {
+	if fun != nil {
+		return a.funcType(fun)
+	}
+	switch tok.Type {
+	case token.INTKW:
+		return types.Int
+	case token.STRINGKW:
+		return types.String
+	case token.BOOLKW:
+		return types.Bool
+	}
+	if dt := a.env.GetDatatype(tok.Literal); dt != nil {
+		return dt.Type
+	}
+	if e := a.env.GetEnum(tok.Literal); e != nil {
+		return e.Type
+	}
+	return &types.Datatype{Name: tok.Literal}
+}
+
+// the type of a variable, a parameter, or a return value; 'listof T' is two tokens
+func (a *Analyzer) declType(t ast.VarType) types.Type {
+	if t.IsList {
+		return &types.List{Elem: a.typeOf(t.TypeOfList, t.Fun)}
 	}
-)
+	return a.typeOf(t.Tok, t.Fun)
+}
 
-func fnParamTypeRepr(param ast.FunctionParameter) string {
-	res := ""
-	if param.IsList {
-		return "list-" + param.TypeOfList.Literal
+// fun(int, int) -> bool
+func (a *Analyzer) funcType(f *ast.FunctionType) *types.Func {
+	res := &types.Func{}
+	for _, v := range f.Params {
+		res.Params = append(res.Params, a.declType(v))
+	}
+	for _, v := range f.Returns {
+		res.Returns = append(res.Returns, a.declType(v))
 	}
-	res += param.Tok.Literal
 	return res
 }
 
-func fnReturnTypeRepr(ret ast.FunctionReturnType) string {
-	res := ""
-	if ret.IsList {
-		return "list-" + ret.TypeOfList.Literal
+// the name of a datatype in t that isn't declared; "" if there's none
+func (a *Analyzer) undeclared(t types.Type) string {
+	switch t := t.(type) {
+	case *types.List:
+		return a.undeclared(t.Elem)
+	case *types.Func:
+		for _, v := range append(append([]types.Type{}, t.Params...), t.Returns...) {
+			if name := a.undeclared(v); name != "" {
+				return name
+			}
+		}
+	case *types.Datatype:
+		if a.env.GetDatatype(t.Name) == nil {
+			return t.Name
+		}
 	}
-	res += ret.Tok.Literal
-	return res
+	return ""
 }
 
-func (a *Analyzer) errorf(line, col uint, msgf string, args ...interface{}) {
-	a.Errs = append(a.Errs, Err{
-		Line:   line,
-		Column: col,
-		Msg:    fmt.Sprintf(msgf, args...),
-	})
+func (a *Analyzer) errorf(code string, line, col uint, msgf string, args ...interface{}) {
+	a.Errs = append(a.Errs, newErr(code, line, col, msgf, args...))
 }
 
 // first pass
 func (a *Analyzer) registerFunctionsAndDatatypes() {
+	// enums, and datatypes come first; the types of fields, and parameters may refer to any of them
+	registered := map[*ast.DatatypeDeclaration]*IRDatatype{}
+	for _, s := range a.program.Stmts {
+		switch s := s.(type) {
+		case *ast.EnumDeclaration:
+			a.registerEnum(s)
+		case *ast.DatatypeDeclaration:
+			ir, err := a.registerDatatype(s)
+			if err != nil {
+				a.errorf("A002", s.Tok.Line, s.Tok.Col, err.Error())
+				continue
+			}
+			registered[s] = ir
+		}
+	}
 	for _, s := range a.program.Stmts {
 		switch s := s.(type) {
 		case *ast.FunctionDeclarationStatement:
 			if err := a.registerFuncSignature(s); err != nil {
-				a.errorf(s.Tok.Line, s.Tok.Col, err.Error())
+				a.errorf("A001", s.Tok.Line, s.Tok.Col, err.Error())
 			}
 		case *ast.DatatypeDeclaration:
-			if err := a.registerDatatype(s); err != nil {
-				a.errorf(s.Tok.Line, s.Tok.Col, err.Error())
+			if ir := registered[s]; ir != nil {
+				a.registerFields(s, ir)
 			}
 		}
 	}
 }
 
 func (a *Analyzer) registerFuncSignature(s *ast.FunctionDeclarationStatement) error {
-	ir := &IRFunction{Name: s.Name.String(), TakesCount: len(s.Params), ReturnsCount: len(s.ReturnTypes)}
+	ir := &IRFunction{Node: nodeOf(s), Name: s.Name.String(), TakesCount: len(s.Params), ReturnsCount: len(s.ReturnTypes)}
 	for _, v := range s.Params {
 		ir.ParamNames = append(ir.ParamNames, v.Name.String())
-		ir.Takes = append(ir.Takes, fnParamTypeRepr(v))
+		ir.Takes = append(ir.Takes, a.declType(v.Type()))
 	}
 	for _, v := range s.ReturnTypes {
-		ir.Returns = append(ir.Returns, fnReturnTypeRepr(v))
+		ir.Returns = append(ir.Returns, a.declType(v.Type()))
+	}
+	if err := a.env.AddFunc(ir.Name, ir); err != nil {
+		return err
 	}
-	return a.env.AddFunc(ir.Name, ir)
+	a.declareFunc(s, ir)
+	return nil
 }
 
 func (a *Analyzer) registerStdFuncSignature(ns, name string, s *ast.FunctionDeclarationStatement) {
 	ir := &IRFunction{Name: s.Name.String(), TakesCount: len(s.Params), ReturnsCount: len(s.ReturnTypes)}
 	for _, v := range s.Params {
 		ir.ParamNames = append(ir.ParamNames, v.Name.String())
-		ir.Takes = append(ir.Takes, fnParamTypeRepr(v))
+		ir.Takes = append(ir.Takes, a.declType(v.Type()))
 	}
 	for _, v := range s.ReturnTypes {
-		ir.Returns = append(ir.Returns, fnReturnTypeRepr(v))
+		ir.Returns = append(ir.Returns, a.declType(v.Type()))
 	}
 	a.std.AddFunc(ns, name, ir)
 }
 
-func (a *Analyzer) registerDatatype(s *ast.DatatypeDeclaration) error {
-	ir := &IRDatatype{Name: s.Name.String(), FieldCount: len(s.Fields)}
-	for _, v := range s.Fields {
-		field := IRDatatypeField{Type: v.Tok.Literal, Name: v.Ident.String()}
+func (a *Analyzer) registerDatatype(s *ast.DatatypeDeclaration) (*IRDatatype, error) {
+	name := s.Name.String()
+	ir := &IRDatatype{Node: nodeOf(s), Name: name, FieldCount: len(s.Fields), Type: &types.Datatype{Name: name}}
+	if err := a.env.AddDatatype(ir.Name, ir); err != nil {
+		return nil, err
+	}
+	// the variants of a sum type are datatypes too
+	for _, v := range s.Variants {
+		vname := v.Name.String()
+		variant := &IRDatatype{Node: nodeOf(v), Name: vname, FieldCount: len(v.Fields), Type: &types.Datatype{Name: vname, Sum: ir.Type}}
+		if err := a.env.AddDatatype(vname, variant); err != nil {
+			a.errorf("A113", v.Name.Tok.Line, v.Name.Tok.Col, err.Error())
+			continue
+		}
+		ir.Variants = append(ir.Variants, variant)
+		ir.Type.Variants = append(ir.Type.Variants, variant.Type)
+	}
+	return ir, nil
+}
+
+func (a *Analyzer) registerEnum(s *ast.EnumDeclaration) {
+	name := s.Name.String()
+	if std.LookupNamespace(name) != nil {
+		// String::from_Color(c) would be ambiguous
+		a.errorf("A103", s.Name.Tok.Line, s.Name.Tok.Col, "enum '%s' has the name of a namespace of the standard library", name)
+		return
+	}
+	ir := &IREnum{Node: nodeOf(s), Name: name, Type: &types.Enum{Name: name}}
+	for _, m := range s.Members {
+		if ir.Type.Member(m.String()) != -1 {
+			a.errorf("A102", m.Tok.Line, m.Tok.Col, "duplicate member '%s' in enum '%s'", m, name)
+			return
+		}
+		ir.Members = append(ir.Members, m.String())
+		ir.Type.Members = append(ir.Type.Members, m.String())
+	}
+	if err := a.env.AddEnum(name, ir); err != nil {
+		a.errorf("A114", s.Tok.Line, s.Tok.Col, err.Error())
+		return
+	}
+	a.declareEnum(s, ir)
+}
+
+// after every datatype is registered
+func (a *Analyzer) registerFields(s *ast.DatatypeDeclaration, ir *IRDatatype) {
+	a.addFields(ir, s.Fields)
+	for _, v := range s.Variants {
+		if variant := a.variantOf(ir, v.Name.String()); variant != nil {
+			a.addFields(variant, v.Fields)
+		}
+	}
+	a.declareDatatype(s, ir)
+}
+
+func (a *Analyzer) addFields(ir *IRDatatype, fields []*ast.DatatypeField) {
+	for _, v := range fields {
+		field := IRDatatypeField{Node: nodeOf(v), Type: a.typeOf(v.Tok, v.Fun), Name: v.Ident.String()}
 		ir.Fields = append(ir.Fields, field)
+		ir.Type.Fields = append(ir.Type.Fields, types.Field{Name: field.Name, Type: field.Type})
+	}
+}
+
+// the registered variant of the sum type dt, named name; nil if there isn't one
+func (a *Analyzer) variantOf(dt *IRDatatype, name string) *IRDatatype {
+	for _, v := range dt.Variants {
+		if v.Name == name {
+			return v
+		}
 	}
-	return a.env.AddDatatype(ir.Name, ir)
+	return nil
 }
 
 func (a *Analyzer) Analyze() *IRProgram {
@@ -135,21 +264,21 @@ func (a *Analyzer) typecheck() *IRProgram {
 	for _, s := range a.program.Stmts {
 		switch s := s.(type) {
 		case *ast.BreakStatement:
-			a.errorf(s.Tok.Line, s.Tok.Col, "top-level break statement")
+			a.errorf("A003", s.Tok.Line, s.Tok.Col, "top-level break statement")
 		case *ast.ContinueStatement:
-			a.errorf(s.Tok.Line, s.Tok.Col, "top-level continue statement")
+			a.errorf("A004", s.Tok.Line, s.Tok.Col, "top-level continue statement")
 		case *ast.PrefixExpr:
-			a.errorf(s.Tok.Line, s.Tok.Col, "top-level prefix-expression")
+			a.errorf("A005", s.Tok.Line, s.Tok.Col, "top-level prefix-expression")
 		case *ast.StringLiteral:
-			a.errorf(s.Typ.Line, s.Typ.Col, "unused string literal")
+			a.errorf("A006", s.Typ.Line, s.Typ.Col, "unused string literal")
 		case *ast.IntLiteral:
-			a.errorf(s.Typ.Line, s.Typ.Col, "unused integer literal")
+			a.errorf("A007", s.Typ.Line, s.Typ.Col, "unused integer literal")
 		case *ast.BoolLiteral:
-			a.errorf(s.Typ.Line, s.Typ.Col, "unused boolean literal")
+			a.errorf("A008", s.Typ.Line, s.Typ.Col, "unused boolean literal")
 		case *ast.DatatypeLiteral:
-			a.errorf(s.Tok.Line, s.Tok.Col, "unused datatype literal")
+			a.errorf("A009", s.Tok.Line, s.Tok.Col, "unused datatype literal")
 		case *ast.ReturnStatement:
-			a.errorf(s.Tok.Line, s.Tok.Col, "return statement outside a function body")
+			a.errorf("A010", s.Tok.Line, s.Tok.Col, "return statement outside a function body")
 		default:
 			if ir := a.typecheckStatement(s, nil); ir != nil {
 				program.Push(ir)
@@ -159,85 +288,67 @@ func (a *Analyzer) typecheck() *IRProgram {
 	return program
 }
 
-const (
-	TypeString = "string"
-	TypeInt    = "int"
-	TypeBool   = "bool"
-	TypeVoid   = "void"
-	// empty lists are of this type (list-any)
-	TypeAny = "any"
-)
-
-var (
-	TypeList_ = func(t string) string {
-		return "list-" + t
+// typecheck a bare expression, and return a statement that prints its value.
+// used by the REPL. nil if there are errors.
+func (a *Analyzer) AnalyzeExpr(expr ast.Expr) *IRShow {
+	if a.Info != nil {
+		a.resolve(expr)
 	}
-	TypeDatatype_ = func(dt string) string {
-		return dt
+	t, err := a.infer(expr)
+	if err != nil {
+		a.pushErr(err)
+		return nil
 	}
-)
-
-type Type struct {
-	typ       string
-	line, col uint
-	next      *Type
-}
-
-func (t *Type) setNext(ty *Type) {
-	if t.next == nil {
-		t.next = ty
+	if l, ok := t.(*types.List); ok && l.Elem == nil {
+		pos := expr.Span().Start
+		a.errorf("A092", pos.Line, pos.Col, "unknown type of empty list")
+		return nil
 	}
+	return &IRShow{Node: nodeOf(expr), Type: t, Value: a.toIrExpr(expr)}
 }
 
-func NewType(typ string, line, col uint) *Type {
-	return &Type{typ: typ, line: line, col: col}
-}
-
-func NewListType(typ string, line, col uint) *Type {
-	return NewType(TypeList_(typ), line, col)
-}
-
-func NewTypeFromVarType(typ ast.VarType, line, col uint) *Type {
-	if typ.IsList {
-		return NewListType(typ.TypeOfList.Literal, line, col)
+// the types of the values of t; a function call may return many values
+func values(t types.Type) []types.Type {
+	if t, ok := t.(*types.Tuple); ok {
+		return t.Types
 	}
-	return NewType(typ.Tok.Literal, line, col)
+	return []types.Type{t}
 }
 
-func (a *Analyzer) matchTypes(lhs, rhs *Type) error {
-	for lhs.next != nil && rhs.next != nil {
-		if lhs.typ != rhs.typ {
-			return newErr(lhs.line, lhs.col, "expected '%s', got '%s'", lhs.typ, rhs.typ)
+// match the types of values (rhs) with the types of what they are assigned to (lhs), one by one
+func (a *Analyzer) matchTypes(line, col uint, lhs, rhs []types.Type) error {
+	i := 0
+	for ; i < len(lhs)-1 && i < len(rhs)-1; i++ {
+		if !(types.AssignableTo(rhs[i], lhs[i])) {
+			return newErr("A011", line, col, "expected '%s', got '%s'", lhs[i], rhs[i])
 		}
-		lhs = lhs.next
-		rhs = rhs.next
 	}
-	lhsExhausted, rhsExhausted := lhs.next == nil, rhs.next == nil
+	lhsExhausted, rhsExhausted := i == len(lhs)-1, i == len(rhs)-1
 	if lhsExhausted && !(rhsExhausted) {
-		return newErr(lhs.line, lhs.col, "unused value of type '%s'", rhs.typ)
+		return newErr("A012", line, col, "unused value of type '%s'", rhs[i])
 	} else if !(lhsExhausted) && rhsExhausted {
-		return newErr(lhs.line, lhs.col, "value assigned to nothing")
-	} else if lhs.typ != rhs.typ {
-		return newErr(lhs.line, lhs.col, "mismatched types '%s', and '%s'", lhs.typ, rhs.typ)
+		return newErr("A013", line, col, "value assigned to nothing")
+	} else if !(types.AssignableTo(rhs[i], lhs[i])) {
+		return newErr("A014", line, col, "mismatched types '%s', and '%s'", lhs[i], rhs[i])
 	}
 	return nil
 }
 
-func (a *Analyzer) match(expr ast.Expr, t *Type) error {
+func (a *Analyzer) match(expr ast.Expr, t types.Type) error {
 	switch expr := expr.(type) {
 	case *ast.StringLiteral:
-		if t.typ != TypeString {
-			return newErr(expr.Typ.Line, expr.Typ.Col, "expected '%s', got 'string'", t.typ)
+		if !(types.AssignableTo(types.String, t)) {
+			return newSpanErr("A015", expr.Span(), "expected '%s', got 'string'", t)
 		}
 		return nil
 	case *ast.IntLiteral:
-		if t.typ != TypeInt {
-			return newErr(expr.Typ.Line, expr.Typ.Col, "expected '%s', got 'int'", t.typ)
+		if !(types.AssignableTo(types.Int, t)) {
+			return newSpanErr("A016", expr.Span(), "expected '%s', got 'int'", t)
 		}
 		return nil
 	case *ast.BoolLiteral:
-		if t.typ != TypeBool {
-			return newErr(expr.Typ.Line, expr.Typ.Col, "expected '%s', got 'bool'", t.typ)
+		if !(types.AssignableTo(types.Bool, t)) {
+			return newSpanErr("A017", expr.Span(), "expected '%s', got 'bool'", t)
 		}
 		return nil
 	case *ast.ListLiteral:
@@ -246,11 +357,8 @@ func (a *Analyzer) match(expr ast.Expr, t *Type) error {
 		if err != nil {
 			return err
 		}
-		if listType.typ == TypeAny {
-			return nil
-		}
-		if t.typ != listType.typ {
-			return newErr(expr.Tok.Line, expr.Tok.Col, "expected '%s', got '%s' in list literal", t.typ, listType.typ)
+		if !(types.AssignableTo(listType, t)) {
+			return newSpanErr("A018", expr.Span(), "expected '%s', got '%s' in list literal", t, listType)
 		}
 		return nil
 	case *ast.DatatypeLiteral:
@@ -258,8 +366,8 @@ func (a *Analyzer) match(expr ast.Expr, t *Type) error {
 		if err != nil {
 			return err
 		}
-		if t.typ != datatypeType.typ {
-			return newErr(expr.Tok.Line, expr.Tok.Col, "expected '%s', got '%s' in datatype literal", t.typ, datatypeType.typ)
+		if !(types.AssignableTo(datatypeType, t)) {
+			return newSpanErr("A019", expr.Span(), "expected '%s', got '%s' in datatype literal", t, datatypeType)
 		}
 		return nil
 	case *ast.FunctionCall:
@@ -267,20 +375,20 @@ func (a *Analyzer) match(expr ast.Expr, t *Type) error {
 		if err != nil {
 			return err
 		}
-		for t.next != nil && fnType.next != nil {
-			if t.typ != fnType.typ {
-				return newErr(expr.Tok.Line, expr.Tok.Col, "expected '%s', got '%s'", t.typ, fnType.typ)
+		want, got := values(t), values(fnType)
+		i := 0
+		for ; i < len(want)-1 && i < len(got)-1; i++ {
+			if !(types.AssignableTo(got[i], want[i])) {
+				return newSpanErr("A020", expr.Span(), "expected '%s', got '%s'", want[i], got[i])
 			}
-			t = t.next
-			fnType = fnType.next
 		}
-		tExhausted, fnTypeExhausted := t.next == nil, fnType.next == nil
+		tExhausted, fnTypeExhausted := i == len(want)-1, i == len(got)-1
 		if tExhausted && !(fnTypeExhausted) {
-			return newErr(expr.Tok.Line, expr.Tok.Col, "unused value from function call '%s'", expr.Ident)
+			return newErr("A021", expr.Tok.Line, expr.Tok.Col, "unused value from function call '%s'", expr.Ident)
 		} else if !(tExhausted) && fnTypeExhausted {
-			return newErr(expr.Tok.Line, expr.Tok.Col, "variable assigned to nothing")
-		} else if t.typ != fnType.typ {
-			return newErr(expr.Tok.Line, expr.Tok.Col, "expected '%s', got '%s'", t.typ, fnType.typ)
+			return newErr("A022", expr.Tok.Line, expr.Tok.Col, "variable assigned to nothing")
+		} else if !(types.AssignableTo(got[i], want[i])) {
+			return newSpanErr("A023", expr.Span(), "expected '%s', got '%s'", want[i], got[i])
 		}
 		return nil
 	case *ast.FunctionCallFromNamespace:
@@ -290,33 +398,33 @@ func (a *Analyzer) match(expr ast.Expr, t *Type) error {
 		if err != nil {
 			return err
 		}
-		fn := a.std.GetFunc(ns, fnName)
+		fn := a.stdFunc(ns, fnName)
 		if fn == nil {
-			return newErr(expr.Namespace.Tok.Line, expr.Namespace.Tok.Col, "unknown function '%s::%s'", ns, fnName)
+			return newErr("A024", expr.Namespace.Tok.Line, expr.Namespace.Tok.Col, "unknown function '%s::%s'", ns, fnName)
 		}
 		for i := 0; i < len(expr.Function.Args); i++ {
 			argType, err := a.infer(expr.Function.Args[i])
 			if err != nil {
 				return err
 			}
-			if argType.typ != t.typ {
-				return newErr(expr.Function.Tok.Line, expr.Namespace.Tok.Col, "expected '%s', got '%s'", t.typ, argType.typ)
+			if !(types.AssignableTo(argType, fn.Takes[i])) {
+				return newErr("A025", expr.Function.Tok.Line, expr.Namespace.Tok.Col, "expected '%s', got '%s'", fn.Takes[i], argType)
 			}
 		}
-		for t.next != nil && typ.next != nil {
-			if t.typ != typ.typ {
-				return newErr(line, col, "expected '%s', got '%s'", t.typ, typ.typ)
+		want, got := values(t), values(typ)
+		i := 0
+		for ; i < len(want)-1 && i < len(got)-1; i++ {
+			if !(types.AssignableTo(got[i], want[i])) {
+				return newErr("A026", line, col, "expected '%s', got '%s'", want[i], got[i])
 			}
-			t = t.next
-			typ = typ.next
 		}
-		tExhausted, fnTypeExhausted := t.next == nil, typ.next == nil
+		tExhausted, fnTypeExhausted := i == len(want)-1, i == len(got)-1
 		if tExhausted && !(fnTypeExhausted) {
-			return newErr(line, col, "unused value from function call '%s::%s'", ns, fnName)
+			return newErr("A027", line, col, "unused value from function call '%s::%s'", ns, fnName)
 		} else if !(tExhausted) && fnTypeExhausted {
-			return newErr(line, col, "variable assigned to nothing")
-		} else if t.typ != typ.typ {
-			return newErr(line, col, "expected '%s', got '%s'", t.typ, typ.typ)
+			return newErr("A028", line, col, "variable assigned to nothing")
+		} else if !(types.AssignableTo(got[i], want[i])) {
+			return newErr("A029", line, col, "expected '%s', got '%s'", want[i], got[i])
 		}
 		return nil
 	case *ast.PrefixExpr:
@@ -324,20 +432,29 @@ func (a *Analyzer) match(expr ast.Expr, t *Type) error {
 		if err != nil {
 			return err
 		}
-		if t.typ != prefType.typ {
-			return newErr(expr.Tok.Line, expr.Tok.Col, "expected '%s', got '%s'", t.typ, prefType.typ)
+		if !(types.AssignableTo(prefType, t)) {
+			return newSpanErr("A030", expr.Span(), "expected '%s', got '%s'", t, prefType)
+		}
+		return nil
+	case *ast.EnumMember:
+		e, _, err := a.enumMember(expr)
+		if err != nil {
+			return err
+		}
+		if !(types.AssignableTo(e.Type, t)) {
+			return newSpanErr("A106", expr.Span(), "expected '%s', got '%s'", t, e.Type)
 		}
 		return nil
 	case *ast.Identifier:
 		if a.env.IsFailedVar(expr.Tok.Literal) {
 			return nil
 		}
-		typ := a.env.GetVar(expr.String())
-		if typ == "" {
-			return newErr(expr.Tok.Line, expr.Tok.Col, "reference to non-existent variable '%s'", expr.String())
+		typ := a.valueType(expr.String())
+		if typ == nil {
+			return newErr("A031", expr.Tok.Line, expr.Tok.Col, "reference to non-existent variable '%s'", expr.String())
 		}
-		if t.typ != typ {
-			return newErr(expr.Tok.Line, expr.Tok.Col, "expected '%s', got '%s'", t.typ, typ)
+		if !(types.AssignableTo(typ, t)) {
+			return newSpanErr("A032", expr.Span(), "expected '%s', got '%s'", t, typ)
 		}
 		return nil
 	}
@@ -345,17 +462,17 @@ func (a *Analyzer) match(expr ast.Expr, t *Type) error {
 }
 
 // minimal type inference
-func (a *Analyzer) infer(expr ast.Expr) (*Type, error) {
+func (a *Analyzer) infer(expr ast.Expr) (types.Type, error) {
 	switch expr := expr.(type) {
 	case *ast.StringLiteral:
-		return NewType(TypeString, expr.Typ.Line, expr.Typ.Col), nil
+		return types.String, nil
 	case *ast.IntLiteral:
-		return NewType(TypeInt, expr.Typ.Line, expr.Typ.Col), nil
+		return types.Int, nil
 	case *ast.BoolLiteral:
-		return NewType(TypeBool, expr.Typ.Line, expr.Typ.Col), nil
+		return types.Bool, nil
 	case *ast.ListLiteral:
 		if len(expr.Elems) < 1 {
-			return NewType(TypeAny, expr.Tok.Line, expr.Tok.Col), nil
+			return &types.List{}, nil
 		}
 		firstElem := expr.Elems[0]
 		firstElemType, err := a.infer(firstElem)
@@ -367,140 +484,118 @@ func (a *Analyzer) infer(expr ast.Expr) (*Type, error) {
 				return nil, err
 			}
 		}
-		return NewType(TypeList_(firstElemType.typ), firstElemType.line, firstElemType.col), nil
+		return &types.List{Elem: firstElemType}, nil
 	case *ast.Identifier:
-		typ := a.env.GetVar(expr.String())
-		if typ == "" {
-			return nil, newErr(expr.Tok.Line, expr.Tok.Col, "reference to non-existent variable '%s'", expr.Tok.Literal)
+		typ := a.valueType(expr.String())
+		if typ == nil {
+			return nil, newErr("A033", expr.Tok.Line, expr.Tok.Col, "reference to non-existent variable '%s'", expr.Tok.Literal)
 		}
-		return NewType(typ, expr.Tok.Line, expr.Tok.Col), nil
+		return typ, nil
 	case *ast.DatatypeLiteral:
 		datatype := a.env.GetDatatype(expr.Tok.Literal)
 		if datatype == nil {
-			return nil, newErr(expr.Tok.Line, expr.Tok.Col, "initialization of non-existent datatype '%s'", expr.Tok.Literal)
+			return nil, newErr("A034", expr.Tok.Line, expr.Tok.Col, "initialization of non-existent datatype '%s'", expr.Tok.Literal)
+		}
+		if len(datatype.Variants) > 0 {
+			return nil, newErr("A094", expr.Tok.Line, expr.Tok.Col, "initialization of sum type '%s'; initialize one of its variants", expr.Tok.Literal)
 		}
 		if len(expr.Fields) > datatype.FieldCount {
 			unknownField := expr.Fields[datatype.FieldCount]
 			dtName := datatype.Name
-			return nil, newErr(expr.Tok.Line, expr.Tok.Col, "unknown field '%s' in datatype literal '%s'", unknownField.Name, dtName)
+			return nil, newErr("A035", expr.Tok.Line, expr.Tok.Col, "unknown field '%s' in datatype literal '%s'", unknownField.Name, dtName)
 		}
-		exprFieldsNameTypeMap := map[string]*Type{}
-		datatypeFieldsNameTypeMap := map[string]*Type{}
-		for _, v := range expr.Fields {
+		fieldTypes := make([]types.Type, len(expr.Fields))
+		for i, v := range expr.Fields {
 			typ, err := a.infer(v.Value)
 			if err != nil {
 				return nil, err
 			}
-			exprFieldsNameTypeMap[v.Name.String()] = typ
-		}
-		for _, v := range datatype.Fields {
-			datatypeFieldsNameTypeMap[v.Name] = NewType(v.Type, expr.Tok.Line, expr.Tok.Col)
+			fieldTypes[i] = typ
 		}
-		for k, v := range exprFieldsNameTypeMap {
-			t, ok := datatypeFieldsNameTypeMap[k]
-			if !(ok) {
-				return nil, newErr(expr.Tok.Line, expr.Tok.Col, "unknown field '%s' in datatype literal '%s'", k, datatype.Name)
+		for i, v := range expr.Fields {
+			k, typ := v.Name.String(), fieldTypes[i]
+			f := datatype.Type.Field(k)
+			if f == nil {
+				return nil, newErr("A036", expr.Tok.Line, expr.Tok.Col, "unknown field '%s' in datatype literal '%s'", k, datatype.Name)
 			}
-			if err := a.matchTypes(t, v); err != nil {
-				errMsg := fmt.Sprintf("type mismatch for field '%s' in datatype literal '%s' (want=%s got=%s)", k, datatype.Name, t.typ, v.typ)
-				if v.next != nil {
+			if !(types.AssignableTo(typ, f.Type)) {
+				errMsg := fmt.Sprintf("type mismatch for field '%s' in datatype literal '%s' (want=%s got=%s)", k, datatype.Name, f.Type, typ)
+				if _, ok := typ.(*types.Tuple); ok {
 					errMsg = fmt.Sprintf("type mismatch for field '%s' in datatype literal '%s'; more value on rhs", k, datatype.Name)
 				}
-				return nil, newErr(expr.Tok.Line, expr.Tok.Col, errMsg)
+				return nil, newErr("A037", expr.Tok.Line, expr.Tok.Col, errMsg)
 			}
 		}
-		return NewType(expr.Tok.Literal, expr.Tok.Line, expr.Tok.Col), nil
+		// a value of a variant is a value of its sum type
+		if datatype.Type.Sum != nil {
+			return datatype.Type.Sum, nil
+		}
+		return datatype.Type, nil
+	case *ast.EnumMember:
+		e, _, err := a.enumMember(expr)
+		if err != nil {
+			return nil, err
+		}
+		return e.Type, nil
 	case *ast.FunctionCall:
-		lenArgs := len(expr.Args)
-		fn := a.env.GetFunc(expr.Tok.Literal)
+		fn, _ := a.callee(expr.Ident)
 		if fn == nil {
-			return nil, newErr(expr.Tok.Line, expr.Tok.Col, "invoking of non-existent function '%s'", expr.Ident)
+			return nil, a.notAFunction("A038", expr.Ident)
 		}
-		if fn.TakesCount == 0 && lenArgs != 0 {
-			return nil, newErr(expr.Tok.Line, expr.Tok.Col, "function '%s' takes no arguments", expr.Ident)
+		if fn.TakesCount == 0 && len(expr.Args) != 0 {
+			return nil, newErr("A039", expr.Tok.Line, expr.Tok.Col, "function '%s' takes no arguments", expr.Ident)
+		}
+		// the arguments may be calls too; one of them can return many values
+		args, err := a.argTypes(expr.Args)
+		if err != nil {
+			return nil, err
 		}
+		lenArgs := len(args)
 		if fn.TakesCount > lenArgs {
-			return nil, newErr(expr.Tok.Line, expr.Tok.Col, "function '%s' was given insufficient number of arguments (want=%d got=%d)", expr.Ident, fn.TakesCount, lenArgs)
+			return nil, newErr("A040", expr.Tok.Line, expr.Tok.Col, "function '%s' was given insufficient number of arguments (want=%d got=%d)", expr.Ident, fn.TakesCount, lenArgs)
 		} else if fn.TakesCount < lenArgs {
-			return nil, newErr(expr.Tok.Line, expr.Tok.Col, "function '%s' was given excessive number of arguments (want=%d got=%d)", expr.Ident, fn.TakesCount, lenArgs)
-		}
-		if fn.ReturnsCount == 0 {
-			return NewType(TypeVoid, expr.Tok.Line, expr.Tok.Col), nil
-		}
-		if fn.ReturnsCount == 1 {
-			return NewType(fn.Returns[0], expr.Tok.Line, expr.Tok.Col), nil
-		}
-		// head of the linked list
-		// other return types will follow this.
-		//
-		// for example:
-		// [int] --next--> [string] --next--> [User] --next--> *nil*
-		// a very simple singly-linked list
-		t := NewType(fn.Returns[0], expr.Tok.Line, expr.Tok.Col)
-		// copy t; because when we exit the loop, t will no longer be the first type; instead
-		// it will be the last type.
-		// And we want to return the first type, so that we can, in the future, follow the type chain.
-		tOriginal := t
-		for i, r := range fn.Returns {
-			if i == 0 {
-				// skip the first one to prevent duplicate type at the beginning
-				continue
-			}
-			t2 := NewType(r, expr.Tok.Line, expr.Tok.Col)
-			t.setNext(t2)
-			t = t2
+			return nil, newErr("A041", expr.Tok.Line, expr.Tok.Col, "function '%s' was given excessive number of arguments (want=%d got=%d)", expr.Ident, fn.TakesCount, lenArgs)
 		}
-		return tOriginal, nil
+		// a tuple if it returns many values; void if it returns nothing
+		return types.Join(fn.Returns), nil
 	case *ast.FunctionCallFromNamespace:
 		// very similar to above case
 
 		lenArgs := len(expr.Function.Args)
 		line, col := expr.Namespace.Tok.Line, expr.Namespace.Tok.Col
 		ns, name := expr.Namespace.Tok.Literal, expr.Function.Ident.String()
-		fn := a.std.GetFunc(ns, name)
+		fn := a.stdFunc(ns, name)
 		if fn == nil {
-			return nil, newErr(line, col, "unknown function '%s::%s'", ns, name)
+			return nil, newErr("A042", line, col, "unknown function '%s::%s'", ns, name)
 		}
 		argLen := len(expr.Function.Args)
 		if argLen > fn.TakesCount {
-			return nil, newErr(line, col, "excessive number of arguments passed to function '%s::%s' (want=%d got=%d)", ns, name, fn.TakesCount, argLen)
+			return nil, newErr("A043", line, col, "excessive number of arguments passed to function '%s::%s' (want=%d got=%d)", ns, name, fn.TakesCount, argLen)
 		} else if argLen < fn.TakesCount {
-			return nil, newErr(line, col, "insufficient number of arguments passed to function '%s::%s' (want=%d got=%d)", ns, name, fn.TakesCount, argLen)
+			return nil, newErr("A044", line, col, "insufficient number of arguments passed to function '%s::%s' (want=%d got=%d)", ns, name, fn.TakesCount, argLen)
 		}
 		if fn.TakesCount == 0 && lenArgs != 0 {
-			return nil, newErr(line, col, "function '%s::%s' takes no arguments", ns, name)
+			return nil, newErr("A045", line, col, "function '%s::%s' takes no arguments", ns, name)
 		}
 		if fn.TakesCount > lenArgs {
-			return nil, newErr(line, col, "function '%s::%s' was given insufficient number of arguments (want=%d got=%d)", ns, name, fn.ReturnsCount, lenArgs)
+			return nil, newErr("A046", line, col, "function '%s::%s' was given insufficient number of arguments (want=%d got=%d)", ns, name, fn.ReturnsCount, lenArgs)
 		} else if fn.TakesCount < lenArgs {
-			return nil, newErr(line, col, "function '%s::%s' was given excessive number of arguments (want=%d got=%d)", ns, name, fn.ReturnsCount, lenArgs)
-		}
-		if fn.ReturnsCount == 0 {
-			return NewType(TypeVoid, line, col), nil
-		}
-		if fn.ReturnsCount == 1 {
-			return NewType(fn.Returns[0], line, col), nil
+			return nil, newErr("A047", line, col, "function '%s::%s' was given excessive number of arguments (want=%d got=%d)", ns, name, fn.ReturnsCount, lenArgs)
 		}
-		t := NewType(fn.Returns[0], line, col)
-		tOriginal := t
-		for i, r := range fn.Returns {
-			if i == 0 {
-				continue
-			}
-			t2 := NewType(r, line, col)
-			t.setNext(t2)
-			t = t2
+		// the arguments may be calls too
+		if _, err := a.argTypes(expr.Function.Args); err != nil {
+			return nil, err
 		}
-		return tOriginal, nil
+		return types.Join(fn.Returns), nil
 	case *ast.PrefixExpr:
-		var expectConsecutive = func(what string) error {
+		var expectConsecutive = func(what types.Type) error {
 			for _, arg := range expr.Args {
 				typ, err := a.infer(arg)
 				if err != nil {
 					return err
 				}
-				if typ.typ != what {
-					return newErr(expr.Tok.Line, expr.Tok.Col, "expected '%s', got '%s'", what, typ.typ)
+				if !(types.Identical(typ, what)) {
+					return newErr("A048", expr.Tok.Line, expr.Tok.Col, "expected '%s', got '%s'", what, typ)
 				}
 			}
 			return nil
@@ -508,148 +603,220 @@ func (a *Analyzer) infer(expr ast.Expr) (*Type, error) {
 		switch expr.Tok.Type {
 		case token.ADD:
 			if len(expr.Args) < 2 {
-				return nil, newErr(expr.Tok.Line, expr.Tok.Col, "operator '+' takes at least two operands")
+				return nil, newErr("A049", expr.Tok.Line, expr.Tok.Col, "operator '+' takes at least two operands")
 			}
 			typ, err := a.infer(expr.Args[0])
 			if err != nil {
 				return nil, err
 			}
-			switch typ.typ {
-			case TypeInt:
-				if err := expectConsecutive(TypeInt); err != nil {
+			switch typ {
+			case types.Int:
+				if err := expectConsecutive(types.Int); err != nil {
 					return nil, err
 				}
 				return typ, nil
-			case TypeString:
-				if err := expectConsecutive(TypeString); err != nil {
+			case types.String:
+				if err := expectConsecutive(types.String); err != nil {
 					return nil, err
 				}
 				return typ, nil
 			default:
-				return nil, newErr(expr.Tok.Line, expr.Tok.Col, "invalid type of expression '%s' for '+' operator", typ.typ)
+				return nil, newErr("A050", expr.Tok.Line, expr.Tok.Col, "invalid type of expression '%s' for '+' operator", typ)
 			}
 		case token.MINUS, token.DIV, token.MUL:
 			if len(expr.Args) < 2 {
-				return nil, newErr(expr.Tok.Line, expr.Tok.Col, "operator '%s' takes at least two operands", token.PrefixExprName(expr.Tok.Type))
+				return nil, newErr("A051", expr.Tok.Line, expr.Tok.Col, "operator '%s' takes at least two operands", token.PrefixExprName(expr.Tok.Type))
 			}
 			typ, err := a.infer(expr.Args[0])
 			if err != nil {
 				return nil, err
 			}
-			if typ.typ != TypeInt {
-				return nil, newErr(expr.Tok.Line, expr.Tok.Col, "expected 'int', got '%s'", typ.typ)
+			if typ != types.Int {
+				return nil, newErr("A052", expr.Tok.Line, expr.Tok.Col, "expected 'int', got '%s'", typ)
 			}
-			if err := expectConsecutive(TypeInt); err != nil {
+			if err := expectConsecutive(types.Int); err != nil {
 				return nil, err
 			}
 			return typ, nil
 		case token.AND, token.OR:
 			if len(expr.Args) != 2 {
-				return nil, newErr(expr.Tok.Line, expr.Tok.Col, "operator '%s' expects exactly two arguments", token.PrefixExprName(expr.Tok.Type))
+				return nil, newErr("A053", expr.Tok.Line, expr.Tok.Col, "operator '%s' expects exactly two arguments", token.PrefixExprName(expr.Tok.Type))
 			}
-			if err := expectConsecutive(TypeBool); err != nil {
+			if err := expectConsecutive(types.Bool); err != nil {
 				return nil, err
 			}
-			return NewType(TypeBool, expr.Tok.Line, expr.Tok.Col), nil
+			return types.Bool, nil
 		case token.LT, token.LTE, token.GT, token.GTE, token.EQUAL:
 			if len(expr.Args) != 2 {
-				return nil, newErr(expr.Tok.Line, expr.Tok.Col, "operator '%s' expects exactly two arguments", token.PrefixExprName(expr.Tok.Type))
+				return nil, newErr("A054", expr.Tok.Line, expr.Tok.Col, "operator '%s' expects exactly two arguments", token.PrefixExprName(expr.Tok.Type))
+			}
+			typ, err := a.infer(expr.Args[0])
+			if err != nil {
+				return nil, err
+			}
+			// members of the same enum can be compared with '='
+			if e, ok := typ.(*types.Enum); ok && expr.Tok.Type == token.EQUAL {
+				if err := expectConsecutive(e); err != nil {
+					return nil, err
+				}
+				return types.Bool, nil
 			}
-			if err := expectConsecutive(TypeInt); err != nil {
+			if err := expectConsecutive(types.Int); err != nil {
 				return nil, err
 			}
-			return NewType(TypeBool, expr.Tok.Line, expr.Tok.Col), nil
+			return types.Bool, nil
 		case token.NOT:
 			if len(expr.Args) != 1 {
-				return nil, newErr(expr.Tok.Line, expr.Tok.Col, "operator 'not' expects exactly one argument")
+				return nil, newErr("A055", expr.Tok.Line, expr.Tok.Col, "operator 'not' expects exactly one argument")
 			}
 			typ, err := a.infer(expr.Args[0])
 			if err != nil {
 				return nil, err
 			}
-			if typ.typ != TypeBool {
-				return nil, newErr(expr.Tok.Line, expr.Tok.Col, "expected 'bool', got '%s'", typ.typ)
+			if typ != types.Bool {
+				return nil, newErr("A056", expr.Tok.Line, expr.Tok.Col, "expected 'bool', got '%s'", typ)
 			}
 			return typ, nil
 		// list/string indexing
 		case token.SINGLE_QUOTE:
 			if len(expr.Args) != 2 {
-				return nil, newErr(expr.Tok.Line, expr.Tok.Col, "operator \"'\" expects exactly two arguments")
+				return nil, newErr("A057", expr.Tok.Line, expr.Tok.Col, "operator \"'\" expects exactly two arguments")
 			}
 			typ, err := a.infer(expr.Args[0])
 			if err != nil {
 				return nil, err
 			}
-			isStrIndex, isListIndex := typ.typ == TypeString, strings.Contains(typ.typ, "list-")
-			if !(isStrIndex) && !(isListIndex) {
-				return nil, newErr(expr.Tok.Line, expr.Tok.Col, "invalid type of expression for \"'\"")
+			if l, ok := typ.(*types.List); ok && l.Elem != nil {
+				return l.Elem, nil
 			}
-			if isListIndex {
-				typOfList := strings.Split(typ.typ, "list-")[1]
-				return NewType(typOfList, expr.Tok.Line, expr.Tok.Col), nil
+			if typ != types.String {
+				return nil, newErr("A058", expr.Tok.Line, expr.Tok.Col, "invalid type of expression for \"'\"")
 			}
-			return NewType(TypeString, expr.Tok.Line, expr.Tok.Col), nil
+			return types.String, nil
 		case token.GET:
 			if len(expr.Args) != 2 {
-				return nil, newErr(expr.Tok.Line, expr.Tok.Col, "operator 'get' expects exactly two arguments")
+				return nil, newErr("A059", expr.Tok.Line, expr.Tok.Col, "operator 'get' expects exactly two arguments")
 			}
 			typ, err := a.infer(expr.Args[0])
 			if err != nil {
 				return nil, err
 			}
-			dt := a.env.GetDatatype(typ.typ)
+			dt := a.datatypeOf(typ)
 			if dt == nil {
-				return nil, newErr(expr.Tok.Line, expr.Tok.Col, "no variable called '%s' that is a datatype", expr.Args[0])
+				return nil, newErr("A060", expr.Tok.Line, expr.Tok.Col, "no variable called '%s' that is a datatype", expr.Args[0])
 			}
-			field := expr.Args[1]
 			// field is an identifier
-			var found bool
-			var retType string
-			for _, v := range dt.Fields {
-				if v.Name == field.String() {
-					found = true
-					retType = v.Type
-				}
-			}
-			if !(found) {
-				return nil, newErr(expr.Tok.Line, expr.Tok.Col, "no field named '%s' in datatype '%s'", field, dt.Name)
+			field := dt.Field(expr.Args[1].String())
+			if field == nil {
+				return nil, newErr("A061", expr.Tok.Line, expr.Tok.Col, "no field named '%s' in datatype '%s'", expr.Args[1], dt.Name)
 			}
-			return NewType(retType, expr.Tok.Line, expr.Tok.Col), nil
+			return field.Type, nil
 		case token.SET:
 			if len(expr.Args) != 3 {
-				return nil, newErr(expr.Tok.Line, expr.Tok.Col, "operator 'set' expects exactly three arguments")
+				return nil, newErr("A062", expr.Tok.Line, expr.Tok.Col, "operator 'set' expects exactly three arguments")
 			}
 			typ, err := a.infer(expr.Args[0])
 			if err != nil {
 				return nil, err
 			}
-			dt := a.env.GetDatatype(typ.typ)
+			// set returns a changed copy; but a constant is never meant to change
+			if id, ok := expr.Args[0].(*ast.Identifier); ok {
+				if _, ok := a.env.IsConst(id.String()); ok {
+					return nil, newErr("A108", expr.Tok.Line, expr.Tok.Col, "'set' on the constant '%s'", id)
+				}
+			}
+			dt := a.datatypeOf(typ)
 			if dt == nil {
-				return nil, newErr(expr.Tok.Line, expr.Tok.Col, "no variable called '%s' that is a datatype", expr.Args[0])
+				return nil, newErr("A063", expr.Tok.Line, expr.Tok.Col, "no variable called '%s' that is a datatype", expr.Args[0])
 			}
-			field := expr.Args[1]
 			// field is an identifier
-			var found bool
-			var fieldType string
-			for _, v := range dt.Fields {
-				if v.Name == field.String() {
-					found = true
-					fieldType = v.Type
-				}
-			}
-			if !(found) {
-				return nil, newErr(expr.Tok.Line, expr.Tok.Col, "no field named '%s' in datatype '%s'", field, dt.Name)
+			field := dt.Field(expr.Args[1].String())
+			if field == nil {
+				return nil, newErr("A064", expr.Tok.Line, expr.Tok.Col, "no field named '%s' in datatype '%s'", expr.Args[1], dt.Name)
 			}
-			if err := a.match(expr.Args[2], NewType(fieldType, expr.Tok.Line, expr.Tok.Col)); err != nil {
+			if err := a.match(expr.Args[2], field.Type); err != nil {
 				return nil, err
 			}
-			return NewType(dt.Name, expr.Tok.Line, expr.Tok.Col), nil
+			return dt, nil
 		}
 	}
 	panic(fmt.Sprintf("--UNREACHABLE--\n*Analyzer.infer: unknown expr '%s'\n", expr.String()))
 }
 
+// the enum of the member m, and the index of m
+func (a *Analyzer) enumMember(m *ast.EnumMember) (*IREnum, int, error) {
+	e := a.env.GetEnum(m.Enum.String())
+	if e == nil && std.LookupNamespace(m.Enum.String()) != nil {
+		// String::from_int, without a call
+		return nil, 0, newErr("A116", m.Enum.Tok.Line, m.Enum.Tok.Col, "'%s' is a namespace of the standard library; its functions can't be used as values", m.Enum)
+	}
+	if e == nil {
+		return nil, 0, newErr("A104", m.Enum.Tok.Line, m.Enum.Tok.Col, "no enum named '%s'", m.Enum)
+	}
+	i := e.Type.Member(m.Member.String())
+	if i == -1 {
+		return nil, 0, newErr("A105", m.Member.Tok.Line, m.Member.Tok.Col, "no member named '%s' in enum '%s'", m.Member, e.Name)
+	}
+	return e, i, nil
+}
+
+// String::from_Color(c), or Color::members(); e is Color
+func (a *Analyzer) enumFuncCall(expr *ast.FunctionCallFromNamespace, e *IREnum) IRExpression {
+	if len(expr.Function.Args) == 1 {
+		return &IREnumName{Node: nodeOf(expr), Type: e.Type, Value: a.toIrExpr(expr.Function.Args[0], e.Type)}
+	}
+	ir := &IRList{Node: nodeOf(expr), Type: &types.List{Elem: e.Type}, Length: len(e.Members)}
+	for i, m := range e.Members {
+		ir.Value = append(ir.Value, &IREnumMember{Node: nodeOf(expr), Type: e.Type, Name: m, Index: i})
+	}
+	return ir
+}
+
+// the declared datatype t; nil if t isn't one
+func (a *Analyzer) datatypeOf(t types.Type) *types.Datatype {
+	if t, ok := t.(*types.Datatype); ok {
+		if dt := a.env.GetDatatype(t.Name); dt != nil {
+			return dt.Type
+		}
+	}
+	return nil
+}
+
+// the type of the variable named name, or of the function named name as a
+// value; nil if there's neither. a variable hides a function.
+func (a *Analyzer) valueType(name string) types.Type {
+	if t := a.env.GetVar(name); t != nil {
+		return t
+	}
+	if fn := a.env.GetFunc(name); fn != nil {
+		return fn.Type()
+	}
+	return nil
+}
+
+// the function that 'name(...)' calls; a declared function, or the value of a
+// variable of a function type. v is the variable; nil if it's a function.
+func (a *Analyzer) callee(id *ast.Identifier) (fn *IRFunction, v *IRVariableReference) {
+	name := id.String()
+	t, ok := a.env.GetVar(name).(*types.Func)
+	if !(ok) {
+		return a.env.GetFunc(name), nil
+	}
+	_, isConst := a.env.IsConst(name)
+	v = &IRVariableReference{Node: nodeOf(id), Name: name, Type: t, Param: a.env.IsParam(name), Const: isConst}
+	return &IRFunction{Name: name, Takes: t.Params, Returns: t.Returns, TakesCount: len(t.Params), ReturnsCount: len(t.Returns)}, v
+}
+
+// the error for a call of name, which isn't a function
+func (a *Analyzer) notAFunction(code string, name *ast.Identifier) error {
+	if t := a.env.GetVar(name.String()); t != nil {
+		return newErr("A110", name.Tok.Line, name.Tok.Col, "invoking of '%s' of type '%s', which is not a function", name, t)
+	}
+	return newErr(code, name.Tok.Line, name.Tok.Col, "invoking of non-existent function '%s'", name)
+}
+
 func (a *Analyzer) typecheckStatement(s ast.Statement, returnWanted *returnWanted) IRStatement {
+	a.resolveStatement(s)
 	switch s := s.(type) {
 	case *ast.VariableDeclarationStatement:
 		if ir := a.typecheckVarDecl(s); ir != nil {
@@ -659,6 +826,10 @@ func (a *Analyzer) typecheckStatement(s ast.Statement, returnWanted *returnWante
 		if ir := a.typecheckListDecl(s); ir != nil {
 			return ir
 		}
+	case *ast.ConstDeclaration:
+		if ir := a.typecheckConstDecl(s); ir != nil {
+			return ir
+		}
 	case *ast.IfStatement:
 		if ir := a.typecheckIfStmt(s, returnWanted); ir != nil {
 			return ir
@@ -667,6 +838,15 @@ func (a *Analyzer) typecheckStatement(s ast.Statement, returnWanted *returnWante
 		if ir := a.typecheckDatatypeDecl(s); ir != nil {
 			return ir
 		}
+	case *ast.EnumDeclaration:
+		// the one of the first pass; nil if it has errors
+		if ir := a.env.GetEnum(s.Name.String()); ir != nil && ir.Node == nodeOf(s) {
+			return ir
+		}
+	case *ast.MatchStatement:
+		if ir := a.typecheckMatch(s, returnWanted); ir != nil {
+			return ir
+		}
 	case *ast.SubsequentVariableDeclarationStatement:
 		if ir := a.typecheckSubseqVarDecl(s); ir != nil {
 			return ir
@@ -697,7 +877,7 @@ func (a *Analyzer) typecheckStatement(s ast.Statement, returnWanted *returnWante
 		}
 	case *ast.ReturnStatement:
 		// I realized I forgot to produce IR for return statements.
-		if ir := a.produceReturnIR(s); ir != nil {
+		if ir := a.produceReturnIR(s, returnWanted); ir != nil {
 			return ir
 		}
 	case *ast.BreakStatement:
@@ -708,87 +888,146 @@ func (a *Analyzer) typecheckStatement(s ast.Statement, returnWanted *returnWante
 		if ir := a.produceContinueIR(s); ir != nil {
 			return ir
 		}
+	case *ast.BadStatement:
+		// the parser already reported the error.
+		// don't report errors for references to the variables it declares.
+		for _, v := range s.Names {
+			a.env.AddFailedVar(v.String())
+		}
 	}
 	return nil
 }
 
-func (a *Analyzer) toIrExpr(expr ast.Expr, typeOfList ...string) IRExpression {
-	// IMPORTANT
-	// typeOfList variable is a variadic parameter, because I want to be able to skip it if I want to.
+// want is the type that expr is assigned to, if it's known. an empty list
+// literal takes its type from it.
+func (a *Analyzer) toIrExpr(expr ast.Expr, want ...types.Type) IRExpression {
 	switch expr := expr.(type) {
 	case *ast.StringLiteral:
-		return &IRString{Value: expr.Val}
+		return &IRString{Node: nodeOf(expr), Value: expr.Val}
 	case *ast.IntLiteral:
-		return &IRInt{Value: expr.String()}
+		return &IRInt{Node: nodeOf(expr), Value: expr.String()}
 	case *ast.BoolLiteral:
-		return &IRBoolean{Value: expr.String()}
+		return &IRBoolean{Node: nodeOf(expr), Value: expr.String()}
 	case *ast.Identifier:
 		typ := a.env.GetVar(expr.Tok.Literal)
-		return &IRVariableReference{Name: expr.String(), Type: typ}
+		if fn := a.env.GetFunc(expr.Tok.Literal); typ == nil && fn != nil {
+			return &IRFunctionReference{Node: nodeOf(expr), Name: fn.Name, Type: fn.Type()}
+		}
+		_, isConst := a.env.IsConst(expr.Tok.Literal)
+		return &IRVariableReference{Node: nodeOf(expr), Name: expr.String(), Type: typ, Param: a.env.IsParam(expr.Tok.Literal), Const: isConst}
 	case *ast.PrefixExpr:
-		ir := &IRPrefExpr{Operator: expr.Tok.Literal}
+		// expr is already typechecked
+		typ, _ := a.infer(expr)
+		ir := &IRPrefExpr{Node: nodeOf(expr), Operator: expr.Tok.Literal, Type: typ}
+		if len(expr.Args) > 0 {
+			ir.Operand, _ = a.infer(expr.Args[0])
+		}
 		for _, v := range expr.Args {
 			ir.Operands = append(ir.Operands, a.toIrExpr(v))
 		}
 		return ir
 	case *ast.ListLiteral:
-		if len(typeOfList) != 1 {
-			panic("toIrExpr: len(typeOfList) != 1")
+		// the literal is already typechecked; learn the type from its elements.
+		t, _ := a.infer(expr)
+		typ, ok := t.(*types.List)
+		if (!(ok) || typ.Elem == nil) && len(want) == 1 {
+			typ, ok = want[0].(*types.List)
 		}
-		ir := &IRList{Type: typeOfList[0], Length: len(expr.Elems)}
+		if !(ok) || typ.Elem == nil {
+			panic("toIrExpr: unknown type of list literal " + expr.String())
+		}
+		ir := &IRList{Node: nodeOf(expr), Type: typ, Length: len(expr.Elems)}
 		for _, v := range expr.Elems {
-			ir.Value = append(ir.Value, a.toIrExpr(v))
+			ir.Value = append(ir.Value, a.toIrExpr(v, typ.Elem))
 		}
 		return ir
 	case *ast.FunctionCall:
 		fnName := expr.Ident.String()
-		// this can't be nil
-		fn := a.env.GetFunc(fnName)
-		ir := &IRFunctionCall{Name: fnName, TakesCount: fn.TakesCount, ReturnsCount: fn.ReturnsCount, Returns: fn.Returns}
-		for _, v := range expr.Args {
-			ir.Takes = append(ir.Takes, a.toIrExpr(v))
+		fn, v := a.callee(expr.Ident)
+		if fn == nil {
+			return a.failedExpr(expr)
+		}
+		ir := &IRFunctionCall{Node: nodeOf(expr), Name: fnName, TakesCount: fn.TakesCount, ReturnsCount: fn.ReturnsCount, Returns: fn.Returns, Value: v}
+		for i, v := range expr.Args {
+			ir.Takes = append(ir.Takes, a.toIrExpr(v, fn.Takes[i]))
 		}
 		return ir
 	case *ast.FunctionCallFromNamespace:
 		fnName, ns := expr.Function.Ident.String(), expr.Namespace.Tok.Literal
-		fn := a.std.GetFunc(ns, fnName)
+		if e := a.enumOfFunc(ns, fnName); e != nil && a.std.GetFunc(ns, fnName) == nil {
+			return a.enumFuncCall(expr, e)
+		}
+		fn := a.stdFunc(ns, fnName)
+		if fn == nil {
+			return a.failedExpr(expr)
+		}
 		ir := &IRFunctionCallFromNamespace{Namespace: ns, IRFunctionCall: IRFunctionCall{
+			Node:         nodeOf(expr),
 			Name:         fnName,
 			Returns:      fn.Returns,
 			TakesCount:   fn.TakesCount,
 			ReturnsCount: fn.ReturnsCount,
 		}}
-		for _, v := range expr.Function.Args {
-			ir.Takes = append(ir.Takes, a.toIrExpr(v))
+		for i, v := range expr.Function.Args {
+			ir.Takes = append(ir.Takes, a.toIrExpr(v, fn.Takes[i]))
 		}
 		return ir
+	case *ast.EnumMember:
+		e, i, err := a.enumMember(expr)
+		if err != nil {
+			return a.failedExpr(expr)
+		}
+		return &IREnumMember{Node: nodeOf(expr), Type: e.Type, Name: e.Members[i], Index: i}
 	case *ast.DatatypeLiteral:
-		ir := &IRDatatypeLiteral{Name: expr.Tok.Literal, FieldsAndValues: make(map[string]IRExpression)}
+		dt := a.env.GetDatatype(expr.Tok.Literal)
+		if dt == nil {
+			return a.failedExpr(expr)
+		}
+		ir := &IRDatatypeLiteral{Node: nodeOf(expr), Name: expr.Tok.Literal, FieldsAndValues: make(map[string]IRExpression)}
 		for _, v := range expr.Fields {
-			ir.FieldsAndValues[v.Name.String()] = a.toIrExpr(v.Value)
+			name := v.Name.String()
+			ir.FieldsAndValues[name] = a.toIrExpr(v.Value, dt.Type.Field(name).Type)
 		}
 		return ir
 	}
 	panic("toIrExpr : unhandled expr " + expr.String())
 }
 
+// an expression that failed to typecheck has no IR. its error is reported, if
+// it isn't already; so the IR of the program isn't used.
+func (a *Analyzer) failedExpr(expr ast.Expr) IRExpression {
+	_, err := a.infer(expr)
+	if err == nil {
+		panic("toIrExpr: no IR for typechecked expr " + expr.String())
+	}
+	e := err.(Err)
+	for _, v := range a.Errs {
+		if v.Code == e.Code && v.Line == e.Line && v.Column == e.Column {
+			return nil
+		}
+	}
+	a.pushErr(err)
+	return nil
+}
+
 func (a *Analyzer) typecheckVarDecl(s *ast.VariableDeclarationStatement) *IRVariable {
 	if d, ok := s.Value.(*ast.Identifier); ok {
 		if a.env.IsFailedVar(d.Tok.Literal) {
 			return nil
 		}
 	}
-	varType := NewType(s.Tok.Literal, s.Tok.Line, s.Tok.Col)
+	varType := a.typeOf(s.Tok, s.Fun)
 	if err := a.match(s.Value, varType); err != nil {
 		a.pushErr(err)
 		a.env.AddFailedVar(s.Ident.String())
 		return nil
 	}
-	ir := &IRVariable{Name: s.Ident.String(), Type: s.Tok.Literal, Value: a.toIrExpr(s.Value)}
+	ir := &IRVariable{Node: nodeOf(s), Name: s.Ident.String(), Type: varType, Value: a.toIrExpr(s.Value, varType)}
 	if err := a.env.AddVar(ir.Name, ir.Type); err != nil {
-		a.errorf(s.Tok.Line, s.Tok.Col, err.Error())
+		a.errorf("A065", s.Tok.Line, s.Tok.Col, err.Error())
 		return nil
 	}
+	a.declareVar(s.Ident, ir.Type)
 	return ir
 }
 
@@ -798,26 +1037,29 @@ func (a *Analyzer) typecheckListDecl(s *ast.ListVariableDeclarationStatement) *I
 			return nil
 		}
 	}
-	listType := NewType(TypeList_(s.Typ.Literal), s.Tok.Line, s.Tok.Col)
+	listType := &types.List{Elem: a.typeOf(s.Typ, s.Fun)}
 	if err := a.match(s.List, listType); err != nil {
 		a.pushErr(err)
 		a.env.AddFailedVar(s.Name.String())
 		return nil
 	}
-	ir := &IRVariable{Name: s.Name.String(), Type: TypeList(s.Typ.Literal), Value: a.toIrExpr(s.List, s.Typ.Literal)}
+	ir := &IRVariable{Node: nodeOf(s), Name: s.Name.String(), Type: listType, Value: a.toIrExpr(s.List, listType)}
 	if err := a.env.AddVar(ir.Name, ir.Type); err != nil {
-		a.errorf(s.Tok.Line, s.Tok.Col, err.Error())
+		a.errorf("A066", s.Tok.Line, s.Tok.Col, err.Error())
 		return nil
 	}
+	a.declareVar(s.Name, ir.Type)
 	return ir
 }
 
 func (a *Analyzer) funAndDatatypeDeclOnlyInGlobalScope(s ast.Statement) error {
 	switch s := s.(type) {
 	case *ast.FunctionDeclarationStatement:
-		return newErr(s.Tok.Line, s.Tok.Col, "function declarations are only allowed at global scope")
+		return newErr("A067", s.Tok.Line, s.Tok.Col, "function declarations are only allowed at global scope")
 	case *ast.DatatypeDeclaration:
-		return newErr(s.Tok.Line, s.Tok.Col, "datatype declarations are only allowed at global scope")
+		return newErr("A068", s.Tok.Line, s.Tok.Col, "datatype declarations are only allowed at global scope")
+	case *ast.EnumDeclaration:
+		return newErr("A101", s.Tok.Line, s.Tok.Col, "enum declarations are only allowed at global scope")
 	}
 	return nil
 }
@@ -836,11 +1078,11 @@ func (a *Analyzer) returnCountAndTypeMustMatch(v ast.Statement, returnWanted *re
 }
 
 func (a *Analyzer) typecheckIfStmt(s *ast.IfStatement, returnWanted *returnWanted) *IRIf {
-	if err := a.match(s.Cond, NewType(TypeBool, s.Tok.Line, s.Tok.Col)); err != nil {
+	if err := a.match(s.Cond, types.Bool); err != nil {
 		a.pushErr(err)
 		return nil
 	}
-	ir := &IRIf{Cond: a.toIrExpr(s.Cond)}
+	ir := &IRIf{Node: nodeOf(s), Cond: a.toIrExpr(s.Cond)}
 	// enter a new scope here
 	a.env.EnterScope()
 	for _, v := range s.Stmts {
@@ -867,7 +1109,7 @@ func (a *Analyzer) typecheckIfStmt(s *ast.IfStatement, returnWanted *returnWante
 }
 
 func (a *Analyzer) typecheckElseStmt(s *ast.ElseStatement, returnWanted *returnWanted) *IRElse {
-	ir := &IRElse{}
+	ir := &IRElse{Node: nodeOf(s)}
 	a.env.EnterScope()
 	for _, v := range s.Stmts {
 		if err := a.returnCountAndTypeMustMatch(v, returnWanted); err != nil {
@@ -889,11 +1131,11 @@ func (a *Analyzer) typecheckElseStmt(s *ast.ElseStatement, returnWanted *returnW
 // this is going to be mostly the same as typecheckIfStmt, but I don't want to create workarounds to prevent
 // entering a new scope when using typecheckIfStmt to typecheck an elseif statement.
 func (a *Analyzer) typecheckElseIfStmt(s *ast.IfStatement, returnWanted *returnWanted) *IRElseIf {
-	if err := a.match(s.Cond, NewType(TypeBool, s.Tok.Line, s.Tok.Col)); err != nil {
+	if err := a.match(s.Cond, types.Bool); err != nil {
 		a.pushErr(err)
 		return nil
 	}
-	ir := &IRElseIf{Cond: a.toIrExpr(s.Cond)}
+	ir := &IRElseIf{Node: nodeOf(s), Cond: a.toIrExpr(s.Cond)}
 	a.env.EnterScope()
 	for _, v := range s.Stmts {
 		if err := a.returnCountAndTypeMustMatch(v, returnWanted); err != nil {
@@ -919,73 +1161,201 @@ func (a *Analyzer) typecheckElseIfStmt(s *ast.IfStatement, returnWanted *returnW
 }
 
 func (a *Analyzer) typecheckDatatypeDecl(s *ast.DatatypeDeclaration) *IRDatatype {
-	ir := &IRDatatype{Name: s.Name.String(), FieldCount: len(s.Fields)}
+	ir := &IRDatatype{Node: nodeOf(s), Name: s.Name.String(), FieldCount: len(s.Fields)}
+	// the one of the first pass; so every use of the datatype has the same type
+	registered := a.env.GetDatatype(ir.Name)
+	if registered == nil {
+		// the name is taken by an enum; that's already reported
+		return nil
+	}
+	ir.Type = registered.Type
+	if len(s.Variants) == 0 {
+		fields, ok := a.typecheckFields(ir.Name, s.Fields)
+		if !(ok) {
+			return nil
+		}
+		ir.Fields = fields
+		if a.containsItself(ir.Type) {
+			a.errorf("A111", s.Name.Tok.Line, s.Name.Tok.Col, "datatype '%s' contains itself, directly or through other datatypes; its zero value would be infinite", ir.Name)
+			return nil
+		}
+		return ir
+	}
+	for _, v := range s.Variants {
+		variant := a.variantOf(registered, v.Name.String())
+		if variant == nil {
+			// the name is taken; that's already reported
+			return nil
+		}
+		fields, ok := a.typecheckFields(variant.Name, v.Fields)
+		if !(ok) {
+			return nil
+		}
+		ir.Variants = append(ir.Variants, &IRDatatype{Node: nodeOf(v), Name: variant.Name, FieldCount: len(fields), Fields: fields, Type: variant.Type})
+	}
+	// the zero value of a sum type is its first variant; with zero values for its fields
+	if first := ir.Type.Variants[0]; a.zeroValueContains(first, ir.Type, map[string]bool{}) {
+		a.errorf("A098", s.Name.Tok.Line, s.Name.Tok.Col, "the first variant of '%s' ('%s') can't contain a '%s'; the zero value of a sum type is its first variant", ir.Name, first.Name, ir.Name)
+		return nil
+	}
+	for i, v := range ir.Variants {
+		if a.containsItself(v.Type) {
+			tok := s.Variants[i].Name.Tok
+			a.errorf("A112", tok.Line, tok.Col, "datatype '%s' contains itself, directly or through other datatypes; its zero value would be infinite", v.Name)
+			return nil
+		}
+	}
+	return ir
+}
+
+// the fields of the datatype, or the variant named name
+func (a *Analyzer) typecheckFields(name string, fs []*ast.DatatypeField) ([]IRDatatypeField, bool) {
+	var res []IRDatatypeField
 	fields := map[string]bool{} // to prevent two fields with the same name
-	for _, v := range s.Fields {
-		isDatatypeType := v.Tok.Type != token.INTKW && v.Tok.Type != token.STRINGKW && v.Tok.Type != token.BOOLKW
-		if isDatatypeType {
-			dt := a.env.GetDatatype(v.Tok.Literal)
-			if dt == nil {
-				// no such datatype
-				a.errorf(v.Tok.Line, v.Tok.Col, "no datatype named '%s'", v.Tok.Literal)
-				return nil
-			}
+	for _, v := range fs {
+		typ := a.typeOf(v.Tok, v.Fun)
+		if dt := a.undeclared(typ); dt != "" {
+			a.errorf("A069", v.Tok.Line, v.Tok.Col, "no datatype named '%s'", dt)
+			return nil, false
 		}
 		fieldName := v.Ident.String()
 		if fields[fieldName] {
-			a.errorf(v.Tok.Line, v.Tok.Col, "duplicate field name '%s' in datatype '%s'", fieldName, ir.Name)
-			return nil
+			a.errorf("A070", v.Tok.Line, v.Tok.Col, "duplicate field name '%s' in datatype '%s'", fieldName, name)
+			return nil, false
 		}
-		ir.Fields = append(ir.Fields, IRDatatypeField{Type: v.Tok.Literal, Name: v.Ident.String()})
+		res = append(res, IRDatatypeField{Node: nodeOf(v), Type: typ, Name: v.Ident.String()})
 		fields[fieldName] = true
 	}
-	return ir
+	return res, true
 }
 
-func (a *Analyzer) typecheckSubseqVarDecl(s *ast.SubsequentVariableDeclarationStatement) *IRSubseq {
-	ir := &IRSubseq{}
-	names, types := s.Names, s.Types
-	var buildTypeChain = func(varTypes []ast.VarType, line, col uint) *Type {
-		t := NewTypeFromVarType(varTypes[0], line, col)
-		if len(varTypes) == 1 {
-			return t
-		}
-		tCopy := t
-		for i := 1; i < len(varTypes); i++ {
-			newT := NewTypeFromVarType(varTypes[i], line, col)
-			tCopy.setNext(newT)
-			tCopy = newT
+// whether a field of dt contains a value of dt; then the zero value of dt would
+// be infinite, and so would be every value of it.
+func (a *Analyzer) containsItself(dt *types.Datatype) bool {
+	seen := map[string]bool{}
+	for _, f := range dt.Fields {
+		if a.zeroValueContains(f.Type, dt, seen) {
+			return true
 		}
-		return t
 	}
-	var buildRhsTypeChain = func() (*Type, error) {
-		t, err := a.infer(s.Values[0])
-		if err != nil {
-			return nil, err
-		}
-		tCopy := t
-		for i := 1; i < len(s.Values); i++ {
-			newT, err := a.infer(s.Values[i])
-			if err != nil {
-				return nil, err
-			}
-			tCopy.setNext(newT)
-			tCopy = newT
+	return false
+}
+
+// whether the zero value of t contains a value of the datatype dt
+func (a *Analyzer) zeroValueContains(t types.Type, dt *types.Datatype, seen map[string]bool) bool {
+	d := a.datatypeOf(t)
+	if d == nil || seen[d.Name] {
+		return false
+	}
+	if d.Name == dt.Name {
+		return true
+	}
+	seen[d.Name] = true
+	if len(d.Variants) > 0 {
+		return a.zeroValueContains(d.Variants[0], dt, seen)
+	}
+	for _, f := range d.Fields {
+		if a.zeroValueContains(f.Type, dt, seen) {
+			return true
 		}
-		return t, nil
 	}
-	lhs := buildTypeChain(types, s.Tok.Line, s.Tok.Col)
-	rhs, err := buildRhsTypeChain()
+	return false
+}
+
+func (a *Analyzer) typecheckMatch(s *ast.MatchStatement, returnWanted *returnWanted) *IRMatch {
+	typ, err := a.infer(s.Value)
 	if err != nil {
 		a.pushErr(err)
 		return nil
 	}
+	sum := a.datatypeOf(typ)
+	if sum == nil || len(sum.Variants) == 0 {
+		a.pushErr(newSpanErr("A095", s.Value.Span(), "match on '%s'; it isn't a sum type", typ))
+		return nil
+	}
+	ir := &IRMatch{Node: nodeOf(s), Type: sum, Value: a.toIrExpr(s.Value)}
+	seen := map[string]bool{} // the variants that have an arm
+	for _, arm := range s.Arms {
+		name := arm.Variant.String()
+		variant := sum.Variant(name)
+		if variant == nil {
+			a.errorf("A096", arm.Variant.Tok.Line, arm.Variant.Tok.Col, "'%s' is not a variant of '%s'", name, sum)
+			return nil
+		}
+		if seen[name] {
+			a.errorf("A097", arm.Variant.Tok.Line, arm.Variant.Tok.Col, "duplicate arm for variant '%s'", name)
+			return nil
+		}
+		seen[name] = true
+		armIr := &IRMatchArm{Node: nodeOf(arm), Variant: variant}
+		a.env.EnterScope()
+		if arm.Name != nil {
+			armIr.Name = arm.Name.String()
+			if err := a.env.AddVar(armIr.Name, variant); err != nil {
+				a.errorf("A099", arm.Name.Tok.Line, arm.Name.Tok.Col, err.Error())
+				a.env.ExitScope()
+				return nil
+			}
+			a.declareVar(arm.Name, variant)
+		}
+		for _, v := range arm.Stmts {
+			if err := a.returnCountAndTypeMustMatch(v, returnWanted); err != nil {
+				a.pushErr(err)
+				return nil
+			}
+			if err := a.funAndDatatypeDeclOnlyInGlobalScope(v); err != nil {
+				a.pushErr(err)
+				return nil
+			}
+			if stmtIr := a.typecheckStatement(v, returnWanted); stmtIr != nil {
+				armIr.Block = append(armIr.Block, stmtIr)
+			}
+		}
+		a.env.ExitScope()
+		ir.Arms = append(ir.Arms, armIr)
+	}
+	if s.Default != nil {
+		ir.Default = a.typecheckElseStmt(s.Default, returnWanted)
+		return ir
+	}
+	var missing []string
+	for _, v := range sum.Variants {
+		if !(seen[v.Name]) {
+			missing = append(missing, "'"+v.Name+"'")
+		}
+	}
+	if len(missing) > 0 {
+		a.errorf("A100", s.Tok.Line, s.Tok.Col, "match on '%s' is not exhaustive; missing %s", sum, strings.Join(missing, ", "))
+		return nil
+	}
+	return ir
+}
+
+func (a *Analyzer) typecheckSubseqVarDecl(s *ast.SubsequentVariableDeclarationStatement) *IRSubseq {
+	ir := &IRSubseq{Node: nodeOf(s)}
+	names := s.Names
+	for _, t := range s.Types {
+		ir.Types = append(ir.Types, a.declType(t))
+	}
+	// index of the first variable each value is assigned to.
+	// a function call returning multiple values is assigned to multiple variables.
+	targets := make([]int, len(s.Values))
+	var rhs []types.Type
+	for i, v := range s.Values {
+		t, err := a.infer(v)
+		if err != nil {
+			a.pushErr(err)
+			return nil
+		}
+		targets[i] = len(rhs)
+		rhs = append(rhs, values(t)...)
+	}
 	var setAllVarsFailed = func() {
 		for _, v := range names {
 			a.env.AddFailedVar(v.String())
 		}
 	}
-	if err := a.matchTypes(lhs, rhs); err != nil {
+	if err := a.matchTypes(s.Tok.Line, s.Tok.Col, ir.Types, rhs); err != nil {
 		a.pushErr(err)
 		setAllVarsFailed()
 		return nil
@@ -993,45 +1363,46 @@ func (a *Analyzer) typecheckSubseqVarDecl(s *ast.SubsequentVariableDeclarationSt
 	for _, n := range names {
 		ir.Names = append(ir.Names, n.String())
 	}
-	for _, n := range types {
-		var t string
-		if n.IsList {
-			t = TypeList_(n.TypeOfList.Literal)
-		} else {
-			t = n.Tok.Literal
-		}
-		ir.Types = append(ir.Types, t)
-	}
-	for _, v := range s.Values {
+	for i, v := range s.Values {
 		if d, ok := v.(*ast.Identifier); ok {
 			if a.env.IsFailedVar(d.String()) {
 				setAllVarsFailed()
 				return nil
 			}
 		}
-		ir.Values = append(ir.Values, a.toIrExpr(v))
+		// an empty list takes the type of the variable it's assigned to.
+		ir.Values = append(ir.Values, a.toIrExpr(v, ir.Types[targets[i]]))
 	}
 	// add variables
-	for i := 0; ; i++ {
-		name := names[i].String()
-		a.env.AddVar(name, rhs.typ)
-		if rhs.next == nil {
-			break
+	for i, name := range ir.Names {
+		if err := a.env.AddVar(name, ir.Types[i]); err != nil {
+			a.errorf("A115", s.Tok.Line, s.Tok.Col, err.Error())
+			return nil
 		}
-		rhs = rhs.next
+		a.declareVar(s.Names[i], ir.Types[i])
 	}
 	return ir
 }
 
 func (a *Analyzer) typecheckReassignment(s *ast.ReassignmentStatement) *IRReassigment {
-	ir := &IRReassigment{Name: s.Ident.String()}
-	typOfOldVal := NewType(a.env.GetVar(ir.Name), s.Tok.Line, s.Tok.Col)
+	ir := &IRReassigment{Node: nodeOf(s), Name: s.Ident.String(), Param: a.env.IsParam(s.Ident.String())}
+	typOfOldVal := a.env.GetVar(ir.Name)
+	if typOfOldVal == nil {
+		if !(a.env.IsFailedVar(ir.Name)) {
+			a.errorf("A093", s.Tok.Line, s.Tok.Col, "assignment to non-existent variable '%s'", ir.Name)
+		}
+		return nil
+	}
+	if _, ok := a.env.IsConst(ir.Name); ok {
+		a.errorf("A107", s.Tok.Line, s.Tok.Col, "assignment to the constant '%s'", ir.Name)
+		return nil
+	}
 	newVal := s.NewValue
 	if err := a.match(newVal, typOfOldVal); err != nil {
 		a.pushErr(err)
 		return nil
 	}
-	ir.NewValue = a.toIrExpr(newVal)
+	ir.NewValue = a.toIrExpr(newVal, typOfOldVal)
 	return ir
 }
 
@@ -1041,9 +1412,9 @@ func (a *Analyzer) illegalFunDatatypeBreakAndContinueIn(what string, s ast.State
 	}
 	switch s := s.(type) {
 	case *ast.BreakStatement:
-		return newErr(s.Tok.Line, s.Tok.Col, "break is not allowed inside %ss", what)
+		return newErr("A071", s.Tok.Line, s.Tok.Col, "break is not allowed inside %ss", what)
 	case *ast.ContinueStatement:
-		return newErr(s.Tok.Line, s.Tok.Col, "continue is not allowed inside %ss", what)
+		return newErr("A072", s.Tok.Line, s.Tok.Col, "continue is not allowed inside %ss", what)
 	}
 	return nil
 }
@@ -1051,7 +1422,7 @@ func (a *Analyzer) illegalFunDatatypeBreakAndContinueIn(what string, s ast.State
 func (a *Analyzer) typecheckBlock(s *ast.BlockStatement, returnWanted *returnWanted) *IRBlock {
 	a.env.EnterScope()
 	defer a.env.ExitScope()
-	ir := &IRBlock{}
+	ir := &IRBlock{Node: nodeOf(s)}
 	for _, v := range s.Stmts {
 		if err := a.returnCountAndTypeMustMatch(v, returnWanted); err != nil {
 			a.pushErr(err)
@@ -1069,10 +1440,9 @@ func (a *Analyzer) typecheckBlock(s *ast.BlockStatement, returnWanted *returnWan
 }
 
 func (a *Analyzer) typecheckLoop(s *ast.LoopStatement, returnWanted *returnWanted) *IRLoop {
-	ir := &IRLoop{}
-	boolType := NewType(TypeBool, s.Tok.Line, s.Tok.Col)
+	ir := &IRLoop{Node: nodeOf(s)}
 	cond := s.Cond
-	if err := a.match(cond, boolType); err != nil {
+	if err := a.match(cond, types.Bool); err != nil {
 		a.pushErr(err)
 		return nil
 	}
@@ -1097,27 +1467,19 @@ func (a *Analyzer) typecheckFunDecl(s *ast.FunctionDeclarationStatement) *IRFunc
 	a.env.EnterScope()
 	defer a.env.ExitScope()
 	defer func() { a.seenReturn = false }()
-	ir := &IRFunction{Name: s.Name.String(), TakesCount: len(s.Params), ReturnsCount: len(s.ReturnTypes)}
+	ir := &IRFunction{Node: nodeOf(s), Name: s.Name.String(), TakesCount: len(s.Params), ReturnsCount: len(s.ReturnTypes)}
 	for _, v := range s.Params {
 		ir.ParamNames = append(ir.ParamNames, v.Name.String())
-		ir.Takes = append(ir.Takes, fnParamTypeRepr(v))
-		param := &IRVariable{Name: v.Name.String()} // value is non-significant.
-		if v.IsList {
-			param.Type = TypeList(v.TypeOfList.Literal)
-		} else {
-			param.Type = v.Tok.Literal
-		}
-		if err := a.env.AddVar(param.Name, param.Type); err != nil {
-			a.errorf(v.Tok.Line, v.Tok.Col, "duplicate parameter '%s' name in function '%s'", param.Name, ir.Name)
+		ir.Takes = append(ir.Takes, a.declType(v.Type()))
+		param := &IRVariable{Name: v.Name.String(), Type: ir.Takes[len(ir.Takes)-1]} // value is non-significant.
+		if err := a.env.AddParam(param.Name, param.Type); err != nil {
+			a.errorf("A073", v.Tok.Line, v.Tok.Col, "duplicate parameter '%s' name in function '%s'", param.Name, ir.Name)
 			return nil
 		}
+		a.declareVar(v.Name, param.Type)
 	}
 	for _, v := range s.ReturnTypes {
-		if v.IsList {
-			ir.Returns = append(ir.Returns, TypeList(v.TypeOfList.Literal))
-			continue
-		}
-		ir.Returns = append(ir.Returns, v.Tok.Literal)
+		ir.Returns = append(ir.Returns, a.declType(v.Type()))
 	}
 	for _, v := range s.Stmts {
 		returnWanted := &returnWanted{count: ir.ReturnsCount, types: ir.Returns}
@@ -1127,7 +1489,7 @@ func (a *Analyzer) typecheckFunDecl(s *ast.FunctionDeclarationStatement) *IRFunc
 			if ir.ReturnsCount == 0 && lenReturn > 0 {
 				// the function wasn't supposed to return anything, but we have got a return statement
 				// here.
-				a.errorf(r.Tok.Line, r.Tok.Col, "unwanted return value in function '%s'", ir.Name)
+				a.errorf("A074", r.Tok.Line, r.Tok.Col, "unwanted return value in function '%s'", ir.Name)
 				return nil
 			}
 			if err := returnWanted.checkCountError(r.Tok.Line, r.Tok.Col, lenReturn); err != nil {
@@ -1136,8 +1498,7 @@ func (a *Analyzer) typecheckFunDecl(s *ast.FunctionDeclarationStatement) *IRFunc
 			}
 			// equal
 			for i, v := range r.ReturnValues {
-				retType := NewType(ir.Returns[i], s.Tok.Line, s.Tok.Col)
-				if err := a.match(v, retType); err != nil {
+				if err := a.match(v, ir.Returns[i]); err != nil {
 					a.pushErr(err)
 				}
 			}
@@ -1151,22 +1512,32 @@ func (a *Analyzer) typecheckFunDecl(s *ast.FunctionDeclarationStatement) *IRFunc
 			ir.Block = append(ir.Block, stmt)
 		}
 	}
-	if !(a.seenReturn) && ir.ReturnsCount > 0 {
-		a.errorf(s.Tok.Line, s.Tok.Col, "missing return statement")
+	// a statement that failed to parse may be the return statement
+	if !(a.seenReturn) && ir.ReturnsCount > 0 && !(hasBadStatement(s.Stmts)) {
+		a.errorf("A075", s.Tok.Line, s.Tok.Col, "missing return statement")
 	}
 	return ir
 }
 
+func hasBadStatement(stmts []ast.Statement) bool {
+	for _, v := range stmts {
+		if _, ok := v.(*ast.BadStatement); ok {
+			return true
+		}
+	}
+	return false
+}
+
 type returnWanted struct {
 	count int
-	types []string
+	types []types.Type
 }
 
 func (r *returnWanted) checkCountError(line, col uint, gotCount int) error {
 	if r.count < gotCount {
-		return newErr(line, col, "excessive return value (want=%d got=%d)", r.count, gotCount)
+		return newErr("A076", line, col, "excessive return value (want=%d got=%d)", r.count, gotCount)
 	} else if r.count > gotCount {
-		return newErr(line, col, "missing return value (want=%d got=%d)", r.count, gotCount)
+		return newErr("A077", line, col, "missing return value (want=%d got=%d)", r.count, gotCount)
 	}
 	return nil
 }
@@ -1174,90 +1545,76 @@ func (r *returnWanted) checkCountError(line, col uint, gotCount int) error {
 func (r *returnWanted) checkTypeError(a *Analyzer, line, col uint, vals []ast.Expr) error {
 	// counts are equal. guaranteed.
 	for i := 0; i < len(vals); i++ {
-		val := vals[i]
-		typ := r.types[i]
-		typType := NewType(typ, line, col)
-		if err := a.match(val, typType); err != nil {
+		if err := a.match(vals[i], r.types[i]); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
+// the types of the arguments of a call. a call returning many values can be
+// the only argument of another call; like in Go.
+func (a *Analyzer) argTypes(args []ast.Expr) ([]types.Type, error) {
+	var res []types.Type
+	for _, v := range args {
+		t, err := a.infer(v)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, t)
+	}
+	if len(res) == 1 {
+		return values(res[0]), nil
+	}
+	return res, nil
+}
+
 func (a *Analyzer) typecheckFunCall(s *ast.FunctionCall) *IRFunctionCall {
 	fnName := s.Ident.String()
-	fn := a.env.GetFunc(fnName)
+	fn, v := a.callee(s.Ident)
 	if fn == nil {
-		a.errorf(s.Tok.Line, s.Tok.Col, "invoking of non-existent function '%s'", fnName)
+		a.pushErr(a.notAFunction("A078", s.Ident))
 		return nil
 	}
-	ir := &IRFunctionCall{Name: fnName}
+	ir := &IRFunctionCall{Node: nodeOf(s), Name: fnName, Value: v}
 	if fn.ReturnsCount > 0 {
-		a.errorf(s.Tok.Line, s.Tok.Col, "unused value from function call '%s'", fnName)
+		a.errorf("A079", s.Tok.Line, s.Tok.Col, "unused value from function call '%s'", fnName)
 		return nil
 	}
 	switch fn.TakesCount {
 	case 0:
 		if len(s.Args) > 0 {
-			a.errorf(s.Tok.Line, s.Tok.Col, "function '%s' takes no arguments", fnName)
+			a.errorf("A080", s.Tok.Line, s.Tok.Col, "function '%s' takes no arguments", fnName)
 			return nil
 		}
 	default:
 		lenArgs := len(s.Args)
 		if lenArgs == 0 {
-			a.errorf(s.Tok.Line, s.Tok.Col, "insufficient number of arguments to function '%s' (want=%d got=%d)", fnName, fn.TakesCount, lenArgs)
+			a.errorf("A081", s.Tok.Line, s.Tok.Col, "insufficient number of arguments to function '%s' (want=%d got=%d)", fnName, fn.TakesCount, lenArgs)
 			return nil
 		}
-		// build arg chain
-		firstArg, err := a.infer(s.Args[0])
+		args, err := a.argTypes(s.Args)
 		if err != nil {
 			a.pushErr(err)
 			return nil
 		}
-		orig := firstArg
-		for i := 1; i < len(s.Args); i++ {
-			next, err := a.infer(s.Args[i])
-			if err != nil {
-				a.pushErr(err)
-				return nil
-			}
-			firstArg.setNext(next)
-			firstArg = next
-		}
-		// build parameter chain
-		param := NewType(fn.Takes[0], s.Tok.Line, s.Tok.Col)
-		origParam := param
-		for i := 1; i < len(fn.Takes); i++ {
-			next := NewType(fn.Takes[i], s.Tok.Line, s.Tok.Col)
-			param.setNext(next)
-			param = next
-		}
-		// this could've been slightly more efficient if we stored the length attribute of the linked list.
-		// but it is not that important because the users won't pass thousands of arguments.
-		// its only downside is the existence of the 6-lines-long code snippet below.
-		lenArgTypes := 1
-		argHead := orig
-		for argHead.next != nil {
-			lenArgTypes++
-			argHead = argHead.next
-		}
-		if err := a.matchTypes(origParam, orig); err != nil {
-			/* there are better ways. this is tightly-coupled to the implementation. */
-			if strings.HasPrefix(err.Error(), "unused") {
-				a.errorf(s.Tok.Line, s.Tok.Col, "excessive number of arguments passed to function call '%s' (want=%d got=%d)", fnName, fn.TakesCount, lenArgTypes)
-			} else if strings.HasPrefix(err.Error(), "mismatched") {
-				a.errorf(s.Tok.Line, s.Tok.Col, "wrong type of argument passed to function '%s'", fnName)
-			} else if strings.HasPrefix(err.Error(), "value ") {
-				a.errorf(s.Tok.Line, s.Tok.Col, "insufficient number of arguments passed to function call '%s' (want=%d got=%d)", fnName, fn.TakesCount, lenArgTypes)
-			} else {
+		if err := a.matchTypes(s.Tok.Line, s.Tok.Col, fn.Takes, args); err != nil {
+			switch err.(Err).Code {
+			case "A012":
+				a.errorf("A082", s.Tok.Line, s.Tok.Col, "excessive number of arguments passed to function call '%s' (want=%d got=%d)", fnName, fn.TakesCount, len(args))
+			case "A014":
+				a.errorf("A083", s.Tok.Line, s.Tok.Col, "wrong type of argument passed to function '%s'", fnName)
+			case "A013":
+				a.errorf("A084", s.Tok.Line, s.Tok.Col, "insufficient number of arguments passed to function call '%s' (want=%d got=%d)", fnName, fn.TakesCount, len(args))
+			default:
 				a.pushErr(err)
 			}
 			return nil
 		}
 	}
 	ir.Returns = fn.Returns
-	for _, v := range s.Args {
-		ir.Takes = append(ir.Takes, a.toIrExpr(v))
+	for i, v := range s.Args {
+		ir.Takes = append(ir.Takes, a.toIrExpr(v, fn.Takes[i]))
 	}
 	ir.ReturnsCount = len(ir.Returns)
 	ir.TakesCount = len(ir.Takes)
@@ -1268,106 +1625,84 @@ func (a *Analyzer) typecheckFunCallFromNamespace(s *ast.FunctionCallFromNamespac
 	// very similar to the above function.
 	fnName := s.Function.Ident.String()
 	ns := s.Namespace.Tok.Literal
-	fn := a.std.GetFunc(ns, fnName)
+	fn := a.stdFunc(ns, fnName)
 	line, col := s.Function.Tok.Line, s.Function.Tok.Col
 	if fn == nil {
-		a.errorf(line, col, "invoking of non-existent function '%s::%s'", ns, fnName)
+		a.errorf("A085", line, col, "invoking of non-existent function '%s::%s'", ns, fnName)
 		return nil
 	}
-	ir := &IRFunctionCallFromNamespace{Namespace: ns, IRFunctionCall: IRFunctionCall{Name: fnName}}
+	ir := &IRFunctionCallFromNamespace{Namespace: ns, IRFunctionCall: IRFunctionCall{Node: nodeOf(s), Name: fnName}}
 	if fn.ReturnsCount > 0 {
-		a.errorf(line, col, "unused value from function call '%s::%s'", ns, fnName)
+		a.errorf("A086", line, col, "unused value from function call '%s::%s'", ns, fnName)
 		return nil
 	}
 	switch fn.TakesCount {
 	case 0:
 		if len(s.Function.Args) > 0 {
-			a.errorf(line, col, "function '%s::%s' takes no arguments", ns, fnName)
+			a.errorf("A087", line, col, "function '%s::%s' takes no arguments", ns, fnName)
 			return nil
 		}
 	default:
 		lenArgs := len(s.Function.Args)
 		if lenArgs == 0 {
-			a.errorf(line, col, "insufficient number of arguments to function '%s::%s' (want=%d got=%d)", ns, fnName, fn.TakesCount, lenArgs)
+			a.errorf("A088", line, col, "insufficient number of arguments to function '%s::%s' (want=%d got=%d)", ns, fnName, fn.TakesCount, lenArgs)
 			return nil
 		}
-		// build arg chain
-		firstArg, err := a.infer(s.Function.Args[0])
+		args, err := a.argTypes(s.Function.Args)
 		if err != nil {
 			a.pushErr(err)
 			return nil
 		}
-		orig := firstArg
-		for i := 1; i < len(s.Function.Args); i++ {
-			next, err := a.infer(s.Function.Args[i])
-			if err != nil {
-				a.pushErr(err)
-				return nil
-			}
-			firstArg.setNext(next)
-			firstArg = next
-		}
-		// build parameter chain
-		param := NewType(fn.Takes[0], line, col)
-		origParam := param
-		for i := 1; i < len(fn.Takes); i++ {
-			next := NewType(fn.Takes[i], line, col)
-			param.setNext(next)
-			param = next
-		}
-
-		// [[copy]]
-		// this could've been  more efficient if we stored the length attribute of the linked list.
-		// but it is not that important because the users won't pass thousands of arguments.
-		// its only downside is the existence of the 6-lines-long code snippet below.
-		lenArgTypes := 1
-		argHead := orig
-		for argHead.next != nil {
-			lenArgTypes++
-			argHead = argHead.next
-		}
-		if err := a.matchTypes(origParam, orig); err != nil {
-			/* there are better ways. this is tightly-coupled to the implementation. */
-			if strings.HasPrefix(err.Error(), "unused") {
-				a.errorf(line, col, "excessive number of arguments passed to function call '%s::%s' (want=%d got=%d)", ns, fnName, fn.TakesCount, lenArgTypes)
-			} else if strings.HasPrefix(err.Error(), "mismatched") {
-				a.errorf(line, col, "wrong type of argument passed to function '%s::%s'", ns, fnName)
-			} else if strings.HasPrefix(err.Error(), "value ") {
-				a.errorf(line, col, "insufficient number of arguments passed to function call '%s::%s' (want=%d got=%d)", ns, fnName, fn.TakesCount, lenArgTypes)
-			} else {
+		if err := a.matchTypes(line, col, fn.Takes, args); err != nil {
+			switch err.(Err).Code {
+			case "A012":
+				a.errorf("A089", line, col, "excessive number of arguments passed to function call '%s::%s' (want=%d got=%d)", ns, fnName, fn.TakesCount, len(args))
+			case "A014":
+				a.errorf("A090", line, col, "wrong type of argument passed to function '%s::%s'", ns, fnName)
+			case "A013":
+				a.errorf("A091", line, col, "insufficient number of arguments passed to function call '%s::%s' (want=%d got=%d)", ns, fnName, fn.TakesCount, len(args))
+			default:
 				a.pushErr(err)
 			}
 			return nil
 		}
 	}
 	ir.Returns = fn.Returns
-	for _, v := range s.Function.Args {
-		ir.Takes = append(ir.Takes, a.toIrExpr(v))
+	for i, v := range s.Function.Args {
+		ir.Takes = append(ir.Takes, a.toIrExpr(v, fn.Takes[i]))
 	}
 	ir.ReturnsCount = len(ir.Returns)
 	ir.TakesCount = len(ir.Takes)
 	return ir
 }
 
-func (a *Analyzer) produceReturnIR(s *ast.ReturnStatement) *IRReturn {
-	ir := &IRReturn{}
-	for _, v := range s.ReturnValues {
-		ir.ReturnValues = append(ir.ReturnValues, a.toIrExpr(v))
+func (a *Analyzer) produceReturnIR(s *ast.ReturnStatement, returnWanted *returnWanted) *IRReturn {
+	ir := &IRReturn{Node: nodeOf(s)}
+	for i, v := range s.ReturnValues {
+		// its declaration is reported
+		if d, ok := v.(*ast.Identifier); ok && a.env.IsFailedVar(d.Tok.Literal) {
+			return nil
+		}
 		t, err := a.infer(v)
 		if err != nil {
 			a.pushErr(err)
 			return nil
 		}
-		ir.ReturnTypes = append(ir.ReturnTypes, t.typ)
+		// an empty list has the type of the function's return value
+		if returnWanted != nil && i < len(returnWanted.types) {
+			t = returnWanted.types[i]
+		}
+		ir.ReturnValues = append(ir.ReturnValues, a.toIrExpr(v, t))
+		ir.ReturnTypes = append(ir.ReturnTypes, t)
 	}
 	ir.ReturnCount = len(s.ReturnValues)
 	return ir
 }
 
 func (a *Analyzer) produceBreakIR(s *ast.BreakStatement) *IRBreak {
-	return &IRBreak{}
+	return &IRBreak{Node: nodeOf(s)}
 }
 
 func (a *Analyzer) produceContinueIR(s *ast.ContinueStatement) *IRContinue {
-	return &IRContinue{}
+	return &IRContinue{Node: nodeOf(s)}
 }
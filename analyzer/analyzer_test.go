@@ -5,6 +5,11 @@ import (
 	"os"
 	"quoi/lexer"
 	"quoi/parser"
+	"quoi/token"
+	"quoi/types"
+	"reflect"
+	"sort"
+	"strings"
 	"testing"
 )
 
@@ -261,6 +266,32 @@ func TestSubseq1(t *testing.T) {
 	_ = program
 }
 
+func TestSubseq2(t *testing.T) {
+	input := `
+		fun f() -> int, string { return 1, "one". }
+		int a, string b, int c = f(), 5.
+		int d, int e, int g = f(), 5.
+		`
+	a := _new(input)
+	program := a.Analyze()
+	if len(a.Errs) != 1 || a.Errs[0].Line != 4 {
+		t.Errorf("expected 1 error on line 4, got %d", len(a.Errs))
+	}
+	for _, v := range a.Errs {
+		t.Logf("Analyzer err : %d:%d -- %s\n", v.Line, v.Column, v.Msg)
+	}
+	ir, ok := program.Stmts[1].(*IRSubseq)
+	if !(ok) {
+		t.Fatalf("expected *IRSubseq, got %T", program.Stmts[1])
+	}
+	if len(ir.Names) != 3 || len(ir.Values) != 2 {
+		t.Errorf("wrong subseq: %s", ir)
+	}
+	if typ := a.env.GetVar("b"); typ != types.String {
+		t.Errorf("expected b to be 'string', got '%s'", typ)
+	}
+}
+
 func TestReas1(t *testing.T) {
 	input := `
 		int x = 1.
@@ -723,3 +754,586 @@ func TestOps3(t *testing.T) {
 	}
 	fmt.Println(program)
 }
+
+func TestBadStatement(t *testing.T) {
+	input := `
+		int x = .
+		int y = x.
+		string z = 4.
+	`
+	p := parser.New(lexer.New(input))
+	program := p.Parse()
+	if len(p.Errs) != 1 {
+		t.Fatalf("expected 1 parser error, got %d", len(p.Errs))
+	}
+	a := New(program)
+	a.Analyze()
+	for _, v := range a.Errs {
+		t.Logf("analyzer err: %d:%d -- %s\n", v.Line, v.Column, v.Msg)
+	}
+	// 'int y = x.' must not be reported, because x is declared by the bad statement.
+	if len(a.Errs) != 1 || a.Errs[0].Line != 4 {
+		t.Errorf("expected 1 analyzer error on line 4, got %d", len(a.Errs))
+	}
+}
+
+// a bad statement in a function body doesn't cause errors about the return statement
+func TestBadStatementInFunction(t *testing.T) {
+	inputs := []string{
+		"fun f(int a) -> int {\n\treturn (* a 2)\n}",
+		"fun f(int a) -> int {\n\tint b = (* a 2.\n\treturn b.\n}",
+		"fun f(int a) -> int {\n\tint b = (* a 2.\n\tif true {\n\t\treturn b.\n\t}\n\treturn a.\n}",
+	}
+	for _, input := range inputs {
+		p := parser.New(lexer.New(input))
+		program := p.Parse()
+		if len(p.Errs) != 1 {
+			t.Fatalf("%q: expected 1 parser error, got %d", input, len(p.Errs))
+		}
+		a := New(program)
+		if a.Analyze(); len(a.Errs) > 0 {
+			t.Errorf("%q: unexpected analyzer errors: %v", input, a.Errs)
+		}
+	}
+}
+
+func TestInfo(t *testing.T) {
+	input := `datatype User {
+	string name
+}
+fun f(int a, User u) -> int {
+	int b = (+ a 1).
+	block
+		int a = 5.
+		b = a.
+	end
+	return (+ a b).
+}
+listof int xs = [f(1, User{name="x"})].
+Stdout::println(String::from_int(('xs 0))).
+`
+	a := _new(input)
+	a.Info = NewInfo()
+	a.Analyze()
+	if len(a.Errs) > 0 {
+		t.Fatalf("unexpected errors: %v", a.Errs)
+	}
+	// line, col of an identifier -> its declaration
+	tests := []struct {
+		line, col uint
+		name      string
+		kind      SymbolKind
+		declLine  uint
+		typ       string
+	}{
+		{4, 14, "User", SymbolDatatype, 1, "datatype User {\n    string name\n}"},
+		{5, 13, "a", SymbolVar, 4, "int"},
+		{8, 3, "b", SymbolVar, 5, "int"},
+		{8, 7, "a", SymbolVar, 7, "int"},
+		{10, 12, "a", SymbolVar, 4, "int"},
+		{12, 18, "f", SymbolFunc, 4, "fun f(int a, User u) -> int"},
+		{12, 23, "User", SymbolDatatype, 1, "datatype User {\n    string name\n}"},
+		{13, 25, "String::from_int", SymbolFunc, 0, "fun String::from_int(int n) -> string"},
+		{13, 36, "xs", SymbolVar, 12, "listof int"},
+	}
+	for _, tt := range tests {
+		var sym *Symbol
+		for span, v := range a.Info.Uses {
+			if span.Start.Line == tt.line && span.Start.Col == tt.col {
+				sym = v
+			}
+		}
+		if sym == nil {
+			t.Errorf("%d:%d: no symbol", tt.line, tt.col)
+			continue
+		}
+		if sym.Name != tt.name || sym.Kind != tt.kind || sym.Decl.Start.Line != tt.declLine || sym.Type != tt.typ {
+			t.Errorf("%d:%d: wrong symbol %+v", tt.line, tt.col, sym)
+		}
+		if tt.declLine > 0 && a.Info.Defs[sym.Decl] != sym {
+			t.Errorf("%d:%d: declaration of %s isn't in Defs", tt.line, tt.col, sym.Name)
+		}
+	}
+	var got []string
+	for span, t := range a.Info.Types {
+		if span.Start.Line == 12 {
+			got = append(got, fmt.Sprint(span.Start.Col, " ", t))
+		}
+	}
+	sort.Strings(got)
+	if want, got := "17 listof int, 18 int, 20 int, 23 User, 33 string", strings.Join(got, ", "); want != got {
+		t.Errorf("wrong types on line 12\nwant=%s\ngot= %s", want, got)
+	}
+}
+
+func TestParams(t *testing.T) {
+	input := `
+		int n = 1.
+		fun f(int n, int m) {
+			n = (+ n m).
+			block
+				int m = 2.
+				m = n.
+			end
+		}
+		n = 2.
+	`
+	a := _new(input)
+	prg := a.Analyze()
+	if len(a.Errs) > 0 {
+		t.Fatalf("unexpected errors: %v", a.Errs)
+	}
+	fn := prg.Stmts[1].(*IRFunction)
+	r1 := fn.Block[0].(*IRReassigment)
+	ops := r1.NewValue.(*IRPrefExpr).Operands
+	r2 := fn.Block[1].(*IRBlock).Stmts[1].(*IRReassigment)
+	r3 := prg.Stmts[2].(*IRReassigment)
+	for _, tt := range []struct {
+		what        string
+		param, want bool
+	}{
+		{"assignment to a parameter", r1.Param, true},
+		{"reference to a parameter", ops[0].(*IRVariableReference).Param, true},
+		{"reference to another parameter", ops[1].(*IRVariableReference).Param, true},
+		{"assignment to a local shadowing a parameter", r2.Param, false},
+		{"reference to a parameter in a block", r2.NewValue.(*IRVariableReference).Param, true},
+		{"assignment to a global", r3.Param, false},
+	} {
+		if tt.param != tt.want {
+			t.Errorf("%s: want Param=%v", tt.what, tt.want)
+		}
+	}
+}
+
+func TestPositions(t *testing.T) {
+	input := `datatype User {
+	string name
+}
+fun f(int a, User u) -> int, bool {
+	if (= a 0) {
+		return 1, true.
+	} elseif (= a 1) {
+		return 2, true.
+	} else {
+		int b, bool c = f((- a 1), u).
+	}
+	loop (lt a 3) {
+		a = (+ a 1).
+		if (= a 2) {
+			continue.
+		}
+		break.
+	}
+	block
+		string n = (get u name).
+	end
+	return (' [a] 0), (gt a 0).
+}
+listof User us = [User{name="x"}].
+Stdout::println(String::from_int(1)).
+`
+	a := _new(input)
+	prg := a.Analyze()
+	if len(a.Errs) > 0 {
+		t.Fatalf("unexpected errors: %v", a.Errs)
+	}
+	// every node comes from the source
+	seen := map[string]bool{}
+	var walk func(v reflect.Value)
+	walk = func(v reflect.Value) {
+		switch v.Kind() {
+		case reflect.Ptr, reflect.Interface:
+			if !(v.IsNil()) {
+				walk(v.Elem())
+			}
+		case reflect.Slice:
+			for i := 0; i < v.Len(); i++ {
+				walk(v.Index(i))
+			}
+		case reflect.Map:
+			for _, k := range v.MapKeys() {
+				walk(v.MapIndex(k))
+			}
+		case reflect.Struct:
+			if n, ok := v.Addr().Interface().(interface{ Pos() token.Pos }); ok && v.Type() != reflect.TypeOf(Node{}) {
+				seen[v.Type().Name()] = true
+				if n.Pos().Line == 0 {
+					t.Errorf("%s has no position", v.Type().Name())
+				}
+			}
+			for i := 0; i < v.NumField(); i++ {
+				walk(v.Field(i))
+			}
+		}
+	}
+	for _, s := range prg.Stmts {
+		walk(reflect.ValueOf(s))
+	}
+	if len(seen) < 20 {
+		t.Errorf("expected every kind of node, got %v", seen)
+	}
+	tests := []struct {
+		node      interface{ Pos() token.Pos }
+		line, col uint
+	}{
+		{prg.Stmts[0].(*IRDatatype).Fields[0], 2, 2},
+		{prg.Stmts[1].(*IRFunction).Block[0].(*IRIf).Cond, 5, 5},
+		{prg.Stmts[2].(*IRVariable).Value.(*IRList).Value[0], 24, 19},
+		{prg.Stmts[3].(*IRFunctionCallFromNamespace).Takes[0].(*IRFunctionCallFromNamespace).Takes[0], 25, 34},
+	}
+	for i, tt := range tests {
+		if pos := tt.node.Pos(); pos.Line != tt.line || pos.Col != tt.col {
+			t.Errorf("%d: wrong position %d:%d, want %d:%d", i, pos.Line, pos.Col, tt.line, tt.col)
+		}
+	}
+}
+
+func TestSumTypes(t *testing.T) {
+	input := `
+		datatype Shape = Circle { int r } | Rect { int w int h }
+		fun area(Shape s) -> int {
+			match s {
+				Circle c {
+					return (* 3 (get c r) (get c r)).
+				}
+				else {
+					return 0.
+				}
+			}
+		}
+		Shape s = Circle{r=1}.
+		s = Rect{w=1 h=2}.
+		match s {
+			Circle { }
+			Rect r {
+				int w = (get r w).
+			}
+		}
+	`
+	a := _new(input)
+	prg := a.Analyze()
+	if len(a.Errs) > 0 {
+		t.Fatalf("unexpected errors: %v", a.Errs)
+	}
+	dt := prg.Stmts[0].(*IRDatatype)
+	if len(dt.Variants) != 2 || dt.Variants[1].Name != "Rect" || dt.Variants[1].FieldCount != 2 {
+		t.Fatalf("wrong sum type: %s", dt)
+	}
+	for _, v := range dt.Type.Variants {
+		if v.Sum != dt.Type {
+			t.Errorf("%s: want Sum=%s, got %v", v, dt.Type, v.Sum)
+		}
+	}
+	// a literal of a variant is a value of the sum type
+	if typ := prg.Stmts[2].(*IRVariable).Type; !(types.Identical(typ, dt.Type)) {
+		t.Errorf("want type %s, got %s", dt.Type, typ)
+	}
+	m := prg.Stmts[4].(*IRMatch)
+	if len(m.Arms) != 2 || m.Arms[0].Name != "" || m.Arms[1].Name != "r" || m.Arms[1].Variant.Name != "Rect" {
+		t.Errorf("wrong match: %s", m)
+	}
+}
+
+func TestSumTypeErrors(t *testing.T) {
+	decls := `
+		datatype Shape = Circle { int r } | Rect { int w int h }
+		Shape s = Circle{r=1}.
+	`
+	tests := []struct {
+		input, code string
+	}{
+		{"Shape t = Shape{}.", "A094"},
+		{"int n = 1.\nmatch n { else { } }", "A095"},
+		{"match s { Circle { } Square { } }", "A096"},
+		{"match s { Circle { } Circle { } Rect { } }", "A097"},
+		{"datatype L = Cons { int head L tail } | Nil", "A098"},
+		{"datatype T = A { U u } | B\ndatatype U {\nT t\n}", "A098"},
+		{"match s { Circle c { int c = 1. } Rect { } }", "A065"},
+		{"match s { Circle { } }", "A100"},
+		{"datatype Circle {}", "A002"},
+		{"datatype S = A | A", "A113"},
+		{"datatype S = A { int x int x }", "A070"},
+		{"Circle c = Circle{r=1}.", "A019"},
+	}
+	for _, tt := range tests {
+		a := _new(decls + tt.input)
+		a.Analyze()
+		if len(a.Errs) == 0 || a.Errs[0].Code != tt.code {
+			t.Errorf("%q: want error %s, got %v", tt.input, tt.code, a.Errs)
+		}
+	}
+	// else makes a match exhaustive
+	a := _new(decls + "match s { Circle { } else { } }")
+	if a.Analyze(); len(a.Errs) > 0 {
+		t.Errorf("unexpected errors: %v", a.Errs)
+	}
+}
+
+// a datatype can't contain itself; except through a variant that isn't the first, or a function
+func TestRecursiveDatatypes(t *testing.T) {
+	tests := []struct {
+		input, code string
+	}{
+		{"datatype U {\n\tint a\n\tU next\n}\nU u = U{a=1}.", "A111"},
+		{"datatype A {\n\tB b\n}\ndatatype B {\n\tint n\n\tA a\n}", "A111"},
+		{"datatype T = L | N { N n }", "A112"},
+		{"datatype T = L | N { M m }\ndatatype M {\n\tN n\n}", "A112"},
+	}
+	for _, tt := range tests {
+		a := _new(tt.input)
+		a.Analyze()
+		if len(a.Errs) == 0 || a.Errs[0].Code != tt.code {
+			t.Errorf("%q: want error %s, got %v", tt.input, tt.code, a.Errs)
+		}
+	}
+	for _, input := range []string{
+		"datatype Tree = Leaf | Node { int v Tree left Tree right }",
+		"datatype U {\n\tfun(U) -> U f\n}",
+	} {
+		a := _new(input)
+		if a.Analyze(); len(a.Errs) > 0 {
+			t.Errorf("%q: unexpected errors: %v", input, a.Errs)
+		}
+	}
+}
+
+func TestEnums(t *testing.T) {
+	input := `
+		enum Color { Red Green Blue }
+		datatype Pixel {
+			Color color
+		}
+		fun is_red(Color c) -> bool {
+			return (= c Color::Red).
+		}
+		Color c = Color::Blue.
+		string name = String::from_Color(c).
+		listof Color all = Color::members().
+		Pixel p = Pixel{color=Color::Green}.
+	`
+	a := _new(input)
+	prg := a.Analyze()
+	if len(a.Errs) > 0 {
+		t.Fatalf("unexpected errors: %v", a.Errs)
+	}
+	e := prg.Stmts[0].(*IREnum)
+	if e.Name != "Color" || len(e.Type.Members) != 3 || e.Type.Member("Blue") != 2 {
+		t.Fatalf("wrong enum: %s", e)
+	}
+	m, ok := prg.Stmts[3].(*IRVariable).Value.(*IREnumMember)
+	if !(ok) || m.Type != e.Type || m.Name != "Blue" || m.Index != 2 {
+		t.Errorf("wrong member: %s", prg.Stmts[3].(*IRVariable).Value)
+	}
+	if n, ok := prg.Stmts[4].(*IRVariable).Value.(*IREnumName); !(ok) || n.Type != e.Type {
+		t.Errorf("wrong conversion to string: %s", prg.Stmts[4].(*IRVariable).Value)
+	}
+	l, ok := prg.Stmts[5].(*IRVariable).Value.(*IRList)
+	if !(ok) || len(l.Value) != 3 || l.Value[1].(*IREnumMember).Name != "Green" {
+		t.Errorf("wrong members: %s", prg.Stmts[5].(*IRVariable).Value)
+	}
+}
+
+func TestEnumErrors(t *testing.T) {
+	decls := `
+		enum Color { Red Green Blue }
+		enum Size { Small Large }
+		Color c = Color::Red.
+	`
+	tests := []struct {
+		input, code string
+	}{
+		// enums don't mix with ints, or with each other
+		{"int n = Color::Red.", "A106"},
+		{"Color d = 1.", "A016"},
+		{"Color d = Size::Small.", "A106"},
+		{"c = Size::Large.", "A106"},
+		{"bool b = (= c 0).", "A048"},
+		{"bool b = (= c Size::Small).", "A048"},
+		{"bool b = (lt c Color::Blue).", "A048"},
+		{"int n = (+ c 1).", "A050"},
+		{"Color d = Shade::Red.", "A104"},
+		{"Color d = Color::Purple.", "A105"},
+		{"string s = String::from_Color(1).", "A025"},
+		{"string s = String::from_Size(c).", "A025"},
+		{"listof Color l = Size::members().", "A029"},
+		{"enum Color { A }", "A114"},
+		{"datatype Color {}", "A002"},
+		{"enum S { A B A }", "A102"},
+		{"enum Math { A }", "A103"},
+		{"block\nenum E { A }\nend", "A101"},
+		{"fun f() {\nenum E { A }\n}", "A101"},
+	}
+	for _, tt := range tests {
+		a := _new(decls + tt.input)
+		a.Analyze()
+		if len(a.Errs) == 0 || a.Errs[0].Code != tt.code {
+			t.Errorf("%q: want error %s, got %v", tt.input, tt.code, a.Errs)
+		}
+	}
+}
+
+func TestConsts(t *testing.T) {
+	input := `
+		enum Color { Red Green }
+		const int MINUTE = 60.
+		const int HOUR = (* MINUTE 60).
+		const string GREETING = (+ "hello, " "world").
+		const bool BIG = (not (lt HOUR 1000)).
+		const Color DEFAULT = Color::Green.
+		int x = 5.
+		const int Y = (+ x 1).
+		const listof int XS = [1, 2].
+	`
+	a := _new(input)
+	prg := a.Analyze()
+	if len(a.Errs) > 0 {
+		t.Fatalf("unexpected errors: %v", a.Errs)
+	}
+	tests := []struct {
+		stmt int
+		want IRExpression
+	}{
+		{1, &IRInt{Value: "60"}},
+		{2, &IRInt{Value: "3600"}},
+		{3, &IRString{Value: "hello, world"}},
+		{4, &IRBoolean{Value: "true"}},
+		{5, &IREnumMember{Type: &types.Enum{Name: "Color"}, Name: "Green"}},
+	}
+	for _, tt := range tests {
+		v := prg.Stmts[tt.stmt].(*IRVariable)
+		if !(v.Const) || v.Value.String() != tt.want.String() {
+			t.Errorf("%s: want the constant %s, got %s", v.Name, tt.want, v.Value)
+		}
+	}
+	// values that aren't known at compile time are left as they are
+	if v := prg.Stmts[7].(*IRVariable); !(v.Const) {
+		t.Errorf("%s isn't a constant", v.Name)
+	} else if _, ok := v.Value.(*IRPrefExpr); !(ok) {
+		t.Errorf("%s: expected an expression, got %s", v.Name, v.Value)
+	}
+	if v := prg.Stmts[8].(*IRVariable); !(v.Const) {
+		t.Errorf("%s isn't a constant", v.Name)
+	}
+}
+
+func TestConstErrors(t *testing.T) {
+	decls := `
+		datatype P {
+			int x
+		}
+		const int N = 1.
+		const P p = P{x=1}.
+	`
+	tests := []struct {
+		input, code string
+	}{
+		{"N = 2.", "A107"},
+		{"fun f() {\nN = 2.\n}", "A107"},
+		{"P q = (set p x 2).", "A108"},
+		{"const int M = (/ N 0).", "A109"},
+		{"const int M = (/ N (- N 1)).", "A109"},
+		{"const string S = N.", "A032"},
+		{"const int N = 2.", "A065"},
+		{"int a, int N = 1, 2.", "A115"},
+	}
+	for _, tt := range tests {
+		a := _new(decls + tt.input)
+		a.Analyze()
+		if len(a.Errs) == 0 || a.Errs[0].Code != tt.code {
+			t.Errorf("%q: want error %s, got %v", tt.input, tt.code, a.Errs)
+		}
+	}
+	// a constant can be shadowed by a variable
+	a := _new(decls + "fun f() {\nint N = 2.\nN = 3.\n}")
+	a.Analyze()
+	if len(a.Errs) > 0 {
+		t.Errorf("unexpected errors: %v", a.Errs)
+	}
+}
+
+func TestFuncValues(t *testing.T) {
+	input := `
+		fun add(int a, int b) -> int {
+			return (+ a b).
+		}
+		fun apply(fun(int, int) -> int f, int a, int b) -> int {
+			return f(a, b).
+		}
+		datatype Op {
+			fun(int, int) -> int run
+		}
+		fun(int, int) -> int f = add.
+		int x = f(1, 2).
+		int y = apply(add, 3, 4).
+		listof fun(int, int) -> int ops = [add, f].
+		Op op = Op{run=add}.
+	`
+	a := _new(input)
+	prg := a.Analyze()
+	if len(a.Errs) > 0 {
+		t.Fatalf("unexpected errors: %v", a.Errs)
+	}
+	fn := &types.Func{Params: []types.Type{types.Int, types.Int}, Returns: []types.Type{types.Int}}
+	f := prg.Stmts[3].(*IRVariable)
+	if !(types.Identical(f.Type, fn)) {
+		t.Errorf("f: expected '%s', got '%s'", fn, f.Type)
+	}
+	if ref, ok := f.Value.(*IRFunctionReference); !(ok) || ref.Name != "add" || !(types.Identical(ref.Type, fn)) {
+		t.Errorf("f: expected a reference to add, got %s", f.Value)
+	}
+	// a call of a variable
+	call := prg.Stmts[4].(*IRVariable).Value.(*IRFunctionCall)
+	if call.Value == nil || call.Value.Name != "f" || call.ReturnsCount != 1 {
+		t.Errorf("x: expected a call of the value of f, got %s", call)
+	}
+	// a call of a function
+	if call := prg.Stmts[5].(*IRVariable).Value.(*IRFunctionCall); call.Value != nil {
+		t.Errorf("y: expected a call of apply, got a call of a value")
+	}
+	// a call of a parameter
+	ret := prg.Stmts[1].(*IRFunction).Block[0].(*IRReturn)
+	if call := ret.ReturnValues[0].(*IRFunctionCall); call.Value == nil || !(call.Value.Param) {
+		t.Errorf("apply: expected a call of the parameter f, got %s", call)
+	}
+}
+
+func TestFuncValueErrors(t *testing.T) {
+	decls := `
+		fun add(int a, int b) -> int {
+			return (+ a b).
+		}
+		fun less(int a, int b) -> bool {
+			return (lt a b).
+		}
+		int n = 1.
+	`
+	tests := []struct {
+		input, code string
+	}{
+		{"fun(int, int) -> int f = less.", "A032"},
+		{"fun(int) -> int f = add.", "A032"},
+		{"int x = add.", "A032"},
+		{"listof fun(int, int) -> int fs = [add, less].", "A032"},
+		{"n(1).", "A110"},
+		{"int x = n(1).", "A110"},
+		{"fun(int, int) -> int f = add.\nint x = f(1).", "A040"},
+		{"fun(int, int) -> int f = add.\nf(1, 2).", "A079"},
+		{"fun(int, int) -> int f = add.\nbool b = f(1, 2).", "A023"},
+		{"datatype D {\n\tfun(Nope) -> int f\n}", "A069"},
+		{"fun(int) -> string f = String::from_int.", "A116"},
+		{"int x = Math::nope.", "A116"},
+	}
+	for _, tt := range tests {
+		a := _new(decls + tt.input)
+		a.Analyze()
+		if len(a.Errs) == 0 || a.Errs[0].Code != tt.code {
+			t.Errorf("%q: want error %s, got %v", tt.input, tt.code, a.Errs)
+		}
+	}
+	// a variable may have the name of a function
+	a := _new(decls + "fun f() -> int {\n\tint add = add(1, 2).\n\treturn add.\n}\nfun g(int less) {\n}\nint add = 5.")
+	a.Analyze()
+	if len(a.Errs) > 0 {
+		t.Errorf("unexpected errors: %v", a.Errs)
+	}
+}
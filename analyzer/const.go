@@ -0,0 +1,138 @@
+package analyzer
+
+import (
+	"fmt"
+	"quoi/ast"
+	"quoi/token"
+	"strconv"
+)
+
+// const int MAX = (* 60 60).
+//
+// a constant is a variable that can't be reassigned. if its value can be
+// computed at compile time, the value is its IR; so backends can use it as a
+// constant.
+func (a *Analyzer) typecheckConstDecl(s *ast.ConstDeclaration) *IRVariable {
+	var ir *IRVariable
+	var value ast.Expr
+	switch d := s.Decl.(type) {
+	case *ast.VariableDeclarationStatement:
+		ir, value = a.typecheckVarDecl(d), d.Value
+	case *ast.ListVariableDeclarationStatement:
+		ir, value = a.typecheckListDecl(d), d.List
+	}
+	if ir == nil {
+		return nil
+	}
+	v, err := a.eval(value)
+	// a constant even if its value is wrong; so that its uses aren't reported too
+	a.env.SetConst(ir.Name, v)
+	if err != nil {
+		a.pushErr(err)
+		return nil
+	}
+	ir.Const = true
+	if v != nil {
+		ir.Value = constIR(v, nodeOf(value))
+	}
+	return ir
+}
+
+// the value of the typechecked expression expr, if it's known at compile time:
+// an int, a string, a bool, or an *IREnumMember. nil if it isn't known; only
+// literals, members of enums, constants, and operators over them are.
+func (a *Analyzer) eval(expr ast.Expr) (interface{}, error) {
+	switch expr := expr.(type) {
+	case *ast.IntLiteral:
+		return int(expr.Val), nil
+	case *ast.StringLiteral:
+		return expr.Val, nil
+	case *ast.BoolLiteral:
+		return expr.Val, nil
+	case *ast.EnumMember:
+		return a.toIrExpr(expr), nil
+	case *ast.Identifier:
+		v, _ := a.env.IsConst(expr.String())
+		return v, nil
+	case *ast.PrefixExpr:
+		return a.evalPrefixExpr(expr)
+	}
+	return nil, nil
+}
+
+func (a *Analyzer) evalPrefixExpr(expr *ast.PrefixExpr) (interface{}, error) {
+	var args []interface{}
+	for _, arg := range expr.Args {
+		v, err := a.eval(arg)
+		if v == nil || err != nil {
+			return nil, err
+		}
+		args = append(args, v)
+	}
+	switch expr.Tok.Type {
+	case token.ADD:
+		if s, ok := args[0].(string); ok {
+			for _, v := range args[1:] {
+				s += v.(string)
+			}
+			return s, nil
+		}
+		n := args[0].(int)
+		for _, v := range args[1:] {
+			n += v.(int)
+		}
+		return n, nil
+	case token.MINUS, token.MUL, token.DIV:
+		n := args[0].(int)
+		for _, v := range args[1:] {
+			switch v := v.(int); expr.Tok.Type {
+			case token.MINUS:
+				n -= v
+			case token.MUL:
+				n *= v
+			default:
+				if v == 0 {
+					return nil, newSpanErr("A109", expr.Span(), "division by zero in the value of a constant")
+				}
+				n /= v
+			}
+		}
+		return n, nil
+	case token.EQUAL:
+		if m, ok := args[0].(*IREnumMember); ok {
+			return m.Name == args[1].(*IREnumMember).Name, nil
+		}
+		return args[0] == args[1], nil
+	case token.LT:
+		return args[0].(int) < args[1].(int), nil
+	case token.LTE:
+		return args[0].(int) <= args[1].(int), nil
+	case token.GT:
+		return args[0].(int) > args[1].(int), nil
+	case token.GTE:
+		return args[0].(int) >= args[1].(int), nil
+	case token.AND:
+		return args[0].(bool) && args[1].(bool), nil
+	case token.OR:
+		return args[0].(bool) || args[1].(bool), nil
+	case token.NOT:
+		return !(args[0].(bool)), nil
+	}
+	// indexing, get, and set are done at run time
+	return nil, nil
+}
+
+// the IR of the value v of a constant
+func constIR(v interface{}, node Node) IRExpression {
+	switch v := v.(type) {
+	case int:
+		return &IRInt{Node: node, Value: strconv.Itoa(v)}
+	case string:
+		return &IRString{Node: node, Value: v}
+	case bool:
+		return &IRBoolean{Node: node, Value: strconv.FormatBool(v)}
+	case *IREnumMember:
+		return &IREnumMember{Node: node, Type: v.Type, Name: v.Name, Index: v.Index}
+	}
+	panic(fmt.Sprintf("constIR: unknown value %v", v))
+}
@@ -0,0 +1,283 @@
+package analyzer
+
+import (
+	"fmt"
+	"quoi/ast"
+	"quoi/std"
+	"quoi/token"
+	"quoi/types"
+	"strings"
+)
+
+type SymbolKind int
+
+const (
+	SymbolVar SymbolKind = iota // variables, and parameters
+	SymbolFunc
+	SymbolDatatype // datatypes, and enums
+)
+
+// a declared name
+type Symbol struct {
+	Name string
+	Kind SymbolKind
+	// type of a variable (e.g. 'listof int'). for functions, and datatypes, their declaration.
+	Type string
+	// the doc comment of functions, and datatypes
+	Doc string
+	// the name in the declaration. zero for the functions of the standard library.
+	Decl token.Span
+}
+
+// Info is what the analyzer learns about the names, and the expressions of a
+// program; for tools like the language server. set Analyzer.Info to NewInfo()
+// before analyzing to fill it.
+type Info struct {
+	// declarations; keyed by the declared name
+	Defs map[token.Span]*Symbol
+	// the declaration every identifier refers to
+	Uses map[token.Span]*Symbol
+	// types of the expressions whose types were inferred. a call to a function
+	// that returns nothing has no type.
+	Types map[token.Span]types.Type
+}
+
+func NewInfo() *Info {
+	return &Info{
+		Defs:  make(map[token.Span]*Symbol),
+		Uses:  make(map[token.Span]*Symbol),
+		Types: make(map[token.Span]types.Type),
+	}
+}
+
+// Signature returns the declaration of fn (e.g. 'fun f(int a) -> bool').
+// name is the name of fn, with its namespace if it's in the standard library.
+func Signature(name string, fn *IRFunction) string {
+	var params []string
+	for i, t := range fn.Takes {
+		params = append(params, t.String()+" "+fn.ParamNames[i])
+	}
+	res := fmt.Sprintf("fun %s(%s)", name, strings.Join(params, ", "))
+	if fn.ReturnsCount > 0 {
+		var returns []string
+		for _, t := range fn.Returns {
+			returns = append(returns, t.String())
+		}
+		res += " -> " + strings.Join(returns, ", ")
+	}
+	return res
+}
+
+// declare sym in the current scope (the global scope for functions, and datatypes)
+func (a *Analyzer) declare(sym *Symbol) {
+	if a.Info == nil {
+		return
+	}
+	a.env.Declare(sym)
+	a.Info.Defs[sym.Decl] = sym
+}
+
+func (a *Analyzer) declareVar(name *ast.Identifier, typ types.Type) {
+	a.declare(&Symbol{Name: name.String(), Kind: SymbolVar, Type: typ.String(), Decl: name.Span()})
+}
+
+func (a *Analyzer) declareFunc(s *ast.FunctionDeclarationStatement, fn *IRFunction) {
+	a.declare(&Symbol{Name: fn.Name, Kind: SymbolFunc, Type: Signature(fn.Name, fn), Doc: s.Doc.Text(), Decl: s.Name.Span()})
+}
+
+func (a *Analyzer) declareDatatype(s *ast.DatatypeDeclaration, dt *IRDatatype) {
+	if len(s.Variants) > 0 {
+		a.declareSum(s, dt)
+		return
+	}
+	decl := fmt.Sprintf("datatype %s {", dt.Name)
+	for _, f := range dt.Fields {
+		decl += fmt.Sprintf("\n    %s %s", f.Type, f.Name)
+	}
+	decl += "\n}"
+	a.declare(&Symbol{Name: dt.Name, Kind: SymbolDatatype, Type: decl, Doc: s.Doc.Text(), Decl: s.Name.Span()})
+}
+
+// a sum type, and its variants. the declaration of a variant is the one of its sum type.
+func (a *Analyzer) declareSum(s *ast.DatatypeDeclaration, dt *IRDatatype) {
+	var variants []string
+	for _, v := range dt.Variants {
+		variant := v.Name
+		if len(v.Fields) > 0 {
+			var fields []string
+			for _, f := range v.Fields {
+				fields = append(fields, fmt.Sprintf("%s %s", f.Type, f.Name))
+			}
+			variant += " { " + strings.Join(fields, " ") + " }"
+		}
+		variants = append(variants, variant)
+	}
+	decl := fmt.Sprintf("datatype %s = %s", dt.Name, strings.Join(variants, " | "))
+	a.declare(&Symbol{Name: dt.Name, Kind: SymbolDatatype, Type: decl, Doc: s.Doc.Text(), Decl: s.Name.Span()})
+	for _, v := range s.Variants {
+		if a.variantOf(dt, v.Name.String()) != nil {
+			a.declare(&Symbol{Name: v.Name.String(), Kind: SymbolDatatype, Type: decl, Doc: s.Doc.Text(), Decl: v.Name.Span()})
+		}
+	}
+}
+
+func (a *Analyzer) declareEnum(s *ast.EnumDeclaration, e *IREnum) {
+	decl := fmt.Sprintf("enum %s { %s }", e.Name, strings.Join(e.Members, " "))
+	a.declare(&Symbol{Name: e.Name, Kind: SymbolDatatype, Type: decl, Doc: s.Doc.Text(), Decl: s.Name.Span()})
+}
+
+// the identifier at tok refers to the declaration of kind, named name
+func (a *Analyzer) use(tok token.Token, kind SymbolKind, name string) {
+	if sym := a.env.Lookup(kind, name); sym != nil {
+		a.Info.Uses[tok.Span()] = sym
+	}
+}
+
+// the identifier at tok refers to the function ns::name of the standard library
+func (a *Analyzer) useStd(tok token.Token, ns, name string) {
+	if fn := a.std.GetFunc(ns, name); fn != nil {
+		doc := std.Lookup(ns, name).Doc
+		name = ns + "::" + name
+		a.Info.Uses[tok.Span()] = &Symbol{Name: name, Kind: SymbolFunc, Type: Signature(name, fn), Doc: doc}
+	}
+}
+
+// a type (e.g. 'int', 'User') that may refer to a datatype
+func (a *Analyzer) useType(tok token.Token) {
+	if tok.Type == token.IDENT {
+		a.use(tok, SymbolDatatype, tok.Literal)
+	}
+}
+
+// like useType; but t may be a function type, whose types may refer to datatypes
+func (a *Analyzer) useVarType(t ast.VarType) {
+	a.useType(t.Tok)
+	a.useType(t.TypeOfList)
+	if t.Fun == nil {
+		return
+	}
+	for _, v := range t.Fun.Params {
+		a.useVarType(v)
+	}
+	for _, v := range t.Fun.Returns {
+		a.useVarType(v)
+	}
+}
+
+// an identifier that refers to a variable, or to a function
+func (a *Analyzer) useValue(id *ast.Identifier) {
+	kind := SymbolVar
+	if a.env.GetVar(id.String()) == nil {
+		kind = SymbolFunc
+	}
+	a.use(id.Tok, kind, id.String())
+}
+
+// record the names that the expressions, and the types in s refer to; and the
+// types of the expressions. s is resolved before it's typechecked; so the
+// variables it declares aren't in scope yet.
+func (a *Analyzer) resolveStatement(s ast.Statement) {
+	if a.Info == nil {
+		return
+	}
+	switch s := s.(type) {
+	case *ast.VariableDeclarationStatement:
+		a.useVarType(ast.VarType{Tok: s.Tok, Fun: s.Fun})
+		a.resolve(s.Value)
+	case *ast.ListVariableDeclarationStatement:
+		a.useVarType(ast.VarType{Tok: s.Typ, Fun: s.Fun})
+		a.resolve(s.List)
+	case *ast.ConstDeclaration:
+		a.resolveStatement(s.Decl)
+	case *ast.SubsequentVariableDeclarationStatement:
+		for _, t := range s.Types {
+			a.useVarType(t)
+		}
+		a.resolve(s.Values...)
+	case *ast.ReassignmentStatement:
+		a.use(s.Ident.Tok, SymbolVar, s.Ident.String())
+		a.resolve(s.NewValue)
+	case *ast.ReturnStatement:
+		a.resolve(s.ReturnValues...)
+	case *ast.LoopStatement:
+		a.resolve(s.Cond)
+	case *ast.IfStatement:
+		for ; s != nil; s = s.Alternative {
+			a.resolve(s.Cond)
+		}
+	case *ast.FunctionDeclarationStatement:
+		for _, p := range s.Params {
+			a.useVarType(p.Type())
+		}
+		for _, r := range s.ReturnTypes {
+			a.useVarType(r.Type())
+		}
+	case *ast.DatatypeDeclaration:
+		for _, f := range s.Fields {
+			a.useVarType(ast.VarType{Tok: f.Tok, Fun: f.Fun})
+		}
+		for _, v := range s.Variants {
+			for _, f := range v.Fields {
+				a.useVarType(ast.VarType{Tok: f.Tok, Fun: f.Fun})
+			}
+		}
+	case *ast.MatchStatement:
+		a.resolve(s.Value)
+		for _, arm := range s.Arms {
+			a.use(arm.Variant.Tok, SymbolDatatype, arm.Variant.String())
+		}
+	case *ast.FunctionCall, *ast.FunctionCallFromNamespace:
+		a.resolve(s.(ast.Expr))
+	}
+}
+
+func (a *Analyzer) resolve(exprs ...ast.Expr) {
+	for _, x := range exprs {
+		if t, err := a.infer(x); err == nil {
+			a.recordType(x.Span(), t)
+		}
+		switch x := x.(type) {
+		case *ast.Identifier:
+			a.useValue(x)
+		case *ast.PrefixExpr:
+			args := x.Args
+			if (x.Tok.Type == token.GET || x.Tok.Type == token.SET) && len(args) > 1 {
+				// the second argument is the name of a field
+				a.resolve(args[0])
+				args = args[2:]
+			}
+			a.resolve(args...)
+		case *ast.FunctionCall:
+			// a variable of a function type, or a function
+			if _, v := a.callee(x.Ident); v != nil {
+				a.use(x.Ident.Tok, SymbolVar, x.Ident.String())
+			} else {
+				a.use(x.Ident.Tok, SymbolFunc, x.Ident.String())
+			}
+			a.resolve(x.Args...)
+		case *ast.FunctionCallFromNamespace:
+			ns, name := x.Namespace.Tok.Literal, x.Function.Ident.String()
+			a.useStd(x.Function.Ident.Tok, ns, name)
+			if a.std.GetFunc(ns, name) == nil && a.enumOfFunc(ns, name) != nil && ns != "String" {
+				// Color::members()
+				a.use(x.Namespace.Tok, SymbolDatatype, ns)
+			}
+			a.resolve(x.Function.Args...)
+		case *ast.EnumMember:
+			a.use(x.Enum.Tok, SymbolDatatype, x.Enum.String())
+		case *ast.ListLiteral:
+			a.resolve(x.Elems...)
+		case *ast.DatatypeLiteral:
+			a.use(x.Tok, SymbolDatatype, x.Tok.Literal)
+			for _, f := range x.Fields {
+				a.resolve(f.Value)
+			}
+		}
+	}
+}
+
+func (a *Analyzer) recordType(span token.Span, t types.Type) {
+	if t != types.Void {
+		a.Info.Types[span] = t
+	}
+}
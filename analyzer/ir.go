@@ -2,6 +2,10 @@ package analyzer
 
 import (
 	"fmt"
+	"quoi/ast"
+	"quoi/token"
+	"quoi/types"
+	"strconv"
 	"strings"
 )
 
@@ -16,31 +20,62 @@ func (i *IRProgram) Push(stmt IRStatement) {
 type IRStatement interface {
 	irStmt()
 	String() string
+	// position of the statement in the Quoi source
+	Pos() token.Pos
 }
 
 type IRExpression interface {
 	irExpr()
 	String() string
+	// position of the expression in the Quoi source
+	Pos() token.Pos
+}
+
+// the range of the AST node that an IR node is produced from. zero if the node
+// doesn't come from the source.
+type Node struct {
+	Span token.Span
+}
+
+func (n Node) Pos() token.Pos { return n.Span.Start }
+
+func nodeOf(n ast.Node) Node {
+	return Node{Span: n.Span()}
 }
 
 type IRVariable struct {
-	Name, Type string
-	Value      IRExpression
+	Node
+	Name  string
+	Type  types.Type
+	Value IRExpression
+	// a constant. its Value is a literal (or a member of an enum), if it's
+	// computed at compile time.
+	Const bool
 }
 
 type IRSubseq struct {
-	Names, Types []string
-	Values       []IRExpression
+	Node
+	Names  []string
+	Types  []types.Type
+	Values []IRExpression
 }
 
 type IRFunction struct {
-	Name                       string
-	ParamNames, Takes, Returns []string
-	TakesCount, ReturnsCount   int
-	Block                      []IRStatement
+	Node
+	Name                     string
+	ParamNames               []string
+	Takes, Returns           []types.Type
+	TakesCount, ReturnsCount int
+	Block                    []IRStatement
+}
+
+// the type of the function as a value
+func (f *IRFunction) Type() *types.Func {
+	return &types.Func{Params: f.Takes, Returns: f.Returns}
 }
 
 type IRIf struct {
+	Node
 	Cond        IRExpression
 	Block       []IRStatement
 	Alternative *IRElseIf
@@ -48,6 +83,7 @@ type IRIf struct {
 }
 
 type IRElseIf struct {
+	Node
 	Cond        IRExpression
 	Block       []IRStatement
 	Alternative *IRElseIf
@@ -55,62 +91,119 @@ type IRElseIf struct {
 }
 
 type IRElse struct {
+	Node
 	Block []IRStatement
 }
 
 type IRReturn struct {
-	ReturnTypes  []string
+	Node
+	ReturnTypes  []types.Type
 	ReturnValues []IRExpression
 	ReturnCount  int
 }
 
-type IRBreak struct{}
-type IRContinue struct{}
+type IRBreak struct{ Node }
+type IRContinue struct{ Node }
 
 type IRDatatypeField struct {
-	Type, Name string
+	Node
+	Type types.Type
+	Name string
 }
 
 type IRDatatype struct {
+	Node
 	Name       string
 	FieldCount int
 	Fields     []IRDatatypeField
+	// every use of the datatype has this type
+	Type *types.Datatype
+	// of a sum type; a sum type has no fields
+	Variants []*IRDatatype
+}
+
+type IREnum struct {
+	Node
+	Name    string
+	Members []string
+	// every use of the enum has this type
+	Type *types.Enum
+}
+
+// match on a value of a sum type
+type IRMatch struct {
+	Node
+	Type    *types.Datatype // of the value; a sum type
+	Value   IRExpression
+	Arms    []*IRMatchArm
+	Default *IRElse // nil if there's no else arm
+}
+
+type IRMatchArm struct {
+	Node
+	Variant *types.Datatype
+	Name    string // the value as a value of Variant; "" if it isn't named
+	Block   []IRStatement
 }
 
 type IRReassigment struct {
+	Node
 	Name     string
 	NewValue IRExpression
+	Param    bool // Name is a parameter; so the assignment changes the argument
 }
 
 // EXPRESSIONS
 
 type IRVariableReference struct {
-	Name, Type string
+	Node
+	Name string
+	Type types.Type
+	// Name is a parameter of the enclosing function. parameters are passed by
+	// reference; they refer to the arguments of the caller.
+	Param bool
+	// Name is a constant; it's passed by the reference of a copy of its value
+	Const bool
 }
 
 type IRInt struct {
+	Node
 	Value string // to avoid converting int to string in codegen.
 }
 
 type IRString struct {
+	Node
 	Value string
 }
 
 type IRBoolean struct {
+	Node
 	Value string
 }
 
 type IRList struct {
-	Type   string
+	Node
+	Type   *types.List
 	Length int
 	Value  []IRExpression
 }
 
 type IRFunctionCall struct {
+	Node
 	Name                     string
 	Takes                    []IRExpression
-	Returns                  []string
+	Returns                  []types.Type
 	TakesCount, ReturnsCount int
+	// the variable (of a function type) named Name, whose value is called; nil
+	// if Name is a function.
+	Value *IRVariableReference
+}
+
+// a function as a value; 'add' in 'fun(int, int) -> int f = add.'
+type IRFunctionReference struct {
+	Node
+	Name string
+	Type *types.Func
 }
 
 type IRFunctionCallFromNamespace struct {
@@ -119,24 +212,55 @@ type IRFunctionCallFromNamespace struct {
 }
 
 type IRDatatypeLiteral struct {
+	Node
 	Name            string
 	FieldsAndValues map[string]IRExpression
 }
 
+// a member of an enum; 'Color::Red'
+type IREnumMember struct {
+	Node
+	Type  *types.Enum
+	Name  string
+	Index int // in the members of Type
+}
+
+// the name of the member that Value (of an enum) is; 'String::from_Color(c)'
+type IREnumName struct {
+	Node
+	Type  *types.Enum
+	Value IRExpression
+}
+
 type IRPrefExpr struct {
+	Node
 	Operator string
 	Operands []IRExpression
+	Type     types.Type // of the result
+	// of the first operand; a string, and a list are indexed differently
+	Operand types.Type
 }
 
 type IRBlock struct {
+	Node
 	Stmts []IRStatement
 }
 
 type IRLoop struct {
+	Node
 	Cond  IRExpression
 	Stmts []IRStatement
 }
 
+// print the value of a bare expression. only the REPL produces this.
+// if the expression has no value (a call to a function returning nothing), it's just evaluated.
+type IRShow struct {
+	Node
+	Value IRExpression
+	// a tuple if it's a call returning multiple values
+	Type types.Type
+}
+
 /* ********** IR STATEMENTS ***************** */
 func (IRVariable) irStmt()                  {}
 func (IRSubseq) irStmt()                    {}
@@ -154,6 +278,9 @@ func (IRPrefExpr) irStmt()                  {}
 func (IRReassigment) irStmt()               {}
 func (IRBlock) irStmt()                     {}
 func (IRLoop) irStmt()                      {}
+func (IRShow) irStmt()                      {}
+func (IRMatch) irStmt()                     {}
+func (IREnum) irStmt()                      {}
 
 /* ********** IR EXPRESSIONS **************** */
 func (IRVariableReference) irExpr()         {}
@@ -163,8 +290,11 @@ func (IRBoolean) irExpr()                   {}
 func (IRList) irExpr()                      {}
 func (IRFunctionCall) irExpr()              {}
 func (IRFunctionCallFromNamespace) irExpr() {}
+func (IRFunctionReference) irExpr()         {}
 func (IRPrefExpr) irExpr()                  {}
 func (IRDatatypeLiteral) irExpr()           {}
+func (IREnumMember) irExpr()                {}
+func (IREnumName) irExpr()                  {}
 
 /* ************ */
 // ADD String methods on IR nodes for debugging.
@@ -182,6 +312,9 @@ func (i *IRVariable) String() string {
 	if i == nil {
 		return "<nil_var>"
 	}
+	if i.Const {
+		return fmt.Sprintf("const!(name:%s type:%s value:%s)", i.Name, i.Type, i.Value)
+	}
 	return fmt.Sprintf("var!(name:%s type:%s value:%s)", i.Name, i.Type, i.Value)
 }
 
@@ -218,7 +351,7 @@ func (f *IRFunction) String() string {
 	}
 	res += fmt.Sprintf("] returns:#%d[", f.ReturnsCount)
 	for i, v := range f.Returns {
-		res += v
+		res += v.String()
 		if !(i == f.ReturnsCount-1) {
 			res += " "
 		}
@@ -274,7 +407,7 @@ func (r *IRReturn) String() string {
 	}
 	res := fmt.Sprintf("return!(types#%d:[", r.ReturnCount)
 	for i, v := range r.ReturnTypes {
-		res += v
+		res += v.String()
 		if i != r.ReturnCount-1 {
 			res += " "
 		}
@@ -318,7 +451,7 @@ func (f *IRFunctionCallFromNamespace) String() string {
 	}
 	res += fmt.Sprintf("] returns:#%d[", f.ReturnsCount)
 	for i, v := range f.Returns {
-		res += v
+		res += v.String()
 		if i != f.ReturnsCount-1 {
 			res += " "
 		}
@@ -340,6 +473,16 @@ func (d *IRDatatype) String() string {
 	if d == nil {
 		return "<nil_datatype>"
 	}
+	if len(d.Variants) > 0 {
+		res := fmt.Sprintf("datatype!(name:%s variants:[", d.Name)
+		for i, v := range d.Variants {
+			if i > 0 {
+				res += " "
+			}
+			res += v.String()
+		}
+		return res + "])"
+	}
 	res := fmt.Sprintf("datatype!(name:%s fields:#%d[ ", d.Name, d.FieldCount)
 	for i, v := range d.Fields {
 		res += fmt.Sprintf("name:%s type:%s", v.Name, v.Type)
@@ -351,6 +494,32 @@ func (d *IRDatatype) String() string {
 	return res
 }
 
+func (e *IREnum) String() string {
+	if e == nil {
+		return "<nil_enum>"
+	}
+	return fmt.Sprintf("enum!(name:%s members:[%s])", e.Name, strings.Join(e.Members, " "))
+}
+
+func (m *IRMatch) String() string {
+	if m == nil {
+		return "<nil_match>"
+	}
+	res := fmt.Sprintf("match!(value:%s", m.Value)
+	for _, arm := range m.Arms {
+		res += fmt.Sprintf(" %s %s {", arm.Variant, arm.Name)
+		for _, v := range arm.Block {
+			res += fmt.Sprintf("\t%s", v)
+		}
+		res += "}"
+	}
+	if m.Default != nil {
+		res += m.Default.String()
+	}
+	res += ")"
+	return res
+}
+
 func (p *IRPrefExpr) String() string {
 	if p == nil {
 		return "<nil_prefexpr>"
@@ -412,6 +581,13 @@ func (v *IRVariableReference) String() string {
 	return fmt.Sprintf("varref!(name:%s type:%s)", v.Name, v.Type)
 }
 
+func (f *IRFunctionReference) String() string {
+	if f == nil {
+		return "<nil_funref>"
+	}
+	return fmt.Sprintf("funref!(name:%s type:%s)", f.Name, f.Type)
+}
+
 func (i *IRInt) String() string {
 	if i == nil {
 		return "<nil_int>"
@@ -430,7 +606,7 @@ func (s *IRString) String() string {
 	if s == nil {
 		return "<nil_str>"
 	}
-	return fmt.Sprintf("\"%s\"", s.Value)
+	return strconv.Quote(s.Value)
 }
 
 func (l *IRList) String() string {
@@ -459,3 +635,24 @@ func (d *IRDatatypeLiteral) String() string {
 	res += "})"
 	return res
 }
+
+func (m *IREnumMember) String() string {
+	if m == nil {
+		return "<nil_enummember>"
+	}
+	return fmt.Sprintf("enummember!(enum:%s name:%s)", m.Type, m.Name)
+}
+
+func (n *IREnumName) String() string {
+	if n == nil {
+		return "<nil_enumname>"
+	}
+	return fmt.Sprintf("enumname!(enum:%s value:%s)", n.Type, n.Value)
+}
+
+func (s *IRShow) String() string {
+	if s == nil {
+		return "<nil_show>"
+	}
+	return fmt.Sprintf("show!(type:%s value:%s)", s.Type, s.Value)
+}
@@ -2,13 +2,21 @@ package analyzer
 
 import (
 	"fmt"
+	"quoi/types"
 )
 
 type SymbolTable struct {
 	// name: type
-	vars      map[string]string
+	vars   map[string]types.Type
+	params map[string]bool // the vars that are parameters of a function
+	// the vars that are constants; with their values (int, string, bool, or
+	// *IREnumMember) if they are known at compile time, nil otherwise.
+	consts    map[string]interface{}
 	funcs     map[string]*IRFunction
 	datatypes map[string]*IRDatatype
+	enums     map[string]*IREnum
+	// declarations of the names above; only if the analyzer records them (Analyzer.Info)
+	symbols map[symbolKey]*Symbol
 
 	// this field exists because:
 	// if typechecking of a variable fails,
@@ -33,21 +41,25 @@ type SymbolTable struct {
 
 func NewSymbolTable() *SymbolTable {
 	return &SymbolTable{
-		vars:      make(map[string]string),
+		vars:      make(map[string]types.Type),
+		params:    make(map[string]bool),
+		consts:    make(map[string]interface{}),
 		funcs:     make(map[string]*IRFunction),
 		datatypes: make(map[string]*IRDatatype),
+		enums:     make(map[string]*IREnum),
+		symbols:   make(map[symbolKey]*Symbol),
 
 		failedVars: make(map[string]bool),
 	}
 }
 
-func (s *SymbolTable) getVar(ident string) string {
+func (s *SymbolTable) getVar(ident string) types.Type {
 	return s.vars[ident]
 }
 
-func (s *SymbolTable) addVar(ident, type_ string) error {
+func (s *SymbolTable) addVar(ident string, type_ types.Type) error {
 	d := s.getVar(ident)
-	if len(d) > 0 {
+	if d != nil {
 		return fmt.Errorf("variable '%s' is already defined", ident)
 	}
 	s.vars[ident] = type_
@@ -82,10 +94,42 @@ func (s *SymbolTable) addDatatype(ident string, rec *IRDatatype) error {
 	if v := s.getDatatype(ident); v != nil {
 		return fmt.Errorf("datatype '%s' is already declared", ident)
 	}
+	if v := s.getEnum(ident); v != nil {
+		return fmt.Errorf("'%s' is already declared as an enum", ident)
+	}
 	s.datatypes[ident] = rec
 	return nil
 }
 
+func (s *SymbolTable) getEnum(ident string) *IREnum {
+	return s.enums[ident]
+}
+
+// enums, and datatypes share their names; both are types
+func (s *SymbolTable) addEnum(ident string, rec *IREnum) error {
+	if v := s.getEnum(ident); v != nil {
+		return fmt.Errorf("enum '%s' is already declared", ident)
+	}
+	if v := s.getDatatype(ident); v != nil {
+		return fmt.Errorf("'%s' is already declared as a datatype", ident)
+	}
+	s.enums[ident] = rec
+	return nil
+}
+
+type symbolKey struct {
+	kind SymbolKind
+	name string
+}
+
+func (s *SymbolTable) getSymbol(kind SymbolKind, ident string) *Symbol {
+	return s.symbols[symbolKey{kind, ident}]
+}
+
+func (s *SymbolTable) addSymbol(sym *Symbol) {
+	s.symbols[symbolKey{sym.Kind, sym.Name}] = sym
+}
+
 type Scope struct {
 	symbolTable *SymbolTable
 }
@@ -130,16 +174,17 @@ func (ss *ScopeStack) ExitScope() {
 	ss.pop()
 }
 
-func (ss *ScopeStack) GetVar(ident string) string {
+// nil if there's no variable named ident
+func (ss *ScopeStack) GetVar(ident string) types.Type {
 	for i := len(ss.Scopes) - 1; i >= 0; i-- {
-		if v := ss.Scopes[i].symbolTable.getVar(ident); v != "" {
+		if v := ss.Scopes[i].symbolTable.getVar(ident); v != nil {
 			return v
 		}
 	}
-	return ""
+	return nil
 }
 
-func (ss *ScopeStack) AddVar(ident, type_ string) error {
+func (ss *ScopeStack) AddVar(ident string, type_ types.Type) error {
 	err := ss.Scopes[len(ss.Scopes)-1].symbolTable.addVar(ident, type_)
 	if err != nil {
 		ss.AddFailedVar(ident)
@@ -147,8 +192,58 @@ func (ss *ScopeStack) AddVar(ident, type_ string) error {
 	return err
 }
 
+// AddParam adds a parameter of the function whose scope is the current scope.
+func (ss *ScopeStack) AddParam(ident string, type_ types.Type) error {
+	if err := ss.AddVar(ident, type_); err != nil {
+		return err
+	}
+	ss.Scopes[len(ss.Scopes)-1].symbolTable.params[ident] = true
+	return nil
+}
+
+// IsParam reports whether the variable ident refers to is a parameter.
+func (ss *ScopeStack) IsParam(ident string) bool {
+	for i := len(ss.Scopes) - 1; i >= 0; i-- {
+		st := ss.Scopes[i].symbolTable
+		if st.getVar(ident) != nil {
+			return st.params[ident]
+		}
+	}
+	return false
+}
+
+// SetConst makes the variable ident of the current scope a constant. value is
+// its value, if it's known at compile time; nil otherwise.
+func (ss *ScopeStack) SetConst(ident string, value interface{}) {
+	ss.Scopes[len(ss.Scopes)-1].symbolTable.consts[ident] = value
+}
+
+// IsConst reports whether the variable ident refers to is a constant. value
+// is its value, if it's known at compile time.
+func (ss *ScopeStack) IsConst(ident string) (value interface{}, ok bool) {
+	for i := len(ss.Scopes) - 1; i >= 0; i-- {
+		st := ss.Scopes[i].symbolTable
+		if st.getVar(ident) != nil {
+			value, ok = st.consts[ident]
+			return value, ok
+		}
+	}
+	return nil, false
+}
+
+// IsFailedVar reports whether ident refers to a variable whose declaration
+// failed; in the current scope, or in an enclosing one.
 func (ss *ScopeStack) IsFailedVar(ident string) bool {
-	return ss.Scopes[len(ss.Scopes)-1].symbolTable.isFailedVar(ident)
+	for i := len(ss.Scopes) - 1; i >= 0; i-- {
+		st := ss.Scopes[i].symbolTable
+		if st.isFailedVar(ident) {
+			return true
+		}
+		if st.getVar(ident) != nil {
+			return false
+		}
+	}
+	return false
 }
 
 func (ss *ScopeStack) AddFailedVar(ident string) {
@@ -173,3 +268,67 @@ func (ss *ScopeStack) AddDatatype(ident string, rec *IRDatatype) error {
 func (ss *ScopeStack) GetDatatype(ident string) *IRDatatype {
 	return ss.Scopes[0].symbolTable.getDatatype(ident)
 }
+
+func (ss *ScopeStack) AddEnum(ident string, rec *IREnum) error {
+	return ss.Scopes[0].symbolTable.addEnum(ident, rec)
+}
+
+func (ss *ScopeStack) GetEnum(ident string) *IREnum {
+	return ss.Scopes[0].symbolTable.getEnum(ident)
+}
+
+// Declare adds sym to the current scope; functions, and datatypes to the global scope.
+func (ss *ScopeStack) Declare(sym *Symbol) {
+	if sym.Kind == SymbolVar {
+		ss.Scopes[len(ss.Scopes)-1].symbolTable.addSymbol(sym)
+		return
+	}
+	ss.Scopes[0].symbolTable.addSymbol(sym)
+}
+
+// Lookup returns the declaration that the name ident of kind refers to. nil if there isn't one.
+func (ss *ScopeStack) Lookup(kind SymbolKind, ident string) *Symbol {
+	if kind != SymbolVar {
+		return ss.Scopes[0].symbolTable.getSymbol(kind, ident)
+	}
+	for i := len(ss.Scopes) - 1; i >= 0; i-- {
+		if sym := ss.Scopes[i].symbolTable.getSymbol(kind, ident); sym != nil {
+			return sym
+		}
+	}
+	return nil
+}
+
+// a deep copy of ss. changes to the copy don't affect ss.
+func (ss *ScopeStack) Copy() *ScopeStack {
+	c := &ScopeStack{}
+	for _, scope := range ss.Scopes {
+		st := NewSymbolTable()
+		for k, v := range scope.symbolTable.vars {
+			st.vars[k] = v
+		}
+		for k, v := range scope.symbolTable.params {
+			st.params[k] = v
+		}
+		for k, v := range scope.symbolTable.consts {
+			st.consts[k] = v
+		}
+		for k, v := range scope.symbolTable.funcs {
+			st.funcs[k] = v
+		}
+		for k, v := range scope.symbolTable.datatypes {
+			st.datatypes[k] = v
+		}
+		for k, v := range scope.symbolTable.enums {
+			st.enums[k] = v
+		}
+		for k, v := range scope.symbolTable.symbols {
+			st.symbols[k] = v
+		}
+		for k, v := range scope.symbolTable.failedVars {
+			st.failedVars[k] = v
+		}
+		c.push(&Scope{symbolTable: st})
+	}
+	return c
+}
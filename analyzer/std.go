@@ -4,96 +4,93 @@ import (
 	"quoi/ast"
 	"quoi/lexer"
 	"quoi/parser"
+	"quoi/std"
+	"quoi/types"
+	"sort"
 	"strings"
 )
 
-// The standard library consisting of different namespaces
-
-const STDOUT = `
-		fun Stdout_println(string s) -> {}
-		fun Stdout_print(string s) -> {}
-	`
-
-const MATH = `
-		fun Math_mod(int n, int n2) -> int {}
-		fun Math_pow(int n, int n2) -> int {}
-		fun Math_sqrt(int n) -> int {}
-	`
-
-const STRING = `
-		fun String_from_int(int n) -> string {}
-		fun String_from_bool(bool b) -> string {}
-		fun String_concat(string s, string s2) -> string {}
-		fun String_index(string s, string ch) -> int {}
-	`
-
-const INT = `
-		fun Int_from_string(string s) -> int {}
-	`
-
-const LIST = `
-		fun List_replace_int(listof int nx, int idx, int new_val) -> listof int {}
-		fun List_replace_string(listof string strx, int idx, string new_val) -> listof string {}
-		fun List_replace_bool(listof bool bx, int idx, bool new_val) -> listof bool {}
-	`
-
+// The standard library consisting of different namespaces.
+// functions are declared in package std; this holds their typechecked signatures.
 type StandardLibrary struct {
-	STDOUT, MATH, STRING, INT, LIST map[string]*IRFunction
+	// keyed by '<namespace>::<function>'
+	funcs map[string]*IRFunction
 }
 
 func InitStandardLibrary(a *Analyzer) *StandardLibrary {
-	s := &StandardLibrary{
-		STDOUT: make(map[string]*IRFunction),
-		MATH:   make(map[string]*IRFunction),
-		STRING: make(map[string]*IRFunction),
-		INT:    make(map[string]*IRFunction),
-		LIST:   make(map[string]*IRFunction),
-	}
+	s := &StandardLibrary{funcs: make(map[string]*IRFunction)}
 	a.std = s
 
-	std := STDOUT + MATH + STRING + INT + LIST
-	l := lexer.New(std)
-	p := parser.New(l)
-	prg := p.Parse()
-
-	for _, v := range prg.Stmts {
-		switch v := v.(type) {
-		case *ast.FunctionDeclarationStatement:
-			splitted := strings.SplitN(v.Name.String(), "_", 2)
-			ns, name := splitted[0], splitted[1]
-			a.registerStdFuncSignature(ns, name, v)
+	for _, f := range std.Funcs {
+		l := lexer.New(f.Decl() + " {}")
+		p := parser.New(l)
+		prg := p.Parse()
+		if len(l.Errs) > 0 || len(p.Errs) > 0 || len(prg.Stmts) != 1 {
+			panic("invalid signature of standard library function " + f.Namespace + "::" + f.Name)
+		}
+		decl, ok := prg.Stmts[0].(*ast.FunctionDeclarationStatement)
+		if !(ok) {
+			panic("invalid signature of standard library function " + f.Namespace + "::" + f.Name)
 		}
+		a.registerStdFuncSignature(f.Namespace, f.Name, decl)
 	}
 	return s
 }
 
-func (s *StandardLibrary) GetFunc(namespace, name string) *IRFunction {
-	switch namespace {
-	case "Stdout":
-		return s.STDOUT[name]
-	case "Math":
-		return s.MATH[name]
-	case "String":
-		return s.STRING[name]
-	case "List":
-		return s.LIST[name]
-	case "Int":
-		return s.INT[name]
+// the signatures of the standard library, without an analyzer
+func NewStandardLibrary() *StandardLibrary {
+	return New(&ast.Program{}).std
+}
+
+// names of the functions in namespace, sorted
+func (s *StandardLibrary) FuncsOf(namespace string) []string {
+	var res []string
+	for k := range s.funcs {
+		if strings.HasPrefix(k, namespace+"::") {
+			res = append(res, strings.TrimPrefix(k, namespace+"::"))
+		}
 	}
-	return nil
+	sort.Strings(res)
+	return res
+}
+
+func (s *StandardLibrary) GetFunc(namespace, name string) *IRFunction {
+	return s.funcs[namespace+"::"+name]
 }
 
 func (s *StandardLibrary) AddFunc(namespace string, name string, decl *IRFunction) {
-	switch namespace {
-	case "Stdout":
-		s.STDOUT[name] = decl
-	case "Math":
-		s.MATH[name] = decl
-	case "String":
-		s.STRING[name] = decl
-	case "List":
-		s.LIST[name] = decl
-	case "Int":
-		s.INT[name] = decl
+	s.funcs[namespace+"::"+name] = decl
+}
+
+// the function ns::name; a function of the standard library, or one of the
+// functions every enum has:
+//
+//	String::from_Color(Color c) -> string   the name of c
+//	Color::members() -> listof Color        the members, in the order of declaration
+//
+// nil if there isn't one.
+func (a *Analyzer) stdFunc(ns, name string) *IRFunction {
+	if fn := a.std.GetFunc(ns, name); fn != nil {
+		return fn
 	}
+	e := a.enumOfFunc(ns, name)
+	switch {
+	case e == nil:
+		return nil
+	case ns == "String":
+		return &IRFunction{Name: name, ParamNames: []string{"c"}, Takes: []types.Type{e.Type}, TakesCount: 1,
+			Returns: []types.Type{types.String}, ReturnsCount: 1}
+	}
+	return &IRFunction{Name: name, Returns: []types.Type{&types.List{Elem: e.Type}}, ReturnsCount: 1}
+}
+
+// the enum that ns::name is a function of; nil if it isn't one
+func (a *Analyzer) enumOfFunc(ns, name string) *IREnum {
+	if ns == "String" && strings.HasPrefix(name, "from_") {
+		return a.env.GetEnum(strings.TrimPrefix(name, "from_"))
+	}
+	if name == "members" {
+		return a.env.GetEnum(ns)
+	}
+	return nil
 }
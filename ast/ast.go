@@ -3,19 +3,100 @@ package ast
 import (
 	"fmt"
 	"quoi/token"
+	"reflect"
 	"strings"
+	"unicode"
 )
 
 type Program struct {
 	Stmts []Statement
+	// every comment in the program, in the order they appear. only if the
+	// lexer keeps comments (lexer.Lexer.KeepComments).
+	Comments []*CommentGroup
 }
 
 func (p *Program) PushStmt(stmt Statement) {
 	p.Stmts = append(p.Stmts, stmt)
 }
 
+func (p *Program) Span() token.Span {
+	var res token.Span
+	for _, v := range p.Stmts {
+		res = res.Join(v.Span())
+	}
+	return res
+}
+
 type Node interface {
 	String() string
+	// the range of the node in the source code
+	Span() token.Span
+}
+
+// return a span from the beginning of start to end.
+// if end is not known (e.g. the node wasn't created by the parser), span of start is returned.
+func span(start token.Token, end token.Pos) token.Span {
+	if end.Line == 0 {
+		return start.Span()
+	}
+	return token.Span{Start: start.Pos(), End: end}
+}
+
+// span of n, or the zero span if n is nil.
+// n may be a nil pointer hidden behind the interface; the parser returns those on errors.
+func spanOf(n Node) token.Span {
+	if n == nil {
+		return token.Span{}
+	}
+	if v := reflect.ValueOf(n); v.Kind() == reflect.Ptr && v.IsNil() {
+		return token.Span{}
+	}
+	return n.Span()
+}
+
+// a comment; from ';' to the end of the line
+type Comment struct {
+	Tok token.Token // token.COMMENT
+}
+
+func (c Comment) String() string   { return c.Tok.Literal }
+func (c Comment) Span() token.Span { return c.Tok.Span() }
+
+// comments on consecutive lines, with nothing else between them. a comment at
+// the end of a line of code is a group of its own.
+type CommentGroup struct {
+	List []*Comment
+}
+
+func (g *CommentGroup) String() string {
+	var lines []string
+	for _, c := range g.List {
+		lines = append(lines, c.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (g *CommentGroup) Span() token.Span {
+	var res token.Span
+	for _, c := range g.List {
+		res = res.Join(c.Span())
+	}
+	return res
+}
+
+// Text returns the text of the comments without the leading ';'s, and the
+// space after them. lines are separated by newlines.
+func (g *CommentGroup) Text() string {
+	if g == nil {
+		return ""
+	}
+	var lines []string
+	for _, c := range g.List {
+		line := strings.TrimLeft(c.Tok.Literal, ";")
+		line = strings.TrimPrefix(line, " ")
+		lines = append(lines, strings.TrimRight(line, " \t\r"))
+	}
+	return strings.Join(lines, "\n")
 }
 
 type Expr interface {
@@ -37,9 +118,37 @@ type StringLiteral struct {
 }
 
 func (s StringLiteral) String() string {
-	return fmt.Sprintf("\"%s\"", s.Val)
+	return Quote(s.Val)
 }
-func (StringLiteral) statement() {}
+
+// Quote returns s as a Quoi string literal, escaping the characters that can't
+// appear in one as is.
+func Quote(s string) string {
+	var res strings.Builder
+	res.WriteByte('"')
+	for _, ch := range s {
+		switch ch {
+		case '\n':
+			res.WriteString(`\n`)
+		case '\t':
+			res.WriteString(`\t`)
+		case '\\':
+			res.WriteString(`\\`)
+		case '"':
+			res.WriteString(`\"`)
+		default:
+			if unicode.IsPrint(ch) {
+				res.WriteRune(ch)
+			} else {
+				fmt.Fprintf(&res, "\\u{%X}", ch)
+			}
+		}
+	}
+	res.WriteByte('"')
+	return res.String()
+}
+func (s StringLiteral) Span() token.Span { return s.Typ.Span() }
+func (StringLiteral) statement()         {}
 
 type IntLiteral struct {
 	Typ token.Token
@@ -49,7 +158,8 @@ type IntLiteral struct {
 func (i IntLiteral) String() string {
 	return fmt.Sprint(i.Val)
 }
-func (IntLiteral) statement() {}
+func (i IntLiteral) Span() token.Span { return i.Typ.Span() }
+func (IntLiteral) statement()         {}
 
 type BoolLiteral struct {
 	Typ token.Token
@@ -59,7 +169,8 @@ type BoolLiteral struct {
 func (b BoolLiteral) String() string {
 	return fmt.Sprint(b.Val)
 }
-func (BoolLiteral) statement() {}
+func (b BoolLiteral) Span() token.Span { return b.Typ.Span() }
+func (BoolLiteral) statement()         {}
 
 type Identifier struct {
 	Tok token.Token
@@ -68,29 +179,105 @@ type Identifier struct {
 func (i Identifier) String() string {
 	return i.Tok.Literal
 }
-func (i Identifier) statement() {}
+func (i Identifier) Span() token.Span { return i.Tok.Span() }
+func (i Identifier) statement()       {}
 
 type VariableDeclarationStatement struct {
-	Tok   token.Token // variable type
-	Ident *Identifier // variable name
-	Value Expr        // variable value
+	Tok   token.Token   // variable type
+	Fun   *FunctionType // the type, if Tok is 'fun'
+	Ident *Identifier   // variable name
+	Value Expr          // variable value
+	End   token.Pos     // end of the statement (after the dot)
 }
 
 func (v VariableDeclarationStatement) String() string {
 	var res strings.Builder
-	res.WriteString(v.Tok.Literal)
+	res.WriteString(typeName(v.Tok, v.Fun))
 	res.WriteByte(' ')
 	res.WriteString(v.Ident.String())
 	res.WriteString(" = ")
 	res.WriteString(v.Value.String())
 	return res.String()
 }
-func (VariableDeclarationStatement) statement() {}
+func (v VariableDeclarationStatement) Span() token.Span { return span(v.Tok, v.End) }
+func (VariableDeclarationStatement) statement()         {}
+
+// const int MAX = (* 60 60).
+type ConstDeclaration struct {
+	Tok  token.Token // token.CONST
+	Decl Statement   // *VariableDeclarationStatement, or *ListVariableDeclarationStatement
+}
+
+func (c ConstDeclaration) String() string   { return "const " + c.Decl.String() }
+func (c ConstDeclaration) Span() token.Span { return span(c.Tok, c.Decl.Span().End) }
+func (ConstDeclaration) statement()         {}
 
 type VarType struct {
 	Tok        token.Token
 	IsList     bool
 	TypeOfList token.Token
+	Fun        *FunctionType // if Tok, or TypeOfList is 'fun'
+}
+
+func (v VarType) String() string {
+	if v.IsList {
+		return "listof " + typeName(v.TypeOfList, v.Fun)
+	}
+	return typeName(v.Tok, v.Fun)
+}
+
+func (v VarType) Span() token.Span {
+	return typeSpan(v.Tok, v.IsList, v.TypeOfList, v.Fun)
+}
+
+// fun(int, listof string) -> bool
+//
+// the type of a function. many return values are in parentheses:
+// fun(int) -> (int, bool)
+type FunctionType struct {
+	Tok     token.Token // token.FUN
+	Params  []VarType
+	Returns []VarType
+	End     token.Pos // after ')', or the return type
+}
+
+func (f FunctionType) String() string {
+	var params, returns []string
+	for _, v := range f.Params {
+		params = append(params, v.String())
+	}
+	for _, v := range f.Returns {
+		returns = append(returns, v.String())
+	}
+	res := "fun(" + strings.Join(params, ", ") + ")"
+	switch len(returns) {
+	case 0:
+		return res
+	case 1:
+		return res + " -> " + returns[0]
+	}
+	return res + " -> (" + strings.Join(returns, ", ") + ")"
+}
+func (f FunctionType) Span() token.Span { return span(f.Tok, f.End) }
+
+// the name of the type tok; fun is the type if tok is 'fun'
+func typeName(tok token.Token, fun *FunctionType) string {
+	if fun != nil {
+		return fun.String()
+	}
+	return tok.Literal
+}
+
+// the span of a type that's written as 'T', or 'listof T'
+func typeSpan(tok token.Token, isList bool, typeOfList token.Token, fun *FunctionType) token.Span {
+	res := tok.Span()
+	if isList {
+		res = res.Join(typeOfList.Span())
+	}
+	if fun != nil {
+		res = res.Join(fun.Span())
+	}
+	return res
 }
 
 /* This structure is a bit weird, isn't it ? */
@@ -99,20 +286,15 @@ type SubsequentVariableDeclarationStatement struct {
 	Types  []VarType
 	Names  []*Identifier
 	Values []Expr
+	End    token.Pos
 }
 
 func (s SubsequentVariableDeclarationStatement) String() string {
 	var res strings.Builder
 	for i, v := range s.Types {
 		putComma := i != len(s.Names)-1
-		if v.IsList {
-			res.WriteString("listof ")
-			res.WriteString(v.TypeOfList.Literal)
-			res.WriteByte(' ')
-		} else {
-			res.WriteString(v.Tok.Literal)
-			res.WriteByte(' ')
-		}
+		res.WriteString(v.String())
+		res.WriteByte(' ')
 		res.WriteString(s.Names[i].String())
 		res.WriteByte(' ')
 		if putComma {
@@ -130,12 +312,14 @@ func (s SubsequentVariableDeclarationStatement) String() string {
 	res.WriteByte('.')
 	return res.String()
 }
-func (SubsequentVariableDeclarationStatement) statement() {}
+func (s SubsequentVariableDeclarationStatement) Span() token.Span { return span(s.Tok, s.End) }
+func (SubsequentVariableDeclarationStatement) statement()         {}
 
 type ReassignmentStatement struct {
 	Tok      token.Token // IDENT token
 	Ident    *Identifier
 	NewValue Expr
+	End      token.Pos
 }
 
 func (r ReassignmentStatement) String() string {
@@ -148,11 +332,13 @@ func (r ReassignmentStatement) String() string {
 	}
 	return fmt.Sprintf("%s = %s.", name, r.NewValue.String())
 }
-func (ReassignmentStatement) statement() {}
+func (r ReassignmentStatement) Span() token.Span { return span(r.Tok, r.End) }
+func (ReassignmentStatement) statement()         {}
 
 type BlockStatement struct {
 	Tok   token.Token
 	Stmts []Statement
+	End   token.Pos // after 'end'
 }
 
 func (b BlockStatement) String() string {
@@ -163,11 +349,13 @@ func (b BlockStatement) String() string {
 	res += "\nend"
 	return res
 }
-func (BlockStatement) statement() {}
+func (b BlockStatement) Span() token.Span { return span(b.Tok, b.End) }
+func (BlockStatement) statement()         {}
 
 type ReturnStatement struct {
 	Tok          token.Token
 	ReturnValues []Expr
+	End          token.Pos
 }
 
 func (r ReturnStatement) String() string {
@@ -184,30 +372,36 @@ func (r ReturnStatement) String() string {
 	return res.String()
 }
 
-func (ReturnStatement) statement() {}
+func (r ReturnStatement) Span() token.Span { return span(r.Tok, r.End) }
+func (ReturnStatement) statement()         {}
 
 type BreakStatement struct {
 	Tok token.Token // token.BREAK
+	End token.Pos
 }
 
 func (b BreakStatement) String() string {
 	return b.Tok.Literal + "."
 }
-func (BreakStatement) statement() {}
+func (b BreakStatement) Span() token.Span { return span(b.Tok, b.End) }
+func (BreakStatement) statement()         {}
 
 type ContinueStatement struct {
 	Tok token.Token
+	End token.Pos
 }
 
 func (c ContinueStatement) String() string {
 	return c.Tok.Literal + "."
 }
-func (ContinueStatement) statement() {}
+func (c ContinueStatement) Span() token.Span { return span(c.Tok, c.End) }
+func (ContinueStatement) statement()         {}
 
 type LoopStatement struct {
 	Tok   token.Token
 	Cond  Expr
 	Stmts []Statement
+	End   token.Pos // after '}'
 }
 
 func (l LoopStatement) String() string {
@@ -226,25 +420,50 @@ func (l LoopStatement) String() string {
 	}
 	return res
 }
-func (LoopStatement) statement() {}
+func (l LoopStatement) Span() token.Span { return span(l.Tok, l.End) }
+func (LoopStatement) statement()         {}
 
 type DatatypeField struct {
-	Tok   token.Token
-	Ident *Identifier
+	Tok     token.Token
+	Fun     *FunctionType // the type, if Tok is 'fun'
+	Ident   *Identifier
+	Doc     *CommentGroup // comments on the lines right above the field
+	Comment *CommentGroup // comment at the end of the line of the field
 }
 
 func (d DatatypeField) String() string {
-	return fmt.Sprintf("%s %s", d.Tok.Literal, d.Ident.String())
+	return fmt.Sprintf("%s %s", typeName(d.Tok, d.Fun), d.Ident.String())
+}
+
+func (d DatatypeField) Span() token.Span {
+	if d.Ident == nil {
+		return typeSpan(d.Tok, false, token.Token{}, d.Fun)
+	}
+	return d.Tok.Span().Join(d.Ident.Span())
 }
 
 type DatatypeDeclaration struct {
 	Tok    token.Token
 	Name   *Identifier
 	Fields []*DatatypeField
+	// a sum type has variants instead of fields:
+	//
+	//	datatype Shape = Circle { int r } | Rect { int w int h }
+	Variants []*DatatypeVariant
+	End      token.Pos     // after '}'
+	Doc      *CommentGroup // comments on the lines right above 'datatype'
+	Comment  *CommentGroup // comment after '}'
 }
 
 func (d DatatypeDeclaration) String() string {
 	res := "datatype "
+	if len(d.Variants) > 0 {
+		var variants []string
+		for _, v := range d.Variants {
+			variants = append(variants, v.String())
+		}
+		return res + d.Name.String() + " = " + strings.Join(variants, " | ")
+	}
 	if d.Name != nil {
 		res += d.Name.String() + " {"
 	}
@@ -260,11 +479,125 @@ func (d DatatypeDeclaration) String() string {
 	res += "\n}"
 	return res
 }
-func (DatatypeDeclaration) statement() {}
+func (d DatatypeDeclaration) Span() token.Span { return span(d.Tok, d.End) }
+func (DatatypeDeclaration) statement()         {}
+
+// enum Color { Red Green Blue }
+type EnumDeclaration struct {
+	Tok     token.Token // token.ENUM
+	Name    *Identifier
+	Members []*Identifier
+	End     token.Pos     // after '}'
+	Doc     *CommentGroup // comments on the lines right above 'enum'
+	Comment *CommentGroup // comment after '}'
+}
+
+func (e EnumDeclaration) String() string {
+	var members []string
+	for _, m := range e.Members {
+		members = append(members, m.String())
+	}
+	return "enum " + e.Name.String() + " { " + strings.Join(members, " ") + " }"
+}
+func (e EnumDeclaration) Span() token.Span { return span(e.Tok, e.End) }
+func (EnumDeclaration) statement()         {}
+
+// a member of an enum; 'Color::Red'
+type EnumMember struct {
+	Enum   *Identifier
+	Member *Identifier
+}
+
+func (e EnumMember) String() string {
+	return e.Enum.String() + "::" + e.Member.String()
+}
+func (e EnumMember) Span() token.Span { return e.Enum.Span().Join(e.Member.Span()) }
+
+// a variant of a sum type; 'Circle { int r }'. a variant without fields may
+// have no braces.
+type DatatypeVariant struct {
+	Name   *Identifier
+	Fields []*DatatypeField
+	End    token.Pos // after '}', or the name
+}
+
+func (d DatatypeVariant) String() string {
+	var fields []string
+	for _, f := range d.Fields {
+		fields = append(fields, f.String())
+	}
+	if len(fields) == 0 {
+		return d.Name.String()
+	}
+	return d.Name.String() + " { " + strings.Join(fields, " ") + " }"
+}
+func (d DatatypeVariant) Span() token.Span { return span(d.Name.Tok, d.End) }
+
+// match s {
+//
+//	Circle c { ... }
+//	Rect { ... }
+//	else { ... }
+//
+// }
+type MatchStatement struct {
+	Tok     token.Token // token.MATCH
+	Value   Expr
+	Arms    []*MatchArm
+	Default *ElseStatement // nil if there's no else arm
+	End     token.Pos      // after '}'
+}
+
+func (m MatchStatement) String() string {
+	var res strings.Builder
+	res.WriteString("match ")
+	if m.Value != nil {
+		res.WriteString(m.Value.String())
+	}
+	res.WriteString(" {")
+	for _, v := range m.Arms {
+		res.WriteString("\n\t")
+		res.WriteString(strings.ReplaceAll(v.String(), "\n", "\n\t"))
+	}
+	if m.Default != nil {
+		res.WriteString("\n\t")
+		res.WriteString(strings.ReplaceAll(strings.TrimPrefix(m.Default.String(), " "), "\n", "\n\t"))
+	}
+	res.WriteString("\n}")
+	return res.String()
+}
+func (m MatchStatement) Span() token.Span { return span(m.Tok, m.End) }
+func (MatchStatement) statement()         {}
+
+type MatchArm struct {
+	Variant *Identifier
+	Name    *Identifier // the value, as a value of Variant; nil if it isn't named
+	Stmts   []Statement
+	End     token.Pos // after '}'
+}
+
+func (m MatchArm) String() string {
+	var res strings.Builder
+	res.WriteString(m.Variant.String())
+	if m.Name != nil {
+		res.WriteString(" " + m.Name.String())
+	}
+	res.WriteString(" {\n")
+	for _, v := range m.Stmts {
+		res.WriteByte('\t')
+		res.WriteString(v.String())
+		res.WriteByte('\n')
+	}
+	res.WriteByte('}')
+	return res.String()
+}
+func (m MatchArm) Span() token.Span { return span(m.Variant.Tok, m.End) }
 
 type PrefixExpr struct {
-	Tok  token.Token // operator (e.g. +, -, ', and, ...)
-	Args []Expr
+	Start token.Pos   // '('
+	Tok   token.Token // operator (e.g. +, -, ', and, ...)
+	Args  []Expr
+	End   token.Pos // after ')'
 }
 
 func (p PrefixExpr) String() string {
@@ -275,12 +608,23 @@ func (p PrefixExpr) String() string {
 	res = res + ")"
 	return res
 }
+func (p PrefixExpr) Span() token.Span {
+	if p.Start.Line == 0 || p.End.Line == 0 {
+		res := p.Tok.Span()
+		for _, v := range p.Args {
+			res = res.Join(spanOf(v))
+		}
+		return res
+	}
+	return token.Span{Start: p.Start, End: p.End}
+}
 func (PrefixExpr) statement() {}
 
 type FunctionCall struct {
 	Tok   token.Token
 	Ident *Identifier
 	Args  []Expr
+	End   token.Pos // after ')'
 }
 
 func (f FunctionCall) String() string {
@@ -298,13 +642,16 @@ func (f FunctionCall) String() string {
 	res += ")"
 	return res
 }
-func (FunctionCall) statement() {}
+func (f FunctionCall) Span() token.Span { return span(f.Tok, f.End) }
+func (FunctionCall) statement()         {}
 
 type Namespace struct {
 	Tok        token.Token
 	Identifier *Identifier // namespace identifier (e.g. Stdout)
 }
 
+func (n Namespace) Span() token.Span { return n.Tok.Span() }
+
 type FunctionCallFromNamespace struct {
 	Namespace *Namespace
 	Function  *FunctionCall
@@ -325,11 +672,22 @@ func (f FunctionCallFromNamespace) String() string {
 	}
 	return res
 }
+func (f FunctionCallFromNamespace) Span() token.Span {
+	var res token.Span
+	if f.Namespace != nil {
+		res = f.Namespace.Span()
+	}
+	if f.Function != nil {
+		res = res.Join(f.Function.Span())
+	}
+	return res
+}
 func (FunctionCallFromNamespace) statement() {}
 
 type ListLiteral struct {
 	Tok   token.Token // [
 	Elems []Expr
+	End   token.Pos // after ']'
 }
 
 func (l ListLiteral) String() string {
@@ -345,13 +703,16 @@ func (l ListLiteral) String() string {
 	res.WriteString("]")
 	return res.String()
 }
-func (ListLiteral) statement() {}
+func (l ListLiteral) Span() token.Span { return span(l.Tok, l.End) }
+func (ListLiteral) statement()         {}
 
 type ListVariableDeclarationStatement struct {
 	Tok  token.Token
-	Typ  token.Token // types of elements in the list
+	Typ  token.Token   // types of elements in the list
+	Fun  *FunctionType // the type of elements, if Typ is 'fun'
 	Name *Identifier
 	List Expr
+	End  token.Pos
 }
 
 func (l ListVariableDeclarationStatement) String() string {
@@ -364,14 +725,16 @@ func (l ListVariableDeclarationStatement) String() string {
 	if l.List != nil {
 		list = l.List.String()
 	}
-	res.WriteString(fmt.Sprintf("listof %s %s = %s.", l.Typ.Literal, ident, list))
+	res.WriteString(fmt.Sprintf("listof %s %s = %s.", typeName(l.Typ, l.Fun), ident, list))
 	return res.String()
 }
-func (ListVariableDeclarationStatement) statement() {}
+func (l ListVariableDeclarationStatement) Span() token.Span { return span(l.Tok, l.End) }
+func (ListVariableDeclarationStatement) statement()         {}
 
 type ElseStatement struct {
 	Tok   token.Token // token.ELSE
 	Stmts []Statement
+	End   token.Pos // after '}'
 }
 
 func (e ElseStatement) String() string {
@@ -385,7 +748,8 @@ func (e ElseStatement) String() string {
 	res.WriteByte('}')
 	return res.String()
 }
-func (ElseStatement) statement() {}
+func (e ElseStatement) Span() token.Span { return span(e.Tok, e.End) }
+func (ElseStatement) statement()         {}
 
 type IfStatement struct {
 	Tok         token.Token // token.IF
@@ -393,6 +757,7 @@ type IfStatement struct {
 	Stmts       []Statement
 	Alternative *IfStatement
 	Default     *ElseStatement
+	End         token.Pos // after '}' of this branch. alternatives have their own.
 }
 
 func (i IfStatement) String() string {
@@ -419,20 +784,55 @@ func (i IfStatement) String() string {
 	}
 	return res.String()
 }
+
+// span of the whole if statement, including elseif, and else branches.
+func (i IfStatement) Span() token.Span {
+	res := span(i.Tok, i.End)
+	if i.Alternative != nil {
+		res = res.Join(i.Alternative.Span())
+	}
+	if i.Default != nil {
+		res = res.Join(i.Default.Span())
+	}
+	return res
+}
 func (IfStatement) statement() {}
 
 type FunctionParameter struct {
 	Tok        token.Token // type of parameter (int, string, User, ...)
 	IsList     bool
 	TypeOfList token.Token
-	Name       *Identifier // name of parameter
+	Fun        *FunctionType // if Tok, or TypeOfList is 'fun'
+	Name       *Identifier   // name of parameter
+}
+
+// the type of the parameter
+func (f FunctionParameter) Type() VarType {
+	return VarType{Tok: f.Tok, IsList: f.IsList, TypeOfList: f.TypeOfList, Fun: f.Fun}
+}
+
+func (f FunctionParameter) Span() token.Span {
+	if f.Name == nil {
+		return f.Type().Span()
+	}
+	return f.Tok.Span().Join(f.Name.Span())
 }
 
 type FunctionReturnType struct {
 	Tok    token.Token // actual type (token.INTKW, token.STRINGKW, token.IDENT, etc.)
 	IsList bool        // since listof token is one token, and types of lists are composed of two tokens, ...
 	// listof int, listof string, listof City, ...
-	TypeOfList token.Token // int, string, City, ...
+	TypeOfList token.Token   // int, string, City, ...
+	Fun        *FunctionType // if Tok, or TypeOfList is 'fun'
+}
+
+// the type of the return value
+func (f FunctionReturnType) Type() VarType {
+	return VarType{Tok: f.Tok, IsList: f.IsList, TypeOfList: f.TypeOfList, Fun: f.Fun}
+}
+
+func (f FunctionReturnType) Span() token.Span {
+	return f.Type().Span()
 }
 
 type FunctionDeclarationStatement struct {
@@ -442,6 +842,9 @@ type FunctionDeclarationStatement struct {
 	ReturnCount int // how many things does this return ?
 	ReturnTypes []FunctionReturnType
 	Stmts       []Statement
+	End         token.Pos     // after '}'
+	Doc         *CommentGroup // comments on the lines right above 'fun'
+	Comment     *CommentGroup // comment after '}'
 }
 
 func (f FunctionDeclarationStatement) String() string {
@@ -455,11 +858,7 @@ func (f FunctionDeclarationStatement) String() string {
 	res.WriteByte('(')
 	for i, v := range f.Params {
 		putComma := i != len(f.Params)-1
-		res.WriteString(v.Tok.Literal)
-		if v.IsList {
-			res.WriteByte(' ')
-			res.WriteString(v.TypeOfList.Literal)
-		}
+		res.WriteString(v.Type().String())
 		res.WriteByte(' ')
 		res.WriteString(v.Name.String())
 		if putComma {
@@ -469,7 +868,7 @@ func (f FunctionDeclarationStatement) String() string {
 	res.WriteString(") -> ")
 	for i, v := range f.ReturnTypes {
 		putComma := i != len(f.ReturnTypes)-1
-		res.WriteString(v.Tok.Literal)
+		res.WriteString(v.Type().String())
 		if putComma {
 			res.WriteString(", ")
 		}
@@ -484,7 +883,8 @@ func (f FunctionDeclarationStatement) String() string {
 	res.WriteByte('}')
 	return res.String()
 }
-func (FunctionDeclarationStatement) statement() {}
+func (f FunctionDeclarationStatement) Span() token.Span { return span(f.Tok, f.End) }
+func (FunctionDeclarationStatement) statement()         {}
 
 // <ident>=<value>
 type DataypeLiteralField struct {
@@ -496,9 +896,18 @@ func (d DataypeLiteralField) String() string {
 	return fmt.Sprintf("%s=%s", d.Name.String(), d.Value.String())
 }
 
+func (d DataypeLiteralField) Span() token.Span {
+	var res token.Span
+	if d.Name != nil {
+		res = d.Name.Span()
+	}
+	return res.Join(spanOf(d.Value))
+}
+
 type DatatypeLiteral struct {
 	Tok    token.Token // token.IDENT
 	Fields []*DataypeLiteralField
+	End    token.Pos // after '}'
 }
 
 func (d DatatypeLiteral) String() string {
@@ -521,4 +930,19 @@ func (d DatatypeLiteral) String() string {
 	res.WriteByte('}')
 	return res.String()
 }
-func (DatatypeLiteral) statement() {}
+func (d DatatypeLiteral) Span() token.Span { return span(d.Tok, d.End) }
+func (DatatypeLiteral) statement()         {}
+
+// a statement that couldn't be parsed. the parser puts it in place of the erroneous
+// statement, so that the rest of the program can still be analyzed.
+type BadStatement struct {
+	Tok   token.Token   // first token of the statement
+	Names []*Identifier // variables that the statement (most likely) declares
+	End   token.Pos
+}
+
+func (b BadStatement) String() string {
+	return "<bad statement>"
+}
+func (b BadStatement) Span() token.Span { return span(b.Tok, b.End) }
+func (BadStatement) statement()         {}
@@ -0,0 +1,255 @@
+// bytecode for a stack-based virtual machine
+//
+// a program is compiled (Compile) from the IR to a list of functions. the code of
+// a function is a sequence of instructions; an opcode (one byte) followed by
+// its operands. operands are big-endian; 2 bytes, except for jump targets,
+// which are 4 bytes.
+//
+// every variable lives in a cell. parameters are passed by reference; if an
+// argument is a variable, the callee gets the cell of the variable, so assigning
+// to the parameter changes the variable of the caller. other arguments are put
+// in new cells.
+//
+// every function has a table of the positions in the Quoi source that its
+// instructions are compiled from; a runtime error is reported at the position
+// of the instruction that failed.
+//
+// compiled programs can be saved to, and loaded from .qbc files (Marshal,
+// Unmarshal), and run with Run.
+package bytecode
+
+import (
+	"encoding/binary"
+	"fmt"
+	"quoi/token"
+	"strconv"
+	"strings"
+)
+
+type Opcode byte
+
+const (
+	OpConst Opcode = iota // push Consts[k]
+	OpTrue
+	OpFalse
+	OpPop
+
+	OpLoad  // push the value of local s
+	OpStore // pop a value, and put it in the cell of local s
+	OpDecl  // pop a value, and put it in a new cell for local s
+	OpRef   // push the cell of local s
+	OpGLoad // same as above, for globals
+	OpGStore
+	OpGDecl
+	OpGRef
+	OpBox // pop a value, and push a new cell holding it
+
+	OpAdd // adds ints, or concatenates strings
+	OpSub
+	OpMul
+	OpDiv
+	OpEq
+	OpLt
+	OpLte
+	OpGt
+	OpGte
+	OpNot
+	OpIndex // pop an index, and a list (or a string), and push the element
+
+	OpList   // pop n values, and push a list of them
+	OpStruct // pop as many values as datatype d has fields, and push a value of d
+	OpGet    // pop a datatype value, and push its field i
+	OpSet    // pop a value v, and a datatype value; push a copy of it with field i set to v
+	OpIs     // pop a datatype value, and push whether it's a value of datatype d
+
+	OpJump        // jump to a
+	OpJumpIfFalse // pop a bool, and jump to a if it's false
+	OpJumpIfTrue  // pop a bool, and jump to a if it's true
+
+	OpCall   // pop argc cells, and call Funcs[f] with them
+	OpNative // pop argc values, and call the standard library function Natives[k]. its result (nil if none) is pushed.
+	OpReturn // return the top n values to the caller
+
+	OpPrint       // pop n values, and print them separated by spaces (like fmt.Println)
+	OpPrintQuoted // pop a string, and print it quoted
+
+	OpFunc      // push Funcs[f] as a value
+	OpNil       // push the zero value of a function type
+	OpCallValue // pop argc cells, and a function value; and call it with them
+
+	opCount
+)
+
+// operand widths in bytes
+var operands = [opCount][]int{
+	OpConst: {2},
+	OpLoad:  {2}, OpStore: {2}, OpDecl: {2}, OpRef: {2},
+	OpGLoad: {2}, OpGStore: {2}, OpGDecl: {2}, OpGRef: {2},
+	OpList: {2}, OpStruct: {2}, OpGet: {2}, OpSet: {2}, OpIs: {2},
+	OpJump: {4}, OpJumpIfFalse: {4}, OpJumpIfTrue: {4},
+	OpCall: {2, 2}, OpNative: {2, 2}, OpReturn: {2},
+	OpPrint: {2},
+	OpFunc:  {2}, OpCallValue: {2},
+}
+
+var opNames = [opCount]string{
+	OpConst: "CONST", OpTrue: "TRUE", OpFalse: "FALSE", OpPop: "POP",
+	OpLoad: "LOAD", OpStore: "STORE", OpDecl: "DECL", OpRef: "REF",
+	OpGLoad: "GLOAD", OpGStore: "GSTORE", OpGDecl: "GDECL", OpGRef: "GREF",
+	OpBox: "BOX",
+	OpAdd: "ADD", OpSub: "SUB", OpMul: "MUL", OpDiv: "DIV",
+	OpEq: "EQ", OpLt: "LT", OpLte: "LTE", OpGt: "GT", OpGte: "GTE", OpNot: "NOT",
+	OpIndex: "INDEX",
+	OpList:  "LIST", OpStruct: "STRUCT", OpGet: "GET", OpSet: "SET", OpIs: "IS",
+	OpJump: "JUMP", OpJumpIfFalse: "JUMPIFFALSE", OpJumpIfTrue: "JUMPIFTRUE",
+	OpCall: "CALL", OpNative: "NATIVE", OpReturn: "RETURN",
+	OpPrint: "PRINT", OpPrintQuoted: "PRINTQ",
+	OpFunc: "FUNC", OpNil: "NIL", OpCallValue: "CALLV",
+}
+
+func (op Opcode) String() string {
+	if op < opCount {
+		return opNames[op]
+	}
+	return fmt.Sprintf("OP(%d)", byte(op))
+}
+
+// size of the instruction in bytes, including the opcode
+func (op Opcode) size() int {
+	n := 1
+	for _, w := range operands[op] {
+		n += w
+	}
+	return n
+}
+
+type Datatype struct {
+	Name   string
+	Fields []string
+}
+
+type Func struct {
+	Name string
+	// parameters are the first locals
+	Params, Locals, Returns int
+	// names of locals, for the disassembler. a slot can be reused by variables
+	// in different scopes; so a name may be 'a|b'.
+	LocalNames []string
+	Code       []byte
+	// the instructions from Lines[i].IP up to Lines[i+1].IP are at Lines[i].Pos
+	// in the Quoi source. sorted by IP.
+	Lines []Line
+}
+
+type Line struct {
+	IP  int
+	Pos token.Pos
+}
+
+// the position in the Quoi source of the instruction at ip; zero if it's unknown
+func (fn *Func) pos(ip int) token.Pos {
+	var pos token.Pos
+	for _, l := range fn.Lines {
+		if l.IP > ip {
+			break
+		}
+		pos = l.Pos
+	}
+	return pos
+}
+
+type Program struct {
+	// name of the Quoi source file; "" if it's unknown
+	File string
+	// ints, and strings
+	Consts    []interface{}
+	Datatypes []Datatype
+	// standard library functions; 'namespace::name'
+	Natives []string
+	// names of global variables
+	Globals []string
+	// Funcs[0] is the top-level code of the program
+	Funcs []*Func
+}
+
+// decode the instruction at code[ip:]. ok is false if it's truncated, or the opcode is unknown.
+func decode(code []byte, ip int) (op Opcode, args []int, ok bool) {
+	op = Opcode(code[ip])
+	if op >= opCount || ip+op.size() > len(code) {
+		return op, nil, false
+	}
+	ip++
+	for _, w := range operands[op] {
+		switch w {
+		case 2:
+			args = append(args, int(binary.BigEndian.Uint16(code[ip:])))
+		case 4:
+			args = append(args, int(binary.BigEndian.Uint32(code[ip:])))
+		}
+		ip += w
+	}
+	return op, args, true
+}
+
+// Disassemble returns a human-readable listing of prg.
+func (prg *Program) Disassemble() string {
+	var res strings.Builder
+	fmt.Fprintf(&res, "globals: %s\n", strings.Join(prg.Globals, ", "))
+	for _, fn := range prg.Funcs {
+		fmt.Fprintf(&res, "\nfunc %s (params %d, locals %d, returns %d)\n", fn.Name, fn.Params, fn.Locals, fn.Returns)
+		for ip := 0; ip < len(fn.Code); {
+			op, args, ok := decode(fn.Code, ip)
+			if !(ok) {
+				fmt.Fprintf(&res, "\t%04d\tinvalid instruction %d\n", ip, fn.Code[ip])
+				break
+			}
+			var strs []string
+			for _, a := range args {
+				strs = append(strs, strconv.Itoa(a))
+			}
+			line := fmt.Sprintf("\t%04d\t%-12s%s", ip, op, strings.Join(strs, " "))
+			if c := prg.comment(fn, op, args); c != "" {
+				line = fmt.Sprintf("%-32s; %s", line, c)
+			}
+			res.WriteString(strings.TrimRight(line, " "))
+			res.WriteByte('\n')
+			ip += op.size()
+		}
+	}
+	return res.String()
+}
+
+// what the operands of an instruction refer to
+func (prg *Program) comment(fn *Func, op Opcode, args []int) string {
+	// the program may be invalid; so indexes are checked
+	name := func(names []string, i int) string {
+		if i < len(names) {
+			return names[i]
+		}
+		return "?"
+	}
+	switch op {
+	case OpConst:
+		if args[0] < len(prg.Consts) {
+			if s, ok := prg.Consts[args[0]].(string); ok {
+				return strconv.Quote(s)
+			}
+			return fmt.Sprint(prg.Consts[args[0]])
+		}
+	case OpLoad, OpStore, OpDecl, OpRef:
+		return name(fn.LocalNames, args[0])
+	case OpGLoad, OpGStore, OpGDecl, OpGRef:
+		return name(prg.Globals, args[0])
+	case OpStruct, OpIs:
+		if args[0] < len(prg.Datatypes) {
+			return prg.Datatypes[args[0]].Name
+		}
+	case OpCall, OpFunc:
+		if args[0] < len(prg.Funcs) {
+			return prg.Funcs[args[0]].Name
+		}
+	case OpNative:
+		return name(prg.Natives, args[0])
+	}
+	return ""
+}
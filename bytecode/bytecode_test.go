@@ -0,0 +1,294 @@
+package bytecode
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"quoi"
+	"quoi/analyzer"
+	"quoi/types"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func compile(t *testing.T, text string) *Program {
+	t.Helper()
+	res, ds := quoi.Compile(context.Background(), quoi.Source{Name: "a.q", Text: text}, quoi.Options{CheckOnly: true})
+	if ds.HasErrors() {
+		t.Fatalf("unexpected diagnostics: %+v", ds)
+	}
+	prg, err := Compile(res.IR)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return prg
+}
+
+// output of the program, followed by the panic message if it fails.
+// the program is run after a round trip through the .qbc format.
+func run(t *testing.T, prg *Program) string {
+	t.Helper()
+	prg, err := Unmarshal(prg.Marshal())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if err := Run(prg, &out); err != nil {
+		out.WriteString("panic: " + err.Error() + "\n")
+	}
+	return out.String()
+}
+
+// the test programs of the interpreter, which are also checked against the Go backend
+func TestPrograms(t *testing.T) {
+	files, _ := filepath.Glob(filepath.Join("..", "interp", "testdata", "*.q"))
+	if len(files) == 0 {
+		t.Fatal("no test programs")
+	}
+	for _, file := range files {
+		src, _ := os.ReadFile(file)
+		want, _ := os.ReadFile(strings.TrimSuffix(file, ".q") + ".out")
+		if got := run(t, compile(t, string(src))); got != string(want) {
+			t.Errorf("%s:\nwant=\n%s\ngot=\n%s", file, want, got)
+		}
+	}
+}
+
+func TestPassByReference(t *testing.T) {
+	tests := []struct {
+		name, input, want string
+	}{
+		{"README", `
+			int age = 30.
+			fun celebrate_birthday(int age) {
+				Stdout::println("Happy birthday").
+				age = (+ age 1).
+			}
+			celebrate_birthday(age).
+			Stdout::println(String::from_int(age)).`, "Happy birthday\n31\n"},
+		{"expressions are copied", `
+			fun inc(int n) -> int {
+				n = (+ n 1).
+				return n.
+			}
+			int x = 1.
+			Stdout::println(String::from_int(inc((+ x 0)))).
+			Stdout::println(String::from_int(inc(5))).
+			Stdout::println(String::from_int(x)).`, "2\n6\n1\n"},
+		{"through calls", `
+			fun inc(int n) {
+				n = (+ n 1).
+			}
+			fun inc_twice(int n) {
+				inc(n).
+				inc(n).
+			}
+			int x = 1.
+			block
+				int y = 10.
+				inc_twice(y).
+				inc_twice(x).
+				Stdout::println(String::from_int(y)).
+			end
+			Stdout::println(String::from_int(x)).`, "12\n3\n"},
+		{"datatypes, and lists", `
+			datatype User {
+				string name
+				int age
+			}
+			fun rename(User u, listof string names) {
+				u = (set u name "Hasan").
+				names = List::replace_string(names, 0, "Hasan").
+			}
+			User u = User{name="Jennifer" age=34}.
+			listof string names = ["Jennifer"].
+			rename(u, names).
+			Stdout::println((+ (get u name) " " (' names 0))).`, "Hasan Hasan\n"},
+		{"aliased parameters", `
+			fun f(int a, int b) {
+				a = 5.
+				Stdout::println(String::from_int(b)).
+			}
+			int x = 1.
+			f(x, x).`, "5\n"},
+	}
+	for _, tt := range tests {
+		if got := run(t, compile(t, tt.input)); got != tt.want {
+			t.Errorf("%s: want=%q got=%q", tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestRuntimeErrors(t *testing.T) {
+	tests := []struct {
+		input, want string
+		line, col   uint // where it happened
+	}{
+		{"int z = 0.\nint x = (/ 5 z).", "runtime error: integer divide by zero", 2, 9},
+		{"listof int nx = [1].\nint x = (' nx 1).", "runtime error: index out of range [1] with length 1", 2, 9},
+		{"fun f(int n) -> int {\n\treturn f(n).\n}\nint x = f(1).", "stack overflow: too many nested calls of f", 2, 9},
+		{"int x = Math::mod(5, String::index(\"a\", \"a\")).", "Math::mod: division by zero", 1, 9},
+		{"fun f(int n) -> int {\n\treturn (/ n 0).\n}\nint x = (+ 1\n\tf(2)).", "runtime error: integer divide by zero", 2, 9},
+	}
+	// not millions of frames
+	defer func(n int) { maxFrames = n }(maxFrames)
+	maxFrames = 1000
+	for _, tt := range tests {
+		// the positions are kept in .qbc files
+		prg, err := Unmarshal(compile(t, tt.input).Marshal())
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = Run(prg, &bytes.Buffer{})
+		rerr, ok := err.(*RuntimeError)
+		if !(ok) || err.Error() != tt.want {
+			t.Errorf("%q: want error %q, got %#v", tt.input, tt.want, err)
+			continue
+		}
+		if rerr.Pos.Line != tt.line || rerr.Pos.Col != tt.col {
+			t.Errorf("%q: want the error at %d:%d, got %d:%d", tt.input, tt.line, tt.col, rerr.Pos.Line, rerr.Pos.Col)
+		}
+	}
+}
+
+// the analyzer rejects such a datatype; the compiler doesn't recurse forever on it
+func TestSelfContainingDatatype(t *testing.T) {
+	typ := &types.Datatype{Name: "U"}
+	typ.Fields = []types.Field{{Name: "a", Type: types.Int}, {Name: "next", Type: typ}}
+	dt := &analyzer.IRDatatype{Name: "U", FieldCount: 2, Type: typ, Fields: []analyzer.IRDatatypeField{{Name: "a", Type: types.Int}, {Name: "next", Type: typ}}}
+	u := &analyzer.IRVariable{Name: "u", Type: typ, Value: &analyzer.IRDatatypeLiteral{Name: "U", FieldsAndValues: map[string]analyzer.IRExpression{}}}
+	_, err := Compile(&analyzer.IRProgram{Stmts: []analyzer.IRStatement{dt, u}})
+	if err == nil || err.Error() != "bytecode: datatype 'U' contains itself" {
+		t.Errorf("got %v", err)
+	}
+}
+
+func TestShortCircuit(t *testing.T) {
+	prg := compile(t, `
+		fun yes(string s) -> bool {
+			Stdout::print(s).
+			return true.
+		}
+		bool b = (or yes("a") yes("b")).
+		bool b2 = (and (not yes("c")) yes("d")).
+		bool b3 = (and yes("e") (or (not yes("f")) yes("g"))).
+		Stdout::println(String::from_bool(b3)).`)
+	if got := run(t, prg); got != "acefgtrue\n" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestDisassemble(t *testing.T) {
+	prg := compile(t, `
+		fun double(int n) -> int {
+			return (* n 2).
+		}
+		int x = 0.
+		loop (lt x 10) {
+			x = (+ double(x) 1).
+		}
+		Stdout::println(String::from_int(x)).`)
+	want := `globals: x
+
+func <top> (params 0, locals 0, returns 0)
+	0000	CONST       1             ; 0
+	0003	GDECL       0             ; x
+	0006	GLOAD       0             ; x
+	0009	CONST       2             ; 10
+	0012	LT
+	0013	JUMPIFFALSE 38
+	0018	GREF        0             ; x
+	0021	CALL        1 1           ; double
+	0026	CONST       3             ; 1
+	0029	ADD
+	0030	GSTORE      0             ; x
+	0033	JUMP        6
+	0038	GLOAD       0             ; x
+	0041	NATIVE      0 1           ; String::from_int
+	0046	NATIVE      1 1           ; Stdout::println
+	0051	POP
+	0052	RETURN      0
+
+func double (params 1, locals 1, returns 1)
+	0000	LOAD        0             ; n
+	0003	CONST       0             ; 2
+	0006	MUL
+	0007	RETURN      1
+	0010	RETURN      0
+`
+	if got := prg.Disassemble(); got != want {
+		t.Errorf("want=\n%s\ngot=\n%s", want, got)
+	}
+}
+
+func TestMarshal(t *testing.T) {
+	prg := compile(t, `
+		datatype User {
+			string name
+			int age
+		}
+		fun f(User u) -> User, int {
+			return (set u age -1), 5.
+		}
+		User u, int n = f(User{name="Jennifer"}).
+		Stdout::println((get u name)).`)
+	prg.File = "a.q"
+	data := prg.Marshal()
+	got, err := Unmarshal(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !(reflect.DeepEqual(prg, got)) {
+		t.Errorf("round trip changed the program:\n%s\n%s", prg.Disassemble(), got.Disassemble())
+	}
+	// a truncated file is an error; not a panic
+	for i := 0; i < len(data); i++ {
+		if _, err := Unmarshal(data[:i]); err == nil {
+			t.Errorf("no error for a file truncated at %d", i)
+		}
+	}
+	if _, err := Unmarshal(append(data, 0)); err == nil {
+		t.Errorf("no error for garbage at the end")
+	}
+}
+
+func TestVerify(t *testing.T) {
+	valid := func() *Program {
+		return &Program{Consts: []interface{}{1}, Funcs: []*Func{{Name: topLevel, Code: []byte{byte(OpConst), 0, 0, byte(OpPop), byte(OpReturn), 0, 0}}}}
+	}
+	if _, err := Unmarshal(valid().Marshal()); err != nil {
+		t.Fatalf("valid program: %s", err)
+	}
+	tests := []struct {
+		name   string
+		change func(prg *Program)
+	}{
+		{"constant out of range", func(prg *Program) { prg.Consts = nil }},
+		{"unknown opcode", func(prg *Program) { prg.Funcs[0].Code[3] = byte(opCount) }},
+		{"truncated instruction", func(prg *Program) { prg.Funcs[0].Code = prg.Funcs[0].Code[:6] }},
+		{"no return", func(prg *Program) { prg.Funcs[0].Code = prg.Funcs[0].Code[:4] }},
+		{"jump into an instruction", func(prg *Program) {
+			prg.Funcs[0].Code = append([]byte{byte(OpJump), 0, 0, 0, 6}, prg.Funcs[0].Code...)
+		}},
+		{"unknown native", func(prg *Program) { prg.Natives = []string{"Math::nope"} }},
+		{"local out of range", func(prg *Program) { prg.Funcs[0].Code[3] = byte(OpDecl) }},
+		{"datatype out of range", func(prg *Program) { prg.Funcs[0].Code[3] = byte(OpIs) }},
+		{"position out of the code", func(prg *Program) { prg.Funcs[0].Lines = []Line{{IP: 7}} }},
+		{"unsorted positions", func(prg *Program) { prg.Funcs[0].Lines = []Line{{IP: 3}, {IP: 0}} }},
+	}
+	for _, tt := range tests {
+		prg := valid()
+		tt.change(prg)
+		if _, err := Unmarshal(prg.Marshal()); err == nil {
+			t.Errorf("%s: no error", tt.name)
+		}
+	}
+	if _, err := Unmarshal([]byte("QBC\x00\x09")); err == nil || !(strings.Contains(err.Error(), "version")) {
+		t.Errorf("unsupported version: %v", err)
+	}
+	if _, err := Unmarshal([]byte("package main")); err == nil {
+		t.Errorf("not a .qbc file: no error")
+	}
+}
@@ -0,0 +1,686 @@
+package bytecode
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"quoi/analyzer"
+	"quoi/std"
+	"quoi/token"
+	"quoi/types"
+	"strconv"
+	"strings"
+)
+
+// name of the function holding the top-level code
+const topLevel = "<top>"
+
+// name of the local holding the value of a match statement
+const matchValue = "<match>"
+
+type compiler struct {
+	prg       *Program
+	consts    map[interface{}]int
+	natives   map[string]int
+	funcs     map[string]int
+	datatypes map[string]int
+	dtDecls   map[string]*analyzer.IRDatatype
+	globals   map[string]int
+	// datatypes whose zero value is being compiled
+	zeroing map[string]bool
+	err     error
+}
+
+// variables declared in a block
+type scope struct {
+	names  map[string]int
+	parent *scope
+}
+
+type loop struct {
+	start  int
+	breaks []int // jumps to patch with the end of the loop
+}
+
+// compiles a single function
+type funcCompiler struct {
+	*compiler
+	fn    *Func
+	scope *scope
+	// variables in the outermost scope of the top-level code are globals
+	top   bool
+	next  int // next free slot
+	loops []*loop
+}
+
+// Compile compiles a typechecked program to bytecode.
+// it fails only if the program exceeds the limits of the format (e.g. more than 65535 constants),
+// or if it's not a program that the analyzer accepts (e.g. a datatype contains itself).
+func Compile(ir *analyzer.IRProgram) (*Program, error) {
+	c := &compiler{
+		prg:       &Program{},
+		consts:    map[interface{}]int{},
+		natives:   map[string]int{},
+		funcs:     map[string]int{},
+		datatypes: map[string]int{},
+		dtDecls:   map[string]*analyzer.IRDatatype{},
+		globals:   map[string]int{},
+		zeroing:   map[string]bool{},
+	}
+	top := &funcCompiler{compiler: c, fn: &Func{Name: topLevel}, top: true}
+	c.prg.Funcs = append(c.prg.Funcs, top.fn)
+	// functions, and datatypes can be used before they are declared
+	for _, s := range ir.Stmts {
+		switch s := s.(type) {
+		case *analyzer.IRFunction:
+			c.funcs[s.Name] = len(c.prg.Funcs)
+			c.prg.Funcs = append(c.prg.Funcs, &Func{Name: s.Name})
+		case *analyzer.IRDatatype:
+			c.datatype(s)
+		}
+	}
+	top.pushScope()
+	top.block(ir.Stmts)
+	top.emit(OpReturn, 0)
+	top.finish()
+	if c.err != nil {
+		return nil, c.err
+	}
+	return c.prg, nil
+}
+
+func (c *compiler) errorf(format string, args ...interface{}) {
+	if c.err == nil {
+		c.err = fmt.Errorf("bytecode: "+format, args...)
+	}
+}
+
+// index into a table with 2-byte indexes
+func (c *compiler) index(i int, what string) int {
+	if i > math.MaxUint16 {
+		c.errorf("too many %s", what)
+	}
+	return i
+}
+
+func (c *compiler) datatype(d *analyzer.IRDatatype) {
+	if _, ok := c.dtDecls[d.Name]; ok {
+		return
+	}
+	// a sum type has no values of its own; they are values of its variants
+	if len(d.Variants) > 0 {
+		c.dtDecls[d.Name] = d
+		for _, v := range d.Variants {
+			c.datatype(v)
+		}
+		return
+	}
+	dt := Datatype{Name: d.Name}
+	for _, f := range d.Fields {
+		dt.Fields = append(dt.Fields, f.Name)
+	}
+	c.datatypes[d.Name] = c.index(len(c.prg.Datatypes), "datatypes")
+	c.dtDecls[d.Name] = d
+	c.prg.Datatypes = append(c.prg.Datatypes, dt)
+}
+
+func (c *compiler) constant(v interface{}) int {
+	if i, ok := c.consts[v]; ok {
+		return i
+	}
+	i := c.index(len(c.prg.Consts), "constants")
+	c.consts[v] = i
+	c.prg.Consts = append(c.prg.Consts, v)
+	return i
+}
+
+func (c *compiler) native(ns, name string) int {
+	key := ns + "::" + name
+	if i, ok := c.natives[key]; ok {
+		return i
+	}
+	i := c.index(len(c.prg.Natives), "standard library functions")
+	c.natives[key] = i
+	c.prg.Natives = append(c.prg.Natives, key)
+	return i
+}
+
+func (fc *funcCompiler) emit(op Opcode, args ...int) int {
+	pos := len(fc.fn.Code)
+	fc.fn.Code = append(fc.fn.Code, byte(op))
+	for i, w := range operands[op] {
+		switch w {
+		case 2:
+			fc.fn.Code = append(fc.fn.Code, 0, 0)
+			binary.BigEndian.PutUint16(fc.fn.Code[len(fc.fn.Code)-2:], uint16(fc.index(args[i], "operands")))
+		case 4:
+			fc.fn.Code = append(fc.fn.Code, 0, 0, 0, 0)
+			binary.BigEndian.PutUint32(fc.fn.Code[len(fc.fn.Code)-4:], uint32(args[i]))
+		}
+	}
+	return pos
+}
+
+// the next instructions are compiled from pos in the Quoi source. an unknown
+// position (of code that isn't from the source) doesn't change the table.
+func (fc *funcCompiler) at(pos token.Pos) {
+	if pos.Line == 0 {
+		return
+	}
+	lines := fc.fn.Lines
+	ip := len(fc.fn.Code)
+	switch {
+	case len(lines) > 0 && lines[len(lines)-1].Pos == pos:
+	case len(lines) > 0 && lines[len(lines)-1].IP == ip:
+		// no instructions at the previous position
+		lines[len(lines)-1].Pos = pos
+	default:
+		fc.fn.Lines = append(lines, Line{IP: ip, Pos: pos})
+	}
+}
+
+// set the target of the jump at pos to the current position
+func (fc *funcCompiler) patch(pos int) {
+	binary.BigEndian.PutUint32(fc.fn.Code[pos+1:], uint32(len(fc.fn.Code)))
+}
+
+func (fc *funcCompiler) pushScope() {
+	fc.scope = &scope{names: map[string]int{}, parent: fc.scope}
+}
+
+// slots of the variables in the scope are reused by the following scopes
+func (fc *funcCompiler) popScope() {
+	fc.next -= len(fc.scope.names)
+	fc.scope = fc.scope.parent
+}
+
+func (fc *funcCompiler) isGlobalScope() bool {
+	return fc.top && fc.scope.parent == nil
+}
+
+// the instruction that declares name with the value on top of the stack.
+// a slot is given to name if it doesn't have one.
+func (fc *funcCompiler) reserve(name string) (Opcode, int) {
+	if fc.isGlobalScope() {
+		g, ok := fc.globals[name]
+		if !(ok) {
+			g = fc.index(len(fc.prg.Globals), "global variables")
+			fc.globals[name] = g
+			fc.prg.Globals = append(fc.prg.Globals, name)
+		}
+		return OpGDecl, g
+	}
+	slot, ok := fc.scope.names[name]
+	if !(ok) {
+		slot = fc.next
+		fc.next++
+		fc.scope.names[name] = slot
+		if fc.next > fc.fn.Locals {
+			fc.fn.Locals = fc.next
+			fc.fn.LocalNames = append(fc.fn.LocalNames, name)
+		} else if !(strings.Contains("|"+fc.fn.LocalNames[slot]+"|", "|"+name+"|")) {
+			fc.fn.LocalNames[slot] += "|" + name
+		}
+	}
+	return OpDecl, slot
+}
+
+func (fc *funcCompiler) declare(name string) {
+	fc.emit(fc.reserve(name))
+}
+
+// emit the local, or the global variant of op (OpLoad, OpStore, or OpRef) for name
+func (fc *funcCompiler) variable(op Opcode, name string) {
+	for s := fc.scope; s != nil; s = s.parent {
+		if slot, ok := s.names[name]; ok {
+			fc.emit(op, slot)
+			return
+		}
+	}
+	g, ok := fc.globals[name]
+	if !(ok) {
+		fc.errorf("undefined variable '%s'", name)
+		return
+	}
+	fc.emit(op+(OpGLoad-OpLoad), g)
+}
+
+func (fc *funcCompiler) finish() {
+	if fc.fn.Locals != len(fc.fn.LocalNames) {
+		panic("bytecode: local names are out of sync")
+	}
+}
+
+func (fc *funcCompiler) block(stmts []analyzer.IRStatement) {
+	for _, s := range stmts {
+		fc.stmt(s)
+	}
+}
+
+// compile stmts in a new scope
+func (fc *funcCompiler) scopedBlock(stmts []analyzer.IRStatement) {
+	fc.pushScope()
+	fc.block(stmts)
+	fc.popScope()
+}
+
+func (fc *funcCompiler) stmt(s analyzer.IRStatement) {
+	fc.at(s.Pos())
+	switch s := s.(type) {
+	case *analyzer.IRVariable:
+		fc.expr(s.Value)
+		fc.declare(s.Name)
+	case *analyzer.IRSubseq:
+		// globals are numbered in the order of the names; but values are popped in reverse.
+		// (locals can't be given slots before the values are compiled; a value may
+		// refer to a variable in an outer scope, that a name shadows.)
+		if fc.isGlobalScope() {
+			for _, name := range s.Names {
+				fc.reserve(name)
+			}
+		}
+		fc.values(s.Values)
+		for i := len(s.Names) - 1; i >= 0; i-- {
+			fc.declare(s.Names[i])
+		}
+	case *analyzer.IRReassigment:
+		fc.expr(s.NewValue)
+		fc.variable(OpStore, s.Name)
+	case *analyzer.IRShow:
+		if s.Type == types.Void {
+			fc.callStmt(s.Value)
+			return
+		}
+		fc.values([]analyzer.IRExpression{s.Value})
+		if s.Type == types.String {
+			fc.emit(OpPrintQuoted)
+			return
+		}
+		fc.emit(OpPrint, len(types.Split(s.Type)))
+	case *analyzer.IRFunctionCall, *analyzer.IRFunctionCallFromNamespace:
+		fc.callStmt(s.(analyzer.IRExpression))
+	case *analyzer.IRIf:
+		fc.if_(s.Cond, s.Block, s.Alternative, s.Default)
+	case *analyzer.IRBlock:
+		fc.scopedBlock(s.Stmts)
+	case *analyzer.IRLoop:
+		l := &loop{start: len(fc.fn.Code)}
+		fc.loops = append(fc.loops, l)
+		if s.Cond != nil {
+			fc.expr(s.Cond)
+			l.breaks = append(l.breaks, fc.emit(OpJumpIfFalse, 0))
+		}
+		fc.scopedBlock(s.Stmts)
+		fc.emit(OpJump, l.start)
+		for _, pos := range l.breaks {
+			fc.patch(pos)
+		}
+		fc.loops = fc.loops[:len(fc.loops)-1]
+	case *analyzer.IRMatch:
+		fc.match(s)
+	case *analyzer.IRBreak:
+		l := fc.loops[len(fc.loops)-1]
+		l.breaks = append(l.breaks, fc.emit(OpJump, 0))
+	case *analyzer.IRContinue:
+		fc.emit(OpJump, fc.loops[len(fc.loops)-1].start)
+	case *analyzer.IRReturn:
+		fc.values(s.ReturnValues)
+		fc.emit(OpReturn, fc.fn.Returns)
+	case *analyzer.IRFunction:
+		fc.function(s)
+	case *analyzer.IRDatatype:
+		fc.datatype(s)
+	case *analyzer.IREnum:
+		// the members of an enum are their names
+	default:
+		panic("bytecode: unknown statement " + s.String())
+	}
+}
+
+func (fc *funcCompiler) if_(cond analyzer.IRExpression, block []analyzer.IRStatement, alt *analyzer.IRElseIf, def *analyzer.IRElse) {
+	fc.expr(cond)
+	next := fc.emit(OpJumpIfFalse, 0)
+	fc.scopedBlock(block)
+	if alt == nil && def == nil {
+		fc.patch(next)
+		return
+	}
+	end := fc.emit(OpJump, 0)
+	fc.patch(next)
+	if alt != nil {
+		fc.if_(alt.Cond, alt.Block, alt.Alternative, alt.Default)
+	} else {
+		fc.scopedBlock(def.Block)
+	}
+	fc.patch(end)
+}
+
+// the value is kept in a local; every arm checks if it's a value of its variant
+func (fc *funcCompiler) match(s *analyzer.IRMatch) {
+	fc.pushScope()
+	fc.expr(s.Value)
+	fc.declare(matchValue)
+	var ends []int
+	for _, arm := range s.Arms {
+		fc.variable(OpLoad, matchValue)
+		fc.emit(OpIs, fc.datatypes[arm.Variant.Name])
+		next := fc.emit(OpJumpIfFalse, 0)
+		fc.pushScope()
+		if arm.Name != "" {
+			fc.variable(OpLoad, matchValue)
+			fc.declare(arm.Name)
+		}
+		fc.block(arm.Block)
+		fc.popScope()
+		ends = append(ends, fc.emit(OpJump, 0))
+		fc.patch(next)
+	}
+	if s.Default != nil {
+		fc.scopedBlock(s.Default.Block)
+	}
+	for _, pos := range ends {
+		fc.patch(pos)
+	}
+	fc.popScope()
+}
+
+func (fc *funcCompiler) function(s *analyzer.IRFunction) {
+	i, ok := fc.funcs[s.Name]
+	if !(ok) {
+		fc.errorf("function '%s' is not declared at the top level", s.Name)
+		return
+	}
+	fn := fc.prg.Funcs[i]
+	fn.Params, fn.Returns = len(s.ParamNames), s.ReturnsCount
+	f := &funcCompiler{compiler: fc.compiler, fn: fn}
+	f.pushScope()
+	for _, name := range s.ParamNames {
+		f.scope.names[name] = f.next
+		f.next++
+		fn.LocalNames = append(fn.LocalNames, name)
+	}
+	fn.Locals = f.next
+	f.block(s.Block)
+	// functions returning values never get here (the analyzer makes sure that
+	// they return); but jumps to the end of an if may still point here.
+	f.emit(OpReturn, 0)
+	f.finish()
+}
+
+// push every value of exprs. calls push all of their return values.
+func (fc *funcCompiler) values(exprs []analyzer.IRExpression) {
+	for _, v := range exprs {
+		switch v := v.(type) {
+		case *analyzer.IRFunctionCall:
+			fc.call(v)
+		default:
+			fc.expr(v)
+		}
+	}
+}
+
+// a call whose return values are not used
+func (fc *funcCompiler) callStmt(c analyzer.IRExpression) {
+	switch c := c.(type) {
+	case *analyzer.IRFunctionCall:
+		fc.call(c)
+		for i := 0; i < c.ReturnsCount; i++ {
+			fc.emit(OpPop)
+		}
+	case *analyzer.IRFunctionCallFromNamespace:
+		fc.expr(c)
+		fc.emit(OpPop)
+	}
+}
+
+// call a user-defined function. arguments are passed by reference; constants
+// are passed in new cells, like values.
+func (fc *funcCompiler) call(c *analyzer.IRFunctionCall) {
+	i, ok := fc.funcs[c.Name]
+	if c.Value != nil {
+		// a function value; it's below the arguments
+		fc.expr(c.Value)
+	} else if !(ok) {
+		fc.errorf("undefined function '%s'", c.Name)
+		return
+	}
+	for _, arg := range c.Takes {
+		if v, ok := arg.(*analyzer.IRVariableReference); ok && !(v.Const) {
+			fc.variable(OpRef, v.Name)
+			continue
+		}
+		fc.expr(arg)
+		fc.emit(OpBox)
+	}
+	// the arguments may be at other positions
+	fc.at(c.Pos())
+	if c.Value != nil {
+		fc.emit(OpCallValue, len(c.Takes))
+		return
+	}
+	fc.emit(OpCall, i, len(c.Takes))
+}
+
+func (fc *funcCompiler) expr(x analyzer.IRExpression) {
+	switch x := x.(type) {
+	case *analyzer.IRInt:
+		n, err := strconv.Atoi(x.Value)
+		if err != nil {
+			panic("bytecode: invalid integer " + x.Value)
+		}
+		fc.emit(OpConst, fc.constant(n))
+	case *analyzer.IRString:
+		fc.emit(OpConst, fc.constant(x.Value))
+	case *analyzer.IRBoolean:
+		if x.Value == "true" {
+			fc.emit(OpTrue)
+		} else {
+			fc.emit(OpFalse)
+		}
+	case *analyzer.IRVariableReference:
+		fc.variable(OpLoad, x.Name)
+	case *analyzer.IRList:
+		for _, v := range x.Value {
+			fc.expr(v)
+		}
+		fc.emit(OpList, len(x.Value))
+	case *analyzer.IRDatatypeLiteral:
+		d := fc.dtDecls[x.Name]
+		if d == nil {
+			fc.errorf("undefined datatype '%s'", x.Name)
+			return
+		}
+		for _, f := range d.Fields {
+			if v, ok := x.FieldsAndValues[f.Name]; ok {
+				fc.expr(v)
+			} else {
+				fc.zero(f.Type)
+			}
+		}
+		fc.emit(OpStruct, fc.datatypes[x.Name])
+	case *analyzer.IRFunctionCall:
+		fc.call(x)
+		// only the first value is used
+		for i := 1; i < x.ReturnsCount; i++ {
+			fc.emit(OpPop)
+		}
+	case *analyzer.IRFunctionCallFromNamespace:
+		if std.Lookup(x.Namespace, x.Name) == nil {
+			fc.errorf("undefined function '%s::%s'", x.Namespace, x.Name)
+			return
+		}
+		for _, v := range x.Takes {
+			fc.expr(v)
+		}
+		fc.at(x.Pos())
+		fc.emit(OpNative, fc.native(x.Namespace, x.Name), len(x.Takes))
+	case *analyzer.IRPrefExpr:
+		fc.prefExpr(x)
+	case *analyzer.IREnumMember:
+		fc.emit(OpConst, fc.constant(x.Name))
+	case *analyzer.IREnumName:
+		fc.expr(x.Value)
+	case *analyzer.IRFunctionReference:
+		i, ok := fc.funcs[x.Name]
+		if !(ok) {
+			fc.errorf("undefined function '%s'", x.Name)
+			return
+		}
+		fc.emit(OpFunc, i)
+	default:
+		panic("bytecode: unknown expression " + x.String())
+	}
+}
+
+// push the zero value of typ
+func (fc *funcCompiler) zero(typ types.Type) {
+	switch typ {
+	case types.Int:
+		fc.emit(OpConst, fc.constant(0))
+	case types.String:
+		fc.emit(OpConst, fc.constant(""))
+	case types.Bool:
+		fc.emit(OpFalse)
+	default:
+		switch t := typ.(type) {
+		case *types.List:
+			fc.emit(OpList, 0)
+			return
+		case *types.Enum:
+			fc.emit(OpConst, fc.constant(t.Members[0]))
+			return
+		case *types.Func:
+			fc.emit(OpNil)
+			return
+		}
+		d := fc.decl(typ)
+		if d == nil {
+			fc.errorf("undefined datatype '%s'", typ)
+			return
+		}
+		// the first variant of a sum type
+		if len(d.Variants) > 0 {
+			d = d.Variants[0]
+		}
+		// the zero value would be infinite
+		if fc.zeroing[d.Name] {
+			fc.errorf("datatype '%s' contains itself", d.Name)
+			return
+		}
+		fc.zeroing[d.Name] = true
+		for _, f := range d.Fields {
+			fc.zero(f.Type)
+		}
+		delete(fc.zeroing, d.Name)
+		fc.emit(OpStruct, fc.datatypes[d.Name])
+	}
+}
+
+var binaryOps = map[string]Opcode{
+	"+": OpAdd, "-": OpSub, "*": OpMul, "/": OpDiv,
+	"=": OpEq, "lt": OpLt, "lte": OpLte, "gt": OpGt, "gte": OpGte,
+}
+
+func (fc *funcCompiler) prefExpr(x *analyzer.IRPrefExpr) {
+	ops := x.Operands
+	switch x.Operator {
+	case "+", "-", "*", "/", "=", "lt", "lte", "gt", "gte":
+		fc.expr(ops[0])
+		for _, v := range ops[1:] {
+			fc.expr(v)
+			fc.at(x.Pos())
+			fc.emit(binaryOps[x.Operator])
+		}
+	case "and", "or":
+		jump, short := OpJumpIfFalse, OpFalse
+		if x.Operator == "or" {
+			jump, short = OpJumpIfTrue, OpTrue
+		}
+		fc.expr(ops[0])
+		shortCircuit := fc.emit(jump, 0)
+		fc.expr(ops[1])
+		end := fc.emit(OpJump, 0)
+		fc.patch(shortCircuit)
+		fc.emit(short)
+		fc.patch(end)
+	case "not":
+		fc.expr(ops[0])
+		fc.emit(OpNot)
+	case "'":
+		fc.expr(ops[0])
+		fc.expr(ops[1])
+		fc.at(x.Pos())
+		fc.emit(OpIndex)
+	case "get":
+		fc.expr(ops[0])
+		fc.emit(OpGet, fc.field(ops[0], ops[1]))
+	case "set":
+		fc.expr(ops[0])
+		fc.expr(ops[2])
+		fc.emit(OpSet, fc.field(ops[0], ops[1]))
+	default:
+		panic("bytecode: unknown operator " + x.Operator)
+	}
+}
+
+// index of the field (an identifier) in the datatype of dt
+func (fc *funcCompiler) field(dt, field analyzer.IRExpression) int {
+	name := field.(*analyzer.IRVariableReference).Name
+	d := fc.decl(fc.typeOf(dt))
+	if d == nil {
+		fc.errorf("unknown datatype of '%s'", dt)
+		return 0
+	}
+	for i, f := range d.Fields {
+		if f.Name == name {
+			return i
+		}
+	}
+	fc.errorf("no field '%s' in datatype '%s'", name, d.Name)
+	return 0
+}
+
+// the declaration of the datatype t; nil if t isn't one
+func (fc *funcCompiler) decl(t types.Type) *analyzer.IRDatatype {
+	if t, ok := t.(*types.Datatype); ok {
+		return fc.dtDecls[t.Name]
+	}
+	return nil
+}
+
+// the type of a datatype-valued expression; nil if it's unknown
+func (fc *funcCompiler) typeOf(x analyzer.IRExpression) types.Type {
+	switch x := x.(type) {
+	case *analyzer.IRVariableReference:
+		return x.Type
+	case *analyzer.IRDatatypeLiteral:
+		return &types.Datatype{Name: x.Name}
+	case *analyzer.IRList:
+		return x.Type
+	case *analyzer.IRFunctionCall:
+		if len(x.Returns) > 0 {
+			return x.Returns[0]
+		}
+	case *analyzer.IRPrefExpr:
+		switch x.Operator {
+		case "set":
+			return fc.typeOf(x.Operands[0])
+		case "get":
+			// type of the field
+			d := fc.decl(fc.typeOf(x.Operands[0]))
+			if d != nil {
+				name := x.Operands[1].(*analyzer.IRVariableReference).Name
+				for _, f := range d.Fields {
+					if f.Name == name {
+						return f.Type
+					}
+				}
+			}
+		case "'":
+			if l, ok := fc.typeOf(x.Operands[0]).(*types.List); ok {
+				return l.Elem
+			}
+		}
+	}
+	return nil
+}
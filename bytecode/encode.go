@@ -0,0 +1,299 @@
+package bytecode
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// .qbc files start with magic, and the version of the format.
+// integers are varints (encoding/binary), and strings are prefixed with their length.
+//
+//	magic version
+//	file:      name of the Quoi source
+//	consts:    count, (tag value)...        tag is 0 for ints, and 1 for strings
+//	datatypes: count, (name count fields...)...
+//	natives:   count, names...
+//	globals:   count, names...
+//	funcs:     count, (name params locals returns count localNames... len code lines)...
+//	lines:     count, (ip offset line col)...
+const (
+	magic   = "QBC\x00"
+	version = 2
+)
+
+const (
+	tagInt = iota
+	tagString
+)
+
+type encoder struct {
+	bytes.Buffer
+}
+
+func (e *encoder) int(n int) {
+	var buf [binary.MaxVarintLen64]byte
+	e.Write(buf[:binary.PutVarint(buf[:], int64(n))])
+}
+
+func (e *encoder) string(s string) {
+	e.int(len(s))
+	e.WriteString(s)
+}
+
+func (e *encoder) strings(strs []string) {
+	e.int(len(strs))
+	for _, s := range strs {
+		e.string(s)
+	}
+}
+
+// Marshal encodes prg in the .qbc format.
+func (prg *Program) Marshal() []byte {
+	var e encoder
+	e.WriteString(magic)
+	e.WriteByte(version)
+	e.string(prg.File)
+	e.int(len(prg.Consts))
+	for _, c := range prg.Consts {
+		switch c := c.(type) {
+		case int:
+			e.WriteByte(tagInt)
+			e.int(c)
+		case string:
+			e.WriteByte(tagString)
+			e.string(c)
+		default:
+			panic(fmt.Sprintf("bytecode: invalid constant %v", c))
+		}
+	}
+	e.int(len(prg.Datatypes))
+	for _, dt := range prg.Datatypes {
+		e.string(dt.Name)
+		e.strings(dt.Fields)
+	}
+	e.strings(prg.Natives)
+	e.strings(prg.Globals)
+	e.int(len(prg.Funcs))
+	for _, fn := range prg.Funcs {
+		e.string(fn.Name)
+		e.int(fn.Params)
+		e.int(fn.Locals)
+		e.int(fn.Returns)
+		e.strings(fn.LocalNames)
+		e.string(string(fn.Code))
+		e.int(len(fn.Lines))
+		for _, l := range fn.Lines {
+			e.int(l.IP)
+			e.int(int(l.Pos.Offset))
+			e.int(int(l.Pos.Line))
+			e.int(int(l.Pos.Col))
+		}
+	}
+	return e.Bytes()
+}
+
+type decoder struct {
+	r   *bytes.Reader
+	err error
+}
+
+func (d *decoder) int() int {
+	if d.err != nil {
+		return 0
+	}
+	n, err := binary.ReadVarint(d.r)
+	if err != nil {
+		d.err = err
+	}
+	return int(n)
+}
+
+func (d *decoder) uint() uint {
+	n := d.int()
+	if n < 0 {
+		d.fail("invalid position %d", n)
+		return 0
+	}
+	return uint(n)
+}
+
+// a count of things that follow. each of them takes at least a byte.
+func (d *decoder) count() int {
+	n := d.int()
+	if n < 0 || n > d.r.Len() {
+		d.fail("invalid count %d", n)
+		return 0
+	}
+	return n
+}
+
+func (d *decoder) string() string {
+	n := d.count()
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(d.r, buf); err != nil && d.err == nil {
+		d.err = err
+	}
+	return string(buf)
+}
+
+func (d *decoder) strings() []string {
+	var res []string
+	for n := d.count(); n > 0 && d.err == nil; n-- {
+		res = append(res, d.string())
+	}
+	return res
+}
+
+func (d *decoder) fail(format string, args ...interface{}) {
+	if d.err == nil {
+		d.err = fmt.Errorf(format, args...)
+	}
+}
+
+// Unmarshal decodes a program encoded by Marshal. the program is verified; so
+// Run can't go out of the bounds of its tables, or its code.
+func Unmarshal(data []byte) (*Program, error) {
+	if !(bytes.HasPrefix(data, []byte(magic))) {
+		return nil, errors.New("bytecode: not a .qbc file")
+	}
+	if len(data) < len(magic)+1 || data[len(magic)] != version {
+		return nil, errors.New("bytecode: unsupported version of the .qbc format")
+	}
+	d := &decoder{r: bytes.NewReader(data[len(magic)+1:])}
+	prg := &Program{File: d.string()}
+	for n := d.count(); n > 0 && d.err == nil; n-- {
+		tag, err := d.r.ReadByte()
+		if err != nil {
+			d.err = err
+			break
+		}
+		switch tag {
+		case tagInt:
+			prg.Consts = append(prg.Consts, d.int())
+		case tagString:
+			prg.Consts = append(prg.Consts, d.string())
+		default:
+			d.fail("invalid constant tag %d", tag)
+		}
+	}
+	for n := d.count(); n > 0 && d.err == nil; n-- {
+		prg.Datatypes = append(prg.Datatypes, Datatype{Name: d.string(), Fields: d.strings()})
+	}
+	prg.Natives = d.strings()
+	prg.Globals = d.strings()
+	for n := d.count(); n > 0 && d.err == nil; n-- {
+		fn := &Func{Name: d.string(), Params: d.int(), Locals: d.int(), Returns: d.int()}
+		fn.LocalNames = d.strings()
+		fn.Code = []byte(d.string())
+		for n := d.count(); n > 0 && d.err == nil; n-- {
+			l := Line{IP: d.int()}
+			l.Pos.Offset, l.Pos.Line, l.Pos.Col = d.uint(), d.uint(), d.uint()
+			fn.Lines = append(fn.Lines, l)
+		}
+		prg.Funcs = append(prg.Funcs, fn)
+	}
+	if d.err == nil && d.r.Len() > 0 {
+		d.fail("%d bytes of garbage at the end", d.r.Len())
+	}
+	if d.err != nil {
+		return nil, fmt.Errorf("bytecode: invalid .qbc file: %w", d.err)
+	}
+	if err := prg.verify(); err != nil {
+		return nil, fmt.Errorf("bytecode: invalid .qbc file: %w", err)
+	}
+	return prg, nil
+}
+
+// check that every instruction is valid, and its operands are in range
+func (prg *Program) verify() error {
+	if len(prg.Funcs) == 0 {
+		return errors.New("no top-level code")
+	}
+	for _, name := range prg.Natives {
+		if lookupNative(name) == nil {
+			return fmt.Errorf("unknown standard library function '%s'", name)
+		}
+	}
+	for _, fn := range prg.Funcs {
+		if fn.Params < 0 || fn.Returns < 0 || fn.Params > fn.Locals || fn.Locals != len(fn.LocalNames) {
+			return fmt.Errorf("%s: invalid parameter, local, or return count", fn.Name)
+		}
+		for i, l := range fn.Lines {
+			if l.IP < 0 || l.IP >= len(fn.Code) || i > 0 && l.IP <= fn.Lines[i-1].IP {
+				return fmt.Errorf("%s: invalid position table", fn.Name)
+			}
+		}
+		// jumps must land on instructions
+		starts := map[int]bool{}
+		var jumps []int
+		ip := 0
+		for ip < len(fn.Code) {
+			starts[ip] = true
+			op, args, ok := decode(fn.Code, ip)
+			if !(ok) {
+				return fmt.Errorf("%s: invalid instruction at %d", fn.Name, ip)
+			}
+			if err := prg.verifyOperands(fn, op, args); err != nil {
+				return fmt.Errorf("%s: %s at %d: %w", fn.Name, op, ip, err)
+			}
+			switch op {
+			case OpJump, OpJumpIfFalse, OpJumpIfTrue:
+				jumps = append(jumps, args[0])
+			}
+			ip += op.size()
+		}
+		for _, target := range jumps {
+			if !(starts[target]) {
+				return fmt.Errorf("%s: jump to %d is not to an instruction", fn.Name, target)
+			}
+		}
+		// the code must not run off its end
+		if len(fn.Code) == 0 || Opcode(fn.Code[lastInstr(fn.Code)]) != OpReturn && Opcode(fn.Code[lastInstr(fn.Code)]) != OpJump {
+			return fmt.Errorf("%s: code doesn't end with a return, or a jump", fn.Name)
+		}
+	}
+	return nil
+}
+
+// position of the last instruction of valid code
+func lastInstr(code []byte) int {
+	last := 0
+	for ip := 0; ip < len(code); ip += Opcode(code[ip]).size() {
+		last = ip
+	}
+	return last
+}
+
+func (prg *Program) verifyOperands(fn *Func, op Opcode, args []int) error {
+	inRange := func(i, n int, what string) error {
+		if i >= n {
+			return fmt.Errorf("%s %d is out of range", what, i)
+		}
+		return nil
+	}
+	switch op {
+	case OpConst:
+		return inRange(args[0], len(prg.Consts), "constant")
+	case OpLoad, OpStore, OpDecl, OpRef:
+		return inRange(args[0], fn.Locals, "local")
+	case OpGLoad, OpGStore, OpGDecl, OpGRef:
+		return inRange(args[0], len(prg.Globals), "global")
+	case OpStruct, OpIs:
+		return inRange(args[0], len(prg.Datatypes), "datatype")
+	case OpCall:
+		if err := inRange(args[0], len(prg.Funcs), "function"); err != nil {
+			return err
+		}
+		if args[1] != prg.Funcs[args[0]].Params {
+			return fmt.Errorf("%d arguments for %d parameters", args[1], prg.Funcs[args[0]].Params)
+		}
+	case OpNative:
+		return inRange(args[0], len(prg.Natives), "standard library function")
+	case OpFunc:
+		return inRange(args[0], len(prg.Funcs), "function")
+	}
+	return nil
+}
@@ -0,0 +1,264 @@
+package bytecode
+
+import (
+	"fmt"
+	"io"
+	"quoi/rt"
+	"quoi/std"
+	"strconv"
+	"strings"
+)
+
+// a runtime error stops the program
+type RuntimeError = rt.Error
+
+// a value of a datatype
+type Struct struct {
+	Type   *Datatype
+	Fields []interface{}
+}
+
+func (s Struct) FieldValues() []interface{} {
+	return s.Fields
+}
+
+// a variable. parameters share the cells of the arguments.
+type cell struct {
+	v interface{}
+}
+
+type frame struct {
+	fn     *Func
+	ip     int
+	locals []*cell
+	// size of the stack when the function was called
+	base int
+}
+
+// how many nested function calls there can be. the frames aren't on the Go
+// stack; so it's about as deep as a small recursive function goes in the Go
+// backend, whose stack is limited to 1GB. a variable for the tests.
+var maxFrames = 5000000
+
+type vm struct {
+	prg     *Program
+	out     io.Writer
+	natives []*std.Func
+	globals []*cell
+	stack   []interface{}
+	frames  []frame
+}
+
+// Run runs prg, writing its output to out.
+// a runtime error is returned as *RuntimeError.
+func Run(prg *Program, out io.Writer) (err error) {
+	m := &vm{prg: prg, out: out, globals: make([]*cell, len(prg.Globals))}
+	for _, name := range prg.Natives {
+		fn := lookupNative(name)
+		if fn == nil {
+			return fmt.Errorf("bytecode: unknown standard library function '%s'", name)
+		}
+		m.natives = append(m.natives, fn)
+	}
+	for i := range m.globals {
+		m.globals[i] = &cell{}
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			rerr := rt.ToError(r)
+			// the instruction that failed; ip is already past it
+			if f := m.frames[len(m.frames)-1]; f.ip > 0 {
+				rerr.Pos = f.fn.pos(f.ip - 1)
+			}
+			err = rerr
+		}
+	}()
+	m.call(prg.Funcs[0], nil)
+	m.run()
+	return nil
+}
+
+func lookupNative(name string) *std.Func {
+	i := strings.Index(name, "::")
+	if i < 0 {
+		return nil
+	}
+	return std.Lookup(name[:i], name[i+2:])
+}
+
+func (m *vm) push(v interface{}) {
+	m.stack = append(m.stack, v)
+}
+
+func (m *vm) pop() interface{} {
+	v := m.stack[len(m.stack)-1]
+	m.stack = m.stack[:len(m.stack)-1]
+	return v
+}
+
+// pop n values
+func (m *vm) popN(n int) []interface{} {
+	res := make([]interface{}, n)
+	copy(res, m.stack[len(m.stack)-n:])
+	m.stack = m.stack[:len(m.stack)-n]
+	return res
+}
+
+func (m *vm) call(fn *Func, args []interface{}) {
+	if len(m.frames) >= maxFrames {
+		panic(&RuntimeError{Msg: "stack overflow: too many nested calls of " + fn.Name})
+	}
+	locals := make([]*cell, fn.Locals)
+	for i, c := range args {
+		locals[i] = c.(*cell)
+	}
+	m.frames = append(m.frames, frame{fn: fn, locals: locals, base: len(m.stack)})
+}
+
+func (m *vm) run() {
+	f := &m.frames[len(m.frames)-1]
+	for {
+		code := f.fn.Code
+		op := Opcode(code[f.ip])
+		var a, b int
+		switch len(operands[op]) {
+		case 1:
+			if operands[op][0] == 2 {
+				a = int(code[f.ip+1])<<8 | int(code[f.ip+2])
+			} else {
+				a = int(code[f.ip+1])<<24 | int(code[f.ip+2])<<16 | int(code[f.ip+3])<<8 | int(code[f.ip+4])
+			}
+		case 2:
+			a = int(code[f.ip+1])<<8 | int(code[f.ip+2])
+			b = int(code[f.ip+3])<<8 | int(code[f.ip+4])
+		}
+		f.ip += op.size()
+
+		switch op {
+		case OpConst:
+			m.push(m.prg.Consts[a])
+		case OpTrue:
+			m.push(true)
+		case OpFalse:
+			m.push(false)
+		case OpPop:
+			m.pop()
+		case OpLoad:
+			m.push(f.locals[a].v)
+		case OpStore:
+			f.locals[a].v = m.pop()
+		case OpDecl:
+			f.locals[a] = &cell{v: m.pop()}
+		case OpRef:
+			m.push(f.locals[a])
+		case OpGLoad:
+			m.push(m.globals[a].v)
+		case OpGStore:
+			m.globals[a].v = m.pop()
+		case OpGDecl:
+			m.globals[a] = &cell{v: m.pop()}
+		case OpGRef:
+			m.push(m.globals[a])
+		case OpBox:
+			m.push(&cell{v: m.pop()})
+		case OpAdd:
+			y, x := m.pop(), m.pop()
+			if s, ok := x.(string); ok {
+				m.push(s + y.(string))
+			} else {
+				m.push(x.(int) + y.(int))
+			}
+		case OpSub, OpMul, OpDiv, OpLt, OpLte, OpGt, OpGte:
+			y, x := m.pop().(int), m.pop().(int)
+			m.push(arith(op, x, y))
+		case OpEq:
+			y, x := m.pop(), m.pop()
+			m.push(x == y)
+		case OpNot:
+			m.push(!(m.pop().(bool)))
+		case OpIndex:
+			idx, v := m.pop().(int), m.pop()
+			m.push(rt.Index(v, idx))
+		case OpList:
+			m.push(m.popN(a))
+		case OpStruct:
+			dt := &m.prg.Datatypes[a]
+			m.push(Struct{Type: dt, Fields: m.popN(len(dt.Fields))})
+		case OpGet:
+			m.push(m.pop().(Struct).Fields[a])
+		case OpIs:
+			m.push(m.pop().(Struct).Type == &m.prg.Datatypes[a])
+		case OpSet:
+			// the operand isn't changed; it's copied
+			v, old := m.pop(), m.pop().(Struct)
+			res := Struct{Type: old.Type, Fields: make([]interface{}, len(old.Fields))}
+			copy(res.Fields, old.Fields)
+			res.Fields[a] = v
+			m.push(res)
+		case OpJump:
+			f.ip = a
+		case OpJumpIfFalse:
+			if !(m.pop().(bool)) {
+				f.ip = a
+			}
+		case OpJumpIfTrue:
+			if m.pop().(bool) {
+				f.ip = a
+			}
+		case OpCall:
+			m.call(m.prg.Funcs[a], m.popN(b))
+			f = &m.frames[len(m.frames)-1]
+		case OpNative:
+			m.push(m.natives[a].Native(m.out, m.popN(b)))
+		case OpFunc:
+			m.push(m.prg.Funcs[a])
+		case OpNil:
+			m.push((*Func)(nil))
+		case OpCallValue:
+			args := m.popN(a)
+			fn := m.pop().(*Func)
+			if fn == nil {
+				panic(&RuntimeError{Msg: "runtime error: invalid memory address or nil pointer dereference"})
+			}
+			m.call(fn, args)
+			f = &m.frames[len(m.frames)-1]
+		case OpReturn:
+			ret := m.popN(a)
+			m.stack = append(m.stack[:f.base], ret...)
+			m.frames = m.frames[:len(m.frames)-1]
+			if len(m.frames) == 0 {
+				return
+			}
+			f = &m.frames[len(m.frames)-1]
+		case OpPrint:
+			var strs []string
+			for _, v := range m.popN(a) {
+				strs = append(strs, rt.Format(v))
+			}
+			fmt.Fprintln(m.out, strings.Join(strs, " "))
+		case OpPrintQuoted:
+			fmt.Fprintln(m.out, strconv.Quote(m.pop().(string)))
+		default:
+			panic(fmt.Sprintf("bytecode: invalid instruction %d", op))
+		}
+	}
+}
+
+func arith(op Opcode, x, y int) interface{} {
+	switch op {
+	case OpSub:
+		return x - y
+	case OpMul:
+		return x * y
+	case OpDiv:
+		// panics with Go's own runtime error if y is 0
+		return x / y
+	case OpLt:
+		return x < y
+	case OpLte:
+		return x <= y
+	case OpGt:
+		return x > y
+	}
+	return x >= y
+}
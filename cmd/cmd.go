@@ -1,63 +1,115 @@
 // compile and run
+//
+// generated Go programs are built inside a private, temporary Go module, so
+// nothing is written to the current directory, except for the executables that
+// are asked for.
 package cmd
 
 import (
+	"errors"
+	"fmt"
 	"io"
 	"os"
 	"os/exec"
-	"syscall"
+	"path/filepath"
+	"runtime"
 )
 
 const (
-	_FILE_NAME = "main.go"
+	_FILE_NAME   = "main.go"
+	_MODULE_NAME = "quoiprogram"
+	_GO_MOD      = "module " + _MODULE_NAME + "\n\ngo 1.16\n"
 )
 
-func saveFile(source, fname string) error {
-	f, err := os.Create(fname)
+// a temporary Go module containing a single main package
+type workspace struct {
+	dir string
+}
+
+func newWorkspace(source string) (*workspace, error) {
+	dir, err := os.MkdirTemp("", "quoi-")
 	if err != nil {
-		return err
+		return nil, fmt.Errorf("create temporary directory: %w", err)
+	}
+	w := &workspace{dir: dir}
+	if err := os.WriteFile(filepath.Join(dir, "go.mod"), []byte(_GO_MOD), 0644); err != nil {
+		w.remove()
+		return nil, fmt.Errorf("save go.mod: %w", err)
 	}
-	_, err = io.WriteString(f, source)
-	return err
+	if err := os.WriteFile(filepath.Join(dir, _FILE_NAME), []byte(source), 0644); err != nil {
+		w.remove()
+		return nil, fmt.Errorf("save %s: %w", _FILE_NAME, err)
+	}
+	return w, nil
 }
 
-func deleteFile(fname string) {
-	if err := os.Remove(fname); err != nil {
-		panic(err)
-	}
+func (w *workspace) remove() {
+	os.RemoveAll(w.dir)
 }
 
-func goCmd(cmd string) {
+// build the program in the workspace to output. go's own error messages are written to stderr.
+func (w *workspace) build(output string, stderr io.Writer) error {
 	bin, err := exec.LookPath("go")
 	if err != nil {
-		panic("quoi: `go` not found")
+		return errors.New("`go` not found")
 	}
-	args := []string{"go", cmd, _FILE_NAME}
-	env := os.Environ()
-	err = syscall.Exec(bin, args, env)
-	if err != nil {
-		panic("quoi: exec: " + err.Error())
+	c := exec.Command(bin, "build", "-o", output, ".")
+	c.Dir = w.dir
+	c.Stdout = stderr
+	c.Stderr = stderr
+	if err := c.Run(); err != nil {
+		return fmt.Errorf("go build: %w", err)
 	}
+	return nil
 }
 
-func RunProgram(source string) {
-	if err := saveFile(source, _FILE_NAME); err != nil {
-		panic("quoi: save file: " + err.Error())
+func exeName(name string) string {
+	if runtime.GOOS == "windows" {
+		return name + ".exe"
 	}
-	goCmd("run")
-	deleteFile(_FILE_NAME)
+	return name
 }
 
-func GetExecutable(source string) {
-	if err := saveFile(source, _FILE_NAME); err != nil {
-		panic("quoi: save file: " + err.Error())
+// RunProgram builds source (a Go program), and runs it with the given standard streams.
+// it returns the exit code of the program.
+//
+// the error is non-nil only if the program couldn't be built, or started.
+func RunProgram(source string, stdin io.Reader, stdout, stderr io.Writer) (int, error) {
+	w, err := newWorkspace(source)
+	if err != nil {
+		return -1, err
 	}
-	goCmd("build")
-	deleteFile(_FILE_NAME)
+	defer w.remove()
+	bin := filepath.Join(w.dir, exeName(_MODULE_NAME))
+	if err := w.build(bin, stderr); err != nil {
+		return -1, err
+	}
+	c := exec.Command(bin)
+	c.Stdin = stdin
+	c.Stdout = stdout
+	c.Stderr = stderr
+	err = c.Run()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode(), nil
+	}
+	if err != nil {
+		return -1, fmt.Errorf("run program: %w", err)
+	}
+	return 0, nil
 }
 
-func GetGo(source string) {
-	if err := saveFile(source, _FILE_NAME); err != nil {
-		panic("quoi: save file: " + err.Error())
+// GetExecutable builds source (a Go program), and places the executable at output.
+// go's own error messages are written to stderr.
+func GetExecutable(source, output string, stderr io.Writer) error {
+	output, err := filepath.Abs(output)
+	if err != nil {
+		return fmt.Errorf("output path: %w", err)
+	}
+	w, err := newWorkspace(source)
+	if err != nil {
+		return err
 	}
+	defer w.remove()
+	return w.build(output, stderr)
 }
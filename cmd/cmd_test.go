@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func skipIfNoGo(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go toolchain not found")
+	}
+}
+
+const program = `package main
+
+import (
+	"fmt"
+	"os"
+)
+
+func main() {
+	fmt.Println("out")
+	fmt.Fprintln(os.Stderr, "err")
+	os.Exit(7)
+}
+`
+
+func TestRunProgram(t *testing.T) {
+	skipIfNoGo(t)
+	// the current directory must not be touched.
+	dir := t.TempDir()
+	wd, _ := os.Getwd()
+	defer os.Chdir(wd)
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	var stdout, stderr bytes.Buffer
+	code, err := RunProgram(program, nil, &stdout, &stderr)
+	if err != nil {
+		t.Fatalf("RunProgram: %s", err)
+	}
+	if code != 7 {
+		t.Errorf("exit code: want=7 got=%d", code)
+	}
+	if stdout.String() != "out\n" {
+		t.Errorf("stdout: %q", stdout.String())
+	}
+	if stderr.String() != "err\n" {
+		t.Errorf("stderr: %q", stderr.String())
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 0 {
+		t.Errorf("RunProgram left %d file(s) in the current directory", len(entries))
+	}
+}
+
+func TestRunProgramBuildError(t *testing.T) {
+	skipIfNoGo(t)
+	var stderr bytes.Buffer
+	_, err := RunProgram("package main\n\nfunc main() { x }\n", nil, nil, &stderr)
+	if err == nil {
+		t.Fatalf("expected an error")
+	}
+	if !(strings.Contains(stderr.String(), "undefined: x")) {
+		t.Errorf("go's error message is not forwarded: %q", stderr.String())
+	}
+}
+
+func TestGetExecutable(t *testing.T) {
+	skipIfNoGo(t)
+	output := filepath.Join(t.TempDir(), exeName("prog"))
+	if err := GetExecutable(program, output, os.Stderr); err != nil {
+		t.Fatalf("GetExecutable: %s", err)
+	}
+	out, err := exec.Command(output).Output()
+	if string(out) != "out\n" {
+		t.Errorf("stdout: %q", out)
+	}
+	if exitErr, ok := err.(*exec.ExitError); !(ok) || exitErr.ExitCode() != 7 {
+		t.Errorf("exit code: %v", err)
+	}
+}
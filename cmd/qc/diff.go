@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// lines of a diff. ' ' for lines in both, '-' for deleted, '+' for inserted lines.
+type diffLine struct {
+	op   byte
+	text string
+}
+
+// diff the lines of a, and b; using the longest common subsequence.
+func diffLines(a, b []string) []diffLine {
+	// lcs[i][j] is the length of the lcs of a[i:], and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	var res []diffLine
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			res = append(res, diffLine{' ', a[i]})
+			i++
+			j++
+		case j == len(b) || i < len(a) && lcs[i+1][j] >= lcs[i][j+1]:
+			res = append(res, diffLine{'-', a[i]})
+			i++
+		default:
+			res = append(res, diffLine{'+', b[j]})
+			j++
+		}
+	}
+	return res
+}
+
+// lines of context around changes
+const diffContext = 3
+
+// unifiedDiff returns the changes from a to b in the unified format; "" if
+// there aren't any.
+func unifiedDiff(nameA, nameB, a, b string) string {
+	split := func(s string) []string {
+		res := strings.SplitAfter(s, "\n")
+		if res[len(res)-1] == "" {
+			res = res[:len(res)-1]
+		}
+		return res
+	}
+	lines := diffLines(split(a), split(b))
+	var res strings.Builder
+	// line numbers (0-based) in a, and b, at lines[k]
+	lineA, lineB := make([]int, len(lines)+1), make([]int, len(lines)+1)
+	for k, l := range lines {
+		lineA[k+1], lineB[k+1] = lineA[k], lineB[k]
+		if l.op != '+' {
+			lineA[k+1]++
+		}
+		if l.op != '-' {
+			lineB[k+1]++
+		}
+	}
+	for k := 0; k < len(lines); {
+		if lines[k].op == ' ' {
+			k++
+			continue
+		}
+		// a hunk; from the context before k, to the context after the last change
+		// that is close enough to the previous one
+		start, end := k-diffContext, k
+		if start < 0 {
+			start = 0
+		}
+		for end < len(lines) {
+			if lines[end].op != ' ' {
+				end++
+				continue
+			}
+			next := end
+			for next < len(lines) && lines[next].op == ' ' {
+				next++
+			}
+			if next == len(lines) || next-end > 2*diffContext {
+				break
+			}
+			end = next
+		}
+		end += diffContext
+		if end > len(lines) {
+			end = len(lines)
+		}
+		if res.Len() == 0 {
+			fmt.Fprintf(&res, "--- %s\n+++ %s\n", nameA, nameB)
+		}
+		fmt.Fprintf(&res, "@@ -%d,%d +%d,%d @@\n", lineA[start]+1, lineA[end]-lineA[start], lineB[start]+1, lineB[end]-lineB[start])
+		for _, l := range lines[start:end] {
+			res.WriteByte(l.op)
+			res.WriteString(l.text)
+			if !(strings.HasSuffix(l.text, "\n")) {
+				res.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+		k = end
+	}
+	return res.String()
+}
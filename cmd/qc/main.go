@@ -0,0 +1,615 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"quoi"
+	"quoi/analyzer"
+	"quoi/ast"
+	"quoi/bytecode"
+	"quoi/cmd"
+	"quoi/diagnostic"
+	"quoi/format"
+	"quoi/interp"
+	"quoi/lexer"
+	"quoi/lsp"
+	"quoi/repl"
+	"quoi/std"
+	"quoi/token"
+	"strings"
+)
+
+// exit codes of qc.
+const (
+	exitOK           = 0
+	exitCompileError = 1 // the program has lexer, parser, or analyzer errors
+	exitUsage        = 2 // bad command line
+	exitFailure      = 3 // reading/writing files, or invoking the go toolchain failed
+)
+
+const usage = `qc is the Quoi compiler.
+
+Usage:
+
+	qc <command> [arguments]
+
+Commands:
+
+	run     compile, and run a Quoi program
+	build   compile a Quoi program to an executable, or to bytecode
+	exec    run a bytecode file
+	check   check a Quoi program for errors without generating code
+	fmt     format Quoi programs
+	emit    print an intermediate form of a Quoi program (go, ast, ir, bytecode, tokens)
+	repl    start an interactive session
+	lsp     start a language server (LSP over stdio)
+	doc     print the documentation of the standard library
+	help    print help for a command
+
+Use "qc help <command>" for more information about a command.
+`
+
+type command struct {
+	name, usage string
+	flags       *flag.FlagSet
+	run         func(c *command, args []string) int
+}
+
+func newCommand(name, usage string, run func(c *command, args []string) int) *command {
+	c := &command{name: name, usage: usage, run: run}
+	c.flags = flag.NewFlagSet(name, flag.ContinueOnError)
+	c.flags.SetOutput(os.Stderr)
+	c.flags.Usage = func() {
+		fmt.Fprintf(c.flags.Output(), "usage: %s\n", c.usage)
+		c.flags.PrintDefaults()
+	}
+	return c
+}
+
+// flags
+var (
+	buildOutput string
+	emitOutput  string
+	diagFormat  string
+	runInterp   bool
+	buildBC     bool
+	fmtWrite    bool
+	fmtDiff     bool
+	fmtList     bool
+)
+
+// register flags shared by the commands that compile a program
+func addCompileFlags(c *command) *command {
+	c.flags.StringVar(&diagFormat, "diagnostics", "text", "format of the errors: `text`, or json (one JSON object per line)")
+	return c
+}
+
+var commands []*command
+
+func init() {
+	build := addCompileFlags(newCommand("build", "qc build [--diagnostics=text|json] [--bytecode] [-o output] file.q", buildCmd))
+	build.flags.StringVar(&buildOutput, "o", "", "write the executable to `output` (default: source file name without '.q', or with '.qbc' for bytecode)")
+	build.flags.BoolVar(&buildBC, "bytecode", false, "compile to a bytecode file that 'qc exec' runs, instead of an executable")
+	emit := addCompileFlags(newCommand("emit", "qc emit [--diagnostics=text|json] [-o output] go|ast|ir|bytecode|tokens file.q\n       qc emit [-o output] bytecode file.qbc", emitCmd))
+	emit.flags.StringVar(&emitOutput, "o", "", "write to `output` instead of stdout")
+	run := addCompileFlags(newCommand("run", "qc run [--diagnostics=text|json] [--interp] file.q", runCmd))
+	run.flags.BoolVar(&runInterp, "interp", false, "run the program with the interpreter, instead of compiling it with the go toolchain")
+	fmt_ := newCommand("fmt", "qc fmt [-w | -d | -l] file.q...", fmtCmd)
+	fmt_.flags.BoolVar(&fmtWrite, "w", false, "write the formatted program to the file, instead of stdout")
+	fmt_.flags.BoolVar(&fmtDiff, "d", false, "print a diff of the changes, instead of the formatted program")
+	fmt_.flags.BoolVar(&fmtList, "l", false, "list the files that aren't formatted, instead of printing the formatted programs")
+	commands = []*command{
+		run,
+		build,
+		newCommand("exec", "qc exec file.qbc", execCmd),
+		addCompileFlags(newCommand("check", "qc check [--diagnostics=text|json] file.q", checkCmd)),
+		fmt_,
+		emit,
+		newCommand("repl", "qc repl", replCmd),
+		newCommand("lsp", "qc lsp", lspCmd),
+		newCommand("doc", "qc doc [namespace | namespace::function]", docCmd),
+		newCommand("help", "qc help [command]", helpCmd),
+	}
+}
+
+func lookupCommand(name string) *command {
+	for _, c := range commands {
+		if c.name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+func errorf(formatMsg string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, "qc: "+formatMsg+"\n", args...)
+}
+
+// report a bad command line, and return exitUsage.
+func usageErrorf(c *command, formatMsg string, args ...interface{}) int {
+	errorf(formatMsg, args...)
+	fmt.Fprintf(os.Stderr, "usage: %s\n", c.usage)
+	return exitUsage
+}
+
+// parse flags of c, and expect exactly n positional arguments; at least one if n is -1.
+func parseArgs(c *command, args []string, n int) ([]string, int) {
+	fs := c.flags
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return nil, exitOK
+		}
+		return nil, exitUsage
+	}
+	if diagFormat != "text" && diagFormat != "json" {
+		return nil, usageErrorf(c, "%s: unknown diagnostics format '%s'", c.name, diagFormat)
+	}
+	if n < 0 && fs.NArg() == 0 {
+		return nil, usageErrorf(c, "%s: expected at least 1 argument", c.name)
+	}
+	if n >= 0 && fs.NArg() != n {
+		return nil, usageErrorf(c, "%s: expected %d argument(s), got %d", c.name, n, fs.NArg())
+	}
+	return fs.Args(), -1
+}
+
+func readFile(fname string) (quoi.Source, error) {
+	bx, err := os.ReadFile(fname)
+	if err != nil {
+		return quoi.Source{}, err
+	}
+	if len(bx) == 0 {
+		return quoi.Source{}, fmt.Errorf("empty source file")
+	}
+	return quoi.Source{Name: fname, Text: string(bx)}, nil
+}
+
+// print ds to stderr, along with the lines of src they point at.
+// with --diagnostics=json, print them as JSON lines instead.
+func report(src quoi.Source, ds []diagnostic.Diagnostic) {
+	diagnostic.SetFile(ds, src.Name)
+	diagnostic.Sort(ds)
+	if diagFormat == "json" {
+		diagnostic.WriteJSON(os.Stderr, ds)
+		return
+	}
+	diagnostic.RenderAll(os.Stderr, src.Text, ds)
+}
+
+// compile src with opts. report errors to stderr.
+func compileWith(src quoi.Source, opts quoi.Options) (quoi.Result, bool) {
+	res, ds := quoi.Compile(context.Background(), src, opts)
+	if len(ds) > 0 {
+		report(src, ds)
+	}
+	return res, !(ds.HasErrors())
+}
+
+// lex, and parse src. report errors to stderr.
+func parse(src quoi.Source) (*ast.Program, bool) {
+	res, ok := compileWith(src, quoi.Options{ParseOnly: true})
+	return res.AST, ok
+}
+
+// parse, and typecheck src. report errors to stderr.
+func analyze(src quoi.Source) (*analyzer.IRProgram, bool) {
+	res, ok := compileWith(src, quoi.Options{CheckOnly: true})
+	return res.IR, ok
+}
+
+func compile(src quoi.Source) (string, bool) {
+	res, ok := compileWith(src, quoi.Options{})
+	return res.Go, ok
+}
+
+// read, and compile the file fname to Go source code.
+func compileFile(fname string) (string, int) {
+	src, err := readFile(fname)
+	if err != nil {
+		errorf("read file '%s': %s", fname, err.Error())
+		return "", exitFailure
+	}
+	gosrc, ok := compile(src)
+	if !(ok) {
+		return "", exitCompileError
+	}
+	return gosrc, exitOK
+}
+
+func runCmd(c *command, args []string) int {
+	args, code := parseArgs(c, args, 1)
+	if code >= 0 {
+		return code
+	}
+	if runInterp {
+		return interpretFile(args[0])
+	}
+	gosrc, code := compileFile(args[0])
+	if code != exitOK {
+		return code
+	}
+	exitCode, err := cmd.RunProgram(gosrc, os.Stdin, os.Stdout, os.Stderr)
+	if err != nil {
+		errorf("%s", err.Error())
+		return exitFailure
+	}
+	return exitCode
+}
+
+// run the file fname with the interpreter. a runtime error is reported like a
+// Go panic; and qc exits with 2, like the compiled program would.
+func interpretFile(fname string) int {
+	src, err := readFile(fname)
+	if err != nil {
+		errorf("read file '%s': %s", fname, err.Error())
+		return exitFailure
+	}
+	ir, ok := analyze(src)
+	if !(ok) {
+		return exitCompileError
+	}
+	if err := interp.Run(ir, os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "panic: %s\n", err.Error())
+		// where it happened; like the stack trace of a Go panic
+		if pos := err.(*interp.RuntimeError).Pos; pos.Line > 0 {
+			fmt.Fprintf(os.Stderr, "\t%s:%d:%d\n", fname, pos.Line, pos.Col)
+		}
+		return 2
+	}
+	return exitOK
+}
+
+func buildCmd(c *command, args []string) int {
+	args, code := parseArgs(c, args, 1)
+	if code >= 0 {
+		return code
+	}
+	fname, output := args[0], buildOutput
+	if buildBC {
+		if output == "" {
+			output = strings.TrimSuffix(fname, ".q") + ".qbc"
+		}
+		return buildBytecode(fname, output)
+	}
+	if output == "" {
+		output = strings.TrimSuffix(fname, ".q")
+		if output == fname {
+			output = fname + ".out"
+		}
+	}
+	gosrc, code := compileFile(fname)
+	if code != exitOK {
+		return code
+	}
+	if err := cmd.GetExecutable(gosrc, output, os.Stderr); err != nil {
+		errorf("%s", err.Error())
+		return exitFailure
+	}
+	return exitOK
+}
+
+// read, and compile the file fname to bytecode.
+func compileBytecodeFile(fname string) (*bytecode.Program, int) {
+	src, err := readFile(fname)
+	if err != nil {
+		errorf("read file '%s': %s", fname, err.Error())
+		return nil, exitFailure
+	}
+	ir, ok := analyze(src)
+	if !(ok) {
+		return nil, exitCompileError
+	}
+	prg, err := bytecode.Compile(ir)
+	if err != nil {
+		errorf("%s", err.Error())
+		return nil, exitCompileError
+	}
+	prg.File = fname
+	return prg, exitOK
+}
+
+func buildBytecode(fname, output string) int {
+	prg, code := compileBytecodeFile(fname)
+	if code != exitOK {
+		return code
+	}
+	if err := os.WriteFile(output, prg.Marshal(), 0644); err != nil {
+		errorf("write file '%s': %s", output, err.Error())
+		return exitFailure
+	}
+	return exitOK
+}
+
+func loadBytecode(fname string) (*bytecode.Program, int) {
+	bx, err := os.ReadFile(fname)
+	if err != nil {
+		errorf("read file '%s': %s", fname, err.Error())
+		return nil, exitFailure
+	}
+	prg, err := bytecode.Unmarshal(bx)
+	if err != nil {
+		errorf("%s: %s", fname, err.Error())
+		return nil, exitFailure
+	}
+	return prg, exitOK
+}
+
+// run a bytecode file. a runtime error is reported like a Go panic; and qc
+// exits with 2, like the compiled program would.
+func execCmd(c *command, args []string) int {
+	args, code := parseArgs(c, args, 1)
+	if code >= 0 {
+		return code
+	}
+	prg, code := loadBytecode(args[0])
+	if code != exitOK {
+		return code
+	}
+	if err := bytecode.Run(prg, os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "panic: %s\n", err.Error())
+		if rerr, ok := err.(*bytecode.RuntimeError); ok && rerr.Pos.Line > 0 {
+			fmt.Fprintf(os.Stderr, "\t%s:%d:%d\n", prg.File, rerr.Pos.Line, rerr.Pos.Col)
+		}
+		return 2
+	}
+	return exitOK
+}
+
+func checkCmd(c *command, args []string) int {
+	args, code := parseArgs(c, args, 1)
+	if code >= 0 {
+		return code
+	}
+	src, err := readFile(args[0])
+	if err != nil {
+		errorf("read file '%s': %s", args[0], err.Error())
+		return exitFailure
+	}
+	if _, ok := analyze(src); !(ok) {
+		return exitCompileError
+	}
+	return exitOK
+}
+
+func fmtCmd(c *command, args []string) int {
+	args, code := parseArgs(c, args, -1)
+	if code >= 0 {
+		return code
+	}
+	if fmtWrite && fmtDiff || fmtWrite && fmtList || fmtDiff && fmtList {
+		return usageErrorf(c, "fmt: -w, -d, and -l can't be used together")
+	}
+	// keep going after a file with errors, like the compiler does with statements
+	res := exitOK
+	for _, fname := range args {
+		if code := formatFile(fname); code != exitOK {
+			res = code
+		}
+	}
+	return res
+}
+
+func formatFile(fname string) int {
+	src, err := readFile(fname)
+	if err != nil {
+		errorf("read file '%s': %s", fname, err.Error())
+		return exitFailure
+	}
+	res, ok := compileWith(src, quoi.Options{ParseOnly: true, Comments: true})
+	if !(ok) {
+		return exitCompileError
+	}
+	formatted := format.Program(res.AST)
+	switch {
+	case fmtList:
+		if formatted != src.Text {
+			fmt.Println(fname)
+		}
+	case fmtDiff:
+		io.WriteString(os.Stdout, unifiedDiff(fname, fname+" (formatted)", src.Text, formatted))
+	case fmtWrite:
+		if formatted == src.Text {
+			return exitOK
+		}
+		if err := os.WriteFile(fname, []byte(formatted), 0644); err != nil {
+			errorf("write file '%s': %s", fname, err.Error())
+			return exitFailure
+		}
+	default:
+		io.WriteString(os.Stdout, formatted)
+	}
+	return exitOK
+}
+
+func emitCmd(c *command, args []string) int {
+	args, code := parseArgs(c, args, 2)
+	if code >= 0 {
+		return code
+	}
+	what, fname := args[0], args[1]
+	if what == "bytecode" {
+		return emitBytecode(fname)
+	}
+	src, err := readFile(fname)
+	if err != nil {
+		errorf("read file '%s': %s", fname, err.Error())
+		return exitFailure
+	}
+	var res strings.Builder
+	switch what {
+	case "tokens":
+		l := lexer.New(src.Text)
+		for {
+			t := l.Next()
+			if t.Type == token.EOF {
+				break
+			}
+			fmt.Fprintf(&res, "%d:%d %s %q\n", t.Line, t.Col, t.Type, t.Literal)
+		}
+		if len(l.Errs) > 0 {
+			report(src, l.Errs)
+			return exitCompileError
+		}
+	case "ast":
+		prg, ok := parse(src)
+		if !(ok) {
+			return exitCompileError
+		}
+		for _, v := range prg.Stmts {
+			res.WriteString(v.String())
+			res.WriteByte('\n')
+		}
+	case "ir":
+		irprg, ok := analyze(src)
+		if !(ok) {
+			return exitCompileError
+		}
+		res.WriteString(irprg.String())
+		res.WriteByte('\n')
+	case "go":
+		gosrc, ok := compile(src)
+		if !(ok) {
+			return exitCompileError
+		}
+		res.WriteString(gosrc)
+	default:
+		return usageErrorf(c, "emit: unknown form '%s'", what)
+	}
+	return writeEmitted(res.String())
+}
+
+// write the output of emit to stdout, or to the file given with -o
+func writeEmitted(s string) int {
+	if emitOutput == "" {
+		io.WriteString(os.Stdout, s)
+		return exitOK
+	}
+	if err := os.WriteFile(emitOutput, []byte(s), 0644); err != nil {
+		errorf("write file '%s': %s", emitOutput, err.Error())
+		return exitFailure
+	}
+	return exitOK
+}
+
+// disassemble a Quoi program, or a bytecode file (.qbc)
+func emitBytecode(fname string) int {
+	var prg *bytecode.Program
+	var code int
+	if strings.HasSuffix(fname, ".qbc") {
+		prg, code = loadBytecode(fname)
+	} else {
+		prg, code = compileBytecodeFile(fname)
+	}
+	if code != exitOK {
+		return code
+	}
+	return writeEmitted(prg.Disassemble())
+}
+
+func replCmd(c *command, args []string) int {
+	if _, code := parseArgs(c, args, 0); code >= 0 {
+		return code
+	}
+	repl.New(os.Stdout, os.Stderr).Run(os.Stdin)
+	return exitOK
+}
+
+func lspCmd(c *command, args []string) int {
+	if _, code := parseArgs(c, args, 0); code >= 0 {
+		return code
+	}
+	if err := lsp.NewServer(os.Stdin, os.Stdout).Run(); err != nil {
+		errorf("lsp: %v", err)
+		return exitFailure
+	}
+	return exitOK
+}
+
+func writeFuncDoc(w io.Writer, f *std.Func) {
+	fmt.Fprintf(w, "%s::%s%s\n", f.Namespace, f.Name, f.Sig)
+	for _, line := range strings.Split(f.Doc, "\n") {
+		fmt.Fprintf(w, "\t%s\n", line)
+	}
+}
+
+func writeNamespaceDoc(w io.Writer, ns *std.Namespace) {
+	fmt.Fprintf(w, "namespace %s\n\t%s\n", ns.Name, ns.Doc)
+	for _, f := range std.FuncsOf(ns.Name) {
+		fmt.Fprintln(w)
+		writeFuncDoc(w, f)
+	}
+}
+
+func docCmd(c *command, args []string) int {
+	if err := c.flags.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return exitOK
+		}
+		return exitUsage
+	}
+	args = c.flags.Args()
+	switch len(args) {
+	case 0:
+		for i := range std.Namespaces {
+			if i > 0 {
+				fmt.Fprintln(os.Stdout)
+			}
+			writeNamespaceDoc(os.Stdout, &std.Namespaces[i])
+		}
+		return exitOK
+	case 1:
+	default:
+		return usageErrorf(c, "doc: expected at most 1 argument, got %d", len(args))
+	}
+	if i := strings.Index(args[0], "::"); i >= 0 {
+		ns, name := args[0][:i], args[0][i+2:]
+		f := std.Lookup(ns, name)
+		if f == nil {
+			return usageErrorf(c, "doc: unknown function '%s::%s'", ns, name)
+		}
+		writeFuncDoc(os.Stdout, f)
+		return exitOK
+	}
+	ns := std.LookupNamespace(args[0])
+	if ns == nil {
+		return usageErrorf(c, "doc: unknown namespace '%s'", args[0])
+	}
+	writeNamespaceDoc(os.Stdout, ns)
+	return exitOK
+}
+
+func helpCmd(c *command, args []string) int {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stdout, usage)
+		return exitOK
+	}
+	hc := lookupCommand(args[0])
+	if hc == nil {
+		return usageErrorf(c, "help: unknown command '%s'", args[0])
+	}
+	hc.flags.SetOutput(os.Stdout)
+	hc.flags.Usage()
+	return exitOK
+}
+
+func main() {
+	args := os.Args[1:]
+	if len(args) < 1 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(exitUsage)
+	}
+	switch args[0] {
+	case "-h", "-help", "--help":
+		args[0] = "help"
+	}
+	c := lookupCommand(args[0])
+	if c == nil {
+		errorf("unknown command '%s'", args[0])
+		fmt.Fprintf(os.Stderr, "Run 'qc help' for usage.\n")
+		os.Exit(exitUsage)
+	}
+	os.Exit(c.run(c, args[1:]))
+}
@@ -0,0 +1,252 @@
+// Package diagnostic is the shared representation of the errors, and the warnings
+// reported by the lexer, the parser, and the analyzer.
+package diagnostic
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+type Severity int
+
+const (
+	Error Severity = iota
+	Warning
+	Note
+)
+
+func (s Severity) String() string {
+	switch s {
+	case Error:
+		return "error"
+	case Warning:
+		return "warning"
+	case Note:
+		return "note"
+	}
+	return "UNKNOWN"
+}
+
+// the compiler phase that reported a diagnostic
+type Phase int
+
+const (
+	Lexer Phase = iota
+	Parser
+	Analyzer
+	// errors that are not caused by the source code (e.g. internal compiler errors)
+	Compiler
+)
+
+func (p Phase) String() string {
+	switch p {
+	case Lexer:
+		return "lexer"
+	case Parser:
+		return "parser"
+	case Analyzer:
+		return "analyzer"
+	case Compiler:
+		return "compiler"
+	}
+	return "UNKNOWN"
+}
+
+// Code is a stable identifier of the place in the compiler that reported the diagnostic;
+// L for the lexer, P for the parser, A for the analyzer, and C for the compiler itself,
+// followed by a number (e.g. A012).
+//
+// Lines, and columns are 1-based. EndLine, and EndColumn point at the last character
+// of the offending range; they are zero if the range is unknown, in which case the
+// diagnostic covers only the character at Line:Column.
+type Diagnostic struct {
+	Severity           Severity
+	Phase              Phase
+	Code               string
+	File               string
+	Line, Column       uint
+	EndLine, EndColumn uint
+	Msg                string
+	Notes, Hints       []string
+}
+
+// return a new error diagnostic
+func New(phase Phase, code string, line, col uint, msgf string, args ...interface{}) Diagnostic {
+	return Diagnostic{
+		Severity: Error,
+		Phase:    phase,
+		Code:     code,
+		Line:     line,
+		Column:   col,
+		Msg:      fmt.Sprintf(msgf, args...),
+	}
+}
+
+func (d Diagnostic) Error() string { return d.Msg }
+
+// kind of the diagnostic, as shown to the user (e.g. TypeError)
+func (d Diagnostic) Kind() string {
+	switch d.Severity {
+	case Warning:
+		return "Warning"
+	case Note:
+		return "Note"
+	}
+	switch d.Phase {
+	case Lexer, Parser:
+		return "SyntaxError"
+	case Analyzer:
+		return "TypeError"
+	}
+	return "Error"
+}
+
+// "file:line:col", or "line:col" if there is no file.
+func (d Diagnostic) Pos() string {
+	pos := fmt.Sprintf("%d:%d", d.Line, d.Column)
+	if d.File != "" {
+		pos = d.File + ":" + pos
+	}
+	return pos
+}
+
+// set the file of every diagnostic in ds
+func SetFile(ds []Diagnostic, file string) {
+	for i := range ds {
+		ds[i].File = file
+	}
+}
+
+// sort ds by position. diagnostics on the same position keep their order.
+func Sort(ds []Diagnostic) {
+	sort.SliceStable(ds, func(i, j int) bool {
+		if ds[i].Line != ds[j].Line {
+			return ds[i].Line < ds[j].Line
+		}
+		return ds[i].Column < ds[j].Column
+	})
+}
+
+// return the nth line (1-based) of src, without the line terminator.
+func sourceLine(src string, n uint) (string, bool) {
+	if n == 0 {
+		return "", false
+	}
+	lines := strings.Split(src, "\n")
+	if int(n) > len(lines) {
+		return "", false
+	}
+	return strings.TrimSuffix(lines[n-1], "\r"), true
+}
+
+// Render writes d to w, preceded by the offending line of src, and a caret line
+// underlining the offending range.
+//
+//	Stdout::println( (lt 5 true) ).
+//	                       ^
+//	10:24 TypeError: invalid expression of type 'bool' for 'lt' operator
+//
+// if the line doesn't exist in src, only the message is written.
+func Render(w io.Writer, src string, d Diagnostic) {
+	if line, ok := sourceLine(src, d.Line); ok {
+		runes := []rune(line)
+		col := d.Column
+		if col == 0 {
+			col = 1
+		}
+		if int(col) > len(runes)+1 {
+			col = uint(len(runes)) + 1
+		}
+		// underline until the end of the range, or the end of the line if the range
+		// spans several lines.
+		end := col
+		if d.EndLine == d.Line && d.EndColumn > col {
+			end = d.EndColumn
+		} else if d.EndLine > d.Line {
+			end = uint(len(runes))
+		}
+		if int(end) > len(runes) {
+			end = uint(len(runes))
+		}
+		if end < col {
+			end = col
+		}
+		var caret strings.Builder
+		for i := uint(1); i < col; i++ {
+			// keep the alignment with tabs in the source line
+			if runes[i-1] == '\t' {
+				caret.WriteByte('\t')
+			} else {
+				caret.WriteByte(' ')
+			}
+		}
+		caret.WriteString(strings.Repeat("^", int(end-col)+1))
+		fmt.Fprintf(w, "%s\n%s\n", line, caret.String())
+	}
+	fmt.Fprintf(w, "%s %s: %s\n", d.Pos(), d.Kind(), d.Msg)
+	for _, n := range d.Notes {
+		fmt.Fprintf(w, "\tnote: %s\n", n)
+	}
+	for _, h := range d.Hints {
+		fmt.Fprintf(w, "\thint: %s\n", h)
+	}
+}
+
+// render every diagnostic in ds, separated by empty lines
+func RenderAll(w io.Writer, src string, ds []Diagnostic) {
+	for i, d := range ds {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		Render(w, src, d)
+	}
+}
+
+type jsonPos struct {
+	Line   uint `json:"line"`
+	Column uint `json:"col"`
+}
+
+type jsonDiagnostic struct {
+	Phase    string   `json:"phase"`
+	Code     string   `json:"code"`
+	Severity string   `json:"severity"`
+	File     string   `json:"file"`
+	Start    jsonPos  `json:"start"`
+	End      jsonPos  `json:"end"`
+	Message  string   `json:"message"`
+	Notes    []string `json:"notes,omitempty"`
+	Hints    []string `json:"hints,omitempty"`
+}
+
+// WriteJSON writes ds to w as JSON lines; one object per diagnostic:
+//
+//	{"phase":"analyzer","code":"A011","severity":"error","file":"main.q","start":{"line":3,"col":9},"end":{"line":3,"col":9},"message":"expected 'int', got 'string'"}
+//
+// if the end of the range is unknown, end is the same as start.
+func WriteJSON(w io.Writer, ds []Diagnostic) error {
+	enc := json.NewEncoder(w)
+	for _, d := range ds {
+		jd := jsonDiagnostic{
+			Phase:    d.Phase.String(),
+			Code:     d.Code,
+			Severity: d.Severity.String(),
+			File:     d.File,
+			Start:    jsonPos{Line: d.Line, Column: d.Column},
+			End:      jsonPos{Line: d.EndLine, Column: d.EndColumn},
+			Message:  d.Msg,
+			Notes:    d.Notes,
+			Hints:    d.Hints,
+		}
+		if d.EndLine == 0 {
+			jd.End = jd.Start
+		}
+		if err := enc.Encode(jd); err != nil {
+			return err
+		}
+	}
+	return nil
+}
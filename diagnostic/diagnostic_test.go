@@ -0,0 +1,84 @@
+package diagnostic
+
+import (
+	"strings"
+	"testing"
+)
+
+func render(src string, d Diagnostic) string {
+	var b strings.Builder
+	Render(&b, src, d)
+	return b.String()
+}
+
+func TestRender1(t *testing.T) {
+	src := strings.Repeat("\n", 9) + "Stdout::println( (lt 5 true) ).\n"
+	d := New(Analyzer, "A001", 10, 24, "invalid expression of type '%s' for 'lt' operator", "bool")
+	want := `Stdout::println( (lt 5 true) ).
+                       ^
+10:24 TypeError: invalid expression of type 'bool' for 'lt' operator
+`
+	if got := render(src, d); got != want {
+		t.Errorf("want:\n%s\ngot:\n%s", want, got)
+	}
+}
+
+func TestRenderSpan(t *testing.T) {
+	src := "int x = \"hey\".\n"
+	d := New(Analyzer, "A002", 1, 9, "expected 'int', got 'string'")
+	d.File = "main.q"
+	d.EndLine, d.EndColumn = 1, 13
+	d.Hints = []string{"use Int::from_string"}
+	want := `int x = "hey".
+        ^^^^^
+main.q:1:9 TypeError: expected 'int', got 'string'
+	hint: use Int::from_string
+`
+	if got := render(src, d); got != want {
+		t.Errorf("want:\n%s\ngot:\n%s", want, got)
+	}
+}
+
+func TestRenderTabs(t *testing.T) {
+	src := "fun f() {\n\t\tint x = y.\n}"
+	d := New(Analyzer, "A003", 2, 11, "reference to non-existent variable 'y'")
+	want := "\t\tint x = y.\n\t\t        ^\n2:11 TypeError: reference to non-existent variable 'y'\n"
+	if got := render(src, d); got != want {
+		t.Errorf("want:\n%q\ngot:\n%q", want, got)
+	}
+}
+
+func TestRenderNoLine(t *testing.T) {
+	d := New(Parser, "P001", 5, 1, "unexpected end-of-file")
+	want := "5:1 SyntaxError: unexpected end-of-file\n"
+	if got := render("x", d); got != want {
+		t.Errorf("want:\n%q\ngot:\n%q", want, got)
+	}
+}
+
+func TestSort(t *testing.T) {
+	ds := []Diagnostic{New(Analyzer, "A001", 3, 1, "c"), New(Parser, "P001", 1, 5, "b"), New(Lexer, "L001", 1, 2, "a")}
+	Sort(ds)
+	for i, want := range []string{"a", "b", "c"} {
+		if ds[i].Msg != want {
+			t.Errorf("#%d: want=%s got=%s", i, want, ds[i].Msg)
+		}
+	}
+}
+
+func TestWriteJSON(t *testing.T) {
+	d := New(Analyzer, "A011", 3, 9, "expected 'int', got 'string'")
+	d.File = "main.q"
+	d2 := New(Lexer, "L005", 1, 2, "unknown symbol ':'")
+	d2.EndLine, d2.EndColumn = 1, 3
+	var b strings.Builder
+	if err := WriteJSON(&b, []Diagnostic{d, d2}); err != nil {
+		t.Fatal(err)
+	}
+	want := `{"phase":"analyzer","code":"A011","severity":"error","file":"main.q","start":{"line":3,"col":9},"end":{"line":3,"col":9},"message":"expected 'int', got 'string'"}
+{"phase":"lexer","code":"L005","severity":"error","file":"","start":{"line":1,"col":2},"end":{"line":1,"col":3},"message":"unknown symbol ':'"}
+`
+	if got := b.String(); got != want {
+		t.Errorf("want:\n%s\ngot:\n%s", want, got)
+	}
+}
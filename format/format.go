@@ -0,0 +1,351 @@
+// Package format prints Quoi programs in the canonical style.
+//
+// the canonical style is:
+//
+//   - indentation with 4 spaces, one statement per line
+//   - one space between the operator, and the operands of prefix expressions: (+ 1 2)
+//   - a space on both sides of '->': fun f(int a) -> int, bool {
+//   - at most one blank line between statements
+//
+// comments are kept; a comment on the line of a statement stays at the end of
+// it, other comments get a line of their own.
+package format
+
+import (
+	"fmt"
+	"quoi/ast"
+	"quoi/lexer"
+	"quoi/parser"
+	"quoi/token"
+	"strings"
+)
+
+const indent = "    "
+
+// Source formats the Quoi program src. the error is the first lexer, or parser
+// error of src; a program with errors is not formatted.
+func Source(src string) (string, error) {
+	l := lexer.New(src)
+	l.KeepComments = true
+	p := parser.New(l)
+	if len(l.Errs) > 0 {
+		return "", l.Errs[0]
+	}
+	prg := p.Parse()
+	if len(p.Errs) > 0 {
+		return "", p.Errs[0]
+	}
+	return Program(prg), nil
+}
+
+// Program formats prg. prg must not have errors (*ast.BadStatement).
+// comments are kept only if the lexer kept them (lexer.Lexer.KeepComments).
+func Program(prg *ast.Program) string {
+	p := &printer{first: true}
+	for _, g := range prg.Comments {
+		p.comments = append(p.comments, g.List...)
+	}
+	for _, s := range prg.Stmts {
+		p.stmt(s)
+	}
+	p.commentsBefore(^uint(0))
+	if p.open {
+		p.res.WriteByte('\n')
+	}
+	return p.res.String()
+}
+
+type printer struct {
+	res      strings.Builder
+	comments []*ast.Comment // comments that aren't printed yet
+	indent   int
+	line     uint // line (in the source) of what was printed last
+	open     bool // the last line isn't terminated yet
+	first    bool // nothing is printed in the current block yet
+	// the last line ends with a comment; nothing can be put after it
+	commented bool
+}
+
+func (p *printer) write(s string) {
+	p.res.WriteString(s)
+}
+
+// start a new line for something at line in the source. blank lines
+// before it are kept (only one of them), except at the beginning of a block.
+func (p *printer) newline(line uint, blank bool) {
+	if p.open {
+		p.res.WriteByte('\n')
+	}
+	if blank && !(p.first) && line > p.line+1 {
+		p.res.WriteByte('\n')
+	}
+	p.write(strings.Repeat(indent, p.indent))
+	p.open = true
+	p.first = false
+	p.commented = false
+	p.line = line
+}
+
+// print the comments before offset
+func (p *printer) commentsBefore(offset uint) {
+	for len(p.comments) > 0 && p.comments[0].Tok.Offset < offset {
+		c := p.comments[0].Tok
+		p.comments = p.comments[1:]
+		text := strings.TrimRight(c.Literal, " \t\r")
+		if p.open && !(p.commented) && c.Line == p.line {
+			// at the end of the line (e.g. after a statement, or after '{' of a block)
+			p.write(" " + text)
+			p.commented = true
+			continue
+		}
+		p.newline(c.Line, true)
+		p.write(text)
+		p.commented = true
+	}
+}
+
+// print the statements of a block that ends at end (right after the closing
+// '}', or 'end'). the header of the block (e.g. 'if x {') is already printed.
+func (p *printer) block(stmts []ast.Statement, end token.Pos, closing string) {
+	p.indent++
+	p.first = true
+	for _, s := range stmts {
+		p.stmt(s)
+	}
+	p.commentsBefore(end.Offset)
+	p.closeBlock(end, closing)
+}
+
+func (p *printer) closeBlock(end token.Pos, closing string) {
+	p.indent--
+	if p.first && !(p.commented) {
+		// empty block
+		p.write(" " + closing)
+	} else {
+		p.newline(end.Line, false)
+		p.write(closing)
+	}
+	p.first = false
+	p.line = end.Line
+}
+
+func (p *printer) stmt(s ast.Statement) {
+	sp := s.Span()
+	p.commentsBefore(sp.Start.Offset)
+	p.newline(sp.Start.Line, true)
+	switch s := s.(type) {
+	case *ast.VariableDeclarationStatement, *ast.ListVariableDeclarationStatement:
+		p.write(vardecl(s))
+	case *ast.ConstDeclaration:
+		p.write("const " + vardecl(s.Decl))
+	case *ast.SubsequentVariableDeclarationStatement:
+		var names []string
+		for i, t := range s.Types {
+			names = append(names, t.String()+" "+s.Names[i].String())
+		}
+		p.write(fmt.Sprintf("%s = %s.", strings.Join(names, ", "), exprs(s.Values)))
+	case *ast.ReassignmentStatement:
+		p.write(fmt.Sprintf("%s = %s.", s.Ident.String(), expr(s.NewValue)))
+	case *ast.ReturnStatement:
+		p.write(fmt.Sprintf("return %s.", exprs(s.ReturnValues)))
+	case *ast.BreakStatement, *ast.ContinueStatement:
+		p.write(s.String())
+	case *ast.BlockStatement:
+		p.write("block")
+		p.block(s.Stmts, s.End, "end")
+	case *ast.LoopStatement:
+		p.write(fmt.Sprintf("loop %s {", expr(s.Cond)))
+		p.block(s.Stmts, s.End, "}")
+	case *ast.IfStatement:
+		p.write("if ")
+		p.if_(s)
+	case *ast.MatchStatement:
+		p.match(s)
+	case *ast.FunctionDeclarationStatement:
+		p.function(s)
+	case *ast.DatatypeDeclaration:
+		if len(s.Variants) > 0 {
+			p.sum(s)
+			break
+		}
+		p.write(fmt.Sprintf("datatype %s {", s.Name.String()))
+		p.indent++
+		p.first = true
+		for _, f := range s.Fields {
+			sp := f.Span()
+			p.commentsBefore(sp.Start.Offset)
+			p.newline(sp.Start.Line, true)
+			p.write(f.String())
+			p.line = sp.End.Line
+		}
+		p.commentsBefore(s.End.Offset)
+		p.closeBlock(s.End, "}")
+	case *ast.EnumDeclaration:
+		p.enum(s)
+	case *ast.StringLiteral, *ast.IntLiteral, *ast.BoolLiteral, *ast.Identifier, *ast.PrefixExpr,
+		*ast.FunctionCall, *ast.FunctionCallFromNamespace, *ast.ListLiteral, *ast.DatatypeLiteral:
+		p.write(expr(s) + ".")
+	default:
+		panic(fmt.Sprintf("format: unexpected statement %T", s))
+	}
+	p.line = sp.End.Line
+}
+
+// a declaration of one variable, or list
+func vardecl(s ast.Statement) string {
+	switch s := s.(type) {
+	case *ast.VariableDeclarationStatement:
+		typ := ast.VarType{Tok: s.Tok, Fun: s.Fun}
+		return fmt.Sprintf("%s %s = %s.", typ, s.Ident.String(), expr(s.Value))
+	case *ast.ListVariableDeclarationStatement:
+		typ := ast.VarType{Tok: s.Tok, IsList: true, TypeOfList: s.Typ, Fun: s.Fun}
+		return fmt.Sprintf("%s %s = %s.", typ, s.Name.String(), expr(s.List))
+	}
+	panic(fmt.Sprintf("format: unexpected declaration %T", s))
+}
+
+// the 'if ' is already printed
+func (p *printer) if_(s *ast.IfStatement) {
+	p.write(expr(s.Cond) + " {")
+	p.block(s.Stmts, s.End, "}")
+	if s.Alternative != nil {
+		p.write(" elseif ")
+		p.line = s.Alternative.Tok.Line
+		p.if_(s.Alternative)
+	}
+	if s.Default != nil {
+		p.write(" else {")
+		p.line = s.Default.Tok.Line
+		p.block(s.Default.Stmts, s.Default.End, "}")
+	}
+}
+
+// a sum type is printed on one line, if it's on one line in the source.
+// otherwise every variant is on a line of its own, after '|'.
+func (p *printer) sum(s *ast.DatatypeDeclaration) {
+	p.write(fmt.Sprintf("datatype %s =", s.Name.String()))
+	if s.Tok.Line == s.End.Line {
+		for i, v := range s.Variants {
+			if i > 0 {
+				p.write(" |")
+			}
+			p.write(" " + v.String())
+		}
+		return
+	}
+	p.indent++
+	p.first = true
+	for _, v := range s.Variants {
+		sp := v.Span()
+		p.commentsBefore(sp.Start.Offset)
+		p.newline(sp.Start.Line, false)
+		p.write("| " + v.String())
+		p.line = sp.End.Line
+	}
+	p.indent--
+}
+
+// an enum is printed on one line, if it's on one line in the source.
+// otherwise every member is on a line of its own.
+func (p *printer) enum(s *ast.EnumDeclaration) {
+	if s.Tok.Line == s.End.Line {
+		p.write(s.String())
+		return
+	}
+	p.write(fmt.Sprintf("enum %s {", s.Name.String()))
+	p.indent++
+	p.first = true
+	for _, m := range s.Members {
+		sp := m.Span()
+		p.commentsBefore(sp.Start.Offset)
+		p.newline(sp.Start.Line, true)
+		p.write(m.String())
+		p.line = sp.End.Line
+	}
+	p.commentsBefore(s.End.Offset)
+	p.closeBlock(s.End, "}")
+}
+
+func (p *printer) match(s *ast.MatchStatement) {
+	p.write(fmt.Sprintf("match %s {", expr(s.Value)))
+	p.indent++
+	p.first = true
+	for _, arm := range s.Arms {
+		sp := arm.Span()
+		p.commentsBefore(sp.Start.Offset)
+		p.newline(sp.Start.Line, true)
+		p.write(arm.Variant.String())
+		if arm.Name != nil {
+			p.write(" " + arm.Name.String())
+		}
+		p.write(" {")
+		p.block(arm.Stmts, arm.End, "}")
+	}
+	if s.Default != nil {
+		p.commentsBefore(s.Default.Tok.Offset)
+		p.newline(s.Default.Tok.Line, true)
+		p.write("else {")
+		p.block(s.Default.Stmts, s.Default.End, "}")
+	}
+	p.commentsBefore(s.End.Offset)
+	p.closeBlock(s.End, "}")
+}
+
+func (p *printer) function(f *ast.FunctionDeclarationStatement) {
+	var params []string
+	for _, v := range f.Params {
+		params = append(params, v.Type().String()+" "+v.Name.String())
+	}
+	p.write(fmt.Sprintf("fun %s(%s)", f.Name.String(), strings.Join(params, ", ")))
+	if len(f.ReturnTypes) > 0 {
+		var types []string
+		for _, v := range f.ReturnTypes {
+			types = append(types, v.Type().String())
+		}
+		p.write(" -> " + strings.Join(types, ", "))
+	}
+	p.write(" {")
+	p.block(f.Stmts, f.End, "}")
+}
+
+func exprs(xs []ast.Expr) string {
+	var res []string
+	for _, x := range xs {
+		res = append(res, expr(x))
+	}
+	return strings.Join(res, ", ")
+}
+
+func expr(x ast.Expr) string {
+	switch x := x.(type) {
+	case *ast.StringLiteral:
+		return ast.Quote(x.Val)
+	case *ast.IntLiteral:
+		return x.Typ.Literal
+	case *ast.BoolLiteral:
+		return x.Typ.Literal
+	case *ast.Identifier:
+		return x.String()
+	case *ast.PrefixExpr:
+		res := "(" + x.Tok.Literal
+		for _, v := range x.Args {
+			res += " " + expr(v)
+		}
+		return res + ")"
+	case *ast.FunctionCall:
+		return fmt.Sprintf("%s(%s)", x.Ident.String(), exprs(x.Args))
+	case *ast.FunctionCallFromNamespace:
+		return x.Namespace.Tok.Literal + "::" + expr(x.Function)
+	case *ast.ListLiteral:
+		return "[" + exprs(x.Elems) + "]"
+	case *ast.DatatypeLiteral:
+		var fields []string
+		for _, f := range x.Fields {
+			fields = append(fields, f.Name.String()+"="+expr(f.Value))
+		}
+		return x.Tok.Literal + "{" + strings.Join(fields, " ") + "}"
+	case *ast.EnumMember:
+		return x.String()
+	}
+	panic(fmt.Sprintf("format: unexpected expression %T", x))
+}
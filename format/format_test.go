@@ -0,0 +1,162 @@
+package format
+
+import (
+	goast "go/ast"
+	goparser "go/parser"
+	gotoken "go/token"
+	"os"
+	"path/filepath"
+	"quoi/lexer"
+	"quoi/parser"
+	"quoi/token"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// the inputs of the parser tests (input := `...`), and the test programs of
+// the other packages. only the ones without errors can be formatted.
+func inputs(t *testing.T) map[string]string {
+	res := map[string]string{}
+	fset := gotoken.NewFileSet()
+	f, err := goparser.ParseFile(fset, filepath.Join("..", "parser", "parser_test.go"), nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	goast.Inspect(f, func(n goast.Node) bool {
+		assign, ok := n.(*goast.AssignStmt)
+		if !(ok) || len(assign.Lhs) != 1 || len(assign.Rhs) != 1 {
+			return true
+		}
+		id, ok := assign.Lhs[0].(*goast.Ident)
+		lit, ok2 := assign.Rhs[0].(*goast.BasicLit)
+		if !(ok) || !(ok2) || id.Name != "input" || lit.Kind != gotoken.STRING {
+			return true
+		}
+		s, err := strconv.Unquote(lit.Value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res[fset.Position(lit.Pos()).String()] = s
+		return true
+	})
+	files, _ := filepath.Glob(filepath.Join("..", "interp", "testdata", "*.q"))
+	quoiFiles, _ := filepath.Glob(filepath.Join("..", "lexer", "tests", "*.quoi"))
+	for _, file := range append(files, quoiFiles...) {
+		bx, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res[file] = string(bx)
+	}
+	for name, src := range res {
+		if _, err := Source(src); err != nil {
+			delete(res, name)
+		}
+	}
+	if len(res) < 20 {
+		t.Fatalf("only %d inputs can be formatted", len(res))
+	}
+	return res
+}
+
+// the statements of src, as printed by the ast package
+func stmts(t *testing.T, src string) string {
+	l := lexer.New(src)
+	p := parser.New(l)
+	prg := p.Parse()
+	if len(l.Errs) > 0 || len(p.Errs) > 0 {
+		t.Fatalf("errors in formatted program:\n%s\n%v %v", src, l.Errs, p.Errs)
+	}
+	var res strings.Builder
+	for _, s := range prg.Stmts {
+		res.WriteString(s.String())
+		res.WriteByte('\n')
+	}
+	return res.String()
+}
+
+func comments(src string) []string {
+	var res []string
+	l := lexer.New(src)
+	l.KeepComments = true
+	for t := l.Next(); t.Type != token.EOF; t = l.Next() {
+		if t.Type == token.COMMENT {
+			res = append(res, strings.TrimRight(t.Literal, " \t\r"))
+		}
+	}
+	return res
+}
+
+func TestIdempotent(t *testing.T) {
+	for name, src := range inputs(t) {
+		once, err := Source(src)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		twice, err := Source(once)
+		if err != nil {
+			t.Fatalf("%s: formatted program has errors: %v\n%s", name, err, once)
+		}
+		if once != twice {
+			t.Errorf("%s: formatting isn't idempotent\nonce=\n%s\ntwice=\n%s", name, once, twice)
+		}
+		if want, got := stmts(t, src), stmts(t, once); want != got {
+			t.Errorf("%s: formatting changed the program\nwant=\n%s\ngot=\n%s", name, want, got)
+		}
+		if want, got := strings.Join(comments(src), "\n"), strings.Join(comments(once), "\n"); want != got {
+			t.Errorf("%s: comments are changed\nwant=\n%s\ngot=\n%s", name, want, got)
+		}
+	}
+}
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		input, want string
+	}{
+		{"int   x=(+   1\n 2).", "int x = (+ 1 2).\n"},
+		{"fun f(int a,listof int b)->int,bool{return a,true.}", "fun f(int a, listof int b) -> int, bool {\n    return a, true.\n}\n"},
+		{"fun f() -> { }", "fun f() { }\n"},
+		{"fun f(){\n\n\n}", "fun f() { }\n"},
+		{"if (= x 1) {\nprint(1).\n}elseif true {\n} else{\nprint(2).}", "if (= x 1) {\n    print(1).\n} elseif true { } else {\n    print(2).\n}\n"},
+		{"loop (lt i 10) {\n  i = (+ i 1).\n  block\n  x.\n  end\n}", "loop (lt i 10) {\n    i = (+ i 1).\n    block\n        x.\n    end\n}\n"},
+		{"datatype User {\n string name\n\n  int age\n}\nUser u = User{\nname=\"a\"\nage=1\n}.", "datatype User {\n    string name\n\n    int age\n}\nUser u = User{name=\"a\" age=1}.\n"},
+		{"int a, listof string b = 1,[\"x\",  \"\\n\"].", "int a, listof string b = 1, [\"x\", \"\\n\"].\n"},
+		{"Stdout::println( String::from_int( 5 ) ).", "Stdout::println(String::from_int(5)).\n"},
+		{"a = 1.\n\n\n\nb = 2.\nc = 3.\n\n", "a = 1.\n\nb = 2.\nc = 3.\n"},
+		// comments
+		{"; a\nint x = 1. ; b\n\n  ; c\nfun f() { ; d\n ; e\n} ; f\n; g", "; a\nint x = 1. ; b\n\n; c\nfun f() { ; d\n    ; e\n} ; f\n; g\n"},
+		{"if true { ; a\n}", "if true { ; a\n}\n"},
+		{"string s = \"; not a comment\". ; comment", "string s = \"; not a comment\". ; comment\n"},
+		{"int x = (+ 1 ; one\n 2).", "int x = (+ 1 2).\n; one\n"},
+		{"datatype T { ; t\n int x ; x\n ; y\n}", "datatype T { ; t\n    int x ; x\n    ; y\n}\n"},
+		{"datatype T {\n\n ; doc\n int x\n}", "datatype T {\n    ; doc\n    int x\n}\n"},
+		{"datatype S=A{int x}|B  |C { int y  string z }", "datatype S = A { int x } | B | C { int y string z }\n"},
+		{"datatype S =\n A { int x } ; a\n  | B\n| C {\n int y\n string z\n}", "datatype S =\n    | A { int x } ; a\n    | B\n    | C { int y string z }\n"},
+		{"match s {\nA a { print(1). }\n\n B {}\nelse{\nprint(2).}\n}", "match s {\n    A a {\n        print(1).\n    }\n\n    B { }\n    else {\n        print(2).\n    }\n}\n"},
+		{"match s { ; s\n A { } ; a\n}", "match s { ; s\n    A { } ; a\n}\n"},
+		{"enum  Color {Red   Green\tBlue}\nColor c=Color::Red.", "enum Color { Red Green Blue }\nColor c = Color::Red.\n"},
+		{"enum Dir { ; dir\nUp ; up\n\n  Down\n}", "enum Dir { ; dir\n    Up ; up\n\n    Down\n}\n"},
+		{"const  int MAX=(*  60 60).\nconst listof int XS=[1,2].", "const int MAX = (* 60 60).\nconst listof int XS = [1, 2].\n"},
+		{"", ""},
+		{"; only a comment   ", "; only a comment\n"},
+	}
+	for _, tt := range tests {
+		got, err := Source(tt.input)
+		if err != nil {
+			t.Errorf("%q: %v", tt.input, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%q:\nwant=\n%s\ngot=\n%s", tt.input, tt.want, got)
+		}
+	}
+}
+
+func TestErrors(t *testing.T) {
+	for _, input := range []string{"int x = .", "\"unterminated", "fun f( {"} {
+		if _, err := Source(input); err == nil {
+			t.Errorf("%q: expected an error", input)
+		}
+	}
+}
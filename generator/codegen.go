@@ -2,10 +2,11 @@ package generator
 
 import (
 	"fmt"
-	"math/rand"
 	"quoi/analyzer"
+	"quoi/std"
+	"quoi/types"
+	"strconv"
 	"strings"
-	"time"
 )
 
 type stringBuilder struct {
@@ -26,20 +27,38 @@ func (s *stringBuilder) String() string {
 
 // Go code producer
 type Generator struct {
-	prg                  *analyzer.IRProgram
-	header, global, body *stringBuilder
-	addedImports         map[string]bool
+	// name of the Quoi source file. if it's not empty, statements are preceded
+	// by //line directives; so Go compile errors, panics, and stack traces point
+	// at the Quoi source. a relative name is relative to the directory of the
+	// generated file.
+	File string
+	// name of the generated file; code that isn't from the Quoi source follows
+	// a //line directive that points back at it. "main.go" by default.
+	GoFile string
+
+	prg                           *analyzer.IRProgram
+	header, runtime, global, body *stringBuilder
+	addedImports                  map[string]bool
+	// standard library functions used by the program
+	usedRuntimeFuncs map[*std.Func]bool
+	funcs            map[string]*analyzer.IRFunction
+	datatypes        map[string]*types.Datatype
 }
 
 func New(prg *analyzer.IRProgram) *Generator {
 	g := &Generator{
-		prg: prg,
+		prg:    prg,
+		GoFile: "main.go",
 
-		header: newStringBuilder(),
-		body:   newStringBuilder(),
+		header:  newStringBuilder(),
+		body:    newStringBuilder(),
+		runtime: newStringBuilder(),
 		// declarations
-		global:       newStringBuilder(),
-		addedImports: make(map[string]bool),
+		global:           newStringBuilder(),
+		addedImports:     make(map[string]bool),
+		usedRuntimeFuncs: make(map[*std.Func]bool),
+		funcs:            make(map[string]*analyzer.IRFunction),
+		datatypes:        make(map[string]*types.Datatype),
 	}
 	g.header.writef("package main\n\nimport(\n")
 	g.body.writef("func main() {\n")
@@ -67,44 +86,89 @@ func (g *Generator) wd(strf string, args ...interface{}) {
 func (g *Generator) assemble() {
 	g.header.writef(")\n\n")
 	g.body.writef("\n}\n")
-	g.header.writef(g.global.b.String())
-	g.header.writef(g.body.b.String())
+	// the runtime comes first; otherwise the //line directives of the
+	// declarations would apply to it too.
+	g.header.writef("%s", g.runtime.b.String())
+	g.header.writef("%s", g.global.b.String())
+	// main isn't from the source; the directive of the last declaration
+	// mustn't apply to it.
+	g.resetLine()
+	g.header.writef("%s", g.body.b.String())
+}
+
+// a //line directive that maps the next line back to the generated file; if
+// there's no source file, there's nothing to reset.
+func (g *Generator) resetLine() {
+	if g.File == "" {
+		return
+	}
+	// the line after the empty line, and the directive
+	line := strings.Count(g.header.String(), "\n") + 3
+	g.header.writef("\n//line %s:%d:1\n", g.GoFile, line)
 }
 
 func (g *Generator) code() string {
-	g.addRuntimeFunctions()
 	return g.header.b.String()
 }
 
 func (g *Generator) Generate() string {
+	// functions can be called before they are declared
+	for _, n := range g.prg.Stmts {
+		switch n := n.(type) {
+		case *analyzer.IRFunction:
+			g.funcs[n.Name] = n
+		case *analyzer.IRDatatype:
+			g.datatypes[n.Name] = n.Type
+			for _, v := range n.Variants {
+				g.datatypes[v.Name] = v.Type
+			}
+		}
+	}
 	for _, n := range g.prg.Stmts {
 		g.stmt(n)
 	}
+	// runtime functions may add imports; so they are added before assembling.
+	g.addRuntimeFunctions()
 	g.assemble()
 	return g.code()
 }
 
-func (g *Generator) addRuntimeFunctions() {
-	// add function definitions for stdlib functions. mangle their names to
-	// avoid redefinitions by the user.
-	rand.Seed(time.Now().UnixNano())
-	var randomFn = func(fnName string) string {
-		return fmt.Sprintf("%s_%d", fnName, rand.Intn(10000))
+// a //line directive for the position of s; the line after it is at that
+// position. "" if there's no source file, or s isn't from the source.
+func (g *Generator) lineDirective(s analyzer.IRStatement) string {
+	pos := s.Pos()
+	if g.File == "" || pos.Line == 0 {
+		return ""
 	}
-	// TODO
-	_ = randomFn
+	// a //line directive must be at the beginning of a line
+	return fmt.Sprintf("\n//line %s:%d:%d\n", g.File, pos.Line, pos.Col)
 }
 
 func (g *Generator) stmt1(s analyzer.IRStatement) string {
+	dir := g.lineDirective(s)
+	if dir == "" {
+		return g.statement(s)
+	}
+	// the statement must start right after the directive
+	return dir + strings.TrimLeft(g.statement(s), "\n")
+}
+
+func (g *Generator) statement(s analyzer.IRStatement) string {
 	switch s := s.(type) {
 	case *analyzer.IRVariable:
 		return g.vardecl(s)
+	case *analyzer.IRSubseq:
+		return g.subseq(s)
+	case *analyzer.IRShow:
+		return g.show(s)
 	case *analyzer.IRIf:
 		return g.if_(s)
 	case *analyzer.IRBlock:
 		return g.block(s)
 	case *analyzer.IRDatatype:
 		return g.dt(s)
+	case *analyzer.IREnum:
+		return g.enum(s)
 	case *analyzer.IRFunction:
 		return g.fun(s)
 	case *analyzer.IRFunctionCall:
@@ -113,6 +177,8 @@ func (g *Generator) stmt1(s analyzer.IRStatement) string {
 		return g.funcallns(s)
 	case *analyzer.IRLoop:
 		return g.loop(s)
+	case *analyzer.IRMatch:
+		return g.match(s)
 	case *analyzer.IRReassigment:
 		return g.reas(s)
 	case *analyzer.IRReturn:
@@ -127,17 +193,19 @@ func (g *Generator) stmt1(s analyzer.IRStatement) string {
 
 func (g *Generator) stmt(s analyzer.IRStatement) {
 	switch s.(type) {
-	case *analyzer.IRFunction, *analyzer.IRDatatype:
-		g.wd(g.stmt1(s))
+	case *analyzer.IRFunction, *analyzer.IRDatatype, *analyzer.IREnum:
+		g.wd("%s", g.stmt1(s))
+	case *analyzer.IRVariable, *analyzer.IRSubseq:
+		g.globalVar(s)
 	default:
-		g.w(g.stmt1(s))
+		g.w("%s", g.stmt1(s))
 	}
 }
 
 func (g *Generator) exprList(ex []analyzer.IRExpression, lenArgs int) string {
 	b := newStringBuilder()
 	for i, v := range ex {
-		b.writef(g.expr(v))
+		b.writef("%s", g.expr(v))
 		if i == lenArgs-1 {
 			continue
 		}
@@ -149,7 +217,7 @@ func (g *Generator) exprList(ex []analyzer.IRExpression, lenArgs int) string {
 func (g *Generator) expr(e analyzer.IRExpression) string {
 	switch e := e.(type) {
 	case *analyzer.IRString:
-		return fmt.Sprintf("\"%s\"", e.Value)
+		return strconv.Quote(e.Value)
 	case *analyzer.IRBoolean:
 		return e.Value
 	case *analyzer.IRInt:
@@ -160,31 +228,37 @@ func (g *Generator) expr(e analyzer.IRExpression) string {
 		for k, v := range e.FieldsAndValues {
 			b.writef("\t%s: %s,\n", k, g.expr(v))
 		}
+		if dt := g.datatypes[e.Name]; dt != nil {
+			for _, f := range dt.Fields {
+				if _, ok := e.FieldsAndValues[f.Name]; ok {
+					continue
+				}
+				if z := g.zero(f.Type); z != "" {
+					b.writef("\t%s: %s,\n", f.Name, z)
+				}
+			}
+		}
 		b.writef("}")
 		return b.String()
 	case *analyzer.IRList:
 		b := newStringBuilder()
-		b.writef("[]%s{ ", e.Type)
-		b.writef(g.exprList(e.Value, len(e.Value)))
+		b.writef("%s{ ", goType(e.Type))
+		b.writef("%s", g.exprList(e.Value, len(e.Value)))
 		b.writef(" }")
 		return b.String()
 	case *analyzer.IRFunctionCall:
-		b := newStringBuilder()
-		b.writef("%s(", e.Name)
-		b.writef(g.exprList(e.Takes, len(e.Takes)))
-		b.writef(")")
-		return b.String()
+		if e.Value != nil {
+			// a function value
+			return fmt.Sprintf("%s(%s)", g.expr(e.Value), g.args(e))
+		}
+		return fmt.Sprintf("%s(%s)", e.Name, g.args(e))
+	case *analyzer.IRFunctionReference:
+		return e.Name
 	case *analyzer.IRFunctionCallFromNamespace:
 		b := newStringBuilder()
-		var ns string
-		switch e.Namespace {
-		case "Stdout":
-			ns = "fmt"
-		default:
-			ns = "TODO: UNKNOWN NAMESPACE"
-		}
-		g.addImport(ns)
-		b.writef("%s.%s", ns, g.expr(&e.IRFunctionCall))
+		b.writef("%s(", g.useRuntimeFunc(e.Namespace, e.Name))
+		b.writef("%s", g.exprList(e.Takes, len(e.Takes)))
+		b.writef(")")
 		return b.String()
 	case *analyzer.IRPrefExpr:
 		b := newStringBuilder()
@@ -206,33 +280,257 @@ func (g *Generator) expr(e analyzer.IRExpression) string {
 		case "not":
 			b.writef("!(%s)", g.expr(e.Operands[0]))
 		case "'":
-			var idx string
-			idx = g.expr(e.Operands[1])
-			b.writef("%s[%s]", g.expr(e.Operands[0]), idx)
-			// bounds checking
-			b.writef("\nif %s > len(%s)-1 { panic(\"index '%s' is out of range\") }\n", idx, g.expr(e.Operands[0]), idx)
+			// Go does the bounds checking. strings are indexed by characters; not by bytes.
+			if e.Operand == types.String {
+				b.writef("string([]rune(%s)[%s])", g.expr(e.Operands[0]), g.expr(e.Operands[1]))
+				break
+			}
+			b.writef("%s[%s]", g.expr(e.Operands[0]), g.expr(e.Operands[1]))
 		case "set":
-			b.writef("%s.%s = %s\n", g.expr(e.Operands[0]), g.expr(e.Operands[1]), g.expr(e.Operands[2]))
+			// set returns a changed copy of its operand
+			dt, field := e.Type.(*types.Datatype), fieldName(e.Operands[1])
+			b.writef("func(v %s, x %s) %s { v.%s = x; return v }(%s, %s)", dt.Name, goType(dt.Field(field).Type), dt.Name, field, g.expr(e.Operands[0]), g.expr(e.Operands[2]))
 		case "get":
-			b.writef("%s.%s\n", g.expr(e.Operands[0]), g.expr(e.Operands[1]))
+			b.writef("%s.%s", g.expr(e.Operands[0]), fieldName(e.Operands[1]))
 		default:
 			b.writef("UNKNOWN OPERATOR %s", e.Operator)
 		}
 		return b.String()
 	case *analyzer.IRVariableReference:
-		b := newStringBuilder()
-		b.writef("%s", e.Name)
-		return b.String()
+		if e.Param {
+			return "(*" + g.varName(e.Name) + ")"
+		}
+		return g.varName(e.Name)
+	case *analyzer.IREnumMember:
+		return member(e.Type, e.Name)
+	case *analyzer.IREnumName:
+		return fmt.Sprintf("string(%s)", g.expr(e.Value))
 	}
 	return "NOT_IMPLEMENTED: " + e.String()
 }
 
+// the Go name of the variable name. a variable may have the name of a
+// function, which it hides in its scope; but 'name(...)' still calls the
+// function. in Go, the variable would hide it from calls too.
+func (g *Generator) varName(name string) string {
+	if g.funcs[name] != nil {
+		return "ℚvar_" + name
+	}
+	return name
+}
+
+// the field operand of get, and set
+func fieldName(e analyzer.IRExpression) string {
+	return e.(*analyzer.IRVariableReference).Name
+}
+
+// arguments of a call to a user-defined function.
+//
+// values are passed by reference; parameters are pointers. a variable is
+// passed by its address, so the callee can change it. any other argument
+// is passed by the address of a copy of its value.
+func (g *Generator) args(c *analyzer.IRFunctionCall) string {
+	var takes []types.Type
+	if c.Value != nil {
+		takes = c.Value.Type.(*types.Func).Params
+	} else {
+		takes = g.funcs[c.Name].Takes
+	}
+	if len(c.Takes) == 1 && valueCount(c.Takes[0]) > 1 {
+		// f(g()); every value g returns is an argument
+		var params, ptrs, refs []string
+		for i, t := range takes {
+			params = append(params, fmt.Sprintf("v%d %s", i, goType(t)))
+			ptrs = append(ptrs, "*"+goType(t))
+			refs = append(refs, fmt.Sprintf("&v%d", i))
+		}
+		return fmt.Sprintf("func(%s) (%s) { return %s }(%s)", strings.Join(params, ", "), strings.Join(ptrs, ", "), strings.Join(refs, ", "), g.expr(c.Takes[0]))
+	}
+	var res []string
+	for i, arg := range c.Takes {
+		res = append(res, g.ref(arg, takes[i]))
+	}
+	return strings.Join(res, ", ")
+}
+
+// a pointer to e, which is an argument of type t. a constant is passed like
+// any other value; so the callee can't change it.
+func (g *Generator) ref(e analyzer.IRExpression, t types.Type) string {
+	if v, ok := e.(*analyzer.IRVariableReference); ok && !(v.Const) {
+		if v.Param {
+			// already a pointer
+			return g.varName(v.Name)
+		}
+		return "&" + g.varName(v.Name)
+	}
+	return fmt.Sprintf("func(v %s) *%s { return &v }(%s)", goType(t), goType(t), g.expr(e))
+}
+
+// the zero value of t, if the Go zero value of goType(t) isn't it; "" if it is.
+// a sum type is a Go interface, whose zero value is nil; but the zero value of
+// a sum type is its first variant. the zero value of an enum is its first member.
+func (g *Generator) zero(t types.Type) string {
+	if e, ok := t.(*types.Enum); ok {
+		return member(e, e.Members[0])
+	}
+	dt, ok := t.(*types.Datatype)
+	if !(ok) || g.datatypes[dt.Name] == nil {
+		return ""
+	}
+	dt = g.datatypes[dt.Name]
+	if len(dt.Variants) > 0 {
+		if z := g.zero(dt.Variants[0]); z != "" {
+			return z
+		}
+		return dt.Variants[0].Name + "{}"
+	}
+	var fields []string
+	for _, f := range dt.Fields {
+		if z := g.zero(f.Type); z != "" {
+			fields = append(fields, f.Name+": "+z)
+		}
+	}
+	if len(fields) == 0 {
+		return ""
+	}
+	return dt.Name + "{" + strings.Join(fields, ", ") + "}"
+}
+
+// Go type of a Quoi type
+func goType(t types.Type) string {
+	switch t := t.(type) {
+	case *types.List:
+		return "[]" + goType(t.Elem)
+	case *types.Func:
+		// parameters are pointers; like the ones of the functions it can be
+		var params, returns []string
+		for _, v := range t.Params {
+			params = append(params, "*"+goType(v))
+		}
+		for _, v := range t.Returns {
+			returns = append(returns, goType(v))
+		}
+		res := "func(" + strings.Join(params, ", ") + ")"
+		switch len(returns) {
+		case 0:
+			return res
+		case 1:
+			return res + " " + returns[0]
+		}
+		return res + " (" + strings.Join(returns, ", ") + ")"
+	}
+	// datatypes are Go structs of the same name
+	return t.String()
+}
+
+// unused variables are not an error in Quoi; but they are in Go.
+func use(name string) string {
+	return fmt.Sprintf("_ = %s\n", name)
+}
+
 func (g *Generator) vardecl(d *analyzer.IRVariable) string {
-	typ := d.Type
-	if strings.Contains(typ, "list-") {
-		typ = "[]" + strings.Split(typ, "list-")[1]
+	if d.Const && isConstant(d.Value) {
+		// unused constants are not an error in Go
+		return fmt.Sprintf("\nconst %s %s = %s\n", g.varName(d.Name), goType(d.Type), g.expr(d.Value))
+	}
+	return fmt.Sprintf("\nvar %s %s = %s\n", g.varName(d.Name), goType(d.Type), g.expr(d.Value)) + use(g.varName(d.Name))
+}
+
+// whether e is a Go constant. the analyzer computes the values of constants
+// at compile time, when it can; they are literals.
+func isConstant(e analyzer.IRExpression) bool {
+	switch e.(type) {
+	case *analyzer.IRInt, *analyzer.IRString, *analyzer.IRBoolean, *analyzer.IREnumMember:
+		return true
 	}
-	return fmt.Sprintf("\nvar %s %s = %s\n", d.Name, typ, g.expr(d.Value))
+	return false
+}
+
+// number of values an expression produces
+func valueCount(e analyzer.IRExpression) int {
+	switch e := e.(type) {
+	case *analyzer.IRFunctionCall:
+		if e.ReturnsCount > 1 {
+			return e.ReturnsCount
+		}
+	case *analyzer.IRFunctionCallFromNamespace:
+		if e.ReturnsCount > 1 {
+			return e.ReturnsCount
+		}
+	}
+	return 1
+}
+
+// int a, string b, int c = f(), 5.
+//
+// is generated as
+//
+// var a int
+// var b string
+// var c int
+// a, b = f()
+// c = 5
+//
+// because Go doesn't allow mixing multi-value function calls with other values.
+func (g *Generator) subseq(d *analyzer.IRSubseq) string {
+	b := newStringBuilder()
+	b.writef("\n")
+	for i, name := range d.Names {
+		b.writef("var %s %s\n", g.varName(name), goType(d.Types[i]))
+		b.writef("%s", use(g.varName(name)))
+	}
+	b.writef("%s", g.subseqValues(d))
+	return b.String()
+}
+
+func (g *Generator) subseqValues(d *analyzer.IRSubseq) string {
+	b := newStringBuilder()
+	var names []string
+	for _, name := range d.Names {
+		names = append(names, g.varName(name))
+	}
+	n := 0
+	for _, v := range d.Values {
+		count := valueCount(v)
+		b.writef("%s = %s\n", strings.Join(names[n:n+count], ", "), g.expr(v))
+		n += count
+	}
+	return b.String()
+}
+
+// global variables are package-level Go variables, so that functions see them.
+// their values are assigned in main, in the order of the program.
+func (g *Generator) globalVar(s analyzer.IRStatement) {
+	dir := g.lineDirective(s)
+	if dir == "" {
+		dir = "\n"
+	}
+	switch s := s.(type) {
+	case *analyzer.IRVariable:
+		if s.Const && isConstant(s.Value) {
+			g.wd("%s", g.stmt1(s))
+			return
+		}
+		g.wd("%svar %s %s\n", dir, g.varName(s.Name), goType(s.Type))
+		g.w("%s%s = %s\n", dir, g.varName(s.Name), g.expr(s.Value))
+	case *analyzer.IRSubseq:
+		g.wd("%s", dir)
+		for i, name := range s.Names {
+			g.wd("var %s %s\n", g.varName(name), goType(s.Types[i]))
+		}
+		g.w("%s%s", dir, g.subseqValues(s))
+	}
+}
+
+func (g *Generator) show(d *analyzer.IRShow) string {
+	if d.Type == types.Void {
+		return g.expr(d.Value) + "\n"
+	}
+	g.addImport("fmt")
+	if d.Type == types.String {
+		return fmt.Sprintf("fmt.Printf(\"%%q\\n\", %s)\n", g.expr(d.Value))
+	}
+	return fmt.Sprintf("fmt.Println(%s)\n", g.expr(d.Value))
 }
 
 func (g *Generator) if_(d *analyzer.IRIf) string {
@@ -240,18 +538,19 @@ func (g *Generator) if_(d *analyzer.IRIf) string {
 	b.writef("if %s {\n\t", g.expr(d.Cond))
 	for _, v := range d.Block {
 		if v, ok := v.(*analyzer.IRElseIf); ok {
-			b.writef(g.elseif(v))
+			b.writef("%s", g.elseif(v))
 			continue
 		}
-		b.writef(g.stmt1(v))
+		b.writef("%s", g.stmt1(v))
 	}
 	b.writef("}")
 	if d.Alternative != nil {
-		b.writef(g.elseif(d.Alternative))
+		b.writef("%s", g.elseif(d.Alternative))
 	}
 	if d.Default != nil {
-		b.writef(g.else_(d.Default))
+		b.writef("%s", g.else_(d.Default))
 	}
+	b.writef("\n")
 	return b.String()
 }
 
@@ -260,17 +559,17 @@ func (g *Generator) elseif(d *analyzer.IRElseIf) string {
 	b.writef(" else if %s {\n\t", g.expr(d.Cond))
 	for _, v := range d.Block {
 		if v, ok := v.(*analyzer.IRElseIf); ok {
-			b.writef(g.elseif(v))
+			b.writef("%s", g.elseif(v))
 			continue
 		}
-		b.writef(g.stmt1(v))
+		b.writef("%s", g.stmt1(v))
 	}
 	b.writef("\n}")
 	if d.Alternative != nil {
-		b.writef(g.elseif(d.Alternative))
+		b.writef("%s", g.elseif(d.Alternative))
 	}
 	if d.Default != nil {
-		b.writef(g.else_(d.Default))
+		b.writef("%s", g.else_(d.Default))
 	}
 	return b.String()
 }
@@ -280,10 +579,10 @@ func (g *Generator) else_(d *analyzer.IRElse) string {
 	b.writef(" else {\n\t")
 	for _, v := range d.Block {
 		if v, ok := v.(*analyzer.IRElseIf); ok {
-			b.writef(g.elseif(v))
+			b.writef("%s", g.elseif(v))
 			continue
 		}
-		b.writef(g.stmt1(v))
+		b.writef("%s", g.stmt1(v))
 	}
 	b.writef("\n}")
 	return b.String()
@@ -293,7 +592,7 @@ func (g *Generator) block(d *analyzer.IRBlock) string {
 	b := newStringBuilder()
 	b.writef("{\n\t")
 	for _, v := range d.Stmts {
-		b.writef(g.stmt1(v))
+		b.writef("%s", g.stmt1(v))
 	}
 	b.writef("\n}\n")
 	return b.String()
@@ -301,19 +600,52 @@ func (g *Generator) block(d *analyzer.IRBlock) string {
 
 func (g *Generator) dt(d *analyzer.IRDatatype) string {
 	b := newStringBuilder()
+	if len(d.Variants) > 0 {
+		return g.sum(d)
+	}
 	b.writef("type %s struct {\n", d.Name)
 	for _, v := range d.Fields {
-		b.writef("\t%s %s\n", v.Name, v.Type)
+		b.writef("\t%s %s\n", v.Name, goType(v.Type))
 	}
 	b.writef("}\n")
 	return b.String()
 }
 
+// a sum type is an interface that only its variants implement. Quoi
+// identifiers can't contain 'ℚ'; so the method can't clash with a field.
+func (g *Generator) sum(d *analyzer.IRDatatype) string {
+	b := newStringBuilder()
+	b.writef("type %s interface {\n\tℚvariant() int // the index of the variant\n}\n", d.Name)
+	for i, v := range d.Variants {
+		b.writef("%s", g.dt(v))
+		b.writef("func (%s) ℚvariant() int { return %d }\n", v.Name, i)
+	}
+	return b.String()
+}
+
+// an enum is a Go string type, and its members are constants of it; so fmt
+// prints the names of the members, even in unexported fields of structs.
+func (g *Generator) enum(d *analyzer.IREnum) string {
+	b := newStringBuilder()
+	b.writef("type %s string\n\nconst (\n", d.Name)
+	for _, m := range d.Members {
+		b.writef("\t%s %s = %q\n", member(d.Type, m), d.Name, m)
+	}
+	b.writef(")\n")
+	return b.String()
+}
+
+// the Go constant of the member name of e. Quoi identifiers can't contain 'ℚ';
+// so it can't clash with a variable, or a function.
+func member(e *types.Enum, name string) string {
+	return "ℚ" + e.Name + "_" + name
+}
+
 func (g *Generator) fun(d *analyzer.IRFunction) string {
 	b := newStringBuilder()
 	b.writef("func %s(", d.Name)
 	for i, v := range d.Takes {
-		b.writef("%s %s", d.ParamNames[i], v)
+		b.writef("%s *%s", g.varName(d.ParamNames[i]), goType(v))
 		if i != len(d.Takes)-1 {
 			b.writef(", ")
 		}
@@ -322,8 +654,8 @@ func (g *Generator) fun(d *analyzer.IRFunction) string {
 	if d.ReturnsCount > 0 {
 		b.writef("(")
 		for i, v := range d.Returns {
-			b.writef(v)
-			if i != len(d.Takes)-1 {
+			b.writef("%s", goType(v))
+			if i != len(d.Returns)-1 {
 				b.writef(", ")
 			}
 		}
@@ -331,40 +663,21 @@ func (g *Generator) fun(d *analyzer.IRFunction) string {
 	}
 	b.writef("{\n")
 	for _, v := range d.Block {
-		b.writef(g.stmt1(v))
+		b.writef("%s", g.stmt1(v))
 	}
 	b.writef("\n}\n")
 	return b.String()
 }
 
 func (g *Generator) funcall(d *analyzer.IRFunctionCall) string {
-	b := newStringBuilder()
-	b.writef("%s(", d.Name)
-	b.writef(g.exprList(d.Takes, d.TakesCount))
-	b.writef(")\n")
-	return b.String()
+	return g.expr(d) + "\n"
 }
 
 func (g *Generator) funcallns(d *analyzer.IRFunctionCallFromNamespace) string {
 	b := newStringBuilder()
-	ns := d.Namespace
-	nsim := map[string]string{
-		"Stdout": "fmt",
-		"Math":   "math",
-		"String": "strings",
-	}
-	nsfm := map[string]string{
-		"println": "Println",
-		"print":   "Print",
-		"mod":     "Mod10",
-		"pow":     "Pow",
-		"sqrt":    "Sqrt",
-	}
-	pkg := nsim[ns]
-	g.addImport(pkg)
-	b.writef("%s.", pkg)
-	d.IRFunctionCall.Name = nsfm[d.Name]
-	b.writef(g.funcall(&d.IRFunctionCall))
+	b.writef("%s(", g.useRuntimeFunc(d.Namespace, d.Name))
+	b.writef("%s", g.exprList(d.Takes, len(d.Takes)))
+	b.writef(")\n")
 	return b.String()
 }
 
@@ -372,12 +685,80 @@ func (g *Generator) loop(d *analyzer.IRLoop) string {
 	b := newStringBuilder()
 	b.writef("for %s {\n", g.expr(d.Cond))
 	for _, v := range d.Stmts {
-		b.writef(g.stmt1(v))
+		b.writef("%s", g.stmt1(v))
 	}
 	b.writef("}\n")
 	return b.String()
 }
 
+//	match s {
+//	    Circle c { ... }
+//	    Rect { ... }
+//	}
+//
+// is generated as
+//
+//	{
+//	    var ℚmatch Shape = s
+//	    if ℚmatch.ℚvariant() == 0 {
+//	        c := ℚmatch.(Circle)
+//	        _ = c
+//	        ...
+//	    } else {
+//	        ...
+//	    }
+//	}
+//
+// the last arm is the else branch, if there's no else arm; so a match whose
+// arms all return is a terminating statement. it isn't a Go switch, because
+// break in a switch wouldn't break the loop around it.
+func (g *Generator) match(d *analyzer.IRMatch) string {
+	b := newStringBuilder()
+	sum := d.Type
+	b.writef("{\nvar ℚmatch %s = %s\n%s", sum.Name, g.expr(d.Value), use("ℚmatch"))
+	if len(d.Arms) == 0 {
+		// only an else arm
+		b.writef("%s}\n", g.block(&analyzer.IRBlock{Stmts: d.Default.Block}))
+		return b.String()
+	}
+	for i, arm := range d.Arms {
+		switch {
+		case i == len(d.Arms)-1 && d.Default == nil:
+			if i > 0 {
+				b.writef(" else {\n")
+			} else {
+				// the only variant
+				b.writef("{\n")
+			}
+		case i == 0:
+			b.writef("if ℚmatch.ℚvariant() == %d {\n", variantIndex(sum, arm.Variant))
+		default:
+			b.writef(" else if ℚmatch.ℚvariant() == %d {\n", variantIndex(sum, arm.Variant))
+		}
+		if arm.Name != "" {
+			b.writef("%s := ℚmatch.(%s)\n%s", g.varName(arm.Name), arm.Variant.Name, use(g.varName(arm.Name)))
+		}
+		for _, v := range arm.Block {
+			b.writef("%s", g.stmt1(v))
+		}
+		b.writef("}")
+	}
+	if d.Default != nil {
+		b.writef("%s", g.else_(d.Default))
+	}
+	b.writef("\n}\n")
+	return b.String()
+}
+
+func variantIndex(sum, variant *types.Datatype) int {
+	for i, v := range sum.Variants {
+		if v.Name == variant.Name {
+			return i
+		}
+	}
+	return -1
+}
+
 func (g *Generator) ret(d *analyzer.IRReturn) string {
 	b := newStringBuilder()
 	b.writef("return %s\n", g.exprList(d.ReturnValues, d.ReturnCount))
@@ -386,6 +767,10 @@ func (g *Generator) ret(d *analyzer.IRReturn) string {
 
 func (g *Generator) reas(d *analyzer.IRReassigment) string {
 	b := newStringBuilder()
-	b.writef("%s = %s\n", d.Name, g.expr(d.NewValue))
+	if d.Param {
+		b.writef("*%s = %s\n", g.varName(d.Name), g.expr(d.NewValue))
+		return b.String()
+	}
+	b.writef("%s = %s\n", g.varName(d.Name), g.expr(d.NewValue))
 	return b.String()
 }
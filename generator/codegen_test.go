@@ -1,11 +1,17 @@
 package generator
 
 import (
+	"bytes"
 	"fmt"
 	"os"
+	"os/exec"
 	"quoi/analyzer"
+	"quoi/ast"
+	"quoi/cmd"
 	"quoi/lexer"
 	"quoi/parser"
+	"quoi/std"
+	"strings"
 	"testing"
 )
 
@@ -135,3 +141,400 @@ func Test4(t *testing.T) {
 
 	fmt.Println(setup(input).Generate())
 }
+
+func TestStringEscapes(t *testing.T) {
+	input := `string s = "a\tb \"c\" d\\e 100% \u{E9}\n".`
+	got := setup(input).Generate()
+	want := `s = "a\tb \"c\" d\\e 100% é\n"`
+	if !(strings.Contains(got, want)) {
+		t.Errorf("want:\n%s\ngot:\n%s", want, got)
+	}
+}
+
+func TestSubseq(t *testing.T) {
+	tests := []struct {
+		input, want string
+	}{
+		{
+			`int a, string b = 1, "x".`,
+			`package main
+
+import(
+)
+
+
+var a int
+var b string
+func main() {
+
+a = 1
+b = "x"
+
+}
+`,
+		},
+		{
+			`fun f() -> int, string { return 1, "one". }
+			int a, string b, int c = f(), 5.`,
+			`package main
+
+import(
+)
+
+func f() (int, string) {
+return 1, "one"
+
+}
+
+var a int
+var b string
+var c int
+func main() {
+
+a, b = f()
+c = 5
+
+}
+`,
+		},
+		{
+			`fun g(listof int xs) -> listof int, bool { return xs, true. }
+			listof string sx, listof int nx, bool ok, listof bool bx = ["a"], g([1, 2]), [].`,
+			`package main
+
+import(
+)
+
+func g(xs *[]int) ([]int, bool) {
+return (*xs), true
+
+}
+
+var sx []string
+var nx []int
+var ok bool
+var bx []bool
+func main() {
+
+sx = []string{ "a" }
+nx, ok = g(func(v []int) *[]int { return &v }([]int{ 1, 2 }))
+bx = []bool{  }
+
+}
+`,
+		},
+	}
+	for i, tt := range tests {
+		if got := setup(tt.input).Generate(); got != tt.want {
+			t.Errorf("#%d: want:\n%s\ngot:\n%s", i, tt.want, got)
+		}
+	}
+}
+
+func TestRuntimeFunctions(t *testing.T) {
+	// every function in the standard library must have a Go implementation,
+	// and the analyzer must know its signature.
+	lib := analyzer.InitStandardLibrary(analyzer.New(&ast.Program{}))
+	for _, f := range std.Funcs {
+		if !(strings.Contains(f.Go, "func "+std.Mangle(f.Namespace, f.Name)+"(")) {
+			t.Errorf("no Go implementation of '%s::%s'", f.Namespace, f.Name)
+		}
+		if lib.GetFunc(f.Namespace, f.Name) == nil {
+			t.Errorf("unknown function '%s::%s'", f.Namespace, f.Name)
+		}
+	}
+}
+
+func TestRuntimeEndToEnd(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go toolchain not found")
+	}
+	input := `
+		Stdout::print("a").
+		Stdout::println("b").
+		Stdout::println(String::from_int(Math::mod(17, 5))).
+		Stdout::println(String::from_int(Math::mod(-17, 5))).
+		Stdout::println(String::from_int(Math::pow(3, 4))).
+		Stdout::println(String::from_int(Math::pow(2, 62))).
+		Stdout::println(String::from_int(Math::pow(2, -1))).
+		Stdout::println(String::from_int(Math::sqrt(99))).
+		Stdout::println(String::from_int(Math::sqrt(100))).
+		Stdout::println(String::from_bool(true)).
+		Stdout::println(String::concat("foo", "bar")).
+		Stdout::println(String::from_int(String::index("Ayşe", "e"))).
+		Stdout::println(String::from_int(String::index("Hello", "z"))).
+		int n = Int::from_string("-42").
+		Stdout::println(String::from_int((+ n 1))).
+		listof int nx = [1, 2, 3].
+		listof int nx2 = List::replace_int(nx, 1, 20).
+		listof string sx = List::replace_string(["a", "b"], 0, "z").
+		listof bool bx = List::replace_bool([true], 0, false).
+		Stdout::println(String::from_int((' nx 1))).
+		Stdout::println(String::from_int((' nx2 1))).
+		Stdout::println((' sx 0)).
+		Stdout::println(String::from_bool((' bx 0))).
+	`
+	want := "ab\n2\n-2\n81\n4611686018427387904\n0\n9\n10\ntrue\nfoobar\n3\n-1\n-41\n2\n20\nz\nfalse\n"
+	var stdout, stderr bytes.Buffer
+	code, err := cmd.RunProgram(setup(input).Generate(), nil, &stdout, &stderr)
+	if err != nil {
+		t.Fatalf("%s\n%s", err, stderr.String())
+	}
+	if code != 0 {
+		t.Fatalf("exit code %d\n%s", code, stderr.String())
+	}
+	if got := stdout.String(); got != want {
+		t.Errorf("want:\n%s\ngot:\n%s", want, got)
+	}
+}
+
+func TestRuntimePanics(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go toolchain not found")
+	}
+	tests := []struct {
+		input, msg string
+	}{
+		{`Stdout::println(String::from_int(Math::mod(1, 0))).`, "Math::mod: division by zero"},
+		{`Stdout::println(String::from_int(Math::sqrt(-1))).`, "Math::sqrt: square root of a negative number"},
+		{`Stdout::println(String::from_int(Int::from_string("x"))).`, `Int::from_string: invalid integer "x"`},
+		{`listof int nx = List::replace_int([1], 1, 0).
+		Stdout::println(String::from_int((' nx 0))).`, "List::replace_int: index '1' is out of range"},
+	}
+	for i, tt := range tests {
+		var stderr bytes.Buffer
+		code, err := cmd.RunProgram(setup(tt.input).Generate(), nil, nil, &stderr)
+		if err != nil {
+			t.Fatalf("#%d: %s\n%s", i, err, stderr.String())
+		}
+		if code == 0 || !(strings.Contains(stderr.String(), tt.msg)) {
+			t.Errorf("#%d: expected a panic with '%s', got exit code %d\n%s", i, tt.msg, code, stderr.String())
+		}
+	}
+}
+
+// the README's examples, and arguments that aren't variables. interp/testdata
+// has more; they are run with this backend too.
+func TestPassByReference(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go toolchain not found")
+	}
+	input := `
+		int age = 30.
+		fun celebrate_birthday(int age) {
+			Stdout::println("Happy birthday").
+			age = (+ age 1).
+		}
+		celebrate_birthday(age).
+		Stdout::println(String::from_int(age)).
+
+		datatype User {
+			string name
+		}
+		fun rename(User u, string v) {
+			u = (set u name v).
+		}
+		User u = User{name="Jennifer"}.
+		string v = "Hasan".
+		rename(u, v).
+		Stdout::println((get u name)).
+		rename(User{}, "x").
+
+		fun two() -> int, int {
+			return 1, 2.
+		}
+		fun add(int a, int b) -> int {
+			a = (+ a b).
+			return a.
+		}
+		Stdout::println(String::from_int(add(two()))).
+		; add changes age; celebrate_birthday changes a copy of what add returns
+		celebrate_birthday(add(age, 1)).
+		Stdout::println(String::from_int(age)).
+	`
+	want := "Happy birthday\n31\nHasan\n3\nHappy birthday\n32\n"
+	var stdout, stderr bytes.Buffer
+	code, err := cmd.RunProgram(setup(input).Generate(), nil, &stdout, &stderr)
+	if err != nil {
+		t.Fatalf("%s\n%s", err, stderr.String())
+	}
+	if code != 0 {
+		t.Fatalf("exit code %d\n%s", code, stderr.String())
+	}
+	if got := stdout.String(); got != want {
+		t.Errorf("want:\n%s\ngot:\n%s", want, got)
+	}
+}
+
+func TestSumTypes(t *testing.T) {
+	input := `
+		datatype Shape = Circle { int r } | Rect { int w int h }
+		datatype Drawing {
+			string title
+			Shape shape
+		}
+		datatype Frame {
+			Drawing d
+		}
+		Frame f = Frame{}.
+		Shape s = Rect{w=1}.
+		match s {
+			Circle c { }
+			else { }
+		}
+	`
+	got := setup(input).Generate()
+	for _, want := range []string{
+		"type Shape interface {",
+		"func (Circle) ℚvariant() int { return 0 }",
+		"func (Rect) ℚvariant() int { return 1 }",
+		// the zero value of a sum type is its first variant; not nil
+		"d: Drawing{shape: Circle{}},",
+		"var ℚmatch Shape = s",
+		"if ℚmatch.ℚvariant() == 0 {\nc := ℚmatch.(Circle)",
+	} {
+		if !(strings.Contains(got, want)) {
+			t.Errorf("%q is not in the generated code:\n%s", want, got)
+		}
+	}
+}
+
+func TestEnums(t *testing.T) {
+	input := `
+		enum Color { Red Green }
+		datatype Pixel {
+			int x
+			Color c
+		}
+		Pixel p = Pixel{x=1}.
+		Color c = Color::Green.
+		bool b = (= c Color::Red).
+		string s = String::from_Color(c).
+		listof Color all = Color::members().
+	`
+	got := setup(input).Generate()
+	for _, want := range []string{
+		"type Color string",
+		"ℚColor_Red Color = \"Red\"",
+		"ℚColor_Green Color = \"Green\"",
+		// the zero value of an enum is its first member; not ""
+		"c: ℚColor_Red,",
+		"var c Color\n",
+		"c = ℚColor_Green",
+		"(c == ℚColor_Red)",
+		"s = string(c)",
+		"[]Color{ ℚColor_Red, ℚColor_Green }",
+	} {
+		if !(strings.Contains(got, want)) {
+			t.Errorf("%q is not in the generated code:\n%s", want, got)
+		}
+	}
+}
+
+func TestConsts(t *testing.T) {
+	input := `
+		const int HOUR = (* 60 60).
+		const string S = "a".
+		const listof int XS = [1, 2].
+		fun f(int n) {
+			n = (+ n 1).
+		}
+		f(HOUR).
+	`
+	got := setup(input).Generate()
+	for _, want := range []string{
+		"const HOUR int = 3600",
+		"const S string = \"a\"",
+		"var XS []int\n",
+		"XS = []int{ 1, 2 }",
+		// f can't change a constant
+		"f(func(v int) *int { return &v }(HOUR))",
+	} {
+		if !(strings.Contains(got, want)) {
+			t.Errorf("%q is not in the generated code:\n%s", want, got)
+		}
+	}
+}
+
+// a variable may have the name of a function; calls still call the function
+func TestShadowedFunctions(t *testing.T) {
+	input := `
+		fun area(int w, int h) -> int {
+			return (* w h).
+		}
+		fun f(int area) -> int {
+			int a = area(area, 2).
+			return a.
+		}
+		fun g() -> int {
+			int area = area(2, 3).
+			return area.
+		}
+		int area = f(1).
+	`
+	got := setup(input).Generate()
+	for _, want := range []string{
+		"func f(ℚvar_area *int) (int)",
+		"var a int = area(ℚvar_area, func(v int) *int { return &v }(2))",
+		"var ℚvar_area int = area(func(v int) *int { return &v }(2), func(v int) *int { return &v }(3))",
+		"return ℚvar_area",
+		"ℚvar_area = f(func(v int) *int { return &v }(1))",
+	} {
+		if !(strings.Contains(got, want)) {
+			t.Errorf("%q is not in the generated code:\n%s", want, got)
+		}
+	}
+}
+
+func TestLineDirectives(t *testing.T) {
+	input := `listof int xs = [1, 2].
+fun at(listof int l, int i) -> int {
+    return (' l i).
+}
+Stdout::println(String::from_int(at(xs, 5))).
+`
+	g := setup(input)
+	g.File = "prog.q"
+	code := g.Generate()
+	for _, want := range []string{
+		"\n//line prog.q:1:1\nvar xs []int",
+		"\n//line prog.q:2:1\nfunc at(",
+		"\n//line prog.q:3:5\nreturn (*l)[(*i)]",
+		"\n//line prog.q:5:1\nℚStdout_println(",
+	} {
+		if !(strings.Contains(code, want)) {
+			t.Errorf("no %q in\n%s", want, code)
+		}
+	}
+	// the runtime isn't mapped to the Quoi source
+	if strings.Index(code, "func ℚStdout_println") > strings.Index(code, "//line") {
+		t.Errorf("runtime functions after a //line directive\n%s", code)
+	}
+	// nor is main; it's mapped back to the generated file
+	lines := strings.Split(code, "\n")
+	for i, l := range lines {
+		if l == "func main() {" {
+			if want := fmt.Sprintf("//line main.go:%d:1", i+1); lines[i-1] != want {
+				t.Errorf("want %q before main, got %q", want, lines[i-1])
+			}
+		}
+	}
+	if strings.Contains(setup(input).Generate(), "//line") {
+		t.Errorf("//line directives without a file name")
+	}
+
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go toolchain not found")
+	}
+	var stderr bytes.Buffer
+	status, err := cmd.RunProgram(code, nil, nil, &stderr)
+	if err != nil {
+		t.Fatalf("%s\n%s", err, stderr.String())
+	}
+	// the stack trace points at the Quoi source
+	for _, want := range []string{"index out of range [5]", "prog.q:3", "prog.q:5"} {
+		if status == 0 || !(strings.Contains(stderr.String(), want)) {
+			t.Errorf("expected a panic with '%s', got exit code %d\n%s", want, status, stderr.String())
+		}
+	}
+}
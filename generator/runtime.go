@@ -0,0 +1,36 @@
+package generator
+
+import (
+	"quoi/std"
+	"sort"
+)
+
+// the Quoi runtime. Go implementations of the standard library functions used
+// by the program (see package std).
+
+// name of the runtime function that implements ns::name. the function is
+// added to the generated code.
+func (g *Generator) useRuntimeFunc(ns, name string) string {
+	fn := std.Lookup(ns, name)
+	if fn == nil {
+		panic("no runtime function for " + ns + "::" + name)
+	}
+	g.usedRuntimeFuncs[fn] = true
+	return std.Mangle(ns, name)
+}
+
+func (g *Generator) addRuntimeFunctions() {
+	var used []*std.Func
+	for fn := range g.usedRuntimeFuncs {
+		used = append(used, fn)
+	}
+	sort.Slice(used, func(i, j int) bool {
+		return std.Mangle(used[i].Namespace, used[i].Name) < std.Mangle(used[j].Namespace, used[j].Name)
+	})
+	for _, fn := range used {
+		for _, pkg := range fn.Imports {
+			g.addImport(pkg)
+		}
+		g.runtime.writef("%s", fn.Go)
+	}
+}
@@ -0,0 +1,540 @@
+// a tree-walking interpreter for the IR
+//
+// it runs a typechecked program without compiling it to Go. a program behaves
+// the same way as its Go counterpart; it prints the same output, and it stops
+// with the same runtime errors.
+//
+// values are represented as:
+//
+//	int, string, bool   -> int, string, bool
+//	listof T            -> []interface{}
+//	datatypes           -> Struct (of its variant, for a value of a sum type)
+//	enums               -> string (the name of the member)
+//	functions           -> *analyzer.IRFunction (nil for the zero value)
+package interp
+
+import (
+	"fmt"
+	"io"
+	"quoi/analyzer"
+	"quoi/rt"
+	"quoi/std"
+	"quoi/token"
+	"quoi/types"
+	"strconv"
+	"strings"
+)
+
+// a runtime error stops the program
+type RuntimeError = rt.Error
+
+// a value of a datatype
+type Struct struct {
+	Type   *analyzer.IRDatatype
+	Fields map[string]interface{}
+}
+
+func (s Struct) FieldValues() []interface{} {
+	var res []interface{}
+	for _, f := range s.Type.Fields {
+		res = append(res, s.Fields[f.Name])
+	}
+	return res
+}
+
+// how many nested function calls there can be. this limit is the
+// interpreter's own; every call takes a few kilobytes of the Go stack of the
+// interpreter, which would overflow (and crash the process) a few hundred
+// thousand calls deep. the Go backend, and the VM allow deeper recursion.
+const maxDepth = 100000
+
+type Interpreter struct {
+	out       io.Writer
+	funcs     map[string]*analyzer.IRFunction
+	datatypes map[string]*analyzer.IRDatatype
+	globals   *env
+	depth     int
+	// the expression that's being run; runtime errors point to it
+	pos token.Pos
+}
+
+// Run runs prg, writing its output to out.
+// a runtime error is returned as *RuntimeError.
+func Run(prg *analyzer.IRProgram, out io.Writer) error {
+	return New(out).Run(prg)
+}
+
+// New returns an interpreter that writes the output of programs to out.
+// the functions, the datatypes, and the global variables of a program are
+// kept for the programs that it runs after it; the REPL runs every input with
+// the same interpreter.
+func New(out io.Writer) *Interpreter {
+	return &Interpreter{
+		out:       out,
+		funcs:     map[string]*analyzer.IRFunction{},
+		datatypes: map[string]*analyzer.IRDatatype{},
+		globals:   newEnv(nil),
+	}
+}
+
+// Run runs prg after the programs that in ran before; prg is typechecked in
+// their environment. a runtime error is returned as *RuntimeError. what prg
+// did before the error is kept; see Save, and Restore.
+func (in *Interpreter) Run(prg *analyzer.IRProgram) (err error) {
+	in.depth, in.pos = 0, token.Pos{}
+	defer func() {
+		if r := recover(); r != nil {
+			rerr := rt.ToError(r)
+			if rerr.Pos == (token.Pos{}) {
+				rerr.Pos = in.pos
+			}
+			err = rerr
+		}
+	}()
+	// functions, and datatypes can be used before they are declared
+	for _, s := range prg.Stmts {
+		in.declare(s)
+	}
+	in.block(prg.Stmts, in.globals)
+	return nil
+}
+
+func (in *Interpreter) declare(s analyzer.IRStatement) {
+	switch s := s.(type) {
+	case *analyzer.IRFunction:
+		in.funcs[s.Name] = s
+	case *analyzer.IRDatatype:
+		in.datatypes[s.Name] = s
+		for _, v := range s.Variants {
+			in.datatypes[v.Name] = v
+		}
+	}
+}
+
+// variables of a scope. a variable is a pointer to its value; a parameter
+// shares it with the argument it's passed.
+// the functions, the datatypes, and the global variables of an interpreter at
+// some point
+type State struct {
+	funcs     map[string]*analyzer.IRFunction
+	datatypes map[string]*analyzer.IRDatatype
+	globals   map[string]*interface{}
+	values    map[string]interface{}
+}
+
+// Save returns the current state of in, to go back to it with Restore.
+func (in *Interpreter) Save() *State {
+	s := &State{
+		funcs:     map[string]*analyzer.IRFunction{},
+		datatypes: map[string]*analyzer.IRDatatype{},
+		globals:   map[string]*interface{}{},
+		values:    map[string]interface{}{},
+	}
+	for k, v := range in.funcs {
+		s.funcs[k] = v
+	}
+	for k, v := range in.datatypes {
+		s.datatypes[k] = v
+	}
+	// values aren't changed in place; copying them is enough
+	for k, v := range in.globals.vars {
+		s.globals[k], s.values[k] = v, *v
+	}
+	return s
+}
+
+// Restore undoes what in did after s was saved; the variables that were
+// declared are forgotten, and the ones that were changed get their values
+// back. the output stays written.
+func (in *Interpreter) Restore(s *State) {
+	in.funcs, in.datatypes = map[string]*analyzer.IRFunction{}, map[string]*analyzer.IRDatatype{}
+	for k, v := range s.funcs {
+		in.funcs[k] = v
+	}
+	for k, v := range s.datatypes {
+		in.datatypes[k] = v
+	}
+	in.globals.vars = map[string]*interface{}{}
+	for k, v := range s.globals {
+		*v = s.values[k]
+		in.globals.vars[k] = v
+	}
+}
+
+type env struct {
+	vars   map[string]*interface{}
+	parent *env
+}
+
+func newEnv(parent *env) *env {
+	return &env{vars: map[string]*interface{}{}, parent: parent}
+}
+
+func (e *env) declare(name string, v interface{}) {
+	e.vars[name] = &v
+}
+
+func (e *env) ref(name string) *interface{} {
+	for ; e != nil; e = e.parent {
+		if v, ok := e.vars[name]; ok {
+			return v
+		}
+	}
+	panic("interp: undefined variable " + name)
+}
+
+func (e *env) lookup(name string) interface{} {
+	return *e.ref(name)
+}
+
+func (e *env) assign(name string, v interface{}) {
+	*e.ref(name) = v
+}
+
+// what to do after a statement
+type flow int
+
+const (
+	flowNext flow = iota
+	flowBreak
+	flowContinue
+	flowReturn
+)
+
+// run stmts in e. returned values are set if flow is flowReturn.
+func (in *Interpreter) block(stmts []analyzer.IRStatement, e *env) (flow, []interface{}) {
+	for _, s := range stmts {
+		if f, ret := in.stmt(s, e); f != flowNext {
+			return f, ret
+		}
+	}
+	return flowNext, nil
+}
+
+func (in *Interpreter) stmt(s analyzer.IRStatement, e *env) (flow, []interface{}) {
+	switch s := s.(type) {
+	case *analyzer.IRVariable:
+		e.declare(s.Name, in.expr(s.Value, e))
+	case *analyzer.IRSubseq:
+		for i, v := range in.values(s.Values, e) {
+			e.declare(s.Names[i], v)
+		}
+	case *analyzer.IRReassigment:
+		e.assign(s.Name, in.expr(s.NewValue, e))
+	case *analyzer.IRShow:
+		in.show(s, e)
+	case *analyzer.IRFunctionCall, *analyzer.IRFunctionCallFromNamespace:
+		in.call(s.(analyzer.IRExpression), e)
+	case *analyzer.IRIf:
+		return in.if_(s.Cond, s.Block, s.Alternative, s.Default, e)
+	case *analyzer.IRBlock:
+		return in.block(s.Stmts, newEnv(e))
+	case *analyzer.IRLoop:
+		return in.loop(s, e)
+	case *analyzer.IRMatch:
+		return in.match(s, e)
+	case *analyzer.IRReturn:
+		return flowReturn, in.values(s.ReturnValues, e)
+	case *analyzer.IRBreak:
+		return flowBreak, nil
+	case *analyzer.IRContinue:
+		return flowContinue, nil
+	case *analyzer.IRFunction, *analyzer.IRDatatype:
+		in.declare(s)
+	case *analyzer.IREnum:
+		// its members are their names
+	default:
+		panic("interp: unknown statement " + s.String())
+	}
+	return flowNext, nil
+}
+
+func (in *Interpreter) if_(cond analyzer.IRExpression, block []analyzer.IRStatement, alt *analyzer.IRElseIf, def *analyzer.IRElse, e *env) (flow, []interface{}) {
+	if in.expr(cond, e).(bool) {
+		return in.block(block, newEnv(e))
+	}
+	if alt != nil {
+		return in.if_(alt.Cond, alt.Block, alt.Alternative, alt.Default, e)
+	}
+	if def != nil {
+		return in.block(def.Block, newEnv(e))
+	}
+	return flowNext, nil
+}
+
+func (in *Interpreter) match(s *analyzer.IRMatch, e *env) (flow, []interface{}) {
+	v := in.expr(s.Value, e).(Struct)
+	for _, arm := range s.Arms {
+		if arm.Variant.Name != v.Type.Name {
+			continue
+		}
+		armEnv := newEnv(e)
+		if arm.Name != "" {
+			armEnv.declare(arm.Name, v)
+		}
+		return in.block(arm.Block, armEnv)
+	}
+	if s.Default != nil {
+		return in.block(s.Default.Block, newEnv(e))
+	}
+	return flowNext, nil
+}
+
+func (in *Interpreter) loop(s *analyzer.IRLoop, e *env) (flow, []interface{}) {
+	for s.Cond == nil || in.expr(s.Cond, e).(bool) {
+		f, ret := in.block(s.Stmts, newEnv(e))
+		switch f {
+		case flowBreak:
+			return flowNext, nil
+		case flowReturn:
+			return f, ret
+		}
+	}
+	return flowNext, nil
+}
+
+// print the value of a bare expression, the way the Go backend does.
+func (in *Interpreter) show(s *analyzer.IRShow, e *env) {
+	if s.Type == types.Void {
+		in.call(s.Value, e)
+		return
+	}
+	values := in.values([]analyzer.IRExpression{s.Value}, e)
+	if s.Type == types.String {
+		fmt.Fprintln(in.out, strconv.Quote(values[0].(string)))
+		return
+	}
+	var strs []string
+	for _, v := range values {
+		strs = append(strs, rt.Format(v))
+	}
+	fmt.Fprintln(in.out, strings.Join(strs, " "))
+}
+
+// values of exprs. a call to a function returning multiple values produces all of them.
+func (in *Interpreter) values(exprs []analyzer.IRExpression, e *env) []interface{} {
+	var res []interface{}
+	for _, v := range exprs {
+		switch v.(type) {
+		case *analyzer.IRFunctionCall, *analyzer.IRFunctionCallFromNamespace:
+			res = append(res, in.call(v, e)...)
+		default:
+			res = append(res, in.expr(v, e))
+		}
+	}
+	return res
+}
+
+// call a user-defined, or a standard library function. it returns every returned value.
+func (in *Interpreter) call(c analyzer.IRExpression, e *env) []interface{} {
+	switch c := c.(type) {
+	case *analyzer.IRFunctionCallFromNamespace:
+		fn := std.Lookup(c.Namespace, c.Name)
+		if fn == nil {
+			panic("interp: no standard library function " + c.Namespace + "::" + c.Name)
+		}
+		args := in.values(c.Takes, e)
+		in.pos = c.Pos()
+		res := fn.Native(in.out, args)
+		if c.ReturnsCount == 0 {
+			return nil
+		}
+		return []interface{}{res}
+	case *analyzer.IRFunctionCall:
+		fn := in.funcs[c.Name]
+		if c.Value != nil {
+			// a function value
+			fn = in.expr(c.Value, e).(*analyzer.IRFunction)
+			if fn == nil {
+				panic(&RuntimeError{Msg: "runtime error: invalid memory address or nil pointer dereference", Pos: c.Pos()})
+			}
+		}
+		if fn == nil {
+			panic("interp: undefined function " + c.Name)
+		}
+		// arguments are passed by reference. a variable is shared with the
+		// callee; any other argument (and a constant) is a copy of its value.
+		var args []*interface{}
+		for _, arg := range c.Takes {
+			if v, ok := arg.(*analyzer.IRVariableReference); ok && !(v.Const) {
+				args = append(args, e.ref(v.Name))
+				continue
+			}
+			for _, v := range in.values([]analyzer.IRExpression{arg}, e) {
+				v := v
+				args = append(args, &v)
+			}
+		}
+		if in.depth >= maxDepth {
+			panic(&RuntimeError{Msg: "stack overflow: too many nested calls of " + c.Name, Pos: c.Pos()})
+		}
+		in.depth++
+		defer func() { in.depth-- }()
+		// functions see the global variables
+		fe := newEnv(in.globals)
+		for i, name := range fn.ParamNames {
+			fe.vars[name] = args[i]
+		}
+		_, ret := in.block(fn.Block, fe)
+		return ret
+	}
+	panic("interp: not a function call " + c.String())
+}
+
+func (in *Interpreter) expr(x analyzer.IRExpression, e *env) interface{} {
+	switch x := x.(type) {
+	case *analyzer.IRInt:
+		n, err := strconv.Atoi(x.Value)
+		if err != nil {
+			panic("interp: invalid integer " + x.Value)
+		}
+		return n
+	case *analyzer.IRString:
+		return x.Value
+	case *analyzer.IRBoolean:
+		return x.Value == "true"
+	case *analyzer.IRVariableReference:
+		return e.lookup(x.Name)
+	case *analyzer.IRList:
+		res := make([]interface{}, 0, len(x.Value))
+		for _, v := range x.Value {
+			res = append(res, in.expr(v, e))
+		}
+		return res
+	case *analyzer.IRDatatypeLiteral:
+		dt := in.datatypes[x.Name]
+		res := in.zero(dt.Type).(Struct)
+		// in the order of declaration; so that side effects are deterministic
+		for _, f := range dt.Fields {
+			if v, ok := x.FieldsAndValues[f.Name]; ok {
+				res.Fields[f.Name] = in.expr(v, e)
+			}
+		}
+		return res
+	case *analyzer.IRFunctionCall, *analyzer.IRFunctionCallFromNamespace:
+		ret := in.call(x, e)
+		if len(ret) == 0 {
+			return nil
+		}
+		return ret[0]
+	case *analyzer.IRPrefExpr:
+		return in.prefExpr(x, e)
+	case *analyzer.IREnumMember:
+		return x.Name
+	case *analyzer.IREnumName:
+		return in.expr(x.Value, e)
+	case *analyzer.IRFunctionReference:
+		return in.funcs[x.Name]
+	}
+	panic("interp: unknown expression " + x.String())
+}
+
+// zero value of typ
+func (in *Interpreter) zero(typ types.Type) interface{} {
+	switch typ {
+	case types.Int:
+		return 0
+	case types.String:
+		return ""
+	case types.Bool:
+		return false
+	}
+	switch t := typ.(type) {
+	case *types.List:
+		return []interface{}{}
+	case *types.Enum:
+		return t.Members[0]
+	case *types.Func:
+		return (*analyzer.IRFunction)(nil)
+	}
+	dt := in.datatypes[typ.String()]
+	if dt == nil {
+		panic("interp: unknown type " + typ.String())
+	}
+	// the first variant of a sum type
+	if len(dt.Variants) > 0 {
+		return in.zero(dt.Variants[0].Type)
+	}
+	res := Struct{Type: dt, Fields: map[string]interface{}{}}
+	for _, f := range dt.Fields {
+		res.Fields[f.Name] = in.zero(f.Type)
+	}
+	return res
+}
+
+func (in *Interpreter) prefExpr(x *analyzer.IRPrefExpr, e *env) interface{} {
+	ops := x.Operands
+	switch x.Operator {
+	case "+":
+		first := in.expr(ops[0], e)
+		if s, ok := first.(string); ok {
+			var res strings.Builder
+			res.WriteString(s)
+			for _, v := range ops[1:] {
+				res.WriteString(in.expr(v, e).(string))
+			}
+			return res.String()
+		}
+		res := first.(int)
+		for _, v := range ops[1:] {
+			res += in.expr(v, e).(int)
+		}
+		return res
+	case "-", "*", "/":
+		res := in.expr(ops[0], e).(int)
+		for _, v := range ops[1:] {
+			n := in.expr(v, e).(int)
+			switch x.Operator {
+			case "-":
+				res -= n
+			case "*":
+				res *= n
+			case "/":
+				// panics with Go's own runtime error if n is 0
+				in.pos = x.Pos()
+				res /= n
+			}
+		}
+		return res
+	case "and":
+		return in.expr(ops[0], e).(bool) && in.expr(ops[1], e).(bool)
+	case "or":
+		return in.expr(ops[0], e).(bool) || in.expr(ops[1], e).(bool)
+	case "not":
+		return !(in.expr(ops[0], e).(bool))
+	case "=":
+		return in.expr(ops[0], e) == in.expr(ops[1], e)
+	case "lt", "lte", "gt", "gte":
+		a, b := in.expr(ops[0], e).(int), in.expr(ops[1], e).(int)
+		switch x.Operator {
+		case "lt":
+			return a < b
+		case "lte":
+			return a <= b
+		case "gt":
+			return a > b
+		}
+		return a >= b
+	case "'":
+		list, idx := in.expr(ops[0], e), in.expr(ops[1], e).(int)
+		in.pos = x.Pos()
+		return rt.Index(list, idx)
+	case "get":
+		return in.expr(ops[0], e).(Struct).Fields[fieldName(ops[1])]
+	case "set":
+		// set doesn't change its operand; it returns a changed copy
+		old := in.expr(ops[0], e).(Struct)
+		res := Struct{Type: old.Type, Fields: map[string]interface{}{}}
+		for k, v := range old.Fields {
+			res.Fields[k] = v
+		}
+		res.Fields[fieldName(ops[1])] = in.expr(ops[2], e)
+		return res
+	}
+	panic("interp: unknown operator " + x.Operator)
+}
+
+// the field operand of 'get', and 'set' is a bare identifier
+func fieldName(x analyzer.IRExpression) string {
+	return x.(*analyzer.IRVariableReference).Name
+}
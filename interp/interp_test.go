@@ -0,0 +1,178 @@
+package interp
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"quoi"
+	"quoi/analyzer"
+	"quoi/cmd"
+	"quoi/rt"
+	"quoi/types"
+	"strings"
+	"testing"
+)
+
+func compile(t *testing.T, name, text string) quoi.Result {
+	t.Helper()
+	res, ds := quoi.Compile(context.Background(), quoi.Source{Name: name, Text: text}, quoi.Options{})
+	if ds.HasErrors() {
+		t.Fatalf("%s: unexpected diagnostics: %+v", name, ds)
+	}
+	return res
+}
+
+// output of the program, followed by the panic message if it fails
+func interpret(prg *analyzer.IRProgram) string {
+	var out bytes.Buffer
+	if err := Run(prg, &out); err != nil {
+		out.WriteString("panic: " + err.Error() + "\n")
+	}
+	return out.String()
+}
+
+// programs in testdata, and their expected output (name.out)
+func programs(t *testing.T) []string {
+	files, err := filepath.Glob(filepath.Join("testdata", "*.q"))
+	if err != nil || len(files) == 0 {
+		t.Fatalf("no test programs: %v", err)
+	}
+	return files
+}
+
+func TestPrograms(t *testing.T) {
+	for _, file := range programs(t) {
+		src, _ := os.ReadFile(file)
+		want, err := os.ReadFile(strings.TrimSuffix(file, ".q") + ".out")
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := interpret(compile(t, file, string(src)).IR)
+		if got != string(want) {
+			t.Errorf("%s:\nwant=\n%s\ngot=\n%s", file, want, got)
+		}
+	}
+}
+
+// programs in testdata/errors are rejected before they run; name.err has their diagnostics
+func TestRejected(t *testing.T) {
+	files, _ := filepath.Glob(filepath.Join("testdata", "errors", "*.q"))
+	if len(files) == 0 {
+		t.Fatal("no test programs")
+	}
+	for _, file := range files {
+		src, _ := os.ReadFile(file)
+		want, err := os.ReadFile(strings.TrimSuffix(file, ".q") + ".err")
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, ds := quoi.Compile(context.Background(), quoi.Source{Name: filepath.Base(file), Text: string(src)}, quoi.Options{CheckOnly: true})
+		var got strings.Builder
+		for _, d := range ds {
+			fmt.Fprintf(&got, "%s %s %s\n", d.Pos(), d.Code, d.Msg)
+		}
+		if got.String() != string(want) {
+			t.Errorf("%s:\nwant=\n%s\ngot=\n%s", file, want, got.String())
+		}
+	}
+}
+
+// every program prints the same output, and fails the same way in both backends.
+func TestBackends(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go toolchain not found")
+	}
+	for _, file := range programs(t) {
+		src, _ := os.ReadFile(file)
+		res := compile(t, file, string(src))
+		var stdout, stderr bytes.Buffer
+		code, err := cmd.RunProgram(res.Go, nil, &stdout, &stderr)
+		if err != nil {
+			t.Fatalf("%s: %s\n%s", file, err, stderr.String())
+		}
+		goOut := stdout.String()
+		if code != 0 {
+			// only the panic message; not the stack trace
+			goOut += strings.SplitAfter(stderr.String(), "\n")[0]
+		}
+		if interpOut := interpret(res.IR); goOut != interpOut {
+			t.Errorf("%s: outputs differ\nGo=\n%s\ninterp=\n%s", file, goOut, interpOut)
+		}
+	}
+}
+
+func TestRuntimeErrors(t *testing.T) {
+	tests := []struct {
+		input, want string
+		line, col   uint // where it happened
+	}{
+		{"int z = 0.\nint x = (/ 5 z).", "runtime error: integer divide by zero", 2, 9},
+		{"int x = Math::mod(5, 0).", "Math::mod: division by zero", 1, 9},
+		{"listof int nx = [].\nint x = (' nx -1).", "runtime error: index out of range [-1]", 2, 9},
+		{"fun f(int n) -> int {\n\treturn f(n).\n}\nint x = f(1).", "stack overflow: too many nested calls of f", 2, 9},
+	}
+	for _, tt := range tests {
+		err := Run(compile(t, "a.q", tt.input).IR, &bytes.Buffer{})
+		rerr, ok := err.(*RuntimeError)
+		if !(ok) || err.Error() != tt.want {
+			t.Errorf("%q: want error %q, got %#v", tt.input, tt.want, err)
+			continue
+		}
+		if rerr.Pos.Line != tt.line || rerr.Pos.Col != tt.col {
+			t.Errorf("%q: want the error at %d:%d, got %d:%d", tt.input, tt.line, tt.col, rerr.Pos.Line, rerr.Pos.Col)
+		}
+	}
+}
+
+func TestSemantics(t *testing.T) {
+	tests := []struct {
+		name, input, want string
+	}{
+		{"set returns a copy", `
+			datatype User {
+				string name
+			}
+			User u = User{name="Jennifer"}.
+			User u2 = (set u name "Hasan").
+			Stdout::println((+ (get u name) " " (get u2 name))).`, "Jennifer Hasan\n"},
+		{"the values of a call are arguments", `
+			fun two() -> int, int {
+				return 1, 2.
+			}
+			fun add(int a, int b) -> int {
+				a = (+ a b).
+				return a.
+			}
+			Stdout::println(String::from_int(add(two()))).`, "3\n"},
+		{"nested loops", `
+			int i = 0.
+			loop (lt i 3) {
+				i = (+ i 1).
+				int j = 0.
+				loop true {
+					j = (+ j 1).
+					if (gt j i) {
+						break.
+					}
+					Stdout::print(String::from_int(j)).
+				}
+			}`, "112123"},
+	}
+	for _, tt := range tests {
+		got := interpret(compile(t, "a.q", tt.input).IR)
+		if got != tt.want {
+			t.Errorf("%s: want=%q got=%q", tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestFormat(t *testing.T) {
+	dt := &analyzer.IRDatatype{Name: "User", Fields: []analyzer.IRDatatypeField{{Type: types.String, Name: "name"}, {Type: &types.List{Elem: types.Int}, Name: "nx"}}}
+	v := []interface{}{Struct{Type: dt, Fields: map[string]interface{}{"name": "Jen", "nx": []interface{}{1, 2}}}, Struct{Type: dt, Fields: map[string]interface{}{"name": "", "nx": []interface{}{}}}}
+	if got := rt.Format(v); got != "[{Jen [1 2]} { []}]" {
+		t.Errorf("got %q", got)
+	}
+}
@@ -1,20 +1,19 @@
 package lexer
 
 import (
-	"fmt"
+	"quoi/diagnostic"
 	"quoi/token"
+	"strconv"
 	"strings"
 	"unicode"
+	"unicode/utf8"
 )
 
 const eof = rune(-1)
 
 type (
 	state int
-	Err   struct {
-		Msg          string
-		Column, Line int
-	}
+	Err   = diagnostic.Diagnostic
 )
 
 const (
@@ -32,15 +31,20 @@ const (
 type lexFn func(*Lexer) token.Token
 
 type Lexer struct {
+	input         string
 	src           []rune // source code
 	lenSrc        uint   // source string length
 	pointer       uint   // index of the current character
-	line, col     uint
-	ch            rune // current character
+	offset        uint   // byte offset of the current character
+	line, col     uint   // position of the current character (1-based)
+	ch            rune   // current character
 	hasReachedEOF bool
 	state         state
 	lexFns        map[state]lexFn // which function to call when in state
 	Errs          []Err
+	// return comments as token.COMMENT, instead of skipping them.
+	// set it before the first call of Next.
+	KeepComments bool
 }
 
 func New(input string) *Lexer {
@@ -52,29 +56,29 @@ func New(input string) *Lexer {
 		stateLexSymbol:  lexSymbol,
 		stateLexNewline: lexNewline,
 	}
-	if len(input) == 0 {
-		panic("lexer.New: empty input string")
-	}
 	l := &Lexer{
+		input:   input,
 		src:     []rune(input),
 		pointer: 0,
-		col:     0,
+		col:     1,
 		state:   stateStart,
 		lexFns:  lexFns,
 	}
 	l.lenSrc = uint(len(l.src))
+	l.line = 1
+	if l.lenSrc == 0 {
+		l.ch = eof
+		l.hasReachedEOF = true
+		return l
+	}
 	l.ch = l.src[l.pointer]
 	l.hasReachedEOF = l.pointer == l.lenSrc-1
-	l.line = 1
 	return l
 }
 
-func (l *Lexer) errorf(col, line int, formatMsg string, elems ...interface{}) {
-	l.Errs = append(l.Errs, Err{
-		Msg:    fmt.Sprintf(formatMsg, elems...),
-		Column: col,
-		Line:   line,
-	})
+// code is the stable error code of the call site (e.g. L002).
+func (l *Lexer) errorf(code string, col, line int, formatMsg string, elems ...interface{}) {
+	l.Errs = append(l.Errs, diagnostic.New(diagnostic.Lexer, code, uint(line), uint(col), formatMsg, elems...))
 }
 
 func (l *Lexer) peek() rune {
@@ -85,18 +89,38 @@ func (l *Lexer) peek() rune {
 }
 
 func (l *Lexer) advance() {
+	if l.ch == eof {
+		return
+	}
+	// step over the current character
+	_, size := utf8.DecodeRuneInString(l.input[l.offset:])
+	l.offset += uint(size)
+	if l.ch == '\n' {
+		l.line++
+		l.col = 1
+	} else {
+		l.col++
+	}
 	if l.hasReachedEOF {
 		l.ch = eof
 		return
 	}
 	l.pointer++
-	l.col++
 	l.ch = l.src[l.pointer]
 	l.hasReachedEOF = l.pointer+1 == l.lenSrc
-	if l.ch == '\n' {
-		l.line++
-		l.col = 0
-	}
+}
+
+// position of the current character
+func (l *Lexer) pos() token.Pos {
+	return token.Pos{Offset: l.offset, Line: l.line, Col: l.col}
+}
+
+// return a token that starts at start, and ends right before the current character
+func (l *Lexer) newToken(typ token.Type, lit string, start token.Pos) token.Token {
+	tok := token.New(typ, lit, start.Line, start.Col)
+	tok.Offset = start.Offset
+	tok.End = l.pos()
+	return tok
 }
 
 func canBeAnIdentifierName(ch rune) bool {
@@ -107,6 +131,10 @@ func isDigit(ch rune) bool {
 	return ch >= '0' && ch <= '9'
 }
 
+func isHexDigit(ch rune) bool {
+	return isDigit(ch) || (ch >= 'a' && ch <= 'f') || (ch >= 'A' && ch <= 'F')
+}
+
 func isWhitespace(ch rune) bool {
 	if ch == '\n' {
 		// this rune will be lexed as a token.NEWLINE.
@@ -117,7 +145,7 @@ func isWhitespace(ch rune) bool {
 
 func isSymbol(ch rune) bool {
 	str := string(ch)
-	symbols := ":.={}()-,+/*'[]"
+	symbols := ":.={}()-,+/*'[]|"
 	return strings.Contains(symbols, str)
 }
 
@@ -131,18 +159,20 @@ const (
 )
 
 func is(char char, ch rune) bool {
-	return byte(ch) == byte(char)
+	return ch == rune(char)
 }
 
 func lexNewline(l *Lexer) token.Token {
-	n := token.New(token.NEWLINE, "\\n", l.line, l.col)
+	start := l.pos()
 	l.advance()
+	n := l.newToken(token.NEWLINE, "\\n", start)
 	l.state = stateStart
 	return n
 }
 
 func lexInt(l *Lexer) token.Token {
 	start := l.pointer
+	startPos := l.pos()
 	if l.ch == '-' {
 		if p := l.peek(); p == '>' {
 			// this is an arrow symbol.
@@ -157,7 +187,7 @@ func lexInt(l *Lexer) token.Token {
 		l.advance()
 	}
 	if !(isDigit(l.ch)) {
-		l.errorf(int(l.col), int(l.line), "no value after minus")
+		l.errorf("L001", int(l.col), int(l.line), "no value after minus")
 	}
 	for isDigit(l.ch) {
 		if l.hasReachedEOF {
@@ -174,54 +204,113 @@ func lexInt(l *Lexer) token.Token {
 	}
 	lit := string(l.src[start:end])
 	l.state = stateStart
-	return token.New(token.INT, lit, l.line, start)
+	return l.newToken(token.INT, lit, startPos)
 }
 
 func lexString(l *Lexer) token.Token {
+	// the starting position of a string is the position of the first quote. (")
+	startPos := l.pos()
 	// eat '"'
 	l.advance()
-	start := l.pointer
-	line := l.line
+	var lit strings.Builder
 	for !(is(doubleQuote, l.ch)) {
-		if l.hasReachedEOF {
-			l.errorf(int(l.col), int(l.line), "unexpected end-of-file: unclosed string")
+		if l.ch == eof {
+			l.errorf("L002", int(l.col), int(l.line), "unexpected end-of-file: unclosed string")
 			break
 		}
 		// no newlines in strings
 		if l.ch == '\n' {
-			l.errorf(int(l.col), int(l.line), "illegal newline in string literal")
+			l.errorf("L003", int(l.col), int(l.line), "illegal newline in string literal")
 		}
+		if l.ch == '\\' {
+			lexEscape(l, &lit)
+			continue
+		}
+		lit.WriteRune(l.ch)
 		l.advance()
 	}
-	end := l.pointer
-	if l.hasReachedEOF {
-		end++
-		// last character of the file is "
-		// don't pick it up
-		if l.ch == '"' {
-			end--
-			l.advance()
+	// eat the closing '"'
+	if l.ch == '"' {
+		l.advance()
+	}
+	l.state = stateStart
+	return l.newToken(token.STRING, lit.String(), startPos)
+}
+
+// decode the escape sequence starting at the current character ('\\'), and write it to b.
+//
+//	\n \t \\ \" \u{1F600}
+func lexEscape(l *Lexer, b *strings.Builder) {
+	start := l.pos()
+	l.advance() // skip '\\'
+	switch l.ch {
+	case 'n':
+		b.WriteByte('\n')
+	case 't':
+		b.WriteByte('\t')
+	case '\\':
+		b.WriteByte('\\')
+	case '"':
+		b.WriteByte('"')
+	case 'u':
+		lexUnicodeEscape(l, b, start)
+		return
+	case eof:
+		// lexString reports the unclosed string
+		return
+	default:
+		l.errorf("L006", int(start.Col), int(start.Line), "invalid escape sequence '\\%c'", l.ch)
+		if l.ch == '\n' {
+			// lexString reports the newline
+			return
 		}
 	}
-	lit := string(l.src[start:end])
-	// test function: TestStringPrecedingWhitespace
-	if !(l.hasReachedEOF) {
-		if l.ch == '"' {
+	l.advance()
+}
+
+// \u{XXXX}; 1 to 6 hexadecimal digits. current character is 'u'.
+func lexUnicodeEscape(l *Lexer, b *strings.Builder, start token.Pos) {
+	l.advance() // skip 'u'
+	if l.ch != '{' {
+		l.errorf("L007", int(start.Col), int(start.Line), "invalid unicode escape sequence: expected '{' after '\\u'")
+		return
+	}
+	l.advance()
+	var digits strings.Builder
+	for isHexDigit(l.ch) {
+		digits.WriteRune(l.ch)
+		l.advance()
+	}
+	if l.ch != '}' || digits.Len() == 0 || digits.Len() > 6 {
+		l.errorf("L009", int(start.Col), int(start.Line), "invalid unicode escape sequence: expected 1 to 6 hexadecimal digits in '\\u{...}'")
+		if l.ch == '}' {
 			l.advance()
 		}
+		return
 	}
-	l.state = stateStart
-	// start-1, because the starting position of a string is actually the position of first quote. (")
-	return token.New(token.STRING, lit, line, start-1)
+	l.advance() // skip '}'
+	n, _ := strconv.ParseUint(digits.String(), 16, 32)
+	if !(utf8.ValidRune(rune(n))) {
+		l.errorf("L008", int(start.Col), int(start.Line), "invalid unicode code point 'U+%s' in escape sequence", strings.ToUpper(digits.String()))
+		return
+	}
+	b.WriteRune(rune(n))
 }
 
 func ignoreComment(l *Lexer) {
-	for !(is(newline, l.ch)) {
+	for !(is(newline, l.ch)) && l.ch != eof {
 		l.advance()
 	}
 	l.state = stateStart
 }
 
+// the literal of the comment is from ';' to the end of the line; the newline is not included.
+func lexComment(l *Lexer) token.Token {
+	start := l.pos()
+	ignoreComment(l)
+	return l.newToken(token.COMMENT, l.input[start.Offset:l.offset], start)
+}
+
 func ignoreWhitespace(l *Lexer) {
 	for isWhitespace(l.ch) {
 		l.advance()
@@ -237,8 +326,10 @@ func lexIdentOrKw(l *Lexer) token.Token {
 		"loop": token.LOOP, "return": token.RETURN, "and": token.AND, "or": token.OR, "not": token.NOT,
 		"lt": token.LT, "lte": token.LTE, "gt": token.GT, "gte": token.GTE, "listof": token.LISTOF,
 		"break": token.BREAK, "continue": token.CONTINUE, "get": token.GET, "set": token.SET,
+		"match": token.MATCH, "enum": token.ENUM, "const": token.CONST,
 	}
 	start := l.pointer
+	startPos := l.pos()
 	for canBeAnIdentifierName(l.ch) || isDigit(l.ch) {
 		l.advance()
 	}
@@ -250,18 +341,13 @@ func lexIdentOrKw(l *Lexer) token.Token {
 		}
 	}
 	lit := string(l.src[start:end])
-	line := l.line
-	if l.ch == '\n' {
-		line--
-	}
-	keyword, isKw := kw[lit]
-	tok := token.New(token.IDENT, lit, line, start)
-	if isKw {
+	tok := l.newToken(token.IDENT, lit, startPos)
+	if keyword, isKw := kw[lit]; isKw {
 		tok.Type = keyword
 	}
 	// bool literal
 	if lit == "true" || lit == "false" {
-		tok = token.New(token.BOOL, lit, line, start)
+		tok.Type = token.BOOL
 	}
 	l.state = stateStart
 	return tok
@@ -283,35 +369,35 @@ func lexSymbol(l *Lexer) token.Token {
 		'\'': token.SINGLE_QUOTE,
 		'[':  token.OPENING_SQUARE_BRACKET,
 		']':  token.CLOSING_SQUARE_BRACKET,
+		'|':  token.PIPE,
 	}
-	start := l.col
+	start := l.pos()
 	if l.ch == '-' {
 		lit := string(l.ch)
-		line, col := l.line, l.col
 		l.advance()
 		if l.ch == '>' {
 			lit += string(l.ch)
 			l.advance()
 			l.state = stateStart
-			return token.New(token.ARROW, lit, line, start)
+			return l.newToken(token.ARROW, lit, start)
 		}
 		l.state = stateStart
-		return token.New(token.MINUS, lit, line, col)
+		return l.newToken(token.MINUS, lit, start)
 	}
 	if l.ch == ':' {
 		lit := string(l.ch)
 		if l.peek() == eof {
-			l.errorf(int(start), int(l.line), "unknown symbol '%s'", lit)
+			l.errorf("L004", int(start.Col), int(start.Line), "unknown symbol '%s'", lit)
 			l.state = stateStart
 			l.advance()
-			return token.New(token.ILLEGAL, lit, l.line, start)
+			return l.newToken(token.ILLEGAL, lit, start)
 		}
 		if l.peek() == ':' {
 			l.advance()
 			lit += string(l.ch)
 			l.advance()
 			l.state = stateStart
-			return token.New(token.DOUBLE_COLON, lit, l.line, l.col)
+			return l.newToken(token.DOUBLE_COLON, lit, start)
 		}
 	}
 	tok, found := symbols[byte(l.ch)]
@@ -319,10 +405,10 @@ func lexSymbol(l *Lexer) token.Token {
 	l.advance()
 	l.state = stateStart
 	if !(found) {
-		l.errorf(int(start), int(l.line), "unknown symbol '%s'", lit)
-		return token.New(token.ILLEGAL, lit, l.line, l.col)
+		l.errorf("L005", int(start.Col), int(start.Line), "unknown symbol '%s'", lit)
+		return l.newToken(token.ILLEGAL, lit, start)
 	}
-	return token.New(tok, lit, l.line, l.col)
+	return l.newToken(tok, lit, start)
 }
 
 // Entry point
@@ -330,7 +416,7 @@ func lexSymbol(l *Lexer) token.Token {
 func (l *Lexer) Next() token.Token {
 	if l.state == stateStart {
 		if l.ch == eof {
-			return token.New(token.EOF, "<<<EOF>>>", l.line, l.col)
+			return l.newToken(token.EOF, "<<<EOF>>>", l.pos())
 		}
 		if isWhitespace(l.ch) {
 			ignoreWhitespace(l)
@@ -347,6 +433,9 @@ func (l *Lexer) Next() token.Token {
 		} else if is(doubleQuote, l.ch) {
 			l.state = stateLexString
 		} else if is(semicolon, l.ch) {
+			if l.KeepComments {
+				return lexComment(l)
+			}
 			ignoreComment(l)
 			return l.Next()
 		} else if canBeAnIdentifierName(l.ch) {
@@ -359,8 +448,10 @@ func (l *Lexer) Next() token.Token {
 	if fn != nil {
 		return fn(l)
 	}
-	ill := token.New(token.ILLEGAL, string(l.ch), l.line, l.col)
+	start := l.pos()
+	lit := string(l.ch)
 	l.advance()
+	ill := l.newToken(token.ILLEGAL, lit, start)
 	l.state = stateStart
 	return ill
 }
@@ -82,7 +82,7 @@ func TestLexerPeek(t *testing.T) {
 func TestPos(t *testing.T) {
 	input := "Some test\nHey"
 	l := New(input)
-	if l.col != 0 {
+	if l.col != 1 {
 		t.Errorf("1: %d\n", l.col)
 	}
 	if l.line != 1 {
@@ -90,7 +90,7 @@ func TestPos(t *testing.T) {
 	}
 	l.advance()
 	l.advance()
-	if l.col != 2 {
+	if l.col != 3 {
 		t.Errorf("3: %d\n", l.col)
 	}
 	if l.line != 1 {
@@ -531,3 +531,126 @@ func Test_2(t *testing.T) {
 	tok := l.Next()
 	printTok(t, tok)
 }
+
+func TestTokenSpan(t *testing.T) {
+	input := "int x = \"héllo\".\n(+ -1 2)"
+	l := New(input)
+	want := []struct {
+		lit               string
+		offset, line, col uint
+		endLine, endCol   uint
+	}{
+		{"int", 0, 1, 1, 1, 4},
+		{"x", 4, 1, 5, 1, 6},
+		{"=", 6, 1, 7, 1, 8},
+		{"héllo", 8, 1, 9, 1, 16},
+		{".", 16, 1, 16, 1, 17},
+		{"\\n", 17, 1, 17, 2, 1},
+		{"(", 18, 2, 1, 2, 2},
+		{"+", 19, 2, 2, 2, 3},
+		{"-1", 21, 2, 4, 2, 6},
+		{"2", 24, 2, 7, 2, 8},
+		{")", 25, 2, 8, 2, 9},
+	}
+	for i, w := range want {
+		tok := l.Next()
+		if tok.Literal != w.lit || tok.Offset != w.offset || tok.Line != w.line || tok.Col != w.col ||
+			tok.End.Line != w.endLine || tok.End.Col != w.endCol {
+			t.Errorf("#%d: want=%q %d %d:%d-%d:%d got=%q %d %d:%d-%d:%d", i, w.lit, w.offset, w.line, w.col, w.endLine, w.endCol,
+				tok.Literal, tok.Offset, tok.Line, tok.Col, tok.End.Line, tok.End.Col)
+		}
+	}
+	if tok := l.Next(); tok.Type != token.EOF || tok.Offset != uint(len(input)) {
+		t.Errorf("want EOF at %d, got %s at %d", len(input), tok.Type, tok.Offset)
+	}
+}
+
+func TestLexStringEscapes(t *testing.T) {
+	input := `"a\tb\nc \\ \"q\" \u{48}\u{1F600}"`
+	l := New(input)
+	str := l.Next()
+	check1(t, str, "a\tb\nc \\ \"q\" H\U0001F600", token.STRING)
+	if len(l.Errs) > 0 {
+		t.Errorf("unexpected errors: %+v", l.Errs)
+	}
+	if str.End.Col != uint(len([]rune(input)))+1 {
+		t.Errorf("wrong end of string: %d", str.End.Col)
+	}
+}
+
+func TestLexStringEscapeErrors(t *testing.T) {
+	tests := []struct {
+		input, code string
+	}{
+		{`"\q"`, "L006"},
+		{`"\u48"`, "L007"},
+		{`"\u{}"`, "L009"},
+		{`"\u{1234567}"`, "L009"},
+		{`"\u{110000}"`, "L008"},
+	}
+	for _, tt := range tests {
+		l := New(tt.input)
+		str := l.Next()
+		if str.Type != token.STRING || l.Next().Type != token.EOF {
+			t.Errorf("%s: expected a single string token", tt.input)
+		}
+		if len(l.Errs) != 1 || l.Errs[0].Code != tt.code {
+			t.Errorf("%s: want one %s error, got %+v", tt.input, tt.code, l.Errs)
+			continue
+		}
+		if l.Errs[0].Column != 2 {
+			t.Errorf("%s: want error at column 2, got %d", tt.input, l.Errs[0].Column)
+		}
+	}
+}
+
+func TestLexEmpty(t *testing.T) {
+	l := New("")
+	if tok := l.Next(); tok.Type != token.EOF {
+		t.Errorf("expected EOF, got %s", tok.Type)
+	}
+	if len(l.Errs) > 0 {
+		t.Errorf("unexpected errors: %+v", l.Errs)
+	}
+}
+
+func TestLexComments(t *testing.T) {
+	input := "int x = 1. ; one\n;; two\n; three"
+	l := New(input)
+	l.KeepComments = true
+	var comments []token.Token
+	types := 0
+	for tok := l.Next(); tok.Type != token.EOF; tok = l.Next() {
+		types++
+		if tok.Type == token.COMMENT {
+			comments = append(comments, tok)
+		}
+	}
+	want := []string{"; one", ";; two", "; three"}
+	if len(comments) != len(want) {
+		t.Fatalf("want %d comments, got %+v", len(want), comments)
+	}
+	for i, c := range comments {
+		if c.Literal != want[i] {
+			t.Errorf("%d: want=%q got=%q", i, want[i], c.Literal)
+		}
+		if got := input[c.Offset:c.End.Offset]; got != c.Literal {
+			t.Errorf("%d: span of the comment is %q", i, got)
+		}
+	}
+	if comments[1].Line != 2 || comments[1].Col != 1 {
+		t.Errorf("wrong position of the comment: %+v", comments[1])
+	}
+	// comments are skipped by default; the other tokens are the same
+	l = New(input)
+	n := 0
+	for tok := l.Next(); tok.Type != token.EOF; tok = l.Next() {
+		if tok.Type == token.COMMENT {
+			t.Errorf("unexpected comment %+v", tok)
+		}
+		n++
+	}
+	if n != types-len(comments) {
+		t.Errorf("want %d tokens, got %d", types-len(comments), n)
+	}
+}
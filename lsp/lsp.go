@@ -0,0 +1,461 @@
+// Package lsp is a language server for Quoi; it speaks the Language Server
+// Protocol (JSON-RPC with Content-Length headers), usually over stdio.
+//
+// every time a document is opened, or changed, it's compiled up to the analyzer
+// (quoi.Compile with Options.CheckOnly), and its diagnostics are published. the
+// declarations, and the references the analyzer records (analyzer.Info) answer
+// the requests:
+//
+//   - textDocument/hover: the type of a variable, or an expression; the
+//     declaration of a function, or a datatype
+//   - textDocument/definition: the declaration of a name
+//   - textDocument/completion: the functions of a namespace after '::', and
+//     the namespaces
+//   - textDocument/documentSymbol: the functions, the datatypes, and the enums
+package lsp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"path/filepath"
+	"quoi"
+	"quoi/analyzer"
+	"quoi/ast"
+	"quoi/diagnostic"
+	"quoi/std"
+	"quoi/token"
+	"quoi/types"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+type Server struct {
+	in  *bufio.Reader
+	out io.Writer
+
+	docs map[string]*document // keyed by URI
+	std  *analyzer.StandardLibrary
+	// got the shutdown request; only exit is accepted
+	shutdown bool
+	// the first error writing a notification; Run stops on it
+	err error
+}
+
+// an open document, and what the analyzer learned about it
+type document struct {
+	uri   string
+	text  string
+	lines []string
+	ast   *ast.Program // nil if there are lexer errors
+	info  *analyzer.Info
+}
+
+func NewServer(in io.Reader, out io.Writer) *Server {
+	return &Server{
+		in:   bufio.NewReader(in),
+		out:  out,
+		docs: make(map[string]*document),
+		std:  analyzer.NewStandardLibrary(),
+	}
+}
+
+// Run serves the requests from in until the exit notification, or the end of
+// in. requests are handled one at a time, in order.
+func (s *Server) Run() error {
+	for {
+		body, err := readMessage(s.in)
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		var msg message
+		if err := json.Unmarshal(body, &msg); err != nil {
+			null := json.RawMessage("null")
+			if err := s.reply(&null, nil, &responseError{codeParseError, err.Error()}); err != nil {
+				return err
+			}
+			continue
+		}
+		if msg.Method == "exit" {
+			return nil
+		}
+		result, rerr := s.handle(&msg)
+		if s.err != nil {
+			return s.err
+		}
+		if msg.ID == nil {
+			// a notification; there's no response, even if it fails
+			continue
+		}
+		if err := s.reply(msg.ID, result, rerr); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *Server) reply(id *json.RawMessage, result interface{}, rerr *responseError) error {
+	res := message{JSONRPC: "2.0", ID: id, Error: rerr}
+	if rerr == nil {
+		bx, err := json.Marshal(result)
+		if err != nil {
+			return err
+		}
+		res.Result = bx
+	}
+	return writeMessage(s.out, res)
+}
+
+func (s *Server) notify(method string, params interface{}) {
+	bx, err := json.Marshal(params)
+	if err == nil {
+		err = writeMessage(s.out, message{JSONRPC: "2.0", Method: method, Params: bx})
+	}
+	if err != nil && s.err == nil {
+		s.err = err
+	}
+}
+
+// the result of a request (nil is a 'null' result)
+func (s *Server) handle(msg *message) (interface{}, *responseError) {
+	if s.shutdown {
+		return nil, &responseError{codeInvalidRequest, "the server is shut down"}
+	}
+	// decode the params into v
+	params := func(v interface{}) *responseError {
+		if err := json.Unmarshal(msg.Params, v); err != nil {
+			return &responseError{codeInvalidParams, err.Error()}
+		}
+		return nil
+	}
+	switch msg.Method {
+	case "initialize":
+		return map[string]interface{}{
+			"capabilities": map[string]interface{}{
+				"textDocumentSync":       1, // full
+				"hoverProvider":          true,
+				"definitionProvider":     true,
+				"documentSymbolProvider": true,
+				"completionProvider": map[string]interface{}{
+					"triggerCharacters": []string{":"},
+				},
+			},
+			"serverInfo": map[string]string{"name": "qc lsp"},
+		}, nil
+	case "shutdown":
+		s.shutdown = true
+		return nil, nil
+	case "textDocument/didOpen":
+		var p DidOpenTextDocumentParams
+		if err := params(&p); err != nil {
+			return nil, err
+		}
+		s.update(p.TextDocument.URI, p.TextDocument.Text)
+		return nil, nil
+	case "textDocument/didChange":
+		var p DidChangeTextDocumentParams
+		if err := params(&p); err != nil {
+			return nil, err
+		}
+		if len(p.ContentChanges) == 0 {
+			return nil, nil
+		}
+		s.update(p.TextDocument.URI, p.ContentChanges[len(p.ContentChanges)-1].Text)
+		return nil, nil
+	case "textDocument/didClose":
+		var p DidCloseTextDocumentParams
+		if err := params(&p); err != nil {
+			return nil, err
+		}
+		delete(s.docs, p.TextDocument.URI)
+		// clear the diagnostics of the document
+		s.publish(p.TextDocument.URI, []Diagnostic{})
+		return nil, nil
+	case "textDocument/hover", "textDocument/definition", "textDocument/completion":
+		var p TextDocumentPositionParams
+		if err := params(&p); err != nil {
+			return nil, err
+		}
+		d := s.docs[p.TextDocument.URI]
+		if d == nil {
+			return nil, &responseError{codeInvalidParams, fmt.Sprintf("unknown document '%s'", p.TextDocument.URI)}
+		}
+		switch msg.Method {
+		case "textDocument/hover":
+			return d.hover(p.Position), nil
+		case "textDocument/definition":
+			return d.definition(p.Position), nil
+		}
+		return s.completion(d, p.Position), nil
+	case "textDocument/documentSymbol":
+		var p DocumentSymbolParams
+		if err := params(&p); err != nil {
+			return nil, err
+		}
+		d := s.docs[p.TextDocument.URI]
+		if d == nil {
+			return nil, &responseError{codeInvalidParams, fmt.Sprintf("unknown document '%s'", p.TextDocument.URI)}
+		}
+		return d.symbols(), nil
+	}
+	if strings.HasPrefix(msg.Method, "$/") || msg.ID == nil {
+		// optional notifications (e.g. initialized, $/cancelRequest)
+		return nil, nil
+	}
+	return nil, &responseError{codeMethodNotFound, fmt.Sprintf("unknown method '%s'", msg.Method)}
+}
+
+// analyze the new text of a document, and publish its diagnostics
+func (s *Server) update(uri, text string) {
+	d := &document{uri: uri, text: text, lines: strings.Split(text, "\n"), info: analyzer.NewInfo()}
+	res, ds := quoi.Compile(context.Background(), quoi.Source{Name: fileName(uri), Text: text},
+		quoi.Options{CheckOnly: true, Comments: true, Info: d.info})
+	d.ast = res.AST
+	s.docs[uri] = d
+	diags := []Diagnostic{}
+	for _, v := range ds {
+		diags = append(diags, d.diagnostic(v))
+	}
+	s.publish(uri, diags)
+}
+
+func (s *Server) publish(uri string, diags []Diagnostic) {
+	s.notify("textDocument/publishDiagnostics", PublishDiagnosticsParams{URI: uri, Diagnostics: diags})
+}
+
+// the path of a file URI; uri itself if it isn't one
+func fileName(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "file" {
+		return uri
+	}
+	return filepath.FromSlash(u.Path)
+}
+
+func (d *document) diagnostic(v diagnostic.Diagnostic) Diagnostic {
+	res := Diagnostic{Code: v.Code, Source: "qc", Message: v.Msg}
+	switch v.Severity {
+	case diagnostic.Error:
+		res.Severity = SeverityError
+	case diagnostic.Warning:
+		res.Severity = SeverityWarning
+	default:
+		res.Severity = SeverityInformation
+	}
+	for _, n := range v.Notes {
+		res.Message += "\nnote: " + n
+	}
+	for _, h := range v.Hints {
+		res.Message += "\nhint: " + h
+	}
+	if v.Line == 0 {
+		// not in the source (e.g. an internal compiler error)
+		return res
+	}
+	res.Range.Start = d.position(v.Line, v.Column)
+	if v.EndLine > 0 {
+		res.Range.End = d.position(v.EndLine, v.EndColumn+1)
+	} else {
+		res.Range.End = d.position(v.Line, v.Column+1)
+	}
+	return res
+}
+
+// length of ch in UTF-16 code units
+func utf16Len(ch rune) uint {
+	if ch >= 0x10000 {
+		return 2
+	}
+	return 1
+}
+
+// the LSP position of a 1-based line, and column (in characters)
+func (d *document) position(line, col uint) Position {
+	if line == 0 || line > uint(len(d.lines)) {
+		return Position{}
+	}
+	res := Position{Line: line - 1}
+	for _, ch := range d.lines[line-1] {
+		if col <= 1 {
+			break
+		}
+		res.Character += utf16Len(ch)
+		col--
+	}
+	return res
+}
+
+func (d *document) rangeOf(span token.Span) Range {
+	return Range{d.position(span.Start.Line, span.Start.Col), d.position(span.End.Line, span.End.Col)}
+}
+
+// the byte offset of an LSP position
+func (d *document) offset(p Position) uint {
+	if p.Line >= uint(len(d.lines)) {
+		return uint(len(d.text))
+	}
+	var res uint
+	for _, l := range d.lines[:p.Line] {
+		res += uint(len(l)) + 1
+	}
+	var units uint
+	for _, ch := range d.lines[p.Line] {
+		if units >= p.Character {
+			break
+		}
+		units += utf16Len(ch)
+		res += uint(utf8.RuneLen(ch))
+	}
+	return res
+}
+
+// the symbol of the identifier at p; a reference, or a declaration
+func (d *document) symbolAt(p Position) (*analyzer.Symbol, token.Span) {
+	off := d.offset(p)
+	for _, m := range []map[token.Span]*analyzer.Symbol{d.info.Uses, d.info.Defs} {
+		for span, sym := range m {
+			if span.Start.Offset <= off && off < span.End.Offset {
+				return sym, span
+			}
+		}
+	}
+	return nil, token.Span{}
+}
+
+func (d *document) hover(p Position) *Hover {
+	var text string
+	sym, span := d.symbolAt(p)
+	if sym != nil {
+		decl := sym.Type
+		if sym.Kind == analyzer.SymbolVar {
+			decl = sym.Type + " " + sym.Name
+		}
+		text = "```quoi\n" + decl + "\n```"
+		if sym.Doc != "" {
+			text += "\n\n" + sym.Doc
+		}
+	} else {
+		// the type of the smallest expression at p
+		off := d.offset(p)
+		var typ types.Type
+		for sp, t := range d.info.Types {
+			if sp.Start.Offset <= off && off < sp.End.Offset &&
+				(span.End.Offset == 0 || sp.End.Offset-sp.Start.Offset < span.End.Offset-span.Start.Offset) {
+				span, typ = sp, t
+			}
+		}
+		if typ == nil {
+			return nil
+		}
+		text = "```quoi\n" + typ.String() + "\n```"
+	}
+	r := d.rangeOf(span)
+	return &Hover{Contents: MarkupContent{Kind: "markdown", Value: text}, Range: &r}
+}
+
+func (d *document) definition(p Position) *Location {
+	sym, _ := d.symbolAt(p)
+	if sym == nil || sym.Decl.Start.Line == 0 {
+		// functions of the standard library aren't declared in the document
+		return nil
+	}
+	return &Location{URI: d.uri, Range: d.rangeOf(sym.Decl)}
+}
+
+func (s *Server) completion(d *document, p Position) *CompletionList {
+	// the text of the line before p
+	line := ""
+	if p.Line < uint(len(d.lines)) {
+		start := d.offset(Position{Line: p.Line})
+		line = d.text[start:d.offset(p)]
+	}
+	isIdent := func(ch rune) bool { return ch == '_' || unicode.IsLetter(ch) || unicode.IsDigit(ch) }
+	// 'namespace::prefix', or 'prefix'
+	prefix := line[strings.LastIndexFunc(line, func(ch rune) bool { return !(isIdent(ch)) })+1:]
+	res := &CompletionList{Items: []CompletionItem{}}
+	if strings.HasSuffix(line[:len(line)-len(prefix)], "::") {
+		before := strings.TrimSuffix(line[:len(line)-len(prefix)], "::")
+		ns := before[strings.LastIndexFunc(before, func(ch rune) bool { return !(isIdent(ch)) })+1:]
+		for _, name := range s.std.FuncsOf(ns) {
+			if !(strings.HasPrefix(name, prefix)) {
+				continue
+			}
+			item := CompletionItem{Label: name, Kind: CompletionFunction,
+				Detail: analyzer.Signature(ns+"::"+name, s.std.GetFunc(ns, name))}
+			if f := std.Lookup(ns, name); f != nil {
+				item.Documentation = f.Doc
+			}
+			res.Items = append(res.Items, item)
+		}
+		return res
+	}
+	for _, ns := range std.Namespaces {
+		if strings.HasPrefix(ns.Name, prefix) {
+			res.Items = append(res.Items, CompletionItem{Label: ns.Name, Kind: CompletionModule, Documentation: ns.Doc})
+		}
+	}
+	return res
+}
+
+// the functions, the datatypes, the enums, and the constants declared in the document
+func (d *document) symbols() []DocumentSymbol {
+	res := []DocumentSymbol{}
+	if d.ast == nil {
+		return res
+	}
+	for _, s := range d.ast.Stmts {
+		switch s := s.(type) {
+		case *ast.FunctionDeclarationStatement:
+			detail := ""
+			if sym := d.info.Defs[s.Name.Span()]; sym != nil {
+				detail = sym.Type
+			}
+			res = append(res, DocumentSymbol{Name: s.Name.String(), Detail: detail, Kind: SymbolKindFunction,
+				Range: d.rangeOf(s.Span()), SelectionRange: d.rangeOf(s.Name.Span())})
+		case *ast.DatatypeDeclaration:
+			sym := DocumentSymbol{Name: s.Name.String(), Kind: SymbolKindStruct,
+				Range: d.rangeOf(s.Span()), SelectionRange: d.rangeOf(s.Name.Span()), Children: d.fields(s.Fields)}
+			// the variants of a sum type
+			for _, v := range s.Variants {
+				sym.Children = append(sym.Children, DocumentSymbol{Name: v.Name.String(), Kind: SymbolKindStruct,
+					Range: d.rangeOf(v.Span()), SelectionRange: d.rangeOf(v.Name.Span()), Children: d.fields(v.Fields)})
+			}
+			res = append(res, sym)
+		case *ast.EnumDeclaration:
+			sym := DocumentSymbol{Name: s.Name.String(), Kind: SymbolKindEnum,
+				Range: d.rangeOf(s.Span()), SelectionRange: d.rangeOf(s.Name.Span())}
+			for _, m := range s.Members {
+				sym.Children = append(sym.Children, DocumentSymbol{Name: m.String(), Kind: SymbolKindEnumMember,
+					Range: d.rangeOf(m.Span()), SelectionRange: d.rangeOf(m.Span())})
+			}
+			res = append(res, sym)
+		case *ast.ConstDeclaration:
+			var name *ast.Identifier
+			detail := ""
+			switch decl := s.Decl.(type) {
+			case *ast.VariableDeclarationStatement:
+				name, detail = decl.Ident, decl.Tok.Literal
+			case *ast.ListVariableDeclarationStatement:
+				name, detail = decl.Name, "listof "+decl.Typ.Literal
+			}
+			res = append(res, DocumentSymbol{Name: name.String(), Detail: detail, Kind: SymbolKindConstant,
+				Range: d.rangeOf(s.Span()), SelectionRange: d.rangeOf(name.Span())})
+		}
+	}
+	return res
+}
+
+func (d *document) fields(fs []*ast.DatatypeField) []DocumentSymbol {
+	var res []DocumentSymbol
+	for _, f := range fs {
+		res = append(res, DocumentSymbol{Name: f.Ident.String(), Detail: f.Tok.Literal,
+			Kind: SymbolKindField, Range: d.rangeOf(f.Span()), SelectionRange: d.rangeOf(f.Ident.Span())})
+	}
+	return res
+}
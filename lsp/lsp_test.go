@@ -0,0 +1,345 @@
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+// a scripted LSP client; talks to a server running in the same process
+type client struct {
+	t      *testing.T
+	in     io.WriteCloser // to the server
+	msgs   chan message   // from the server
+	done   chan error     // result of Server.Run
+	nextID int
+}
+
+func newClient(t *testing.T) *client {
+	serverIn, clientOut := io.Pipe()
+	clientIn, serverOut := io.Pipe()
+	c := &client{t: t, in: clientOut, msgs: make(chan message, 100), done: make(chan error, 1)}
+	go func() {
+		c.done <- NewServer(serverIn, serverOut).Run()
+		serverOut.Close()
+	}()
+	go func() {
+		r := bufio.NewReader(clientIn)
+		for {
+			body, err := readMessage(r)
+			if err != nil {
+				close(c.msgs)
+				return
+			}
+			var msg message
+			if err := json.Unmarshal(body, &msg); err != nil {
+				t.Errorf("invalid message from the server: %s", body)
+			}
+			c.msgs <- msg
+		}
+	}()
+	t.Cleanup(func() { clientOut.Close() })
+	return c
+}
+
+func (c *client) send(id int, method string, params interface{}) {
+	msg := map[string]interface{}{"jsonrpc": "2.0", "method": method, "params": params}
+	if id > 0 {
+		msg["id"] = id
+	}
+	if err := writeMessage(c.in, msg); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+// the next message from the server
+func (c *client) receive() message {
+	select {
+	case msg, ok := <-c.msgs:
+		if !(ok) {
+			c.t.Fatal("the server closed the connection")
+		}
+		return msg
+	case <-time.After(5 * time.Second):
+		c.t.Fatal("timed out waiting for the server")
+	}
+	return message{}
+}
+
+// send a request, and decode its result into result
+func (c *client) request(method string, params, result interface{}) *responseError {
+	c.nextID++
+	c.send(c.nextID, method, params)
+	msg := c.receive()
+	if msg.ID == nil || string(*msg.ID) != fmt.Sprint(c.nextID) {
+		c.t.Fatalf("%s: expected the response %d, got %+v", method, c.nextID, msg)
+	}
+	if msg.Error != nil {
+		return msg.Error
+	}
+	if err := json.Unmarshal(msg.Result, result); err != nil {
+		c.t.Fatalf("%s: invalid result %s: %v", method, msg.Result, err)
+	}
+	return nil
+}
+
+func (c *client) notify(method string, params interface{}) {
+	c.send(0, method, params)
+}
+
+// wait for the diagnostics of uri
+func (c *client) diagnostics(uri string) []Diagnostic {
+	msg := c.receive()
+	if msg.Method != "textDocument/publishDiagnostics" {
+		c.t.Fatalf("expected diagnostics, got %+v", msg)
+	}
+	var p PublishDiagnosticsParams
+	if err := json.Unmarshal(msg.Params, &p); err != nil {
+		c.t.Fatal(err)
+	}
+	if p.URI != uri {
+		c.t.Fatalf("expected diagnostics of '%s', got '%s'", uri, p.URI)
+	}
+	return p.Diagnostics
+}
+
+func pos(line, char uint) TextDocumentPositionParams {
+	return TextDocumentPositionParams{TextDocument: TextDocumentIdentifier{uri}, Position: Position{line, char}}
+}
+
+const uri = "file:///tmp/main.q"
+
+const src = `; a user
+datatype User {
+    string name
+    int age
+}
+
+; greets u
+fun greet(User u, int times) -> string {
+    string s = "héllo ".
+    return (+ s (get u name)).
+}
+
+User u = User{name="😀" age=1}.
+Stdout::println(greet(u, 2)).
+`
+
+func open(t *testing.T) *client {
+	c := newClient(t)
+	var init map[string]interface{}
+	if err := c.request("initialize", map[string]interface{}{"capabilities": map[string]interface{}{}}, &init); err != nil {
+		t.Fatal(err.Message)
+	}
+	if _, ok := init["capabilities"]; !(ok) {
+		t.Fatalf("no capabilities in %v", init)
+	}
+	c.notify("initialized", map[string]interface{}{})
+	c.notify("textDocument/didOpen", DidOpenTextDocumentParams{TextDocumentItem{URI: uri, LanguageID: "quoi", Version: 1, Text: src}})
+	if ds := c.diagnostics(uri); len(ds) != 0 {
+		t.Fatalf("unexpected diagnostics %+v", ds)
+	}
+	return c
+}
+
+func TestDiagnostics(t *testing.T) {
+	c := open(t)
+	change := func(text string) []Diagnostic {
+		c.notify("textDocument/didChange", map[string]interface{}{
+			"textDocument":   map[string]interface{}{"uri": uri, "version": 2},
+			"contentChanges": []map[string]string{{"text": text}},
+		})
+		return c.diagnostics(uri)
+	}
+	ds := change("int x = 1.\nstring s = x.")
+	if len(ds) != 1 {
+		t.Fatalf("expected 1 diagnostic, got %+v", ds)
+	}
+	want := Diagnostic{Range: Range{Position{1, 11}, Position{1, 12}}, Severity: SeverityError, Code: "A032", Source: "qc", Message: "expected 'string', got 'int'"}
+	if ds[0] != want {
+		t.Errorf("wrong diagnostic\nwant=%+v\ngot= %+v", want, ds[0])
+	}
+	ds = change("\"unterminated")
+	if len(ds) != 1 || ds[0].Range.Start.Line != 0 || ds[0].Code[0] != 'L' {
+		t.Errorf("expected a lexer error, got %+v", ds)
+	}
+	// lexer errors leave no AST
+	var syms []DocumentSymbol
+	if err := c.request("textDocument/documentSymbol", DocumentSymbolParams{TextDocumentIdentifier{uri}}, &syms); err != nil || len(syms) != 0 {
+		t.Errorf("expected no symbols, got %+v %v", syms, err)
+	}
+	if ds := change(src); len(ds) != 0 {
+		t.Errorf("unexpected diagnostics %+v", ds)
+	}
+	c.notify("textDocument/didClose", DidCloseTextDocumentParams{TextDocumentIdentifier{uri}})
+	if ds := c.diagnostics(uri); len(ds) != 0 {
+		t.Errorf("expected the diagnostics to be cleared, got %+v", ds)
+	}
+	var h *Hover
+	if err := c.request("textDocument/hover", pos(0, 0), &h); err == nil || err.Code != codeInvalidParams {
+		t.Errorf("expected an error for a closed document, got %v", err)
+	}
+}
+
+func TestHover(t *testing.T) {
+	c := open(t)
+	tests := []struct {
+		line, char uint
+		want       string // "" if there's nothing to show
+		rng        Range
+	}{
+		// the parameter u
+		{9, 21, "```quoi\nUser u\n```", Range{Position{9, 21}, Position{9, 22}}},
+		{9, 14, "```quoi\nstring s\n```", Range{Position{9, 14}, Position{9, 15}}},
+		{13, 17, "```quoi\nfun greet(User u, int times) -> string\n```\n\ngreets u", Range{Position{13, 16}, Position{13, 21}}},
+		{12, 10, "```quoi\ndatatype User {\n    string name\n    int age\n}\n```\n\na user", Range{Position{12, 9}, Position{12, 13}}},
+		{13, 9, "```quoi\nfun Stdout::println(string s)\n```\n\nprint s, and a newline.", Range{Position{13, 8}, Position{13, 15}}},
+		// declarations
+		{7, 5, "```quoi\nfun greet(User u, int times) -> string\n```\n\ngreets u", Range{Position{7, 4}, Position{7, 9}}},
+		{12, 5, "```quoi\nUser u\n```", Range{Position{12, 5}, Position{12, 6}}},
+		// the type of an expression
+		{9, 11, "```quoi\nstring\n```", Range{Position{9, 11}, Position{9, 29}}},
+		// after '😀', which is two UTF-16 code units
+		{12, 28, "```quoi\nint\n```", Range{Position{12, 28}, Position{12, 29}}},
+		// keywords, and blank lines
+		{9, 4, "", Range{}},
+		{5, 0, "", Range{}},
+	}
+	for _, tt := range tests {
+		var h *Hover
+		if err := c.request("textDocument/hover", pos(tt.line, tt.char), &h); err != nil {
+			t.Fatal(err.Message)
+		}
+		if tt.want == "" {
+			if h != nil {
+				t.Errorf("%d:%d: expected no hover, got %+v", tt.line, tt.char, h)
+			}
+			continue
+		}
+		if h == nil {
+			t.Errorf("%d:%d: no hover", tt.line, tt.char)
+			continue
+		}
+		if h.Contents.Value != tt.want || h.Range == nil || *h.Range != tt.rng {
+			t.Errorf("%d:%d: wrong hover\nwant=%q %v\ngot= %q %v", tt.line, tt.char, tt.want, tt.rng, h.Contents.Value, h.Range)
+		}
+	}
+}
+
+func TestDefinition(t *testing.T) {
+	c := open(t)
+	tests := []struct {
+		line, char uint
+		want       *Range
+	}{
+		{9, 14, &Range{Position{8, 11}, Position{8, 12}}},  // s
+		{9, 21, &Range{Position{7, 15}, Position{7, 16}}},  // u (the parameter)
+		{13, 22, &Range{Position{12, 5}, Position{12, 6}}}, // u (the global)
+		{13, 18, &Range{Position{7, 4}, Position{7, 9}}},   // greet
+		{7, 11, &Range{Position{1, 9}, Position{1, 13}}},   // User
+		{13, 10, nil}, // println isn't declared in the document
+		{9, 4, nil},
+	}
+	for _, tt := range tests {
+		var loc *Location
+		if err := c.request("textDocument/definition", pos(tt.line, tt.char), &loc); err != nil {
+			t.Fatal(err.Message)
+		}
+		if tt.want == nil {
+			if loc != nil {
+				t.Errorf("%d:%d: expected no definition, got %+v", tt.line, tt.char, loc)
+			}
+			continue
+		}
+		if loc == nil || loc.URI != uri || loc.Range != *tt.want {
+			t.Errorf("%d:%d: wrong definition\nwant=%v\ngot= %+v", tt.line, tt.char, *tt.want, loc)
+		}
+	}
+}
+
+func TestCompletion(t *testing.T) {
+	c := open(t)
+	c.notify("textDocument/didChange", map[string]interface{}{
+		"textDocument":   map[string]interface{}{"uri": uri},
+		"contentChanges": []map[string]string{{"text": "String::\nString::from_i\nSt"}},
+	})
+	c.diagnostics(uri)
+	labels := func(line, char uint) string {
+		var res CompletionList
+		if err := c.request("textDocument/completion", pos(line, char), &res); err != nil {
+			t.Fatal(err.Message)
+		}
+		var labels []string
+		for _, v := range res.Items {
+			labels = append(labels, v.Label)
+		}
+		return strings.Join(labels, " ")
+	}
+	if got := labels(0, 8); !(strings.Contains(got, "from_int")) || !(strings.Contains(got, "concat")) || strings.Contains(got, "println") {
+		t.Errorf("wrong completions after 'String::': %s", got)
+	}
+	if want, got := "from_int", labels(1, 14); want != got {
+		t.Errorf("wrong completions after 'String::from_i'\nwant=%s\ngot= %s", want, got)
+	}
+	if want, got := "Stdout String", labels(2, 2); want != got {
+		t.Errorf("wrong completions after 'St'\nwant=%s\ngot= %s", want, got)
+	}
+	var res CompletionList
+	c.request("textDocument/completion", pos(1, 14), &res)
+	if len(res.Items) != 1 || res.Items[0].Detail != "fun String::from_int(int n) -> string" || res.Items[0].Documentation == "" {
+		t.Errorf("wrong completion item %+v", res.Items)
+	}
+}
+
+func TestDocumentSymbols(t *testing.T) {
+	c := open(t)
+	var syms []DocumentSymbol
+	if err := c.request("textDocument/documentSymbol", DocumentSymbolParams{TextDocumentIdentifier{uri}}, &syms); err != nil {
+		t.Fatal(err.Message)
+	}
+	var got []string
+	for _, s := range syms {
+		got = append(got, fmt.Sprintf("%s %d %v %q", s.Name, s.Kind, s.Range, s.Detail))
+		for _, f := range s.Children {
+			got = append(got, fmt.Sprintf("  %s %d %v %q", f.Name, f.Kind, f.SelectionRange, f.Detail))
+		}
+	}
+	want := []string{
+		`User 23 {{1 0} {4 1}} ""`,
+		`  name 8 {{2 11} {2 15}} "string"`,
+		`  age 8 {{3 8} {3 11}} "int"`,
+		`greet 12 {{7 0} {10 1}} "fun greet(User u, int times) -> string"`,
+	}
+	if strings.Join(want, "\n") != strings.Join(got, "\n") {
+		t.Errorf("wrong symbols\nwant=\n%s\ngot=\n%s", strings.Join(want, "\n"), strings.Join(got, "\n"))
+	}
+}
+
+func TestProtocol(t *testing.T) {
+	c := open(t)
+	var res interface{}
+	if err := c.request("textDocument/unknown", map[string]string{}, &res); err == nil || err.Code != codeMethodNotFound {
+		t.Errorf("expected 'method not found', got %v", err)
+	}
+	// unknown notifications are ignored
+	c.notify("$/cancelRequest", map[string]int{"id": 1})
+	if err := c.request("shutdown", nil, &res); err != nil || res != nil {
+		t.Errorf("shutdown: %v %v", err, res)
+	}
+	if err := c.request("textDocument/hover", pos(0, 0), &res); err == nil || err.Code != codeInvalidRequest {
+		t.Errorf("expected an error after shutdown, got %v", err)
+	}
+	c.notify("exit", nil)
+	select {
+	case err := <-c.done:
+		if err != nil {
+			t.Errorf("Run: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the server didn't exit")
+	}
+}
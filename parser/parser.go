@@ -9,35 +9,62 @@
 package parser
 
 import (
-	"fmt"
-	"os"
 	"quoi/ast"
+	"quoi/diagnostic"
 	"quoi/lexer"
 	"quoi/token"
 )
 
-type Err struct {
-	Msg          string
-	Column, Line uint
-}
+type Err = diagnostic.Diagnostic
 
-func newErr(line, col uint, formatMsg string, elems ...interface{}) Err {
-	return Err{Msg: fmt.Sprintf(formatMsg, elems...), Column: col, Line: line}
+// code is the stable error code of the call site (e.g. P017).
+func newErr(code string, line, col uint, formatMsg string, elems ...interface{}) Err {
+	return diagnostic.New(diagnostic.Parser, code, line, col, formatMsg, elems...)
 }
 
+// stop parsing after this many errors
+const maxErrors = 10
+
 type Parser struct {
 	tokens      []token.Token
 	ptr         uint
 	tok         token.Token // current token pointed to, by ptr
 	lexerErrors []lexer.Err
 	Errs        []Err
+
+	nesting int  // how many statements are being parsed (e.g. 2 in a function body)
+	failed  bool // the statement being parsed has an error
+
+	// comments aren't in tokens; the parser doesn't see them.
+	// they are attached to declarations instead.
+	comments []*ast.CommentGroup
+	trailing map[*ast.CommentGroup]bool // groups at the end of a line of code
 }
 
 func New(l *lexer.Lexer) *Parser {
 	toks := []token.Token{}
+	p := &Parser{trailing: map[*ast.CommentGroup]bool{}}
+	var (
+		group *ast.CommentGroup
+		prev  token.Token // last token that isn't a comment, or a newline
+	)
 	// TODO make this memory efficient
 	for {
 		t := l.Next()
+		if t.Type == token.COMMENT {
+			afterCode := prev.Line == t.Line
+			if group == nil || afterCode || p.trailing[group] || group.List[len(group.List)-1].Tok.Line+1 != t.Line {
+				group = &ast.CommentGroup{}
+				p.comments = append(p.comments, group)
+				p.trailing[group] = afterCode
+			}
+			group.List = append(group.List, &ast.Comment{Tok: t})
+			continue
+		}
+		if t.Type != token.NEWLINE {
+			prev = t
+			group = nil
+		}
 		toks = append(toks, t)
 		if t.Type == token.EOF {
 			break
@@ -46,7 +73,6 @@ func New(l *lexer.Lexer) *Parser {
 	if len(toks) == 0 {
 		panic("lexer.New: error: len(tokens) is zero (0)")
 	}
-	p := &Parser{}
 	p.tokens = toks
 	p.lexerErrors = l.Errs
 	p.ptr = 0
@@ -54,12 +80,54 @@ func New(l *lexer.Lexer) *Parser {
 	return p
 }
 
-func (p *Parser) errorf(line, col uint, formatMsg string, elems ...interface{}) {
-	p.Errs = append(p.Errs, Err{
-		Msg:    fmt.Sprintf(formatMsg, elems...),
-		Column: col,
-		Line:   line,
-	})
+// the comment group on the lines right above tok. a comment at the end of
+// a line of code belongs to that line, not to tok.
+func (p *Parser) docOf(tok token.Token) *ast.CommentGroup {
+	for _, g := range p.comments {
+		last := g.List[len(g.List)-1].Tok
+		if last.Line+1 == tok.Line && last.Offset < tok.Offset && !(p.trailing[g]) {
+			return g
+		}
+	}
+	return nil
+}
+
+// the comment at the end of the line, after end.
+func (p *Parser) commentAfter(end token.Pos) *ast.CommentGroup {
+	for _, g := range p.comments {
+		first := g.List[0].Tok
+		if first.Line == end.Line && first.Offset >= end.Offset && p.trailing[g] {
+			return g
+		}
+	}
+	return nil
+}
+
+func (p *Parser) errorf(code string, line, col uint, formatMsg string, elems ...interface{}) {
+	p.report(newErr(code, line, col, formatMsg, elems...))
+}
+
+// append err to p.Errs.
+//
+// only the first error in a statement is reported; the following ones are most likely caused by it.
+// duplicate errors are dropped, and the parser stops after maxErrors errors.
+func (p *Parser) report(err Err) {
+	if p.failed || len(p.Errs) >= maxErrors {
+		return
+	}
+	p.failed = true
+	for _, e := range p.Errs {
+		if e.Line == err.Line && e.Column == err.Column && e.Msg == err.Msg {
+			return
+		}
+	}
+	p.Errs = append(p.Errs, err)
+	if len(p.Errs) == maxErrors {
+		p.Errs = append(p.Errs, newErr("P108", err.Line, err.Column, "too many errors"))
+		// give up; jump to EOF.
+		p.ptr = uint(len(p.tokens) - 1)
+		p.tok = p.tokens[p.ptr]
+	}
 }
 
 // set p.tok to the next token
@@ -86,6 +154,14 @@ func (p *Parser) unmove() {
 	p.tok = p.tokens[p.ptr]
 }
 
+// end position of the previous token; that is the last consumed token.
+func (p *Parser) prevEnd() token.Pos {
+	if p.ptr < 1 {
+		return p.tok.Pos()
+	}
+	return p.tokens[p.ptr-1].End
+}
+
 func (p *Parser) moveif(cond bool) {
 	if cond {
 		p.move()
@@ -123,40 +199,126 @@ func (p *Parser) expect(t token.Type) bool {
 //
 // useful in situations like coming across an erroneous expression, or statement;
 // and wanting to ignore the whole statement to prevent giving redundant error messages.
+//
+// stops after a dot, or before:
+//   - '}', or 'end' closing the enclosing block,
+//   - 'fun', or 'datatype', which can only start a new statement,
+//   - a keyword that starts a statement (e.g. 'if', 'int') at the beginning of a line.
+//
+// the current token is never a stopping point (except for a dot, '}', and 'end'); because, we
+// usually report an error while on the first token of the statement, and we want to skip it.
 func (p *Parser) skip() {
-	kwm := map[token.Type]bool{
-		token.INTKW: true, token.STRINGKW: true, token.BOOLKW: true, token.DATATYPE: true,
-		token.FUN: true, token.BLOCK: true, token.END: true, token.IF: true, token.ELSEIF: true,
-		token.ELSE: true, token.LOOP: true, token.RETURN: true, token.LISTOF: true, token.CONTINUE: true,
-		token.BREAK: true,
-	}
-	/*
-		if we are already on a token that is in kwm, that means we wanted to check the peek token.
-		we should move here.
-
-		example case :
-
-			listof { x = [].
-
-			in list decl. parse fn :
-
-			if peek := p.peek(); p.errif(!(canBeATypeForList(peek.Type)), newErr(peek.Line, peek.Col,
-				"unexpected token '%s' as type for list", peek.Literal)) {
-				return nil
+	stmtKw := map[token.Type]bool{
+		token.INTKW: true, token.STRINGKW: true, token.BOOLKW: true, token.LISTOF: true, token.BLOCK: true,
+		token.IF: true, token.LOOP: true, token.RETURN: true, token.CONTINUE: true, token.BREAK: true,
+		token.MATCH: true,
+	}
+	for first := true; ; first = false {
+		atLineStart := p.ptr > 0 && p.tokens[p.ptr-1].Type == token.NEWLINE
+		switch p.tok.Type {
+		case token.EOF:
+			return
+		case token.DOT:
+			p.move()
+			return
+		case token.CLOSING_CURLY, token.END:
+			if p.nesting > 1 {
+				return
+			}
+		case token.FUN, token.DATATYPE, token.ENUM:
+			// a function type may be in the middle of a statement
+			isType := p.curis(token.FUN) && p.peekis(token.OPENING_PAREN)
+			if !(first) && (!(isType) || atLineStart) {
+				return
+			}
+		default:
+			if !(first) && atLineStart && stmtKw[p.tok.Type] {
+				return
 			}
-	*/
-	_, iskw := kwm[p.tok.Type]
-	if iskw {
+		}
 		p.move()
 	}
+}
+
+// synchronize after an erroneous statement starting at p.tokens[start].
+//
+// skip (called when the error was reported) stops at the first dot; but, a statement
+// may contain blocks (e.g. a function body). skip the rest of those blocks, and the
+// elseif/else branches that follow them.
+func (p *Parser) sync(start uint) {
+	depth := 0
+	for _, t := range p.tokens[start:p.ptr] {
+		switch t.Type {
+		case token.OPENING_CURLY:
+			depth++
+		case token.CLOSING_CURLY:
+			depth--
+		}
+	}
 	for {
-		if _, iskw := kwm[p.tok.Type]; iskw || p.tok.Type == token.EOF {
-			break
+		for depth > 0 && p.curnot(token.EOF) {
+			switch p.tok.Type {
+			case token.OPENING_CURLY:
+				depth++
+			case token.CLOSING_CURLY:
+				depth--
+			case token.FUN, token.DATATYPE, token.ENUM:
+				// a new declaration; the block was never closed.
+				if !(p.curis(token.FUN) && p.peekis(token.OPENING_PAREN)) {
+					return
+				}
+			}
+			p.move()
+		}
+		if !(p.curis(token.ELSEIF) || p.curis(token.ELSE)) {
+			return
+		}
+		for p.curnot(token.OPENING_CURLY) && p.curnot(token.EOF) {
+			p.move()
+		}
+		depth = 0
+		if p.curis(token.OPENING_CURLY) {
+			depth = 1
+			p.move()
 		}
-		p.move()
 	}
 }
 
+// names of the variables that the statement starting at p.tokens[start] declares.
+// e.g. x, and y in `int x, listof string y = 5, .`
+func (p *Parser) declaredNames(start uint) []*ast.Identifier {
+	var names []*ast.Identifier
+	first := p.tokens[start]
+	switch first.Type {
+	case token.INTKW, token.STRINGKW, token.BOOLKW, token.LISTOF, token.IDENT, token.CONST:
+	case token.FUN:
+		// a function type; not a function declaration
+		if start+1 >= uint(len(p.tokens)) || p.tokens[start+1].Type != token.OPENING_PAREN {
+			return nil
+		}
+	default:
+		return nil
+	}
+	var prev token.Type
+	for i := start; i < uint(len(p.tokens)); i++ {
+		t := p.tokens[i]
+		switch t.Type {
+		case token.NEWLINE:
+			continue
+		case token.EQUAL, token.DOT, token.EOF:
+			return names
+		case token.IDENT:
+			switch prev {
+			// ')' ends a function type
+			case token.INTKW, token.STRINGKW, token.BOOLKW, token.IDENT, token.CLOSING_PAREN:
+				names = append(names, &ast.Identifier{Tok: t})
+			}
+		}
+		prev = t.Type
+	}
+	return names
+}
+
 func (p *Parser) eat(typ token.Type) {
 	for p.curis(typ) {
 		p.move()
@@ -166,10 +328,9 @@ func (p *Parser) eat(typ token.Type) {
 // append error if cond.
 // skip to the next statement if cond.
 // return true if cond.
-func (p *Parser) errif(cond bool, errmsgf string, args ...interface{}) bool {
+func (p *Parser) errif(cond bool, code string, errmsgf string, args ...interface{}) bool {
 	if cond {
-		err := newErr(p.tok.Line, p.tok.Col, errmsgf, args...)
-		p.Errs = append(p.Errs, err)
+		p.report(newErr(code, p.tok.Line, p.tok.Col, errmsgf, args...))
 		p.skip()
 	}
 	return cond
@@ -178,7 +339,7 @@ func (p *Parser) errif(cond bool, errmsgf string, args ...interface{}) bool {
 // set pos manually
 func (p *Parser) errif2(cond bool, err Err) bool {
 	if cond {
-		p.Errs = append(p.Errs, err)
+		p.report(err)
 		p.skip()
 	}
 	return cond
@@ -224,6 +385,7 @@ func isOperator(tok token.Token) bool {
 func isReturnOrFunctionParamType(tok token.Type) bool {
 	rtm := map[token.Type]bool{
 		token.INTKW: true, token.STRINGKW: true, token.BOOLKW: true, token.IDENT: true, token.LISTOF: true,
+		token.FUN: true,
 	}
 	return rtm[tok]
 }
@@ -244,7 +406,11 @@ func isASubseqVariableDecl(p *Parser) bool {
 	// save ptr here to revert back to the old position of the parser.
 	ptr := p.ptr // current token is a type, or a token.LISTOF.
 	p.moveif(p.curis(token.LISTOF))
-	p.move()
+	if p.curis(token.FUN) {
+		skipFunctionType(p)
+	} else {
+		p.move()
+	}
 	p.eat(token.NEWLINE)
 	if p.curnot(token.IDENT) {
 		// in this case, parseStatement will call parseVariableDeclarationStatement, and it will give an error.
@@ -258,6 +424,44 @@ func isASubseqVariableDecl(p *Parser) bool {
 	return ok
 }
 
+// move past the function type at the current token ('fun') without parsing it;
+// it may be invalid.
+func skipFunctionType(p *Parser) {
+	var skipParens = func() {
+		if p.curnot(token.OPENING_PAREN) {
+			return
+		}
+		for depth := 0; p.curnot(token.EOF); {
+			switch p.tok.Type {
+			case token.OPENING_PAREN:
+				depth++
+			case token.CLOSING_PAREN:
+				depth--
+			}
+			p.move()
+			if depth == 0 {
+				return
+			}
+		}
+	}
+	p.move() // skip fun
+	skipParens()
+	if p.curnot(token.ARROW) {
+		return
+	}
+	p.move() // skip ->
+	if p.curis(token.OPENING_PAREN) {
+		skipParens()
+		return
+	}
+	p.moveif(p.curis(token.LISTOF))
+	if p.curis(token.FUN) {
+		skipFunctionType(p)
+		return
+	}
+	p.move()
+}
+
 // dangerously similar to isASubseqVariableDecl.
 func isDatatypeInitialization(p *Parser) bool {
 	var reset = func(p *Parser, ptr uint) {
@@ -277,23 +481,22 @@ func isDatatypeInitialization(p *Parser) bool {
 }
 
 // also moves if isStmt && !(p.curnot(token.DOT))
-func assertDot(p *Parser, isStmt bool, errmsgf string, args ...interface{}) bool {
+func assertDot(p *Parser, isStmt bool, code string, errmsgf string, args ...interface{}) bool {
 	var res bool
 	if isStmt {
-		res = p.errif(p.curnot(token.DOT), errmsgf, args...)
+		res = p.errif(p.curnot(token.DOT), code, errmsgf, args...)
 		p.moveif(!(res))
 	}
 	return res
 }
 
+// parse the program. if the lexer reported errors, the program is empty; the
+// errors are in the lexer.
 func (p *Parser) Parse() *ast.Program {
+	program := &ast.Program{Comments: p.comments}
 	if len(p.lexerErrors) > 0 {
-		for _, e := range p.lexerErrors {
-			fmt.Printf("[!] line:col(%d:%d) %s\n", e.Line, e.Column, e.Msg)
-		}
-		os.Exit(1)
+		return program
 	}
-	program := &ast.Program{}
 loop:
 	for {
 		if p.tok.Type == token.EOF {
@@ -306,9 +509,63 @@ loop:
 	return program
 }
 
+// parse the input as a single expression, optionally followed by a dot. nil if the input
+// is not an expression. used by the REPL.
+func (p *Parser) ParseExpr() ast.Expr {
+	if len(p.lexerErrors) > 0 {
+		return nil
+	}
+	p.eat(token.NEWLINE)
+	// parseExpr starts at the token before the expression
+	p.tokens = append([]token.Token{{Type: token.ILLEGAL}}, p.tokens[p.ptr:]...)
+	p.ptr = 0
+	p.tok = p.tokens[p.ptr]
+	expr := p.parseExpr()
+	if len(p.Errs) > 0 {
+		return nil
+	}
+	if expr == nil {
+		p.errorf("P109", p.tok.Line, p.tok.Col, "expected an expression, got '%s'", p.tok.Literal)
+		return nil
+	}
+	p.eat(token.NEWLINE)
+	if p.curis(token.DOT) {
+		p.move()
+	}
+	p.eat(token.NEWLINE)
+	if p.curnot(token.EOF) {
+		p.errorf("P110", p.tok.Line, p.tok.Col, "unexpected token '%s' after expression", p.tok.Literal)
+		return nil
+	}
+	return expr
+}
+
 // > advance parser at the end
 
+// parse a statement. if the statement has errors, synchronize, and return an *ast.BadStatement
+// in place of it.
 func (p *Parser) parseStatement() ast.Statement {
+	start, outerFailed := p.ptr, p.failed
+	p.nesting++
+	p.failed = false
+	defer func() {
+		p.nesting--
+		p.failed = outerFailed
+	}()
+	stmt := p.parseStatement1()
+	if !(p.failed) {
+		return stmt
+	}
+	p.sync(start)
+	if p.ptr == start {
+		// make progress
+		p.move()
+	}
+	bad := &ast.BadStatement{Tok: p.tokens[start], Names: p.declaredNames(start), End: p.prevEnd()}
+	return bad
+}
+
+func (p *Parser) parseStatement1() ast.Statement {
 	// we are doing "if-stmt-is-not-nil" checks here because when calling this function in *Parser.Parse,
 	// "if p.parseStatement() != nil" checks do not work. This may be because Statement is an interface,
 	// and even if a pointer to a struct that implements ast.Statement is nil, *Parser.Parse thinks
@@ -320,7 +577,7 @@ func (p *Parser) parseStatement() ast.Statement {
 	thisIsAStmt := true
 	switch p.tok.Type {
 	case token.ILLEGAL:
-		p.errorf(p.tok.Line, p.tok.Col, "illegal token '%s'", p.tok.Literal)
+		p.errorf("P001", p.tok.Line, p.tok.Col, "illegal token '%s'", p.tok.Literal)
 		p.skip()
 	case token.NEWLINE:
 		p.move()
@@ -348,7 +605,7 @@ func (p *Parser) parseStatement() ast.Statement {
 	case token.STRINGKW, token.INTKW, token.BOOLKW:
 		isSubseq := isASubseqVariableDecl(p)
 		if isSubseq {
-			if stmt := p.parseSubsequentVariableDeclarationStatement(); stmt != nil {
+			if stmt := p.parseSubsequentVariableDeclarationStatement(); stmt != nil || p.failed {
 				return stmt
 			}
 		}
@@ -358,7 +615,7 @@ func (p *Parser) parseStatement() ast.Statement {
 	case token.LISTOF:
 		isSubseq := isASubseqVariableDecl(p)
 		if isSubseq {
-			if stmt := p.parseSubsequentVariableDeclarationStatement(); stmt != nil {
+			if stmt := p.parseSubsequentVariableDeclarationStatement(); stmt != nil || p.failed {
 				return stmt
 			}
 		}
@@ -369,30 +626,30 @@ func (p *Parser) parseStatement() ast.Statement {
 		identTok := p.tok
 		switch p.peek().Type {
 		case token.EQUAL:
-			if stmt := p.parseReassignmentStatement(identTok); stmt != nil {
+			if stmt := p.parseReassignmentStatement(identTok); stmt != nil || p.failed {
 				return stmt
 			}
 		case token.OPENING_PAREN:
-			if stmt := p.parseFunctionCall(identTok, thisIsAStmt, ""); stmt != nil {
+			if stmt := p.parseFunctionCall(identTok, thisIsAStmt, ""); stmt != nil || p.failed {
 				return stmt
 			}
 		case token.DOUBLE_COLON:
-			if stmt := p.parseFunctionCallFromNamespace(identTok, true); stmt != nil {
+			if stmt := p.parseFunctionCallFromNamespace(identTok, true); stmt != nil || p.failed {
 				return stmt
 			}
 		case token.IDENT:
 			isSubseq := isASubseqVariableDecl(p)
 			if isSubseq {
-				if stmt := p.parseSubsequentVariableDeclarationStatement(); stmt != nil {
+				if stmt := p.parseSubsequentVariableDeclarationStatement(); stmt != nil || p.failed {
 					return stmt
 				}
 			}
-			if stmt := p.parseVariableDeclarationStatement(); stmt != nil {
+			if stmt := p.parseVariableDeclarationStatement(); stmt != nil || p.failed {
 				return stmt
 			}
 		}
 		if isDatatypeInitialization(p) {
-			if stmt := p.parseDatatypeLiteral(thisIsAStmt); stmt != nil {
+			if stmt := p.parseDatatypeLiteral(thisIsAStmt); stmt != nil || p.failed {
 				return stmt
 			}
 		}
@@ -424,22 +681,46 @@ func (p *Parser) parseStatement() ast.Statement {
 		if stmt := p.parseDatatypeDeclarationStatement(); stmt != nil {
 			return stmt
 		}
+	case token.ENUM:
+		if stmt := p.parseEnumDeclaration(); stmt != nil {
+			return stmt
+		}
+	case token.CONST:
+		if stmt := p.parseConstDeclaration(); stmt != nil {
+			return stmt
+		}
 	case token.IF:
 		if stmt := p.parseIfStatement(false); stmt != nil {
 			return stmt
 		}
+	case token.MATCH:
+		if stmt := p.parseMatchStatement(); stmt != nil {
+			return stmt
+		}
 	case token.ELSEIF, token.ELSE:
-		p.errorf(p.tok.Line, p.tok.Col, "elseif/else statement without a preceding if statement")
+		p.errorf("P002", p.tok.Line, p.tok.Col, "elseif/else statement without a preceding if statement")
 		p.skip()
 		return nil
 	case token.FUN:
+		// fun(int) -> bool f = ...
+		if p.peekis(token.OPENING_PAREN) {
+			if isASubseqVariableDecl(p) {
+				if stmt := p.parseSubsequentVariableDeclarationStatement(); stmt != nil || p.failed {
+					return stmt
+				}
+			}
+			if stmt := p.parseVariableDeclarationStatement(); stmt != nil {
+				return stmt
+			}
+			break
+		}
 		if stmt := p.parseFunctionDeclarationStatement(); stmt != nil {
 			return stmt
 		}
 	case token.EOF:
 		break
 	default:
-		p.errorf(p.tok.Line, p.tok.Col, "unexpected token '%s'", p.tok.Literal)
+		p.errorf("P003", p.tok.Line, p.tok.Col, "unexpected token '%s'", p.tok.Literal)
 		tokTyp := p.tok.Type
 		// skip token of same type to avoid giving repetitive error messages
 		p.eat(tokTyp)
@@ -448,14 +729,14 @@ func (p *Parser) parseStatement() ast.Statement {
 }
 
 func (p *Parser) parseStringLiteral(isStmt bool) *ast.StringLiteral {
-	if p.errif(p.curnot(token.STRING), "illegal string '%s'", p.tok.Literal) {
+	if p.errif(p.curnot(token.STRING), "P004", "illegal string '%s'", p.tok.Literal) {
 		return nil
 	}
 	// if isStmt, then this is an expression statement.
 	// expression statements need a dot at the end, because they are statements.
 	s := &ast.StringLiteral{Typ: p.tok, Val: p.tok.Literal}
 	p.move()
-	if assertDot(p, isStmt, "unexpected token '%s'. need a dot at the end of a statement", p.tok.Literal) {
+	if assertDot(p, isStmt, "P005", "unexpected token '%s'. need a dot at the end of a statement", p.tok.Literal) {
 		return nil
 	}
 	return s
@@ -463,13 +744,13 @@ func (p *Parser) parseStringLiteral(isStmt bool) *ast.StringLiteral {
 
 func (p *Parser) parseIntLiteral(isStmt bool) *ast.IntLiteral {
 	// this can help me in debugging.
-	if p.errif(p.curnot(token.INT), "illegal integer '%s'", p.tok.Literal) {
+	if p.errif(p.curnot(token.INT), "P006", "illegal integer '%s'", p.tok.Literal) {
 		return nil
 	}
 	n := atoi(p)
 	i := &ast.IntLiteral{Typ: p.tok, Val: n}
 	p.move()
-	if assertDot(p, isStmt, "unexpected token '%s'. need a dot at the end of a statement", p.tok.Literal) {
+	if assertDot(p, isStmt, "P007", "unexpected token '%s'. need a dot at the end of a statement", p.tok.Literal) {
 		return nil
 	}
 	return i
@@ -477,13 +758,13 @@ func (p *Parser) parseIntLiteral(isStmt bool) *ast.IntLiteral {
 
 func (p *Parser) parseBoolLiteral(isStmt bool) *ast.BoolLiteral {
 	// this can help me in debugging.
-	if p.errif(p.curnot(token.BOOL), "illegal boolean '%s'", p.tok.Literal) {
+	if p.errif(p.curnot(token.BOOL), "P008", "illegal boolean '%s'", p.tok.Literal) {
 		return nil
 	}
 	b := atob(p)
 	boo := &ast.BoolLiteral{Typ: p.tok, Val: b}
 	p.move()
-	if assertDot(p, isStmt, "unexpected token '%s'. need a dot at the end of a statement", p.tok.Literal) {
+	if assertDot(p, isStmt, "P009", "unexpected token '%s'. need a dot at the end of a statement", p.tok.Literal) {
 		return nil
 	}
 	return boo
@@ -491,12 +772,12 @@ func (p *Parser) parseBoolLiteral(isStmt bool) *ast.BoolLiteral {
 
 func (p *Parser) parseIdentifier(isStmt bool) *ast.Identifier {
 	// this can help me in debugging.
-	if p.errif(p.curnot(token.IDENT), "illegal identifier '%s'", p.tok.Literal) {
+	if p.errif(p.curnot(token.IDENT), "P010", "illegal identifier '%s'", p.tok.Literal) {
 		return nil
 	}
 	i := &ast.Identifier{Tok: p.tok}
 	p.move()
-	if assertDot(p, isStmt, "unexpected token '%s'. need a dot at the end of a statement", p.tok.Literal) {
+	if assertDot(p, isStmt, "P011", "unexpected token '%s'. need a dot at the end of a statement", p.tok.Literal) {
 		return nil
 	}
 	return i
@@ -528,6 +809,10 @@ func (p *Parser) parseExpr() ast.Expr {
 
 			return p.parseFunctionCall(identTok, false, "")
 		case token.DOUBLE_COLON:
+			// Color::Red is a member of an enum; not a function call
+			if p.peekN(2).Type == token.IDENT && p.peekN(3).Type != token.OPENING_PAREN {
+				return p.parseEnumMember()
+			}
 			return p.parseFunctionCallFromNamespace(identTok, false)
 		}
 		if isDatatypeInitialization(p) {
@@ -543,55 +828,61 @@ func (p *Parser) parseExpr() ast.Expr {
 	return nil
 }
 
-// tok, isList, listType, identifier
-func (p *Parser) parseVariableTypeAndName() (token.Token, bool, token.Token, *ast.Identifier) {
+// the type, and the name of a variable
+func (p *Parser) parseVariableTypeAndName() (ast.VarType, *ast.Identifier) {
 	// current token is a type must be a type
 	var (
-		tok     token.Token
-		listTyp token.Token
-		id      *ast.Identifier
-		isList  bool
+		typ ast.VarType
+		id  *ast.Identifier
 	)
-	if p.errif(!(isReturnOrFunctionParamType(p.tok.Type)),
+	if p.errif(!(isReturnOrFunctionParamType(p.tok.Type)), "P012",
 		"illegal type '%s' in variable declaration statement", p.tok.Literal) {
-		return tok, isList, listTyp, nil
+		return typ, nil
 	}
-	tok = p.tok
+	typ.Tok = p.tok
+	tok := typ.Tok
 	if p.curis(token.LISTOF) {
-		isList = true
+		typ.IsList = true
 		p.move()
-		if p.errif(!(isReturnOrFunctionParamType(p.tok.Type)),
+		if p.errif(!(isReturnOrFunctionParamType(p.tok.Type)), "P013",
 			"illegal type '%s' in list variable declaration statement", p.tok.Literal) {
-			return tok, isList, listTyp, nil
+			return typ, nil
 		}
-		listTyp = p.tok
+		typ.TypeOfList = p.tok
+	}
+	if p.curis(token.FUN) {
+		if typ.Fun = p.parseFunctionType(); typ.Fun == nil {
+			return typ, nil
+		}
+	} else {
+		p.move()
 	}
-	p.move()
 	p.eat(token.NEWLINE)
 	// allow newline after type.
 	// int
 	//     x = 5.
 	// is legal.
-	if p.errif(p.curnot(token.IDENT),
+	if p.errif(p.curnot(token.IDENT), "P014",
 		"unexpected token '%s' in variable declaration statement, where an identifier were expected after type '%s'",
 		p.tok.Literal, tok.Literal) {
-		return tok, isList, listTyp, nil
+		return typ, nil
 	}
 	isStmt := false
 	id = p.parseIdentifier(isStmt)
-	return tok, isList, listTyp, id
+	return typ, id
 }
 
 func (p *Parser) parseVariableDeclarationStatement() *ast.VariableDeclarationStatement {
 	var v = &ast.VariableDeclarationStatement{}
-	tok, _, _, id := p.parseVariableTypeAndName()
+	typ, id := p.parseVariableTypeAndName()
 	if id == nil { // parseVariableTypeAndName's second return value is nil, only when there was an error
 		// we don't report any errors here; because, parseVariableTypeAndName already did that for us.
 		return nil
 	}
-	v.Tok = tok
+	v.Tok = typ.Tok
+	v.Fun = typ.Fun
 	v.Ident = id
-	if p.errif(p.curnot(token.EQUAL),
+	if p.errif(p.curnot(token.EQUAL), "P015",
 		"unexpected token '%s', expected an equal sign", p.tok.Literal) {
 		return nil
 	}
@@ -600,24 +891,54 @@ func (p *Parser) parseVariableDeclarationStatement() *ast.VariableDeclarationSta
 		goto noval
 	}
 	if p.errif2(!(isExpr(p.peek().Type)),
-		newErr(line, col,
+		newErr("P016", line, col,
 			"unexpected token '%s' as value in variable declaration", p.peek().Literal)) {
 		return nil
 	}
 noval:
 	v.Value = p.parseExpr()
 	if p.errif2(v.Value == nil,
-		newErr(line, col, "no value set to variable '%s'", v.Ident.String())) {
+		newErr("P017", line, col, "no value set to variable '%s'", v.Ident.String())) {
 		return nil
 	}
-	if p.errif(p.curnot(token.DOT),
+	if p.errif(p.curnot(token.DOT), "P018",
 		"unexpected token: need a dot at the end of a statement") {
 		return nil
 	}
 	p.move()
+	v.End = p.prevEnd()
 	return v
 }
 
+// const int MAX = (* 60 60).
+//
+// a constant declaration declares one constant; of any type.
+func (p *Parser) parseConstDeclaration() *ast.ConstDeclaration {
+	c := &ast.ConstDeclaration{Tok: p.tok}
+	p.move() // skip const
+	switch p.tok.Type {
+	case token.INTKW, token.STRINGKW, token.BOOLKW, token.IDENT, token.LISTOF, token.FUN:
+		if p.errif(isASubseqVariableDecl(p), "P128", "a constant declaration declares only one constant") {
+			return nil
+		}
+	default:
+		p.errorf("P127", p.tok.Line, p.tok.Col, "unexpected token '%s' after 'const', where a type was expected", p.tok.Literal)
+		p.skip()
+		return nil
+	}
+	if p.curis(token.LISTOF) {
+		if d := p.parseListVariableDeclarationStatement(); d != nil {
+			c.Decl = d
+		}
+	} else if d := p.parseVariableDeclarationStatement(); d != nil {
+		c.Decl = d
+	}
+	if c.Decl == nil {
+		return nil
+	}
+	return c
+}
+
 /* parse comma separated variables */
 /* like: */
 /* int n, string y, bool z = <expr>, ... . */
@@ -628,7 +949,7 @@ func (p *Parser) parseSubsequentVariableDeclarationStatement() *ast.SubsequentVa
 	var res = &ast.SubsequentVariableDeclarationStatement{Tok: p.tok}
 	// parse types, and names
 	for p.curnot(token.EQUAL) {
-		if p.errif(p.curis(token.EOF),
+		if p.errif(p.curis(token.EOF), "P019",
 			"unexpected end-of-file: unfinished subsequent variable declaration statement") {
 			return nil
 		}
@@ -641,30 +962,29 @@ func (p *Parser) parseSubsequentVariableDeclarationStatement() *ast.SubsequentVa
 			(int, and string; respectively.)
 			I couldn't figure out the reason why, so I switched to returning non-pointer token.Token type.
 		*/
-		tok, isList, listTyp, id := p.parseVariableTypeAndName()
+		typ, id := p.parseVariableTypeAndName()
 		if id == nil {
 			return nil
 		}
-		typ := ast.VarType{Tok: tok, IsList: isList, TypeOfList: listTyp}
 		res.Types = append(res.Types, typ)
 		res.Names = append(res.Names, id)
 		if p.curis(token.EQUAL) {
 			break
 		}
-		if p.errif(p.curnot(token.COMMA),
+		if p.errif(p.curnot(token.COMMA), "P020",
 			"unexpected token '%s' where a comma was expected in subsequent variable declaration '%s %s'",
-			p.tok.Literal, tok.Literal, id.String()) {
+			p.tok.Literal, typ.Tok.Literal, id.String()) {
 			return nil
 		}
 		p.move() // skip ,
 	}
 	p.move() // skip =
 	for p.curnot(token.DOT) {
-		if p.errif(p.curis(token.EOF),
+		if p.errif(p.curis(token.EOF), "P021",
 			"unexpected end-of-file: unfinished subsequent variable declaration statement") {
 			return nil
 		}
-		if p.errif(!(isExpr(p.tok.Type)),
+		if p.errif(!(isExpr(p.tok.Type)), "P022",
 			"unexpected token '%s' as value in subsequent variable declaration statement", p.tok.Literal) {
 			return nil
 		}
@@ -675,7 +995,7 @@ func (p *Parser) parseSubsequentVariableDeclarationStatement() *ast.SubsequentVa
 		if p.curis(token.DOT) {
 			break
 		}
-		if p.errif(p.curnot(token.COMMA),
+		if p.errif(p.curnot(token.COMMA), "P023",
 			"unexpected token '%s' in subsequent variable declaration statement, where a comma was expected", p.tok.Literal) {
 			return nil
 		}
@@ -683,30 +1003,32 @@ func (p *Parser) parseSubsequentVariableDeclarationStatement() *ast.SubsequentVa
 		p.eat(token.NEWLINE)
 	}
 	p.move() // skip .
+	res.End = p.prevEnd()
 	return res
 }
 
 func (p *Parser) parseReassignmentStatement(identTok token.Token) *ast.ReassignmentStatement {
 	r := &ast.ReassignmentStatement{Tok: identTok, Ident: &ast.Identifier{Tok: identTok}}
 	if eqOk, peek := p.expect(token.EQUAL), p.peek(); !(eqOk) {
-		p.errorf(peek.Line, peek.Col, "unexpected token: expected an equal sign, got '%s'", peek.Type)
+		p.errorf("P024", peek.Line, peek.Col, "unexpected token: expected an equal sign, got '%s'", peek.Type)
 		p.move()
 		return nil
 	}
 	line, col := p.peek().Line, p.peek().Col
-	if p.errif2(!(isExpr(p.peek().Type)), newErr(line, col,
+	if p.errif2(!(isExpr(p.peek().Type)), newErr("P025", line, col,
 		"unexpected token '%s' as new value in reassignment statement", p.peek().Literal)) {
 		return nil
 	}
 	r.NewValue = p.parseExpr()
-	if p.errif2(r.NewValue == nil, newErr(line, col, "no value in reassignment")) {
+	if p.errif2(r.NewValue == nil, newErr("P026", line, col, "no value in reassignment")) {
 		return nil
 	}
-	if p.errif(p.curnot(token.DOT),
+	if p.errif(p.curnot(token.DOT), "P027",
 		"unexpected token '%s' need a dot at the end of a statement", p.tok.Literal) {
 		return nil
 	}
 	p.move()
+	r.End = p.prevEnd()
 	return r
 }
 
@@ -714,7 +1036,7 @@ func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 	b := &ast.BlockStatement{Tok: p.tok}
 	p.move()
 	for p.tok.Type != token.END {
-		if p.errif(p.curis(token.EOF),
+		if p.errif(p.curis(token.EOF), "P028",
 			"unexpected end-of-file: unclosed block statement") {
 			return nil
 		}
@@ -723,6 +1045,7 @@ func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 		}
 	}
 	p.move()
+	b.End = p.prevEnd()
 	return b
 }
 
@@ -734,23 +1057,23 @@ func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 		// I could've just swapped this if statement, and the one below; I know.
 		goto noval
 	}
-	if p.errif2(!(isExpr(p.peek().Type)), newErr(p.peek().Line, p.peek().Col,
+	if p.errif2(!(isExpr(p.peek().Type)), newErr("P029", p.peek().Line, p.peek().Col,
 		"unexpected token '%s' as return value in return statement", p.peek().Literal)) {
 		return nil
 	}
 noval:
 	expr := p.parseExpr()
-	if p.errif2(expr == nil, newErr(line, col, "return statement with no value")) {
+	if p.errif2(expr == nil, newErr("P030", line, col, "return statement with no value")) {
 		return nil
 	}
 	r.ReturnValues = append(r.ReturnValues, expr)
 	// multiple returns
 	if p.curis(token.COMMA) {
 		for p.curnot(token.DOT) {
-			if p.errif(p.curis(token.EOF), "unexpected end-of-file: unfinished return statement") {
+			if p.errif(p.curis(token.EOF), "P031", "unexpected end-of-file: unfinished return statement") {
 				return nil
 			}
-			if p.errif2(!(isExpr(p.peek().Type)), newErr(p.peek().Line, p.peek().Col,
+			if p.errif2(!(isExpr(p.peek().Type)), newErr("P032", p.peek().Line, p.peek().Col,
 				"unexpected token '%s' as return value in return statement", p.peek().Literal)) {
 				return nil
 			}
@@ -759,57 +1082,60 @@ noval:
 			}
 		}
 	}
-	if p.errif(p.curnot(token.DOT),
+	if p.errif(p.curnot(token.DOT), "P033",
 		"unexpected token '%s' where a dot was expected at the end of a return statement", p.tok.Literal) {
 		return nil
 	}
 	p.move()
+	r.End = p.prevEnd()
 	return r
 }
 
 func (p *Parser) parseBreakStatement() *ast.BreakStatement {
 	// current token is token.BREAK
 	b := &ast.BreakStatement{Tok: p.tok}
-	if p.errif(!(p.peekis(token.DOT)),
+	if p.errif(!(p.peekis(token.DOT)), "P034",
 		"unexpected token '%s' at the end of break statement where a dot was expected", p.peek().Literal) {
 		return nil
 	}
 	p.dmove()
+	b.End = p.prevEnd()
 	return b
 }
 
 func (p *Parser) parseContinueStatement() *ast.ContinueStatement {
 	// current token is token.CONTINUE
 	c := &ast.ContinueStatement{Tok: p.tok}
-	if p.errif(!(p.peekis(token.DOT)),
+	if p.errif(!(p.peekis(token.DOT)), "P035",
 		"unexpected token '%s' at the end of continue statement where a dot was expected", p.peek().Literal) {
 		return nil
 	}
 	p.dmove()
+	c.End = p.prevEnd()
 	return c
 }
 
 func (p *Parser) parseLoopStatement() *ast.LoopStatement {
 	l := &ast.LoopStatement{Tok: p.tok}
 	line, col := p.peek().Line, p.peek().Col
-	if p.errif2(p.peekis(token.OPENING_CURLY), newErr(line, col, "missing condition in loop statement")) {
+	if p.errif2(p.peekis(token.OPENING_CURLY), newErr("P036", line, col, "missing condition in loop statement")) {
 		return nil
 	}
-	if p.errif2(!(isExpr(p.peek().Type)), newErr(line, col,
+	if p.errif2(!(isExpr(p.peek().Type)), newErr("P037", line, col,
 		"unexpected token '%s' in loop statement. loop statement condition must be an expression", p.peek().Literal)) {
 		return nil
 	}
 	l.Cond = p.parseExpr()
-	if p.errif2(l.Cond == nil, newErr(line, col, "missing condition in loop statement")) {
+	if p.errif2(l.Cond == nil, newErr("P038", line, col, "missing condition in loop statement")) {
 		return nil
 	}
-	if p.errif(p.curnot(token.OPENING_CURLY),
+	if p.errif(p.curnot(token.OPENING_CURLY), "P039",
 		"unexpected token: expected an opening curly brace, got '%s'", p.tok.Type) {
 		return nil
 	}
 	p.move() // skip '{'
 	for p.curnot(token.CLOSING_CURLY) {
-		if p.errif(p.curis(token.EOF),
+		if p.errif(p.curis(token.EOF), "P040",
 			"unexpected end-of-file: unclosed loop statement") {
 			return nil
 		}
@@ -817,32 +1143,40 @@ func (p *Parser) parseLoopStatement() *ast.LoopStatement {
 			l.Stmts = append(l.Stmts, stmt)
 		}
 	}
-	if p.errif(p.curnot(token.CLOSING_CURLY),
+	if p.errif(p.curnot(token.CLOSING_CURLY), "P041",
 		"unexpected token: expected a closing curly brace, got '%s'", p.tok.Type) {
 		return nil
 	}
 	p.move()
+	l.End = p.prevEnd()
 	return l
 }
 
 func (p *Parser) parseDatatypeField() *ast.DatatypeField {
 	// require newline at the end of every field
-	f := &ast.DatatypeField{Tok: p.tok}
+	f := &ast.DatatypeField{Tok: p.tok, Doc: p.docOf(p.tok)}
 	switch p.tok.Type {
 	// TODO lists
-	case token.INTKW, token.STRINGKW, token.BOOLKW, token.IDENT:
+	case token.INTKW, token.STRINGKW, token.BOOLKW, token.IDENT, token.FUN:
+		if p.curis(token.FUN) {
+			if f.Fun = p.parseFunctionType(); f.Fun == nil {
+				return nil
+			}
+			p.unmove() // the last token of the type
+		}
 		if identOk, peek := p.expect(token.IDENT), p.peek(); !(identOk) {
-			p.errorf(peek.Line, peek.Col, "missing identifier: expected an identifier in datatype field")
+			p.errorf("P042", peek.Line, peek.Col, "missing identifier: expected an identifier in datatype field")
 			p.skip()
 			return nil
 		}
 		f.Ident = p.parseIdentifier(false)
-		if p.errif(p.curnot(token.NEWLINE),
+		if p.errif(p.curnot(token.NEWLINE), "P043",
 			"missing newline after datatype field") {
 			return nil
 		}
+		f.Comment = p.commentAfter(f.Ident.Tok.End)
 	default:
-		p.errorf(p.tok.Line, p.tok.Col, "invalid token '%s' for datatype field", p.tok.Literal)
+		p.errorf("P044", p.tok.Line, p.tok.Col, "invalid token '%s' for datatype field", p.tok.Literal)
 		return nil
 	}
 	p.move()
@@ -850,26 +1184,30 @@ func (p *Parser) parseDatatypeField() *ast.DatatypeField {
 }
 
 func (p *Parser) parseDatatypeDeclarationStatement() *ast.DatatypeDeclaration {
-	d := &ast.DatatypeDeclaration{Tok: p.tok}
+	d := &ast.DatatypeDeclaration{Tok: p.tok, Doc: p.docOf(p.tok)}
 	if identOk, peek := p.expect(token.IDENT), p.peek(); !(identOk) {
-		p.errorf(peek.Line, peek.Col, "datatype without a name")
+		p.errorf("P045", peek.Line, peek.Col, "datatype without a name")
 		p.skip()
 		return nil
 	}
 	line, col := p.tok.Line, p.tok.Col
 	name := p.parseIdentifier(false)
-	if p.errif2(name == nil, newErr(line, col, "expected a name for the datatype declaration")) {
+	if p.errif2(name == nil, newErr("P046", line, col, "expected a name for the datatype declaration")) {
 		return nil
 	}
 	d.Name = name
-	if p.errif(p.curnot(token.OPENING_CURLY),
+	if p.curis(token.EQUAL) {
+		return p.parseDatatypeVariants(d)
+	}
+	if p.errif(p.curnot(token.OPENING_CURLY), "P047",
 		"missing opening curly brace in datatype declaration") {
 		return nil
 	}
 	p.move() // skip {
-	p.moveif(p.curis(token.NEWLINE))
+	// there may be blank lines, or comments before the first field
+	p.eat(token.NEWLINE)
 	for {
-		if p.errif(p.curis(token.EOF),
+		if p.errif(p.curis(token.EOF), "P048",
 			"unexpected end-of-file: expected a closing curly brace at the end of datatype declaration") {
 			return nil
 		}
@@ -895,27 +1233,237 @@ func (p *Parser) parseDatatypeDeclarationStatement() *ast.DatatypeDeclaration {
 		p.eat(token.NEWLINE)
 		d.Fields = append(d.Fields, field)
 	}
-	if p.errif(p.curnot(token.CLOSING_CURLY),
+	if p.errif(p.curnot(token.CLOSING_CURLY), "P049",
 		"unexpected token '%s'. expected a closing curly brace at the end of datatype declaration",
 		p.tok.Literal) {
 		return nil
 	}
 	p.move()
+	d.End = p.prevEnd()
+	d.Comment = p.commentAfter(d.End)
 	return d
 }
 
+// enum Color { Red Green Blue }
+//
+// members are separated by spaces, or newlines.
+func (p *Parser) parseEnumDeclaration() *ast.EnumDeclaration {
+	e := &ast.EnumDeclaration{Tok: p.tok, Doc: p.docOf(p.tok)}
+	if identOk, peek := p.expect(token.IDENT), p.peek(); !(identOk) {
+		p.errorf("P122", peek.Line, peek.Col, "enum without a name")
+		p.skip()
+		return nil
+	}
+	e.Name = p.parseIdentifier(false)
+	if p.errif(p.curnot(token.OPENING_CURLY), "P123",
+		"missing opening curly brace in enum declaration") {
+		return nil
+	}
+	p.move() // skip {
+	p.eat(token.NEWLINE)
+	for p.curnot(token.CLOSING_CURLY) {
+		if p.errif(p.curis(token.EOF), "P124", "unexpected end-of-file: unclosed enum '%s'", e.Name) {
+			return nil
+		}
+		if p.errif(p.curnot(token.IDENT), "P125",
+			"unexpected token '%s' in enum '%s', where the name of a member was expected", p.tok.Literal, e.Name) {
+			return nil
+		}
+		e.Members = append(e.Members, p.parseIdentifier(false))
+		p.eat(token.NEWLINE)
+	}
+	if p.errif(len(e.Members) == 0, "P126", "enum '%s' has no members", e.Name) {
+		return nil
+	}
+	p.move() // skip }
+	e.End = p.prevEnd()
+	e.Comment = p.commentAfter(e.End)
+	return e
+}
+
+// Color::Red
+func (p *Parser) parseEnumMember() *ast.EnumMember {
+	// current token is the name of the enum
+	m := &ast.EnumMember{Enum: &ast.Identifier{Tok: p.tok}}
+	p.move() // skip ::
+	p.move()
+	m.Member = p.parseIdentifier(false)
+	return m
+}
+
+// the variants of a sum type, after its name:
+//
+//	datatype Shape = Circle { int r } | Rect { int w int h }
+//
+// variants may be on lines of their own; the first one may start with '|' too.
+func (p *Parser) parseDatatypeVariants(d *ast.DatatypeDeclaration) *ast.DatatypeDeclaration {
+	// current token is '='
+	p.move()
+	p.eat(token.NEWLINE)
+	p.moveif(p.curis(token.PIPE))
+	for {
+		p.eat(token.NEWLINE)
+		if p.errif(p.curnot(token.IDENT), "P111",
+			"unexpected token '%s' in datatype '%s', where the name of a variant was expected", p.tok.Literal, d.Name) {
+			return nil
+		}
+		v := p.parseDatatypeVariant()
+		if v == nil {
+			return nil
+		}
+		d.Variants = append(d.Variants, v)
+		// is there a '|' after the newlines?
+		ahead := uint(0)
+		for p.peekN(ahead).Type == token.NEWLINE {
+			ahead++
+		}
+		if p.peekN(ahead).Type != token.PIPE {
+			break
+		}
+		p.eat(token.NEWLINE)
+		p.move() // skip |
+	}
+	d.End = p.prevEnd()
+	d.Comment = p.commentAfter(d.End)
+	return d
+}
+
+// fields of a variant are separated by spaces, or newlines.
+func (p *Parser) parseDatatypeVariant() *ast.DatatypeVariant {
+	// current token is the name of the variant
+	v := &ast.DatatypeVariant{Name: p.parseIdentifier(false)}
+	if p.curnot(token.OPENING_CURLY) {
+		// no fields
+		v.End = p.prevEnd()
+		return v
+	}
+	p.move() // skip {
+	p.eat(token.NEWLINE)
+	for p.curnot(token.CLOSING_CURLY) {
+		if p.errif(p.curis(token.EOF), "P112", "unexpected end-of-file: unclosed variant '%s'", v.Name) {
+			return nil
+		}
+		f := &ast.DatatypeField{Tok: p.tok, Doc: p.docOf(p.tok)}
+		switch p.tok.Type {
+		case token.INTKW, token.STRINGKW, token.BOOLKW, token.IDENT:
+		case token.FUN:
+			if f.Fun = p.parseFunctionType(); f.Fun == nil {
+				return nil
+			}
+			p.unmove() // the last token of the type
+		default:
+			p.errorf("P113", p.tok.Line, p.tok.Col, "invalid token '%s' for a field of variant '%s'", p.tok.Literal, v.Name)
+			p.skip()
+			return nil
+		}
+		if identOk, peek := p.expect(token.IDENT), p.peek(); !(identOk) {
+			p.errorf("P114", peek.Line, peek.Col, "missing identifier: expected an identifier in a field of variant '%s'", v.Name)
+			p.skip()
+			return nil
+		}
+		f.Ident = p.parseIdentifier(false)
+		f.Comment = p.commentAfter(f.Ident.Tok.End)
+		v.Fields = append(v.Fields, f)
+		p.eat(token.NEWLINE)
+	}
+	p.move() // skip }
+	v.End = p.prevEnd()
+	return v
+}
+
+func (p *Parser) parseMatchStatement() *ast.MatchStatement {
+	// current token is token.MATCH
+	m := &ast.MatchStatement{Tok: p.tok}
+	peek := p.peek()
+	if p.errif2(!(isExpr(peek.Type)), newErr("P115", peek.Line, peek.Col,
+		"unexpected token '%s' in match statement, where a value was expected", peek.Literal)) {
+		return nil
+	}
+	// 'match s {' isn't a datatype literal; but 'match Ok{value=1} {', and 'match Ok{} {' are.
+	isLiteral := (p.peekN(3).Type == token.IDENT && p.peekN(4).Type == token.EQUAL) ||
+		(p.peekN(3).Type == token.CLOSING_CURLY && p.peekN(4).Type == token.OPENING_CURLY)
+	if peek.Type == token.IDENT && p.peekN(2).Type == token.OPENING_CURLY && !(isLiteral) {
+		p.move()
+		m.Value = p.parseIdentifier(false)
+	} else {
+		m.Value = p.parseExpr()
+	}
+	if p.errif2(m.Value == nil, newErr("P116", peek.Line, peek.Col, "missing value in match statement")) {
+		return nil
+	}
+	if p.errif(p.curnot(token.OPENING_CURLY), "P117",
+		"unexpected token '%s' in match statement, where a '{' was expected", p.tok.Literal) {
+		return nil
+	}
+	p.move() // skip {
+	for {
+		p.eat(token.NEWLINE)
+		if p.curis(token.CLOSING_CURLY) {
+			break
+		}
+		if p.errif(p.curis(token.EOF), "P118", "unexpected end-of-file: unclosed match statement") {
+			return nil
+		}
+		if p.errif(m.Default != nil, "P119", "the else arm must be the last arm of a match statement") {
+			return nil
+		}
+		if p.curis(token.ELSE) {
+			if m.Default = p.parseElseStatement(); m.Default == nil {
+				return nil
+			}
+			continue
+		}
+		arm := p.parseMatchArm()
+		if arm == nil {
+			return nil
+		}
+		m.Arms = append(m.Arms, arm)
+	}
+	p.move()
+	m.End = p.prevEnd()
+	return m
+}
+
+// Circle c { ... }
+func (p *Parser) parseMatchArm() *ast.MatchArm {
+	if p.errif(p.curnot(token.IDENT), "P120",
+		"unexpected token '%s' in match statement, where a variant was expected", p.tok.Literal) {
+		return nil
+	}
+	arm := &ast.MatchArm{Variant: p.parseIdentifier(false)}
+	if p.curis(token.IDENT) {
+		arm.Name = p.parseIdentifier(false)
+	}
+	if p.errif(p.curnot(token.OPENING_CURLY), "P121",
+		"unexpected token '%s' after variant '%s', where a '{' was expected", p.tok.Literal, arm.Variant) {
+		return nil
+	}
+	p.move() // skip {
+	for p.curnot(token.CLOSING_CURLY) {
+		if p.errif(p.curis(token.EOF), "P133", "unexpected end-of-file: unclosed match statement") {
+			return nil
+		}
+		if stmt := p.parseStatement(); stmt != nil {
+			arm.Stmts = append(arm.Stmts, stmt)
+		}
+	}
+	p.move()
+	arm.End = p.prevEnd()
+	return arm
+}
+
 func (p *Parser) parseOperator(isStmt bool) *ast.PrefixExpr {
 	// current token is token.OPENING_PAREN
-	pe := &ast.PrefixExpr{}
-	if p.errif(p.peekis(token.EOF),
+	pe := &ast.PrefixExpr{Start: p.tok.Pos()}
+	if p.errif(p.peekis(token.EOF), "P050",
 		"unexpected end-of-file: expected an operator after '(', in prefix expression") {
 		return nil
 	}
-	if p.errif(p.peekis(token.CLOSING_PAREN),
+	if p.errif(p.peekis(token.CLOSING_PAREN), "P051",
 		"missing operator in prefix expression") {
 		return nil
 	}
-	if peek := p.peek(); p.errif2(!(isOperator(peek)), newErr(peek.Line, peek.Col,
+	if peek := p.peek(); p.errif2(!(isOperator(peek)), newErr("P052", peek.Line, peek.Col,
 		"unknown operator '%s' in prefix expression", peek.Literal)) {
 		return nil
 	}
@@ -927,11 +1475,11 @@ func (p *Parser) parseOperator(isStmt bool) *ast.PrefixExpr {
 		if p.curis(token.CLOSING_PAREN) {
 			break
 		}
-		if p.errif(p.curis(token.EOF),
+		if p.errif(p.curis(token.EOF), "P053",
 			"unexpected end-of-file: expected a closing ')'") {
 			return nil
 		}
-		if p.errif(!(isExpr(p.tok.Type)),
+		if p.errif(!(isExpr(p.tok.Type)), "P054",
 			"unexpected token '%s' as argument to operator '%s'. it expects expressions",
 			p.tok.Literal, token.PrefixExprName(pe.Tok.Type)) {
 			return nil
@@ -943,7 +1491,8 @@ func (p *Parser) parseOperator(isStmt bool) *ast.PrefixExpr {
 	}
 	// current token is token.CLOSING_PAREN
 	p.move()
-	if assertDot(p, isStmt, "unexpected token '%s' at the end of prefix expression, where a dot was expected", p.tok.Literal) {
+	pe.End = p.prevEnd()
+	if assertDot(p, isStmt, "P055", "unexpected token '%s' at the end of prefix expression, where a dot was expected", p.tok.Literal) {
 		return nil
 	}
 	return pe
@@ -960,7 +1509,7 @@ func (p *Parser) parseFunctionCall(ident token.Token, isStmt bool, namespace str
 		fnName = namespace + "::" + fnName
 	}
 	p.move()
-	if p.errif(p.curnot(token.OPENING_PAREN),
+	if p.errif(p.curnot(token.OPENING_PAREN), "P056",
 		"missing '(' in function call '%s'", fnName) {
 		return nil
 	}
@@ -975,14 +1524,14 @@ func (p *Parser) parseFunctionCall(ident token.Token, isStmt bool, namespace str
 			p.dmove()
 			goto end
 		}
-		if peek := p.peek(); p.errif2(!(isExpr(peek.Type)), newErr(peek.Line, peek.Col,
+		if peek := p.peek(); p.errif2(!(isExpr(peek.Type)), newErr("P057", peek.Line, peek.Col,
 			"unexpected token '%s' as argument to function call '%s'. it expects expressions", peek.Literal, fnName)) {
 			return nil
 		}
 		if arg := p.parseExpr(); arg != nil {
 			fc.Args = append(fc.Args, arg)
 		}
-		if p.errif(p.curis(token.COMMA) && p.peekis(token.CLOSING_PAREN),
+		if p.errif(p.curis(token.COMMA) && p.peekis(token.CLOSING_PAREN), "P058",
 			"redundant comma in function call '%s'", fnName) {
 			return nil
 		}
@@ -990,12 +1539,13 @@ func (p *Parser) parseFunctionCall(ident token.Token, isStmt bool, namespace str
 			p.move()
 			goto end
 		}
-		if p.errif(p.curnot(token.COMMA), "missing comma in function call '%s'", fnName) {
+		if p.errif(p.curnot(token.COMMA), "P059", "missing comma in function call '%s'", fnName) {
 			return nil
 		}
 	}
 end:
-	if assertDot(p, isStmt, "unexpected token '%s' at the end of function call expression statement '%s', where a dot was expected",
+	fc.End = p.prevEnd()
+	if assertDot(p, isStmt, "P060", "unexpected token '%s' at the end of function call expression statement '%s', where a dot was expected",
 		p.tok.Literal, fnName) {
 		return nil
 	}
@@ -1005,12 +1555,12 @@ end:
 func (p *Parser) parseFunctionCallFromNamespace(namespaceTok token.Token, isStmt bool) *ast.FunctionCallFromNamespace {
 	fcfn := &ast.FunctionCallFromNamespace{Namespace: &ast.Namespace{Tok: namespaceTok, Identifier: &ast.Identifier{Tok: namespaceTok}}}
 	if dColonOk, peek := p.expect(token.DOUBLE_COLON), p.peek(); !(dColonOk) {
-		p.errorf(peek.Line, peek.Col, "unexpected token '%s' when calling a function from namespace '%s'. expected `::`", peek.Literal, fcfn.Namespace.Identifier.String())
+		p.errorf("P061", peek.Line, peek.Col, "unexpected token '%s' when calling a function from namespace '%s'. expected `::`", peek.Literal, fcfn.Namespace.Identifier.String())
 		p.move()
 		return nil
 	}
 	if identOk, peek := p.expect(token.IDENT), p.peek(); !(identOk) {
-		p.errorf(peek.Line, peek.Col, "unexpected token '%s'. expected a function name", peek.Literal)
+		p.errorf("P062", peek.Line, peek.Col, "unexpected token '%s'. expected a function name", peek.Literal)
 		p.move()
 		return nil
 	}
@@ -1026,39 +1576,46 @@ func (p *Parser) parseListVariableDeclarationStatement() *ast.ListVariableDeclar
 	var canBeATypeForList = func(tok token.Type) bool {
 		tflm := map[token.Type]bool{
 			token.INTKW: true, token.STRINGKW: true, token.BOOLKW: true, token.IDENT: true,
-			token.LISTOF: true,
+			token.LISTOF: true, token.FUN: true,
 		}
 		_, ok := tflm[tok]
 		return ok
 	}
-	if peek := p.peek(); p.errif2(!(canBeATypeForList(peek.Type)), newErr(peek.Line, peek.Col,
+	if peek := p.peek(); p.errif2(!(canBeATypeForList(peek.Type)), newErr("P063", peek.Line, peek.Col,
 		"unexpected token '%s' as type for list", peek.Literal)) {
 		return nil
 	}
 	p.move()
 	l.Typ = p.tok
+	if p.curis(token.FUN) {
+		if l.Fun = p.parseFunctionType(); l.Fun == nil {
+			return nil
+		}
+		p.unmove() // the last token of the type
+	}
 	if identOk, peek := p.expect(token.IDENT), p.peek(); !(identOk) {
-		p.errorf(peek.Line, peek.Col, "unexpected token '%s'. expected an identifier in list declaration", peek.Literal)
+		p.errorf("P064", peek.Line, peek.Col, "unexpected token '%s'. expected an identifier in list declaration", peek.Literal)
 		p.skip()
 		return nil
 	}
 	l.Name = p.parseIdentifier(false)
-	if p.errif(p.curnot(token.EQUAL),
+	if p.errif(p.curnot(token.EQUAL), "P065",
 		"unexpected token '%s'. expected an equal sign",
 		p.tok.Literal) {
 		return nil
 	}
 	list := p.parseExpr()
-	if p.errif(list == nil, "missing value for list declaration '%s'", l.Name) {
+	if p.errif(list == nil, "P066", "missing value for list declaration '%s'", l.Name) {
 		return nil
 	}
 	l.List = list
-	if p.errif(p.curnot(token.DOT),
+	if p.errif(p.curnot(token.DOT), "P067",
 		"unexpected token '%s', expected a dot. unfinished list declaration statement",
 		p.tok.Literal) {
 		return nil
 	}
 	p.move() // skip .
+	l.End = p.prevEnd()
 	return l
 }
 
@@ -1068,9 +1625,10 @@ func (p *Parser) parseListLiteral(isStmt bool) *ast.ListLiteral {
 	// no elems
 	if p.peekis(token.CLOSING_SQUARE_BRACKET) {
 		p.dmove()
+		l.End = p.prevEnd()
 		return l
 	}
-	if peek := p.peek(); p.errif2(!(isExpr(peek.Type)), newErr(peek.Line, peek.Col,
+	if peek := p.peek(); p.errif2(!(isExpr(peek.Type)), newErr("P068", peek.Line, peek.Col,
 		"unexpected token '%s' as list element",
 		peek.Literal)) {
 		return nil
@@ -1082,16 +1640,16 @@ func (p *Parser) parseListLiteral(isStmt bool) *ast.ListLiteral {
 		if p.curis(token.CLOSING_SQUARE_BRACKET) {
 			goto end
 		}
-		if p.errif(p.curis(token.EOF),
+		if p.errif(p.curis(token.EOF), "P069",
 			"unexpected end-of-file: unclosed list literal") {
 			return nil
 		}
-		if p.errif(p.curnot(token.COMMA),
+		if p.errif(p.curnot(token.COMMA), "P070",
 			"unexpected token '%s'. missing comma in list literal",
 			p.tok.Literal) {
 			return nil
 		}
-		if peek := p.peek(); p.errif2(!(isExpr(peek.Type)), newErr(peek.Line, peek.Col,
+		if peek := p.peek(); p.errif2(!(isExpr(peek.Type)), newErr("P071", peek.Line, peek.Col,
 			"unexpected token '%s' as list element",
 			peek.Literal)) {
 			return nil
@@ -1102,7 +1660,8 @@ func (p *Parser) parseListLiteral(isStmt bool) *ast.ListLiteral {
 	}
 end:
 	p.move() // skip ]
-	if assertDot(p, isStmt, "unexpected token '%s'. need a dot at the end of a statement", p.tok.Literal) {
+	l.End = p.prevEnd()
+	if assertDot(p, isStmt, "P072", "unexpected token '%s'. need a dot at the end of a statement", p.tok.Literal) {
 		return nil
 	}
 	return l
@@ -1118,7 +1677,7 @@ func (p *Parser) parseIfStatement(isAlternative bool) *ast.IfStatement {
 	if isAlternative {
 		stmtType = "elseif"
 	}
-	if peek := p.peek(); p.errif2(!(isExpr(p.peek().Type)), newErr(peek.Line, peek.Col,
+	if peek := p.peek(); p.errif2(!(isExpr(p.peek().Type)), newErr("P073", peek.Line, peek.Col,
 		"unexpected token '%s' as condition to %s statement", peek.Literal, stmtType)) {
 		return nil
 	}
@@ -1126,16 +1685,16 @@ func (p *Parser) parseIfStatement(isAlternative bool) *ast.IfStatement {
 	if cond := p.parseExpr(); cond != nil {
 		i.Cond = cond
 	}
-	if p.errif2(i.Cond == nil, newErr(line, col, "no condition in %s statement body", stmtType)) {
+	if p.errif2(i.Cond == nil, newErr("P074", line, col, "no condition in %s statement body", stmtType)) {
 		return nil
 	}
-	if p.errif(p.curnot(token.OPENING_CURLY),
+	if p.errif(p.curnot(token.OPENING_CURLY), "P075",
 		"unexpected token '%s' in if statement, where a '{' was expected", p.tok.Literal) {
 		return nil
 	}
 	p.move() // skip {
 	for p.curnot(token.CLOSING_CURLY) {
-		if p.errif(p.curis(token.EOF), "unexpected end-of-file: unclosed %s statement", stmtType) {
+		if p.errif(p.curis(token.EOF), "P076", "unexpected end-of-file: unclosed %s statement", stmtType) {
 			return nil
 		}
 		if stmt := p.parseStatement(); stmt != nil {
@@ -1144,6 +1703,7 @@ func (p *Parser) parseIfStatement(isAlternative bool) *ast.IfStatement {
 	}
 	// current token is token.CLOSING_CURLY
 	p.move()
+	i.End = p.prevEnd()
 	switch p.tok.Type {
 	case token.ELSEIF:
 		i.Alternative = p.parseIfStatement(true)
@@ -1157,13 +1717,13 @@ func (p *Parser) parseElseStatement() *ast.ElseStatement {
 	// current token is token.ELSE
 	e := &ast.ElseStatement{Tok: p.tok}
 	if openingCurlyOk := p.expect(token.OPENING_CURLY); !(openingCurlyOk) {
-		p.errorf(p.tok.Line, p.tok.Col, "unexpected token '%s', where a '{' was expected in else statement", p.tok.Literal)
+		p.errorf("P077", p.tok.Line, p.tok.Col, "unexpected token '%s', where a '{' was expected in else statement", p.tok.Literal)
 		p.skip()
 		return nil
 	}
 	p.move() // skip {
 	for p.curnot(token.CLOSING_CURLY) {
-		if p.errif(p.curis(token.EOF), "unexpected end-of-file: unclosed else statement") {
+		if p.errif(p.curis(token.EOF), "P078", "unexpected end-of-file: unclosed else statement") {
 			return nil
 		}
 		if stmt := p.parseStatement(); stmt != nil {
@@ -1171,9 +1731,97 @@ func (p *Parser) parseElseStatement() *ast.ElseStatement {
 		}
 	}
 	p.move()
+	e.End = p.prevEnd()
 	return e
 }
 
+// fun(int, listof string) -> bool
+//
+// current token is 'fun'. after it, the current token is the one after the type.
+func (p *Parser) parseFunctionType() *ast.FunctionType {
+	f := &ast.FunctionType{Tok: p.tok}
+	p.move() // skip fun
+	if p.errif(p.curnot(token.OPENING_PAREN), "P129",
+		"unexpected token '%s' in function type, where a '(' was expected", p.tok.Literal) {
+		return nil
+	}
+	p.move() // skip (
+	params, ok := p.parseTypes()
+	if !(ok) {
+		return nil
+	}
+	f.Params = params
+	if p.curnot(token.ARROW) {
+		f.End = p.prevEnd()
+		return f
+	}
+	p.move() // skip ->
+	if p.curis(token.OPENING_PAREN) {
+		// many return values
+		line, col := p.tok.Line, p.tok.Col
+		p.move()
+		if f.Returns, ok = p.parseTypes(); !(ok) {
+			return nil
+		}
+		if p.errif2(len(f.Returns) == 0, newErr("P130", line, col, "no return types in parentheses in function type")) {
+			return nil
+		}
+	} else {
+		t, ok := p.parseType()
+		if !(ok) {
+			return nil
+		}
+		f.Returns = []ast.VarType{t}
+	}
+	f.End = p.prevEnd()
+	return f
+}
+
+// comma separated types, until ')'; the current token is the one after ')' after it.
+func (p *Parser) parseTypes() ([]ast.VarType, bool) {
+	var res []ast.VarType
+	for p.curnot(token.CLOSING_PAREN) {
+		t, ok := p.parseType()
+		if !(ok) {
+			return nil, false
+		}
+		res = append(res, t)
+		if p.curis(token.CLOSING_PAREN) {
+			break
+		}
+		if p.errif(p.curnot(token.COMMA), "P131",
+			"unexpected token '%s' in function type, where a comma was expected", p.tok.Literal) {
+			return nil, false
+		}
+		p.move() // skip ,
+	}
+	p.move() // skip )
+	return res, true
+}
+
+// a type in a function type; int, User, listof int, fun(int) -> bool, ...
+func (p *Parser) parseType() (ast.VarType, bool) {
+	t := ast.VarType{Tok: p.tok}
+	if p.curis(token.LISTOF) {
+		t.IsList = true
+		p.move()
+		t.TypeOfList = p.tok
+	}
+	switch p.tok.Type {
+	case token.INTKW, token.STRINGKW, token.BOOLKW, token.IDENT:
+		p.move()
+	case token.FUN:
+		if t.Fun = p.parseFunctionType(); t.Fun == nil {
+			return t, false
+		}
+	default:
+		p.errorf("P132", p.tok.Line, p.tok.Col, "invalid type '%s' in function type", p.tok.Literal)
+		p.skip()
+		return t, false
+	}
+	return t, true
+}
+
 func (p *Parser) parseFunctionParam(fnName string) *ast.FunctionParameter {
 	// current token is a type, or 'listof'
 	param := &ast.FunctionParameter{Tok: p.tok}
@@ -1183,11 +1831,11 @@ func (p *Parser) parseFunctionParam(fnName string) *ast.FunctionParameter {
 		// expect the type of list
 		p.move()
 		// no multi-dimensional list
-		if p.errif(p.curis(token.LISTOF),
+		if p.errif(p.curis(token.LISTOF), "P079",
 			"illegal multi-dimensional list as parameter type in function declaration '%s'", fnName) {
 			return nil
 		}
-		if p.errif(!(isReturnOrFunctionParamType(p.tok.Type)),
+		if p.errif(!(isReturnOrFunctionParamType(p.tok.Type)), "P080",
 			"invalid parameter type '%s' in function declaration '%s'", p.tok.Literal, fnName) {
 			return nil
 		}
@@ -1198,20 +1846,26 @@ func (p *Parser) parseFunctionParam(fnName string) *ast.FunctionParameter {
 	if param.IsList {
 		type_ = "listof " + param.TypeOfList.Literal
 	}
-	if p.errif(!(validType),
+	if p.errif(!(validType), "P081",
 		"invalid type '%s' for parameter in function declaration '%s'", type_, fnName) {
 		return nil
 	}
+	if p.curis(token.FUN) {
+		if param.Fun = p.parseFunctionType(); param.Fun == nil {
+			return nil
+		}
+		p.unmove() // the last token of the type
+	}
 	p.move()
 	type_ = param.Tok.Literal
 	if param.IsList {
 		type_ += " " + param.TypeOfList.Literal
 	}
-	if p.errif(p.curis(token.NEWLINE),
+	if p.errif(p.curis(token.NEWLINE), "P082",
 		"illegal newline after type '%s' in parameter list, in function declaration '%s'", type_, fnName) {
 		return nil
 	}
-	if p.errif(p.curnot(token.IDENT),
+	if p.errif(p.curnot(token.IDENT), "P083",
 		"missing parameter name in function declaration '%s'", fnName) {
 		return nil
 	}
@@ -1224,14 +1878,14 @@ func (p *Parser) parseFunctionParam(fnName string) *ast.FunctionParameter {
 	if p.curis(token.CLOSING_PAREN) {
 		return param
 	}
-	if p.errif(p.curnot(token.COMMA) && !(p.peekis(token.CLOSING_PAREN)),
+	if p.errif(p.curnot(token.COMMA) && !(p.peekis(token.CLOSING_PAREN)), "P084",
 		"missing comma between parameters in function declaration '%s'", fnName) {
 		return nil
 	}
 	line, col := p.tok.Line, p.tok.Col
 	stoppedAtComma := p.curis(token.COMMA)
 	redundantComma := stoppedAtComma && (p.peekis(token.CLOSING_PAREN) || p.peekis(token.NEWLINE) && p.peekN(2).Type == token.CLOSING_PAREN)
-	if p.errif2(redundantComma, newErr(line, col,
+	if p.errif2(redundantComma, newErr("P085", line, col,
 		"redundant comma in parameter list of function declaration '%s'", fnName)) {
 		return nil
 	}
@@ -1244,7 +1898,7 @@ func (p *Parser) parseFunctionParams(fnName string) []ast.FunctionParameter {
 	// current token is on a type
 	var res = []ast.FunctionParameter{}
 	for p.curnot(token.CLOSING_PAREN) {
-		if p.errif(p.curis(token.EOF),
+		if p.errif(p.curis(token.EOF), "P086",
 			"unexpected end-of-file: unclosed parameter list in function '%s'", fnName) {
 			return nil
 		}
@@ -1264,25 +1918,31 @@ func (p *Parser) parseFunctionReturnType(fnName string) *ast.FunctionReturnType
 	frt.IsList = frt.Tok.Type == token.LISTOF
 	if frt.IsList {
 		p.move()
-		if p.errif(!(isReturnOrFunctionParamType(p.tok.Type)),
+		if p.errif(!(isReturnOrFunctionParamType(p.tok.Type)), "P087",
 			"invalid type 'listof %s' as return type in function declaration '%s'", p.tok.Literal, fnName) {
 			return nil
 		}
-		if p.errif(p.curis(token.LISTOF),
+		if p.errif(p.curis(token.LISTOF), "P088",
 			"illegal multi-dimensional list as return type in function declaration '%s'", fnName) {
 			return nil
 		}
 		frt.TypeOfList = p.tok
 	}
-	if p.errif(!(isReturnOrFunctionParamType(frt.Tok.Type)),
+	if p.errif(!(isReturnOrFunctionParamType(frt.Tok.Type)), "P089",
 		"invalid type '%s' as return type in function declaration '%s'", p.tok.Literal, fnName) {
 		return nil
 	}
+	if p.curis(token.FUN) {
+		if frt.Fun = p.parseFunctionType(); frt.Fun == nil {
+			return nil
+		}
+		p.unmove() // the last token of the type
+	}
 	p.move()
 	if p.curis(token.OPENING_CURLY) {
 		return frt
 	}
-	if p.errif(p.curnot(token.COMMA) && !(p.peekis(token.OPENING_CURLY)),
+	if p.errif(p.curnot(token.COMMA) && !(p.peekis(token.OPENING_CURLY)), "P090",
 		"missing comma between return types in function declaration '%s'", fnName) {
 		return nil
 	}
@@ -1290,13 +1950,13 @@ func (p *Parser) parseFunctionReturnType(fnName string) *ast.FunctionReturnType
 	if frt.IsList {
 		type_ = "listof " + frt.TypeOfList.Literal
 	}
-	if p.errif(p.curis(token.NEWLINE) && p.peekis(token.COMMA),
+	if p.errif(p.curis(token.NEWLINE) && p.peekis(token.COMMA), "P091",
 		"illegal newline after return type '%s' in function declaration '%s'", type_, fnName) {
 		return nil
 	}
 	stoppedAtComma := p.curis(token.COMMA)
 	redundantComma := stoppedAtComma && (p.peekis(token.OPENING_CURLY) || p.peekis(token.NEWLINE) && p.peekN(2).Type == token.OPENING_CURLY)
-	if p.errif(redundantComma, "redundant comma after return type '%s' in function declaration '%s'", type_, fnName) {
+	if p.errif(redundantComma, "P092", "redundant comma after return type '%s' in function declaration '%s'", type_, fnName) {
 		return nil
 	}
 	p.moveif(p.curis(token.COMMA))
@@ -1309,7 +1969,7 @@ func (p *Parser) parseFunctionReturnTypes(fnName string) (int, []ast.FunctionRet
 	rtx := []ast.FunctionReturnType{}
 	p.move()
 	for p.curnot(token.OPENING_CURLY) {
-		if p.errif(p.curis(token.EOF),
+		if p.errif(p.curis(token.EOF), "P093",
 			"unexpected end-of-file: missing function body in function declaration '%s'", fnName) {
 			return -1, nil
 		}
@@ -1324,21 +1984,21 @@ func (p *Parser) parseFunctionReturnTypes(fnName string) (int, []ast.FunctionRet
 
 func (p *Parser) parseFunctionDeclarationStatement() *ast.FunctionDeclarationStatement {
 	// current token is token.FUN
-	fds := &ast.FunctionDeclarationStatement{Tok: p.tok}
+	fds := &ast.FunctionDeclarationStatement{Tok: p.tok, Doc: p.docOf(p.tok)}
 	p.move()
 	line, col := p.tok.Line, p.tok.Col
 	isStmt := false
-	if p.errif(p.curnot(token.IDENT),
+	if p.errif(p.curnot(token.IDENT), "P094",
 		"unexpected token '%s' as function name where an identifier was expected", p.tok.Literal) {
 		return nil
 	}
 	if name := p.parseIdentifier(isStmt); name != nil {
 		fds.Name = name
 	}
-	if p.errif2(fds.Name == nil, newErr(line, col, "missing function name")) {
+	if p.errif2(fds.Name == nil, newErr("P095", line, col, "missing function name")) {
 		return nil
 	}
-	if p.errif(p.curnot(token.OPENING_PAREN),
+	if p.errif(p.curnot(token.OPENING_PAREN), "P096",
 		"unexpected token '%s', where a '(' was expected in function declaration '%s'",
 		p.tok.Literal, fds.Name) {
 		return nil
@@ -1369,14 +2029,14 @@ noparam:
 		return nil
 	}
 	// current token is '{'
-	if p.errif(p.curnot(token.OPENING_CURLY),
+	if p.errif(p.curnot(token.OPENING_CURLY), "P097",
 		"unexpected token '%s' in function '%s', where a '{' was expected as the beginning of body block",
 		p.tok.Literal, fds.Name) {
 		return nil
 	}
 	p.move()
 	for p.curnot(token.CLOSING_CURLY) {
-		if p.errif(p.curis(token.EOF),
+		if p.errif(p.curis(token.EOF), "P098",
 			"unexpected end-of-file: unclosed body of function '%s'", fds.Name) {
 			return nil
 		}
@@ -1385,6 +2045,8 @@ noparam:
 		}
 	}
 	p.move() // skip '}'
+	fds.End = p.prevEnd()
+	fds.Comment = p.commentAfter(fds.End)
 	return fds
 }
 
@@ -1393,27 +2055,27 @@ func (p *Parser) parseDatatypeLiteralField(literal string) *ast.DataypeLiteralFi
 	dlf := &ast.DataypeLiteralField{}
 	isStmt := false
 	line, col := p.tok.Line, p.tok.Col
-	if p.errif2(p.curnot(token.IDENT), newErr(line, col,
+	if p.errif2(p.curnot(token.IDENT), newErr("P099", line, col,
 		"unexpected token '%s' in datatype literal '%s', where an identifier was expected", p.tok.Literal, literal)) {
 		return nil
 	}
 	dlf.Name = p.parseIdentifier(isStmt)
-	if p.errif2(dlf.Name == nil, newErr(line, col, "missing field name in datatype literal '%s'", literal)) {
+	if p.errif2(dlf.Name == nil, newErr("P100", line, col, "missing field name in datatype literal '%s'", literal)) {
 		return nil
 	}
 	line, col = p.tok.Line, p.tok.Col
-	if p.errif2(p.curnot(token.EQUAL), newErr(line, col,
+	if p.errif2(p.curnot(token.EQUAL), newErr("P101", line, col,
 		"unexpected token '%s' after identifier in datatype literal '%s', where an '=' was expected", p.tok.Literal, literal)) {
 		return nil
 	}
 	// don't skip '=', because parseExpr checks p.peek().Type
-	if peek := p.peek(); p.errif2(!(isExpr(peek.Type)), newErr(line, col,
+	if peek := p.peek(); p.errif2(!(isExpr(peek.Type)), newErr("P102", line, col,
 		"unexpected token '%s' as value to '%s' in datatype literal '%s'", peek.Literal, dlf.Name, literal)) {
 		return nil
 	}
 	dlf.Value = p.parseExpr()
 	// is it possible ? I think not...
-	if p.errif2(dlf.Value == nil, newErr(line, col, "missing value to '%s' field in datatype literal '%s'", dlf.Name, literal)) {
+	if p.errif2(dlf.Value == nil, newErr("P103", line, col, "missing value to '%s' field in datatype literal '%s'", dlf.Name, literal)) {
 		return nil
 	}
 	p.eat(token.NEWLINE)
@@ -1430,7 +2092,7 @@ func (p *Parser) parseDatatypeLiteral(isStmt bool) *ast.DatatypeLiteral {
 	p.eat(token.NEWLINE)
 	literal := dl.Tok.Literal
 	for p.curnot(token.CLOSING_CURLY) {
-		if p.errif(p.curis(token.EOF),
+		if p.errif(p.curis(token.EOF), "P104",
 			"unexpected end-of-file: unclosed datatype literal '%s'", literal) {
 			return nil
 		}
@@ -1442,7 +2104,8 @@ func (p *Parser) parseDatatypeLiteral(isStmt bool) *ast.DatatypeLiteral {
 		p.eat(token.NEWLINE)
 	}
 	p.move()
-	if assertDot(p, isStmt, "unexpected token '%s' at the end of datatype literal '%s' where a dot was expected", p.tok.Literal, literal) {
+	dl.End = p.prevEnd()
+	if assertDot(p, isStmt, "P105", "unexpected token '%s' at the end of datatype literal '%s' where a dot was expected", p.tok.Literal, literal) {
 		return nil
 	}
 	return dl
@@ -6,6 +6,7 @@ import (
 	"quoi/lexer"
 	"quoi/token"
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -686,3 +687,452 @@ s		listof int nxx = "hey".
 	print_stmts(t, program)
 	print_errs(t, errs)
 }
+
+func TestSpan(t *testing.T) {
+	input := `fun f(int a) -> int {
+	return (+ a
+		1).
+}
+Stdout::println(f(5)).
+listof int nx = [1, 2].`
+	program, errs, _ := _parse(input)
+	check_error_count(t, errs, 0)
+	check_stmt_count(t, program, 3)
+	src := input
+	text := func(n ast.Node) string {
+		s := n.Span()
+		return src[s.Start.Offset:s.End.Offset]
+	}
+	fn := program.Stmts[0].(*ast.FunctionDeclarationStatement)
+	ret := fn.Stmts[0].(*ast.ReturnStatement)
+	call := program.Stmts[1].(*ast.FunctionCallFromNamespace)
+	list := program.Stmts[2].(*ast.ListVariableDeclarationStatement)
+	tests := []struct {
+		node ast.Node
+		want string
+	}{
+		{fn, input[:strings.Index(input, "}")+1]},
+		{ret, "return (+ a\n\t\t1)."},
+		{ret.ReturnValues[0], "(+ a\n\t\t1)"},
+		{call, "Stdout::println(f(5))"},
+		{call.Function.Args[0], "f(5)"},
+		{list, "listof int nx = [1, 2]."},
+		{list.List, "[1, 2]"},
+	}
+	for i, tt := range tests {
+		if got := text(tt.node); got != tt.want {
+			t.Errorf("#%d: want=%q got=%q", i, tt.want, got)
+		}
+	}
+	if s := ret.ReturnValues[0].Span(); s.Start.Line != 2 || s.Start.Col != 9 || s.End.Line != 3 || s.End.Col != 5 {
+		t.Errorf("wrong position of prefix expression: %+v", s)
+	}
+}
+
+func TestRecovery(t *testing.T) {
+	input := `int x = .
+int y = 5.
+fun f( {
+	int z = 1.
+}
+if true {
+	int q = = 4.
+	int w = 3.
+}
+string s = "ok".`
+	program, errs, _ := _parse(input)
+	print_errs(t, errs)
+	check_error_count(t, errs, 3)
+	wantLines := []uint{1, 3, 7}
+	for i, e := range errs {
+		if i < len(wantLines) && e.Line != wantLines[i] {
+			t.Errorf("err#%d: want line %d, got %d", i, wantLines[i], e.Line)
+		}
+	}
+	check_stmt_count(t, program, 5)
+	bad, ok := program.Stmts[0].(*ast.BadStatement)
+	if !(ok) {
+		t.Fatalf("expected *ast.BadStatement, got %T", program.Stmts[0])
+	}
+	if len(bad.Names) != 1 || bad.Names[0].String() != "x" {
+		t.Errorf("wrong declared names: %+v", bad.Names)
+	}
+	if _, ok := program.Stmts[1].(*ast.VariableDeclarationStatement); !(ok) {
+		t.Errorf("expected variable declaration, got %T", program.Stmts[1])
+	}
+	if _, ok := program.Stmts[2].(*ast.BadStatement); !(ok) {
+		t.Errorf("expected *ast.BadStatement, got %T", program.Stmts[2])
+	}
+	ifStmt, ok := program.Stmts[3].(*ast.IfStatement)
+	if !(ok) {
+		t.Fatalf("expected if statement, got %T", program.Stmts[3])
+	}
+	if len(ifStmt.Stmts) != 2 {
+		t.Errorf("expected 2 statements in if block, got %d", len(ifStmt.Stmts))
+	}
+	if _, ok := program.Stmts[4].(*ast.VariableDeclarationStatement); !(ok) {
+		t.Errorf("expected variable declaration, got %T", program.Stmts[4])
+	}
+}
+
+func TestRecoveryErrorCap(t *testing.T) {
+	var sb strings.Builder
+	for i := 0; i < maxErrors*2; i++ {
+		sb.WriteString("int x = .\n")
+	}
+	_, errs, _ := _parse(sb.String())
+	check_error_count(t, errs, maxErrors+1)
+	if last := errs[len(errs)-1]; last.Msg != "too many errors" {
+		t.Errorf("expected 'too many errors', got '%s'", last.Msg)
+	}
+}
+
+func TestRecoveryOneErrorPerStatement(t *testing.T) {
+	input := `int x = (+ 1 ) ) ) .
+int y = 1.`
+	program, errs, _ := _parse(input)
+	print_errs(t, errs)
+	check_error_count(t, errs, 1)
+	check_stmt_count(t, program, 2)
+}
+
+func TestParseExpr(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string // "" if the input is not an expression
+	}{
+		{"(+ 1 2)", "(+ 1 2)"},
+		{"\n(+ 1 2).\n", "(+ 1 2)"},
+		{"x", "x"},
+		{"f(1)", "f(1)"},
+		{"int x = 1.", ""},
+		{"x = 1.", ""},
+		{"1 2", ""},
+	}
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		expr := p.ParseExpr()
+		if tt.want == "" {
+			if expr != nil || len(p.Errs) == 0 {
+				t.Errorf("%q: expected an error", tt.input)
+			}
+			continue
+		}
+		if expr == nil || len(p.Errs) > 0 {
+			t.Errorf("%q: unexpected errors: %+v", tt.input, p.Errs)
+			continue
+		}
+		if expr.String() != tt.want {
+			t.Errorf("%q: want=%s got=%s", tt.input, tt.want, expr.String())
+		}
+	}
+}
+
+func TestComments(t *testing.T) {
+	input := `; the user
+;; of the program
+datatype User {
+	; name of the user
+	string name ; first, and last
+	int age
+} ; a datatype
+
+int x = 1. ; not a doc comment
+fun f() {
+	; body
+}
+
+; far away
+
+fun g() { } ; g
+`
+	l := lexer.New(input)
+	l.KeepComments = true
+	p := New(l)
+	program := p.Parse()
+	check_error_count(t, p.Errs, 0)
+	check_stmt_count(t, program, 4)
+	if len(program.Comments) != 8 {
+		t.Errorf("expected 8 comment groups, got %d", len(program.Comments))
+	}
+	dt := program.Stmts[0].(*ast.DatatypeDeclaration)
+	tests := []struct {
+		what string
+		got  *ast.CommentGroup
+		want string
+	}{
+		{"datatype doc", dt.Doc, "the user\nof the program"},
+		{"datatype comment", dt.Comment, "a datatype"},
+		{"field doc", dt.Fields[0].Doc, "name of the user"},
+		{"field comment", dt.Fields[0].Comment, "first, and last"},
+		{"field doc", dt.Fields[1].Doc, ""},
+		{"field comment", dt.Fields[1].Comment, ""},
+		{"f doc", program.Stmts[2].(*ast.FunctionDeclarationStatement).Doc, ""},
+		{"g doc", program.Stmts[3].(*ast.FunctionDeclarationStatement).Doc, ""},
+		{"g comment", program.Stmts[3].(*ast.FunctionDeclarationStatement).Comment, "g"},
+	}
+	for _, tt := range tests {
+		if got := tt.got.Text(); got != tt.want {
+			t.Errorf("%s: want=%q got=%q", tt.what, tt.want, got)
+		}
+	}
+	// comments don't change the program
+	want, _, _ := _parse(input)
+	for i, s := range want.Stmts {
+		if s.String() != program.Stmts[i].String() {
+			t.Errorf("%d: want=%s got=%s", i, s, program.Stmts[i])
+		}
+	}
+	if len(want.Comments) != 0 {
+		t.Errorf("comments are kept by default")
+	}
+}
+
+func TestSumType(t *testing.T) {
+	input := `datatype Shape = Circle { int r } | Rect { int w int h }
+datatype Result =
+	| Ok { string value }
+	| Err {
+		string msg
+		int code
+	}
+	| Empty
+`
+	program, errs, _ := _parse(input)
+	print_errs(t, errs)
+	check_error_count(t, errs, 0)
+	check_stmt_count(t, program, 2)
+	tests := []struct {
+		variants []string
+		fields   []int
+	}{
+		{[]string{"Circle", "Rect"}, []int{1, 2}},
+		{[]string{"Ok", "Err", "Empty"}, []int{1, 2, 0}},
+	}
+	for i, tt := range tests {
+		dt := program.Stmts[i].(*ast.DatatypeDeclaration)
+		if len(dt.Fields) != 0 {
+			t.Errorf("%s: a sum type has no fields", dt.Name)
+		}
+		if len(dt.Variants) != len(tt.variants) {
+			t.Fatalf("%s: want %d variants, got %d", dt.Name, len(tt.variants), len(dt.Variants))
+		}
+		for j, v := range dt.Variants {
+			if v.Name.String() != tt.variants[j] || len(v.Fields) != tt.fields[j] {
+				t.Errorf("%s: want variant %s with %d fields, got %s", dt.Name, tt.variants[j], tt.fields[j], v)
+			}
+		}
+	}
+	want := "datatype Shape = Circle { int r } | Rect { int w int h }"
+	if got := program.Stmts[0].String(); got != want {
+		t.Errorf("want=%q got=%q", want, got)
+	}
+}
+
+func TestMatch(t *testing.T) {
+	input := `match s {
+	Circle c {
+		Stdout::println("circle").
+	}
+	Rect { }
+	else {
+		break.
+	}
+}
+match Ok{value="x"} {
+	Ok o { }
+}`
+	program, errs, _ := _parse(input)
+	print_errs(t, errs)
+	check_error_count(t, errs, 0)
+	check_stmt_count(t, program, 2)
+	m := program.Stmts[0].(*ast.MatchStatement)
+	if m.Value.String() != "s" || len(m.Arms) != 2 || m.Default == nil {
+		t.Fatalf("wrong match statement: %s", m)
+	}
+	if m.Arms[0].Variant.String() != "Circle" || m.Arms[0].Name.String() != "c" || len(m.Arms[0].Stmts) != 1 {
+		t.Errorf("wrong first arm: %s", m.Arms[0])
+	}
+	if m.Arms[1].Variant.String() != "Rect" || m.Arms[1].Name != nil || len(m.Arms[1].Stmts) != 0 {
+		t.Errorf("wrong second arm: %s", m.Arms[1])
+	}
+	if _, ok := program.Stmts[1].(*ast.MatchStatement).Value.(*ast.DatatypeLiteral); !(ok) {
+		t.Errorf("expected a datatype literal as the value, got %s", program.Stmts[1].(*ast.MatchStatement).Value)
+	}
+}
+
+func TestSumTypeAndMatchErrors(t *testing.T) {
+	tests := []struct {
+		input, code string
+	}{
+		{"datatype Shape = \n", "P111"},
+		{"datatype Shape = Circle { int r ", "P112"},
+		{"datatype Shape = Circle { 5 }", "P113"},
+		{"datatype Shape = Circle { int }", "P114"},
+		{"match . { }", "P115"},
+		{"match s Circle { }", "P117"},
+		{"match s { Circle { }", "P118"},
+		{"match s { Circle {\nint x = 1.", "P133"},
+		{"match s { else { } Circle { } }", "P119"},
+		{"match s { 5 { } }", "P120"},
+		{"match s { Circle c d { } }", "P121"},
+	}
+	for _, tt := range tests {
+		_, errs, _ := _parse(tt.input)
+		if len(errs) == 0 || errs[0].Code != tt.code {
+			t.Errorf("%q: want error %s, got %v", tt.input, tt.code, errs)
+		}
+	}
+}
+
+func TestEnum(t *testing.T) {
+	input := `enum Color { Red Green Blue }
+enum Direction {
+	Up
+	Down
+}
+Color c = Color::Green.
+listof Color all = Color::members().
+bool b = (= c Color::Red).
+`
+	program, errs, _ := _parse(input)
+	print_errs(t, errs)
+	check_error_count(t, errs, 0)
+	check_stmt_count(t, program, 5)
+	tests := []struct {
+		name    string
+		members []string
+	}{
+		{"Color", []string{"Red", "Green", "Blue"}},
+		{"Direction", []string{"Up", "Down"}},
+	}
+	for i, tt := range tests {
+		e := program.Stmts[i].(*ast.EnumDeclaration)
+		if e.Name.String() != tt.name || len(e.Members) != len(tt.members) {
+			t.Fatalf("want enum %s with %d members, got %s", tt.name, len(tt.members), e)
+		}
+		for j, m := range e.Members {
+			if m.String() != tt.members[j] {
+				t.Errorf("%s: want member %s, got %s", e.Name, tt.members[j], m)
+			}
+		}
+	}
+	want := "enum Color { Red Green Blue }"
+	if got := program.Stmts[0].String(); got != want {
+		t.Errorf("want=%q got=%q", want, got)
+	}
+	m, ok := program.Stmts[2].(*ast.VariableDeclarationStatement).Value.(*ast.EnumMember)
+	if !(ok) || m.String() != "Color::Green" {
+		t.Errorf("expected the member Color::Green, got %s", program.Stmts[2].(*ast.VariableDeclarationStatement).Value)
+	}
+	// a call with the name of an enum as the namespace isn't a member
+	if _, ok := program.Stmts[3].(*ast.ListVariableDeclarationStatement).List.(*ast.FunctionCallFromNamespace); !(ok) {
+		t.Errorf("expected a function call, got %s", program.Stmts[3].(*ast.ListVariableDeclarationStatement).List)
+	}
+	cmp := program.Stmts[4].(*ast.VariableDeclarationStatement).Value.(*ast.PrefixExpr)
+	if _, ok := cmp.Args[1].(*ast.EnumMember); !(ok) {
+		t.Errorf("expected the member Color::Red, got %s", cmp.Args[1])
+	}
+}
+
+func TestEnumErrors(t *testing.T) {
+	tests := []struct {
+		input, code string
+	}{
+		{"enum { Red }", "P122"},
+		{"enum Color Red Green", "P123"},
+		{"enum Color { Red Green", "P124"},
+		{"enum Color { Red, Green }", "P125"},
+		{"enum Color { }", "P126"},
+	}
+	for _, tt := range tests {
+		_, errs, _ := _parse(tt.input)
+		if len(errs) == 0 || errs[0].Code != tt.code {
+			t.Errorf("%q: want error %s, got %v", tt.input, tt.code, errs)
+		}
+	}
+}
+
+func TestConst(t *testing.T) {
+	input := `const int MAX = (* 60 60).
+const listof string NAMES = ["a", "b"].
+const Color C = Color::Red.
+`
+	program, errs, _ := _parse(input)
+	print_errs(t, errs)
+	check_error_count(t, errs, 0)
+	check_stmt_count(t, program, 3)
+	for i, want := range []string{"const int MAX = (* 60 60)", `const listof string NAMES = ["a", "b"].`, "const Color C = Color::Red"} {
+		c, ok := program.Stmts[i].(*ast.ConstDeclaration)
+		if !(ok) {
+			t.Fatalf("expected a constant declaration, got %T", program.Stmts[i])
+		}
+		if got := c.String(); got != want {
+			t.Errorf("want=%q got=%q", want, got)
+		}
+	}
+	if _, ok := program.Stmts[1].(*ast.ConstDeclaration).Decl.(*ast.ListVariableDeclarationStatement); !(ok) {
+		t.Errorf("expected a list declaration, got %T", program.Stmts[1].(*ast.ConstDeclaration).Decl)
+	}
+}
+
+func TestConstErrors(t *testing.T) {
+	tests := []struct {
+		input, code string
+	}{
+		{"const = 1.", "P127"},
+		{"const 1.", "P127"},
+		{"const int a, int b = 1, 2.", "P128"},
+	}
+	for _, tt := range tests {
+		_, errs, _ := _parse(tt.input)
+		if len(errs) == 0 || errs[0].Code != tt.code {
+			t.Errorf("%q: want error %s, got %v", tt.input, tt.code, errs)
+		}
+	}
+}
+
+func TestFunctionType(t *testing.T) {
+	input := `fun apply(fun(int, int) -> int f, listof fun(int) g) -> fun() -> (int, bool) {
+	return h.
+}
+fun(int, int) -> bool less = lt2.
+listof fun(string) fs = [print].
+fun(fun(int) -> int) -> listof int m, int n = map, 1.
+datatype Op {
+	fun(int, int) -> int run
+}
+`
+	program, errs, _ := _parse(input)
+	print_errs(t, errs)
+	check_error_count(t, errs, 0)
+	check_stmt_count(t, program, 5)
+	want := []string{
+		"fun apply(fun(int, int) -> int f, listof fun(int) g) -> fun() -> (int, bool)",
+		"fun(int, int) -> bool less = lt2",
+		"listof fun(string) fs = [print].",
+		"fun(fun(int) -> int) -> listof int m , int n  = map, 1.",
+		"datatype Op {\n\tfun(int, int) -> int run\n}",
+	}
+	for i, stmt := range program.Stmts {
+		if got := stmt.String(); !(strings.HasPrefix(got, want[i])) {
+			t.Errorf("want=%q got=%q", want[i], got)
+		}
+	}
+}
+
+func TestFunctionTypeErrors(t *testing.T) {
+	tests := []struct {
+		input, code string
+	}{
+		{"fun(int -> int f = g.", "P131"},
+		{"fun(int) -> () f = g.", "P130"},
+		{"fun(1) f = g.", "P132"},
+	}
+	for _, tt := range tests {
+		_, errs, _ := _parse(tt.input)
+		if len(errs) == 0 || errs[0].Code != tt.code {
+			t.Errorf("%q: want error %s, got %v", tt.input, tt.code, errs)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+// Package quoi compiles Quoi programs to Go.
+//
+// Compile never panics, nor exits the process; every error is returned as a
+// diagnostic. It doesn't share state between calls, so it's safe to call it
+// concurrently.
+package quoi
+
+import (
+	"context"
+	"path/filepath"
+	"quoi/analyzer"
+	"quoi/ast"
+	"quoi/diagnostic"
+	"quoi/generator"
+	"quoi/lexer"
+	"quoi/parser"
+)
+
+// a Quoi source file
+type Source struct {
+	// file name shown in diagnostics, and in the //line directives of the
+	// generated Go code (made absolute). it may be empty.
+	Name string
+	Text string
+}
+
+type Options struct {
+	// stop after parsing. Result.IR, and Result.Go are left empty.
+	ParseOnly bool
+	// stop after typechecking. Result.Go is left empty.
+	CheckOnly bool
+	// keep the comments in Result.AST (ast.Program.Comments, and the Doc, and
+	// Comment fields of declarations).
+	Comments bool
+	// if not nil, the analyzer records the declarations, and the references of
+	// the program in it (see analyzer.Info).
+	Info *analyzer.Info
+}
+
+// output of the phases that ran
+type Result struct {
+	AST *ast.Program
+	IR  *analyzer.IRProgram
+	// the generated Go program (package main)
+	Go string
+}
+
+// diagnostics sorted by position
+type Diagnostics []diagnostic.Diagnostic
+
+func (ds Diagnostics) HasErrors() bool {
+	for _, d := range ds {
+		if d.Severity == diagnostic.Error {
+			return true
+		}
+	}
+	return false
+}
+
+// Compile runs the lexer, the parser, the analyzer, and the generator on src.
+//
+// the analyzer runs even if there are parser errors, so that all errors are
+// reported at once. Go code is generated only if there are no errors.
+// if ctx is done, Compile stops before the next phase.
+func Compile(ctx context.Context, src Source, opts Options) (res Result, ds Diagnostics) {
+	defer func() {
+		if r := recover(); r != nil {
+			res = Result{}
+			d := diagnostic.New(diagnostic.Compiler, "C001", 0, 0, "internal compiler error: %v", r)
+			// not the stack trace; it means nothing to the user
+			d.Notes = []string{"this is a bug in the compiler; please report it with the program that caused it"}
+			ds = append(ds, d)
+		}
+		diagnostic.SetFile(ds, src.Name)
+		diagnostic.Sort(ds)
+	}()
+	canceled := func() bool {
+		if err := ctx.Err(); err != nil {
+			ds = append(ds, diagnostic.New(diagnostic.Compiler, "C002", 0, 0, "compilation stopped: %s", err.Error()))
+			return true
+		}
+		return false
+	}
+
+	if canceled() {
+		return res, ds
+	}
+	l := lexer.New(src.Text)
+	l.KeepComments = opts.Comments
+	p := parser.New(l)
+	if len(l.Errs) > 0 {
+		return res, append(ds, l.Errs...)
+	}
+	res.AST = p.Parse()
+	ds = append(ds, p.Errs...)
+	if opts.ParseOnly || canceled() {
+		return res, ds
+	}
+
+	a := analyzer.New(res.AST)
+	a.Info = opts.Info
+	ir := a.Analyze()
+	ds = append(ds, a.Errs...)
+	if ds.HasErrors() {
+		return res, ds
+	}
+	res.IR = ir
+	if opts.CheckOnly || canceled() {
+		return res, ds
+	}
+
+	g := generator.New(ir)
+	if src.Name != "" {
+		// the Go program is built in another directory
+		g.File = src.Name
+		if abs, err := filepath.Abs(src.Name); err == nil {
+			g.File = abs
+		}
+	}
+	res.Go = g.Generate()
+	return res, ds
+}
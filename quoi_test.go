@@ -0,0 +1,120 @@
+package quoi
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestCompile(t *testing.T) {
+	src := Source{Name: "main.q", Text: `
+		int x = Math::pow(2, 10).
+		Stdout::println(String::from_int(x)).
+	`}
+	res, ds := Compile(context.Background(), src, Options{})
+	if len(ds) > 0 {
+		t.Fatalf("unexpected diagnostics: %+v", ds)
+	}
+	if res.AST == nil || res.IR == nil {
+		t.Errorf("AST, or IR is missing")
+	}
+	if !(strings.Contains(res.Go, "func main()")) {
+		t.Errorf("no Go code generated:\n%s", res.Go)
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		codes []string
+	}{
+		{"empty", "", nil},
+		{"lexer", `string s = "\q".`, []string{"L006"}},
+		{"parser and analyzer", "int x = .\nstring y = 5.", []string{"P017", "A016"}},
+		{"argument of an argument", "Stdout::println(String::from_int(Math::sqrt(nx))).", []string{"A033"}},
+		{"member of an undeclared enum in an argument", "int n = Math::sqrt(Math::pow(Colour::Red, 2)).", []string{"A104"}},
+		{"undeclared datatype in an argument", "fun f(int a) -> int {\n\treturn a.\n}\nint n = f(f(Foo{})).", []string{"A034"}},
+	}
+	for _, tt := range tests {
+		res, ds := Compile(context.Background(), Source{Name: "a.q", Text: tt.input}, Options{})
+		if len(ds) != len(tt.codes) {
+			t.Errorf("%s: want %d diagnostic(s), got %+v", tt.name, len(tt.codes), ds)
+			continue
+		}
+		for i, d := range ds {
+			if d.Code != tt.codes[i] {
+				t.Errorf("%s: #%d: want code %s, got %s", tt.name, i, tt.codes[i], d.Code)
+			}
+			if d.File != "a.q" {
+				t.Errorf("%s: #%d: file is not set", tt.name, i)
+			}
+		}
+		if ds.HasErrors() && res.Go != "" {
+			t.Errorf("%s: Go code generated despite errors", tt.name)
+		}
+	}
+}
+
+func TestCompileOptions(t *testing.T) {
+	src := Source{Text: "int x = 1."}
+	res, _ := Compile(context.Background(), src, Options{ParseOnly: true})
+	if res.AST == nil || res.IR != nil || res.Go != "" {
+		t.Errorf("ParseOnly: %+v", res)
+	}
+	res, _ = Compile(context.Background(), src, Options{CheckOnly: true})
+	if res.AST == nil || res.IR == nil || res.Go != "" {
+		t.Errorf("CheckOnly: %+v", res)
+	}
+}
+
+func TestCompileCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	res, ds := Compile(ctx, Source{Text: "int x = 1."}, Options{})
+	if len(ds) != 1 || ds[0].Code != "C002" {
+		t.Errorf("want a C002 diagnostic, got %+v", ds)
+	}
+	if res.Go != "" {
+		t.Errorf("Go code generated after cancellation")
+	}
+}
+
+func TestCompileConcurrent(t *testing.T) {
+	src := Source{Text: `
+		datatype User {
+			string name
+		}
+		fun greet(User u) -> string {
+			return String::concat("hello, ", (get u name)).
+		}
+		listof int nx = [1, 2, 3].
+		int i = 0.
+		loop (lt i 3) {
+			Stdout::println(String::from_int((' nx i))).
+			i = (+ i 1).
+		}
+	`}
+	want, ds := Compile(context.Background(), src, Options{})
+	if len(ds) > 0 {
+		t.Fatalf("unexpected diagnostics: %+v", ds)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 32; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			got, ds := Compile(context.Background(), src, Options{})
+			if len(ds) > 0 || got.Go != want.Go {
+				t.Errorf("different result from a concurrent call")
+			}
+			// errors too
+			_, ds = Compile(context.Background(), Source{Text: "int x = \"s\"."}, Options{})
+			if len(ds) != 1 {
+				t.Errorf("want 1 diagnostic, got %d", len(ds))
+			}
+		}()
+	}
+	wg.Wait()
+}
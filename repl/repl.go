@@ -0,0 +1,271 @@
+// interactive Quoi
+//
+// every input is typechecked in the environment (analyzer.ScopeStack) of the
+// previous inputs, and run by an interpreter that keeps the variables, the
+// functions, and the datatypes of the previous inputs. a Go toolchain isn't
+// needed.
+package repl
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"quoi/analyzer"
+	"quoi/ast"
+	"quoi/diagnostic"
+	"quoi/interp"
+	"quoi/lexer"
+	"quoi/parser"
+	"quoi/token"
+	"quoi/types"
+	"strings"
+)
+
+const (
+	prompt     = "quoi> "
+	contPrompt = "...   "
+)
+
+const help = `Enter statements, or expressions to print their values.
+Commands:
+	:type <expr>   print the type of an expression
+	:ast [code]    print the AST of code, or of the session
+	:ir [code]     print the IR of code, or of the session
+	:reset         forget every statement
+	:help          print this message
+	:quit          exit (or Ctrl-D)
+`
+
+type REPL struct {
+	out, errOut io.Writer
+
+	env   *analyzer.ScopeStack
+	in    *interp.Interpreter
+	stmts []ast.Statement
+	ir    []analyzer.IRStatement
+}
+
+func New(out, errOut io.Writer) *REPL {
+	r := &REPL{out: out, errOut: errOut}
+	r.reset()
+	return r
+}
+
+func (r *REPL) reset() {
+	r.env = analyzer.NewScopeStack()
+	r.in = interp.New(r.out)
+	r.stmts, r.ir = nil, nil
+}
+
+// Run reads inputs from in until EOF, or ':quit'.
+func (r *REPL) Run(in io.Reader) {
+	sc := bufio.NewScanner(in)
+	fmt.Fprint(r.out, prompt)
+	var input strings.Builder
+	for sc.Scan() {
+		input.WriteString(sc.Text())
+		input.WriteByte('\n')
+		if !(complete(input.String())) {
+			fmt.Fprint(r.out, contPrompt)
+			continue
+		}
+		text := input.String()
+		input.Reset()
+		if strings.TrimSpace(text) == ":quit" {
+			return
+		}
+		r.Eval(text)
+		fmt.Fprint(r.out, prompt)
+	}
+	fmt.Fprintln(r.out)
+}
+
+// an input is complete if every bracket, and block is closed; and it doesn't
+// end with '=', or '|' (the variants of a sum type may follow on the next lines).
+func complete(input string) bool {
+	l := lexer.New(input)
+	depth := 0
+	var last token.Type
+	for {
+		t := l.Next()
+		switch t.Type {
+		case token.EOF:
+			if last == token.EQUAL || last == token.PIPE {
+				return len(l.Errs) > 0
+			}
+			return depth <= 0 || len(l.Errs) > 0
+		case token.OPENING_CURLY, token.OPENING_PAREN, token.OPENING_SQUARE_BRACKET, token.BLOCK:
+			depth++
+		case token.CLOSING_CURLY, token.CLOSING_PAREN, token.CLOSING_SQUARE_BRACKET, token.END:
+			depth--
+		}
+		if t.Type != token.NEWLINE {
+			last = t.Type
+		}
+	}
+}
+
+// Eval evaluates a single input; a command, statements, or an expression.
+func (r *REPL) Eval(input string) {
+	trimmed := strings.TrimSpace(input)
+	if trimmed == "" {
+		return
+	}
+	if strings.HasPrefix(trimmed, ":") {
+		r.command(trimmed)
+		return
+	}
+	if expr, ok := r.parseExpr(input); ok {
+		r.evalExpr(input, expr)
+		return
+	}
+	r.evalStmts(input)
+}
+
+func (r *REPL) command(input string) {
+	cmd, arg := input, ""
+	if i := strings.IndexAny(input, " \t\n"); i >= 0 {
+		cmd, arg = input[:i], strings.TrimSpace(input[i:])
+	}
+	switch cmd {
+	case ":type":
+		expr, ok := r.parseExpr(arg)
+		if !(ok) {
+			r.report(arg, r.parseErrs(arg))
+			return
+		}
+		a := analyzer.NewWithEnv(&ast.Program{}, r.env.Copy())
+		show := a.AnalyzeExpr(expr)
+		if len(a.Errs) > 0 {
+			r.report(arg, a.Errs)
+			return
+		}
+		fmt.Fprintln(r.out, show.Type)
+	case ":ast":
+		stmts := r.stmts
+		if arg != "" {
+			prg, errs := parse(arg)
+			if len(errs) > 0 {
+				r.report(arg, errs)
+				return
+			}
+			stmts = prg.Stmts
+		}
+		for _, s := range stmts {
+			fmt.Fprintln(r.out, s.String())
+		}
+	case ":ir":
+		ir := r.ir
+		if arg != "" {
+			var ok bool
+			_, ir, ok = r.analyze(arg, r.env.Copy())
+			if !(ok) {
+				return
+			}
+		}
+		fmt.Fprintln(r.out, (&analyzer.IRProgram{Stmts: ir}).String())
+	case ":reset":
+		r.reset()
+	case ":help":
+		fmt.Fprint(r.out, help)
+	default:
+		fmt.Fprintf(r.errOut, "unknown command '%s'. see ':help'.\n", cmd)
+	}
+}
+
+func parse(input string) (*ast.Program, []diagnostic.Diagnostic) {
+	l := lexer.New(input)
+	p := parser.New(l)
+	if len(l.Errs) > 0 {
+		return nil, l.Errs
+	}
+	prg := p.Parse()
+	return prg, p.Errs
+}
+
+// ok if input is a single expression
+func (r *REPL) parseExpr(input string) (ast.Expr, bool) {
+	p := parser.New(lexer.New(input))
+	expr := p.ParseExpr()
+	return expr, expr != nil && len(p.Errs) == 0
+}
+
+func (r *REPL) parseErrs(input string) []diagnostic.Diagnostic {
+	l := lexer.New(input)
+	p := parser.New(l)
+	p.ParseExpr()
+	return append(l.Errs, p.Errs...)
+}
+
+// parse, and typecheck input in env. errors are reported.
+func (r *REPL) analyze(input string, env *analyzer.ScopeStack) (*ast.Program, []analyzer.IRStatement, bool) {
+	prg, errs := parse(input)
+	if len(errs) > 0 {
+		r.report(input, errs)
+		return nil, nil, false
+	}
+	a := analyzer.NewWithEnv(prg, env)
+	ir := a.Analyze()
+	if len(a.Errs) > 0 {
+		r.report(input, a.Errs)
+		return nil, nil, false
+	}
+	return prg, ir.Stmts, true
+}
+
+func (r *REPL) evalStmts(input string) {
+	// the environment is changed only if the input is valid
+	env := r.env.Copy()
+	prg, ir, ok := r.analyze(input, env)
+	if !(ok) {
+		return
+	}
+	if !(r.run(ir)) {
+		return
+	}
+	r.env = env
+	r.stmts = append(r.stmts, prg.Stmts...)
+	r.ir = append(r.ir, ir...)
+}
+
+func (r *REPL) evalExpr(input string, expr ast.Expr) {
+	a := analyzer.NewWithEnv(&ast.Program{}, r.env.Copy())
+	show := a.AnalyzeExpr(expr)
+	if len(a.Errs) > 0 {
+		r.report(input, a.Errs)
+		return
+	}
+	if !(r.run([]analyzer.IRStatement{show})) {
+		return
+	}
+	// a call to a function that returns nothing is a statement of the session;
+	// the other expressions are not kept.
+	if show.Type == types.Void {
+		r.ir = append(r.ir, show)
+		if s, ok := expr.(ast.Statement); ok {
+			r.stmts = append(r.stmts, s)
+		}
+	}
+}
+
+// run ir in the state of the previous inputs. false if it failed; then what it
+// did before the runtime error is undone, like its declarations are forgotten
+// by the typechecker. only its output stays.
+func (r *REPL) run(ir []analyzer.IRStatement) bool {
+	saved := r.in.Save()
+	err := r.in.Run(&analyzer.IRProgram{Stmts: ir})
+	if err == nil {
+		return true
+	}
+	r.in.Restore(saved)
+	fmt.Fprintf(r.errOut, "panic: %s\n", err.Error())
+	if pos := err.(*interp.RuntimeError).Pos; pos.Line > 0 {
+		fmt.Fprintf(r.errOut, "\t%d:%d\n", pos.Line, pos.Col)
+	}
+	return false
+}
+
+func (r *REPL) report(input string, ds []diagnostic.Diagnostic) {
+	diagnostic.Sort(ds)
+	diagnostic.RenderAll(r.errOut, input, ds)
+}
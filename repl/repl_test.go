@@ -0,0 +1,138 @@
+package repl
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestComplete(t *testing.T) {
+	tests := []struct {
+		input string
+		want  bool
+	}{
+		{"int x = 5.", true},
+		{"fun f() {", false},
+		{"fun f() {\n}", true},
+		{"block", false},
+		{"block\nint x = 1.\nend", true},
+		{"(+ 1", false},
+		{`string s = "{".`, true},
+		// the variants of a sum type may be on the next lines
+		{"datatype S =", false},
+		{"datatype S = A { int x } |", false},
+		{"datatype S =\n    A |\n    B", true},
+	}
+	for _, tt := range tests {
+		if got := complete(tt.input); got != tt.want {
+			t.Errorf("complete(%q): want=%t got=%t", tt.input, tt.want, got)
+		}
+	}
+}
+
+func TestTypeCommand(t *testing.T) {
+	var out, errOut bytes.Buffer
+	r := New(&out, &errOut)
+	// doesn't need Go; nothing is run.
+	r.Eval(":type (+ 1 2)")
+	r.Eval(":type [\"a\"]")
+	r.Eval(":type String::index(\"ab\", \"b\")")
+	r.Eval(":type nope")
+	if want := "int\nlistof string\nint\n"; out.String() != want {
+		t.Errorf("want:\n%s\ngot:\n%s", want, out.String())
+	}
+	if !(strings.Contains(errOut.String(), "reference to non-existent variable 'nope'")) {
+		t.Errorf("unexpected errors: %s", errOut.String())
+	}
+}
+
+func TestSession(t *testing.T) {
+	input := `int x = 5.
+(+ x 1)
+Stdout::println("once").
+fun double(int n) -> int {
+	return (* n 2).
+}
+double(x)
+int y = z.
+:type double(1)
+:reset
+x
+`
+	var out, errOut bytes.Buffer
+	New(&out, &errOut).Run(strings.NewReader(input))
+	got := strings.ReplaceAll(strings.ReplaceAll(out.String(), prompt, ""), contPrompt, "")
+	// "once" is printed only once; an input is run only when it's entered.
+	want := "6\nonce\n10\nint\n\n"
+	if got != want {
+		t.Errorf("want:\n%q\ngot:\n%q", want, got)
+	}
+	errs := errOut.String()
+	if !(strings.Contains(errs, "1:9 TypeError: reference to non-existent variable 'z'")) {
+		t.Errorf("missing error for 'z': %s", errs)
+	}
+	// after :reset, x is gone
+	if !(strings.Contains(errs, "reference to non-existent variable 'x'")) {
+		t.Errorf("missing error for 'x': %s", errs)
+	}
+}
+
+func TestState(t *testing.T) {
+	input := `int n = 0.
+fun inc() -> int {
+	n = (+ n 1).
+	return n.
+}
+inc()
+inc()
+n = (* n 10).
+int m = (/ n 0).
+n
+m
+`
+	var out, errOut bytes.Buffer
+	New(&out, &errOut).Run(strings.NewReader(input))
+	got := strings.ReplaceAll(strings.ReplaceAll(out.String(), prompt, ""), contPrompt, "")
+	// the state of the session is kept between inputs; a failed input declares nothing
+	if want := "1\n2\n20\n\n"; got != want {
+		t.Errorf("want:\n%q\ngot:\n%q", want, got)
+	}
+	errs := errOut.String()
+	if !(strings.Contains(errs, "panic: runtime error: integer divide by zero\n\t1:9\n")) {
+		t.Errorf("missing runtime error: %s", errs)
+	}
+	if !(strings.Contains(errs, "reference to non-existent variable 'm'")) {
+		t.Errorf("missing error for 'm': %s", errs)
+	}
+}
+
+func TestFailedInput(t *testing.T) {
+	input := `int n = 1.
+fun put(int v) {
+	n = v.
+}
+int k = 7. put(5). fun f() -> int { return k. } int d = (/ k 0).
+n
+k
+string k = "seven".
+k
+f()
+`
+	var out, errOut bytes.Buffer
+	New(&out, &errOut).Run(strings.NewReader(input))
+	got := strings.ReplaceAll(strings.ReplaceAll(out.String(), prompt, ""), contPrompt, "")
+	// the failed input is undone in the interpreter, like in the typechecker
+	if want := "1\n\"seven\"\n\n"; got != want {
+		t.Errorf("want:\n%q\ngot:\n%q", want, got)
+	}
+	errs := errOut.String()
+	if !(strings.Contains(errs, "panic: runtime error: integer divide by zero\n")) {
+		t.Errorf("missing runtime error: %s", errs)
+	}
+	if !(strings.Contains(errs, "reference to non-existent variable 'k'")) {
+		t.Errorf("missing error for 'k': %s", errs)
+	}
+	if !(strings.Contains(errs, "'f'")) {
+		t.Errorf("missing error for 'f': %s", errs)
+	}
+}
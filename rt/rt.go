@@ -0,0 +1,70 @@
+// what the interpreter (interp), and the bytecode VM (bytecode) share at
+// runtime; so both behave like the Go programs that the generator produces.
+package rt
+
+import (
+	"fmt"
+	"quoi/token"
+	"runtime"
+	"strings"
+)
+
+// a runtime error stops the program. it's the panic message the Go program would print.
+type Error struct {
+	Msg string
+	Pos token.Pos // where in the Quoi source it happened; zero if unknown
+}
+
+func (e *Error) Error() string {
+	return e.Msg
+}
+
+// ToError returns the runtime error for r, a recovered panic. runtime errors
+// of Go (division by zero, index out of range, ...) keep their messages.
+// standard library functions panic with strings.
+func ToError(r interface{}) *Error {
+	switch r := r.(type) {
+	case *Error:
+		return r
+	case runtime.Error:
+		return &Error{Msg: r.Error()}
+	case string:
+		return &Error{Msg: r}
+	}
+	return &Error{Msg: fmt.Sprint(r)}
+}
+
+// a value of a datatype
+type Struct interface {
+	// in the order of their declaration
+	FieldValues() []interface{}
+}
+
+// Format formats v like Go's fmt.Print formats the Go counterpart of v.
+func Format(v interface{}) string {
+	switch v := v.(type) {
+	case []interface{}:
+		var strs []string
+		for _, elem := range v {
+			strs = append(strs, Format(elem))
+		}
+		return "[" + strings.Join(strs, " ") + "]"
+	case Struct:
+		var strs []string
+		for _, field := range v.FieldValues() {
+			strs = append(strs, Format(field))
+		}
+		return "{" + strings.Join(strs, " ") + "}"
+	}
+	return fmt.Sprint(v)
+}
+
+// Index returns the element i of a list, or the character i of a string;
+// strings are indexed by characters, not by bytes. it panics with Go's own
+// runtime error if i is out of range.
+func Index(v interface{}, i int) interface{} {
+	if s, ok := v.(string); ok {
+		return string([]rune(s)[i])
+	}
+	return v.([]interface{})[i]
+}
@@ -0,0 +1,54 @@
+package rt
+
+import (
+	"errors"
+	"testing"
+)
+
+type pair struct {
+	a, b interface{}
+}
+
+func (p pair) FieldValues() []interface{} {
+	return []interface{}{p.a, p.b}
+}
+
+func TestFormat(t *testing.T) {
+	v := []interface{}{pair{"Jen", []interface{}{1, 2}}, pair{"", []interface{}{}}, true}
+	if got := Format(v); got != "[{Jen [1 2]} { []} true]" {
+		t.Errorf("got %q", got)
+	}
+}
+
+// the message of a recovered panic
+func recovered(f func()) (msg string) {
+	defer func() {
+		msg = ToError(recover()).Msg
+	}()
+	f()
+	return ""
+}
+
+func TestIndex(t *testing.T) {
+	if got := Index("ğüş", 1); got != "ü" {
+		t.Errorf("got %q", got)
+	}
+	if got := Index([]interface{}{1, 2}, 1); got != 2 {
+		t.Errorf("got %v", got)
+	}
+	tests := []struct {
+		f    func()
+		want string
+	}{
+		{func() { Index("ğü", 2) }, "runtime error: index out of range [2] with length 2"},
+		{func() { Index([]interface{}{}, -1) }, "runtime error: index out of range [-1]"},
+		{func() { panic("Math::mod: division by zero") }, "Math::mod: division by zero"},
+		{func() { panic(&Error{Msg: "stack overflow"}) }, "stack overflow"},
+		{func() { panic(errors.New("other")) }, "other"},
+	}
+	for _, tt := range tests {
+		if got := recovered(tt.f); got != tt.want {
+			t.Errorf("want %q, got %q", tt.want, got)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package std
+
+import "strconv"
+
+// helpers of the Native implementations. they behave exactly like the Go implementations.
+
+func pow(n, n2 int) int {
+	if n2 < 0 {
+		switch n {
+		case 0:
+			panic("Math::pow: division by zero")
+		case 1:
+			return 1
+		case -1:
+			if n2%2 == 0 {
+				return 1
+			}
+			return -1
+		}
+		return 0
+	}
+	res := 1
+	for n2 > 0 {
+		if n2&1 == 1 {
+			res *= n
+		}
+		n *= n
+		n2 >>= 1
+	}
+	return res
+}
+
+func sqrt(n int) int {
+	if n < 0 {
+		panic("Math::sqrt: square root of a negative number")
+	}
+	if n < 2 {
+		return n
+	}
+	x := n/2 + 1
+	for {
+		y := (x + n/x) / 2
+		if y >= x {
+			return x
+		}
+		x = y
+	}
+}
+
+// a copy of list, with the value at idx replaced by newVal
+func replace(fn string, list []interface{}, idx int, newVal interface{}) []interface{} {
+	if idx < 0 || idx > len(list)-1 {
+		panic(fn + ": index '" + strconv.Itoa(idx) + "' is out of range")
+	}
+	res := make([]interface{}, len(list))
+	copy(res, list)
+	res[idx] = newVal
+	return res
+}
@@ -0,0 +1,339 @@
+// the Quoi standard library.
+//
+// every namespace function is declared once in this table; with its Quoi
+// signature, its Go implementation, the packages the implementation imports,
+// and its documentation. the analyzer typechecks calls using the signatures,
+// the generator injects the implementations of used functions into the
+// generated code, the interpreter calls their native implementations, and
+// 'qc doc' prints the documentation.
+package std
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// a namespace of the standard library
+type Namespace struct {
+	Name, Doc string
+}
+
+// a function in a namespace
+type Func struct {
+	Namespace, Name string
+	// Quoi signature; parameter list, and return types.
+	// for example, '(int n, int n2) -> int'.
+	Sig string
+	Doc string
+	// packages that Go needs to import
+	Imports []string
+	// Go implementation. the function is named Mangle(Namespace, Name).
+	Go string
+	// implementation for the interpreter (package interp). ints are int, and
+	// lists are []interface{}. errors are panics with a string, like in Go.
+	Native func(out io.Writer, args []interface{}) interface{}
+}
+
+// name of the Go implementation of ns::name.
+// Quoi identifiers can't contain 'ℚ', so user-defined functions can't clash with them.
+func Mangle(ns, name string) string {
+	return "ℚ" + ns + "_" + name
+}
+
+// Quoi declaration of f. for example, 'fun mod(int n, int n2) -> int'.
+func (f *Func) Decl() string {
+	return "fun " + f.Name + f.Sig
+}
+
+var Namespaces = []Namespace{
+	{"Stdout", "printing to the standard output."},
+	{"Math", "integer arithmetic."},
+	{"String", "converting to strings, and manipulating them."},
+	{"Int", "converting to integers."},
+	{"List", "manipulating lists."},
+}
+
+var Funcs = []*Func{
+	{
+		Namespace: "Stdout", Name: "println",
+		Sig:     "(string s)",
+		Doc:     "print s, and a newline.",
+		Imports: []string{"fmt"},
+		Go: `func ℚStdout_println(s string) {
+	fmt.Println(s)
+}
+`,
+		Native: func(out io.Writer, args []interface{}) interface{} {
+			fmt.Fprintln(out, args[0].(string))
+			return nil
+		},
+	},
+	{
+		Namespace: "Stdout", Name: "print",
+		Sig:     "(string s)",
+		Doc:     "print s.",
+		Imports: []string{"fmt"},
+		Go: `func ℚStdout_print(s string) {
+	fmt.Print(s)
+}
+`,
+		Native: func(out io.Writer, args []interface{}) interface{} {
+			fmt.Fprint(out, args[0].(string))
+			return nil
+		},
+	},
+	{
+		Namespace: "Math", Name: "mod",
+		Sig: "(int n, int n2) -> int",
+		Doc: `remainder of n / n2. it takes the sign of n (like Go's '%'), so that
+(+ (* (/ n n2) n2) Math::mod(n, n2)) is n.`,
+		Go: `func ℚMath_mod(n int, n2 int) int {
+	if n2 == 0 {
+		panic("Math::mod: division by zero")
+	}
+	return n % n2
+}
+`,
+		Native: func(_ io.Writer, args []interface{}) interface{} {
+			n, n2 := args[0].(int), args[1].(int)
+			if n2 == 0 {
+				panic("Math::mod: division by zero")
+			}
+			return n % n2
+		},
+	},
+	{
+		Namespace: "Math", Name: "pow",
+		Sig: "(int n, int n2) -> int",
+		Doc: "n to the power of n2. negative powers are truncated towards zero.",
+		Go: `func ℚMath_pow(n int, n2 int) int {
+	if n2 < 0 {
+		// 1 / n^(-n2), truncated
+		switch n {
+		case 0:
+			panic("Math::pow: division by zero")
+		case 1:
+			return 1
+		case -1:
+			if n2%2 == 0 {
+				return 1
+			}
+			return -1
+		}
+		return 0
+	}
+	res := 1
+	for n2 > 0 {
+		if n2&1 == 1 {
+			res *= n
+		}
+		n *= n
+		n2 >>= 1
+	}
+	return res
+}
+`,
+		Native: func(_ io.Writer, args []interface{}) interface{} {
+			return pow(args[0].(int), args[1].(int))
+		},
+	},
+	{
+		Namespace: "Math", Name: "sqrt",
+		Sig: "(int n) -> int",
+		Doc: "square root of n, rounded down.",
+		Go: `func ℚMath_sqrt(n int) int {
+	if n < 0 {
+		panic("Math::sqrt: square root of a negative number")
+	}
+	if n < 2 {
+		return n
+	}
+	x := n/2 + 1
+	for {
+		y := (x + n/x) / 2
+		if y >= x {
+			return x
+		}
+		x = y
+	}
+}
+`,
+		Native: func(_ io.Writer, args []interface{}) interface{} {
+			return sqrt(args[0].(int))
+		},
+	},
+	{
+		Namespace: "String", Name: "from_int",
+		Sig:     "(int n) -> string",
+		Doc:     "decimal representation of n.",
+		Imports: []string{"strconv"},
+		Go: `func ℚString_from_int(n int) string {
+	return strconv.Itoa(n)
+}
+`,
+		Native: func(_ io.Writer, args []interface{}) interface{} {
+			return strconv.Itoa(args[0].(int))
+		},
+	},
+	{
+		Namespace: "String", Name: "from_bool",
+		Sig:     "(bool b) -> string",
+		Doc:     "\"true\", or \"false\".",
+		Imports: []string{"strconv"},
+		Go: `func ℚString_from_bool(b bool) string {
+	return strconv.FormatBool(b)
+}
+`,
+		Native: func(_ io.Writer, args []interface{}) interface{} {
+			return strconv.FormatBool(args[0].(bool))
+		},
+	},
+	{
+		Namespace: "String", Name: "concat",
+		Sig: "(string s, string s2) -> string",
+		Doc: "s followed by s2.",
+		Go: `func ℚString_concat(s string, s2 string) string {
+	return s + s2
+}
+`,
+		Native: func(_ io.Writer, args []interface{}) interface{} {
+			return args[0].(string) + args[1].(string)
+		},
+	},
+	{
+		Namespace: "String", Name: "index",
+		Sig: "(string s, string ch) -> int",
+		Doc: `index (in characters, not bytes) of the first occurence of ch in s.
+-1 if there's none.`,
+		Imports: []string{"strings", "unicode/utf8"},
+		Go: `func ℚString_index(s string, ch string) int {
+	i := strings.Index(s, ch)
+	if i < 0 {
+		return -1
+	}
+	return utf8.RuneCountInString(s[:i])
+}
+`,
+		Native: func(_ io.Writer, args []interface{}) interface{} {
+			s, ch := args[0].(string), args[1].(string)
+			i := strings.Index(s, ch)
+			if i < 0 {
+				return -1
+			}
+			return utf8.RuneCountInString(s[:i])
+		},
+	},
+	{
+		Namespace: "Int", Name: "from_string",
+		Sig:     "(string s) -> int",
+		Doc:     "the integer in s. the program stops if s is not an integer.",
+		Imports: []string{"strconv"},
+		Go: `func ℚInt_from_string(s string) int {
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		panic("Int::from_string: invalid integer " + strconv.Quote(s))
+	}
+	return n
+}
+`,
+		Native: func(_ io.Writer, args []interface{}) interface{} {
+			s := args[0].(string)
+			n, err := strconv.Atoi(s)
+			if err != nil {
+				panic("Int::from_string: invalid integer " + strconv.Quote(s))
+			}
+			return n
+		},
+	},
+	{
+		Namespace: "List", Name: "replace_int",
+		Sig:     "(listof int nx, int idx, int new_val) -> listof int",
+		Doc:     "a copy of nx, with the value at idx replaced by new_val.",
+		Imports: []string{"strconv"},
+		Go: `func ℚList_replace_int(nx []int, idx int, new_val int) []int {
+	if idx < 0 || idx > len(nx)-1 {
+		panic("List::replace_int: index '" + strconv.Itoa(idx) + "' is out of range")
+	}
+	res := make([]int, len(nx))
+	copy(res, nx)
+	res[idx] = new_val
+	return res
+}
+`,
+		Native: func(_ io.Writer, args []interface{}) interface{} {
+			return replace("List::replace_int", args[0].([]interface{}), args[1].(int), args[2])
+		},
+	},
+	{
+		Namespace: "List", Name: "replace_string",
+		Sig:     "(listof string strx, int idx, string new_val) -> listof string",
+		Doc:     "a copy of strx, with the value at idx replaced by new_val.",
+		Imports: []string{"strconv"},
+		Go: `func ℚList_replace_string(strx []string, idx int, new_val string) []string {
+	if idx < 0 || idx > len(strx)-1 {
+		panic("List::replace_string: index '" + strconv.Itoa(idx) + "' is out of range")
+	}
+	res := make([]string, len(strx))
+	copy(res, strx)
+	res[idx] = new_val
+	return res
+}
+`,
+		Native: func(_ io.Writer, args []interface{}) interface{} {
+			return replace("List::replace_string", args[0].([]interface{}), args[1].(int), args[2])
+		},
+	},
+	{
+		Namespace: "List", Name: "replace_bool",
+		Sig:     "(listof bool bx, int idx, bool new_val) -> listof bool",
+		Doc:     "a copy of bx, with the value at idx replaced by new_val.",
+		Imports: []string{"strconv"},
+		Go: `func ℚList_replace_bool(bx []bool, idx int, new_val bool) []bool {
+	if idx < 0 || idx > len(bx)-1 {
+		panic("List::replace_bool: index '" + strconv.Itoa(idx) + "' is out of range")
+	}
+	res := make([]bool, len(bx))
+	copy(res, bx)
+	res[idx] = new_val
+	return res
+}
+`,
+		Native: func(_ io.Writer, args []interface{}) interface{} {
+			return replace("List::replace_bool", args[0].([]interface{}), args[1].(int), args[2])
+		},
+	},
+}
+
+// nil if there's no such namespace
+func LookupNamespace(ns string) *Namespace {
+	for i := range Namespaces {
+		if Namespaces[i].Name == ns {
+			return &Namespaces[i]
+		}
+	}
+	return nil
+}
+
+// nil if there's no such function
+func Lookup(ns, name string) *Func {
+	for _, f := range Funcs {
+		if f.Namespace == ns && f.Name == name {
+			return f
+		}
+	}
+	return nil
+}
+
+// functions in namespace ns, in the order of declaration
+func FuncsOf(ns string) []*Func {
+	var res []*Func
+	for _, f := range Funcs {
+		if f.Namespace == ns {
+			res = append(res, f)
+		}
+	}
+	return res
+}
@@ -0,0 +1,272 @@
+package std
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestFuncs(t *testing.T) {
+	seen := map[string]bool{}
+	for _, f := range Funcs {
+		if LookupNamespace(f.Namespace) == nil {
+			t.Errorf("'%s::%s' is in an undeclared namespace", f.Namespace, f.Name)
+		}
+		if seen[f.Namespace+"::"+f.Name] {
+			t.Errorf("'%s::%s' is declared twice", f.Namespace, f.Name)
+		}
+		seen[f.Namespace+"::"+f.Name] = true
+		if f.Doc == "" {
+			t.Errorf("'%s::%s' is not documented", f.Namespace, f.Name)
+		}
+		if f.Native == nil {
+			t.Errorf("'%s::%s' has no native implementation", f.Namespace, f.Name)
+		}
+	}
+	for _, ns := range Namespaces {
+		if len(FuncsOf(ns.Name)) == 0 {
+			t.Errorf("namespace '%s' is empty", ns.Name)
+		}
+	}
+}
+
+func TestLookup(t *testing.T) {
+	f := Lookup("Math", "mod")
+	if f == nil {
+		t.Fatalf("Math::mod not found")
+	}
+	if f.Decl() != "fun mod(int n, int n2) -> int" {
+		t.Errorf("wrong declaration: %s", f.Decl())
+	}
+	if Lookup("Math", "nope") != nil || Lookup("Nope", "mod") != nil {
+		t.Errorf("found a non-existent function")
+	}
+	if Mangle("Math", "mod") != "ℚMath_mod" {
+		t.Errorf("wrong mangled name: %s", Mangle("Math", "mod"))
+	}
+}
+
+// call ns::name natively. the panic value is returned as a string.
+func callNative(ns, name string, out *bytes.Buffer, args ...interface{}) (res interface{}, panicked string) {
+	defer func() {
+		if r := recover(); r != nil {
+			panicked = r.(string)
+		}
+	}()
+	return Lookup(ns, name).Native(out, args), ""
+}
+
+func TestNative(t *testing.T) {
+	tests := []struct {
+		ns, name string
+		args     []interface{}
+		res      interface{}
+		panicked string
+	}{
+		{"Math", "mod", []interface{}{-7, 3}, -1, ""},
+		{"Math", "mod", []interface{}{7, 0}, nil, "Math::mod: division by zero"},
+		{"Math", "pow", []interface{}{3, 4}, 81, ""},
+		{"Math", "pow", []interface{}{-1, -3}, -1, ""},
+		{"Math", "sqrt", []interface{}{17}, 4, ""},
+		{"String", "index", []interface{}{"ğüx", "x"}, 2, ""},
+		{"String", "from_bool", []interface{}{false}, "false", ""},
+		{"Int", "from_string", []interface{}{"12a"}, nil, `Int::from_string: invalid integer "12a"`},
+		{"List", "replace_int", []interface{}{[]interface{}{1, 2}, 1, 5}, []interface{}{1, 5}, ""},
+		{"List", "replace_bool", []interface{}{[]interface{}{true}, 1, false}, nil, "List::replace_bool: index '1' is out of range"},
+	}
+	for _, tt := range tests {
+		res, panicked := callNative(tt.ns, tt.name, nil, tt.args...)
+		if panicked != tt.panicked || !(reflect.DeepEqual(res, tt.res)) {
+			t.Errorf("%s::%s%v = %v, panic %q; want %v, panic %q", tt.ns, tt.name, tt.args, res, panicked, tt.res, tt.panicked)
+		}
+	}
+	list := []interface{}{"a", "b"}
+	callNative("List", "replace_string", nil, list, 0, "c")
+	if list[0] != "a" {
+		t.Errorf("List::replace_string changed its argument")
+	}
+	var out bytes.Buffer
+	callNative("Stdout", "print", &out, "hi ")
+	callNative("Stdout", "println", &out, "there")
+	if out.String() != "hi there\n" {
+		t.Errorf("wrong output: %q", out.String())
+	}
+}
+
+// calls that TestBackends makes with both implementations. every function is
+// called at least once.
+var backendCalls = []struct {
+	ns, name string
+	args     []interface{}
+}{
+	{"Stdout", "println", []interface{}{"hello, ğü"}},
+	{"Stdout", "print", []interface{}{"a\tb"}},
+	{"Math", "mod", []interface{}{-7, 3}},
+	{"Math", "mod", []interface{}{7, -3}},
+	{"Math", "mod", []interface{}{7, 0}},
+	{"Math", "pow", []interface{}{3, 4}},
+	{"Math", "pow", []interface{}{-2, 3}},
+	{"Math", "pow", []interface{}{2, 0}},
+	{"Math", "pow", []interface{}{0, -1}},
+	{"Math", "pow", []interface{}{1, -5}},
+	{"Math", "pow", []interface{}{-1, -3}},
+	{"Math", "pow", []interface{}{-1, -4}},
+	{"Math", "pow", []interface{}{5, -2}},
+	{"Math", "sqrt", []interface{}{0}},
+	{"Math", "sqrt", []interface{}{1}},
+	{"Math", "sqrt", []interface{}{17}},
+	{"Math", "sqrt", []interface{}{1 << 40}},
+	{"Math", "sqrt", []interface{}{-1}},
+	{"String", "from_int", []interface{}{-42}},
+	{"String", "from_bool", []interface{}{true}},
+	{"String", "concat", []interface{}{"ğ", "ü"}},
+	{"String", "index", []interface{}{"ğüx", "x"}},
+	{"String", "index", []interface{}{"abc", "z"}},
+	{"String", "index", []interface{}{"abc", ""}},
+	{"Int", "from_string", []interface{}{"-12"}},
+	{"Int", "from_string", []interface{}{"12a"}},
+	{"Int", "from_string", []interface{}{""}},
+	{"List", "replace_int", []interface{}{[]interface{}{1, 2}, 1, 5}},
+	{"List", "replace_int", []interface{}{[]interface{}{}, 0, 1}},
+	{"List", "replace_int", []interface{}{[]interface{}{1}, -1, 2}},
+	{"List", "replace_string", []interface{}{[]interface{}{"a", "b"}, 0, "c"}},
+	{"List", "replace_bool", []interface{}{[]interface{}{true}, 1, false}},
+}
+
+// the parameter, and the result types of the Go implementation of f; result is
+// "" if it returns nothing.
+func goSignature(t *testing.T, f *Func) (params []string, result string) {
+	t.Helper()
+	file, err := parser.ParseFile(token.NewFileSet(), "", "package std\n"+f.Go, 0)
+	if err != nil {
+		t.Fatalf("%s::%s: %s", f.Namespace, f.Name, err)
+	}
+	fn := file.Decls[0].(*ast.FuncDecl)
+	for _, p := range fn.Type.Params.List {
+		for range p.Names {
+			params = append(params, types.ExprString(p.Type))
+		}
+	}
+	if fn.Type.Results != nil {
+		result = types.ExprString(fn.Type.Results.List[0].Type)
+	}
+	return params, result
+}
+
+// v as a Go expression of type typ
+func goLiteral(v interface{}, typ string) string {
+	switch v := v.(type) {
+	case []interface{}:
+		var elems []string
+		for _, e := range v {
+			elems = append(elems, goLiteral(e, strings.TrimPrefix(typ, "[]")))
+		}
+		return typ + "{" + strings.Join(elems, ", ") + "}"
+	case string:
+		return strconv.Quote(v)
+	}
+	return fmt.Sprint(v)
+}
+
+// what a call printed, and its result (or its panic). strings are quoted.
+func callResult(out string, res interface{}, void bool, panicked string) string {
+	if panicked != "" {
+		return fmt.Sprintf("%s\npanic: %s\n", out, panicked)
+	}
+	if void {
+		return out + "\n=> ()\n"
+	}
+	if s, ok := res.(string); ok {
+		return fmt.Sprintf("%s\n=> %q\n", out, s)
+	}
+	return fmt.Sprintf("%s\n=> %v\n", out, res)
+}
+
+// the Go, and the native implementation of every function behave the same way
+func TestBackends(t *testing.T) {
+	called := map[*Func]bool{}
+	for _, c := range backendCalls {
+		called[Lookup(c.ns, c.name)] = true
+	}
+	for _, f := range Funcs {
+		if !(called[f]) {
+			t.Errorf("'%s::%s' is not called by TestBackends", f.Namespace, f.Name)
+		}
+	}
+	gobin, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go toolchain not found")
+	}
+
+	imports := map[string]bool{"fmt": true}
+	var impls, calls strings.Builder
+	var want []string
+	for _, f := range Funcs {
+		for _, pkg := range f.Imports {
+			imports[pkg] = true
+		}
+		impls.WriteString(f.Go)
+	}
+	for _, c := range backendCalls {
+		f := Lookup(c.ns, c.name)
+		params, result := goSignature(t, f)
+		var args []string
+		for i, v := range c.args {
+			args = append(args, goLiteral(v, params[i]))
+		}
+		call := Mangle(c.ns, c.name) + "(" + strings.Join(args, ", ") + ")"
+		fmt.Fprintf(&calls, "\tfunc() {\n\t\tdefer func() {\n\t\t\tif r := recover(); r != nil {\n\t\t\t\tfmt.Printf(\"\\npanic: %%v\\n\", r)\n\t\t\t}\n\t\t}()\n")
+		switch {
+		case result == "":
+			fmt.Fprintf(&calls, "\t\t%s\n\t\tfmt.Print(\"\\n=> ()\\n\")\n", call)
+		case result == "string":
+			fmt.Fprintf(&calls, "\t\tfmt.Printf(\"\\n=> %%q\\n\", %s)\n", call)
+		default:
+			fmt.Fprintf(&calls, "\t\tfmt.Printf(\"\\n=> %%v\\n\", %s)\n", call)
+		}
+		calls.WriteString("\t}()\n")
+
+		var out bytes.Buffer
+		res, panicked := callNative(c.ns, c.name, &out, c.args...)
+		want = append(want, callResult(out.String(), res, result == "", panicked))
+	}
+	var src strings.Builder
+	src.WriteString("package main\n\nimport (\n")
+	for pkg := range imports {
+		fmt.Fprintf(&src, "\t%q\n", pkg)
+	}
+	src.WriteString(")\n\n" + impls.String() + "\nfunc main() {\n" + calls.String() + "}\n")
+
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module stdtest\n\ngo 1.16\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "main.go"), []byte(src.String()), 0644)
+	run := exec.Command(gobin, "run", ".")
+	run.Dir = dir
+	got, err := run.CombinedOutput()
+	if err != nil {
+		t.Fatalf("%s\n%s\n%s", err, got, src.String())
+	}
+	// the results of the calls, in order
+	results := strings.SplitAfter(string(got), "\n")
+	var i int
+	for n, c := range backendCalls {
+		lines := strings.Count(want[n], "\n")
+		if i+lines > len(results) {
+			t.Fatalf("missing output for %s::%s%v", c.ns, c.name, c.args)
+		}
+		if g := strings.Join(results[i:i+lines], ""); g != want[n] {
+			t.Errorf("%s::%s%v: Go=%q native=%q", c.ns, c.name, c.args, g, want[n])
+		}
+		i += lines
+	}
+}
@@ -50,13 +50,18 @@ const (
 	GTE
 	GET
 	SET
+	MATCH
+	PIPE // '|' between the variants of a datatype
+	ENUM
+	CONST
+	COMMENT // only if the lexer keeps comments
 )
 
 func (t Type) String() string {
 	tt := map[Type]string{
 		EOF: "EOF", ILLEGAL: "ILLEGAL",
 		IDENT: "IDENTIFIER", INT: "INTEGER", STRING: "STRING", BOOL: "BOOLEAN",
-		DATATYPE: "DATATYPE", FUN: "FUN", GET: "GET", SET: "SET",
+		DATATYPE: "DATATYPE", FUN: "FUN", GET: "GET", SET: "SET", COMMENT: "COMMENT", MATCH: "MATCH", PIPE: "PIPE", ENUM: "ENUM", CONST: "CONST",
 		BLOCK: "BLOCK", END: "END", IF: "IF", ELSEIF: "ELSEIF", ELSE: "ELSE",
 		LOOP: "LOOP", BREAK: "BREAK", CONTINUE: "CONTINUE", RETURN: "RETURN", NEWLINE: "NEWLINE",
 		OPENING_PAREN: "OPENING_PAREN", CLOSING_PAREN: "CLOSING_PAREN",
@@ -70,10 +75,42 @@ func (t Type) String() string {
 	return tt[t]
 }
 
+// a position in the source code.
+// Offset is a 0-based byte offset; Line, and Col are 1-based. Col counts characters, not bytes.
+type Pos struct {
+	Offset    uint
+	Line, Col uint
+}
+
+// a range in the source code. End is exclusive; it is the position right after the last
+// character of the range.
+type Span struct {
+	Start, End Pos
+}
+
+// return a span that covers both s, and other
+func (s Span) Join(other Span) Span {
+	if other.Start.Line == 0 {
+		return s
+	}
+	if s.Start.Line == 0 {
+		return other
+	}
+	if other.Start.Offset < s.Start.Offset {
+		s.Start = other.Start
+	}
+	if other.End.Offset > s.End.Offset {
+		s.End = other.End
+	}
+	return s
+}
+
 type Token struct {
 	Type      Type
 	Literal   string
-	Line, Col uint
+	Offset    uint // byte offset of the first character
+	Line, Col uint // position of the first character
+	End       Pos  // position right after the last character
 }
 
 // return new token
@@ -86,6 +123,16 @@ func New(typ Type, lit string, line, col uint) Token {
 	}
 }
 
+// return the position of the first character of t
+func (t Token) Pos() Pos {
+	return Pos{Offset: t.Offset, Line: t.Line, Col: t.Col}
+}
+
+// return the range that t covers in the source code
+func (t Token) Span() Span {
+	return Span{Start: t.Pos(), End: t.End}
+}
+
 // return operator sign for an arithmetic operator
 func PrefixExprName(t Type) string {
 	switch t {
@@ -0,0 +1,224 @@
+// the types of Quoi
+//
+// int, bool, string, and void are single values (Int, Bool, String, Void);
+// so they can be compared with ==. the other types are compared with Identical.
+//
+// the String method of a type prints it the way it's written in Quoi:
+//
+//	int, string, bool
+//	listof int
+//	User
+//	Color         (an enum)
+//	int, string   (the values of a function returning two values)
+//	fun(int, int) -> bool
+package types
+
+import "strings"
+
+type Type interface {
+	String() string
+	aType()
+}
+
+type basic struct {
+	name string
+}
+
+var (
+	Int    Type = &basic{"int"}
+	Bool   Type = &basic{"bool"}
+	String Type = &basic{"string"}
+	// the type of a call to a function that returns nothing
+	Void Type = &basic{"void"}
+)
+
+// Elem is nil for an empty list literal ('[]'); it's assignable to every list.
+type List struct {
+	Elem Type
+}
+
+// datatypes are nominal; two datatypes are the same if they have the same name.
+//
+// a sum type is a datatype with variants instead of fields. its variants are
+// datatypes too; a value of the sum type is a value of one of them.
+type Datatype struct {
+	Name     string
+	Fields   []Field
+	Variants []*Datatype
+	Sum      *Datatype // the sum type that this is a variant of; nil if it isn't one
+}
+
+// enums are nominal too. a value of an enum is one of its members.
+type Enum struct {
+	Name    string
+	Members []string
+}
+
+type Field struct {
+	Name string
+	Type Type
+}
+
+// the values of a function that returns more than one value
+type Tuple struct {
+	Types []Type
+}
+
+// the type of a function value. functions are structural; two function types
+// are the same if their parameters, and their return values are.
+type Func struct {
+	Params  []Type
+	Returns []Type
+}
+
+func (*basic) aType()    {}
+func (*List) aType()     {}
+func (*Datatype) aType() {}
+func (*Enum) aType()     {}
+func (*Tuple) aType()    {}
+func (*Func) aType()     {}
+
+func (b *basic) String() string { return b.name }
+
+func (l *List) String() string {
+	if l.Elem == nil {
+		return "[]"
+	}
+	return "listof " + l.Elem.String()
+}
+
+func (d *Datatype) String() string { return d.Name }
+
+func (e *Enum) String() string { return e.Name }
+
+func (t *Tuple) String() string {
+	var res []string
+	for _, v := range t.Types {
+		res = append(res, v.String())
+	}
+	return strings.Join(res, ", ")
+}
+
+// fun(int, string) -> bool; many return values are in parentheses:
+// fun(int) -> (int, bool)
+func (f *Func) String() string {
+	var params []string
+	for _, v := range f.Params {
+		params = append(params, v.String())
+	}
+	res := "fun(" + strings.Join(params, ", ") + ")"
+	switch len(f.Returns) {
+	case 0:
+		return res
+	case 1:
+		return res + " -> " + f.Returns[0].String()
+	}
+	return res + " -> (" + (&Tuple{Types: f.Returns}).String() + ")"
+}
+
+// the field named name; nil if there isn't one
+func (d *Datatype) Field(name string) *Field {
+	for i := range d.Fields {
+		if d.Fields[i].Name == name {
+			return &d.Fields[i]
+		}
+	}
+	return nil
+}
+
+// the variant named name; nil if there isn't one
+func (d *Datatype) Variant(name string) *Datatype {
+	for _, v := range d.Variants {
+		if v.Name == name {
+			return v
+		}
+	}
+	return nil
+}
+
+// the index of the member named name; -1 if there isn't one
+func (e *Enum) Member(name string) int {
+	for i, m := range e.Members {
+		if m == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// Identical reports whether a, and b are the same type.
+func Identical(a, b Type) bool {
+	if a == b {
+		return true
+	}
+	switch a := a.(type) {
+	case *List:
+		b, ok := b.(*List)
+		if !(ok) {
+			return false
+		}
+		if a.Elem == nil || b.Elem == nil {
+			return a.Elem == b.Elem
+		}
+		return Identical(a.Elem, b.Elem)
+	case *Datatype:
+		b, ok := b.(*Datatype)
+		return ok && a.Name == b.Name
+	case *Enum:
+		b, ok := b.(*Enum)
+		return ok && a.Name == b.Name
+	case *Tuple:
+		b, ok := b.(*Tuple)
+		return ok && identicalAll(a.Types, b.Types)
+	case *Func:
+		b, ok := b.(*Func)
+		return ok && identicalAll(a.Params, b.Params) && identicalAll(a.Returns, b.Returns)
+	}
+	return false
+}
+
+func identicalAll(a, b []Type) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !(Identical(a[i], b[i])) {
+			return false
+		}
+	}
+	return true
+}
+
+// AssignableTo reports whether a value of type v can be assigned to a variable of type t.
+func AssignableTo(v, t Type) bool {
+	if l, ok := v.(*List); ok && l.Elem == nil {
+		_, ok := t.(*List)
+		return ok
+	}
+	return Identical(v, t)
+}
+
+// Split returns the types of the values of t; a tuple has many, void has none.
+func Split(t Type) []Type {
+	switch t := t.(type) {
+	case *Tuple:
+		return t.Types
+	case nil:
+		return nil
+	}
+	if t == Void {
+		return nil
+	}
+	return []Type{t}
+}
+
+// Join is the opposite of Split.
+func Join(ts []Type) Type {
+	switch len(ts) {
+	case 0:
+		return Void
+	case 1:
+		return ts[0]
+	}
+	return &Tuple{Types: ts}
+}
@@ -0,0 +1,93 @@
+package types
+
+import "testing"
+
+var user = &Datatype{Name: "User", Fields: []Field{{"name", String}, {"friends", &List{Elem: &Datatype{Name: "User"}}}}}
+
+func TestString(t *testing.T) {
+	tests := []struct {
+		typ  Type
+		want string
+	}{
+		{Int, "int"},
+		{Void, "void"},
+		{&List{Elem: Int}, "listof int"},
+		{&List{Elem: &List{Elem: Bool}}, "listof listof bool"},
+		{&List{}, "[]"},
+		{user, "User"},
+		{&Tuple{Types: []Type{Int, &List{Elem: String}}}, "int, listof string"},
+		{&Func{}, "fun()"},
+		{&Func{Params: []Type{Int, Int}, Returns: []Type{Bool}}, "fun(int, int) -> bool"},
+		{&Func{Params: []Type{&Func{Params: []Type{Int}}}, Returns: []Type{Int, user}}, "fun(fun(int)) -> (int, User)"},
+	}
+	for _, test := range tests {
+		if got := test.typ.String(); got != test.want {
+			t.Errorf("got %q, want %q", got, test.want)
+		}
+	}
+}
+
+func TestIdentical(t *testing.T) {
+	tests := []struct {
+		a, b Type
+		want bool
+	}{
+		{Int, Int, true},
+		{Int, String, false},
+		{&List{Elem: Int}, &List{Elem: Int}, true},
+		{&List{Elem: &List{Elem: Int}}, &List{Elem: &List{Elem: Int}}, true},
+		{&List{Elem: &List{Elem: Int}}, &List{Elem: Int}, false},
+		{&List{}, &List{Elem: Int}, false},
+		{&List{}, &List{}, true},
+		{user, &Datatype{Name: "User"}, true},
+		{user, &Datatype{Name: "Post"}, false},
+		{&Tuple{Types: []Type{Int, Bool}}, &Tuple{Types: []Type{Int, Bool}}, true},
+		{&Tuple{Types: []Type{Int, Bool}}, &Tuple{Types: []Type{Bool, Int}}, false},
+		{&Tuple{Types: []Type{Int}}, Int, false},
+		{&Func{Params: []Type{Int}, Returns: []Type{Bool}}, &Func{Params: []Type{Int}, Returns: []Type{Bool}}, true},
+		{&Func{Params: []Type{Int}, Returns: []Type{Bool}}, &Func{Params: []Type{Int}}, false},
+		{&Func{Params: []Type{Int}}, &Func{Params: []Type{String}}, false},
+		{&Func{Params: []Type{user}}, &Func{Params: []Type{&Datatype{Name: "User"}}}, true},
+	}
+	for _, test := range tests {
+		if got := Identical(test.a, test.b); got != test.want {
+			t.Errorf("Identical(%s, %s) = %v, want %v", test.a, test.b, got, test.want)
+		}
+	}
+}
+
+func TestAssignableTo(t *testing.T) {
+	tests := []struct {
+		v, t Type
+		want bool
+	}{
+		{Int, Int, true},
+		{&List{}, &List{Elem: user}, true},
+		{&List{}, Int, false},
+		{&List{Elem: Int}, &List{}, false},
+		{&List{Elem: String}, &List{Elem: Int}, false},
+	}
+	for _, test := range tests {
+		if got := AssignableTo(test.v, test.t); got != test.want {
+			t.Errorf("AssignableTo(%s, %s) = %v, want %v", test.v, test.t, got, test.want)
+		}
+	}
+}
+
+func TestSplitJoin(t *testing.T) {
+	if n := len(Split(Void)); n != 0 {
+		t.Errorf("void has %d values", n)
+	}
+	if n := len(Split(Int)); n != 1 {
+		t.Errorf("int has %d values", n)
+	}
+	tuple := &Tuple{Types: []Type{Int, String}}
+	if n := len(Split(tuple)); n != 2 {
+		t.Errorf("%s has %d values", tuple, n)
+	}
+	for _, typ := range []Type{Void, Int, tuple} {
+		if got := Join(Split(typ)); !(Identical(got, typ)) {
+			t.Errorf("Join(Split(%s)) = %s", typ, got)
+		}
+	}
+}